@@ -21,6 +21,8 @@ func attractorRuns(args []string) {
 		attractorRunsList(args[1:])
 	case "prune":
 		attractorRunsPrune(args[1:])
+	case "diff":
+		attractorRunsDiff(args[1:])
 	default:
 		runsUsage()
 		os.Exit(1)
@@ -31,6 +33,7 @@ func runsUsage() {
 	fmt.Fprintln(os.Stderr, "usage:")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor runs list [--json]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor runs prune [--before YYYY-MM-DD] [--graph PATTERN] [--label KEY=VALUE] [--orphans] [--dry-run | --yes]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor runs diff <runA> <runB> [--json] [--repo <path>]")
 }
 
 // runManifest is the subset of manifest.json fields we care about for list/prune.
@@ -65,7 +68,8 @@ func loadRunRecords(baseDir string) ([]runRecord, error) {
 	}
 	var records []runRecord
 	for _, e := range entries {
-		if !e.IsDir() {
+		// Dot directories (e.g. the stage cache) are not runs.
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
 			continue
 		}
 		dir := filepath.Join(baseDir, e.Name())
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+func attractorRunsDiff(args []string) {
+	os.Exit(runAttractorRunsDiff(args, os.Stdout, os.Stderr))
+}
+
+func runAttractorRunsDiff(args []string, stdout io.Writer, stderr io.Writer) int {
+	var runs []string
+	var repoPath string
+	asJSON := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--repo":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(stderr, "--repo requires a value")
+				return 1
+			}
+			repoPath = args[i]
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				fmt.Fprintf(stderr, "unknown arg: %s\n", args[i])
+				return 1
+			}
+			runs = append(runs, args[i])
+		}
+	}
+	if len(runs) != 2 {
+		fmt.Fprintln(stderr, "usage: kilroy attractor runs diff <runA> <runB> [--json] [--repo <path>]")
+		return 1
+	}
+
+	var snaps [2]*runstate.Snapshot
+	for i, run := range runs {
+		s, err := loadDiffSnapshot(run)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		snaps[i] = s
+	}
+	d := runstate.Compare(snaps[0], snaps[1])
+	addCodeDiff(d, repoPath)
+
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	printRunDiff(stdout, d)
+	return 0
+}
+
+// loadDiffSnapshot accepts a logs root path or a run ID under the default
+// runs directory.
+func loadDiffSnapshot(run string) (*runstate.Snapshot, error) {
+	logsRoot := run
+	if info, err := os.Stat(run); err != nil || !info.IsDir() {
+		logsRoot = filepath.Join(engine.DefaultRunsBaseDir(), run)
+		if info, err := os.Stat(logsRoot); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("run %q: not a logs root or a run ID in %s", run, engine.DefaultRunsBaseDir())
+		}
+	}
+	s, err := runstate.LoadSnapshot(logsRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := runstate.ApplyVerbose(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// addCodeDiff runs git diff between the final commits in repoPath, or else
+// in the repo either run's manifest names.
+func addCodeDiff(d *runstate.RunDiff, repoPath string) {
+	if d.A.FinalCommitSHA == "" || d.B.FinalCommitSHA == "" {
+		d.CodeDiffError = "both runs need a final commit"
+		return
+	}
+	if d.A.FinalCommitSHA == d.B.FinalCommitSHA {
+		return
+	}
+	if repoPath == "" {
+		for _, root := range []string{d.A.LogsRoot, d.B.LogsRoot} {
+			if raw, err := os.ReadFile(filepath.Join(root, "manifest.json")); err == nil {
+				var m runManifest
+				if json.Unmarshal(raw, &m) == nil && m.RepoPat != "" {
+					repoPath = m.RepoPat
+					break
+				}
+			}
+		}
+	}
+	if repoPath == "" {
+		repoPath = "."
+	}
+	out, err := gitutil.Diff(repoPath, d.A.FinalCommitSHA, d.B.FinalCommitSHA)
+	if err != nil {
+		d.CodeDiffError = fmt.Sprintf("git diff in %s: %v", repoPath, err)
+		return
+	}
+	d.CodeDiff = out
+}
+
+func printRunDiff(w io.Writer, d *runstate.RunDiff) {
+	for _, side := range []struct {
+		name string
+		s    runstate.RunSummary
+	}{{"A", d.A}, {"B", d.B}} {
+		s := side.s
+		fmt.Fprintf(w, "%s: %s  state=%s  attempts=%d  duration=%s", side.name, s.LogsRoot, s.State, s.Attempts, formatDiffDuration(s.DurationMS))
+		if s.Usage != nil {
+			fmt.Fprintf(w, "  tokens=%d/%d  cost_usd=%.4f", s.Usage.InputTokens, s.Usage.OutputTokens, s.Usage.CostUSD)
+		}
+		fmt.Fprintln(w)
+		if s.FailureReason != "" {
+			fmt.Fprintf(w, "   failure_reason=%s\n", s.FailureReason)
+		}
+	}
+
+	fmt.Fprintln(w, "\n--- stage trace ---")
+	fmt.Fprintf(w, "  %-40s %s\n", "A", "B")
+	for _, r := range d.Trace {
+		marker := " "
+		if r.A == nil || r.B == nil || r.A.Status != r.B.Status {
+			marker = "!"
+		}
+		fmt.Fprintf(w, "%s %-40s %s\n", marker, formatTraceCell(r.A), formatTraceCell(r.B))
+	}
+
+	fmt.Fprintln(w, "\n--- changed nodes ---")
+	changed := 0
+	for _, n := range d.Nodes {
+		if !n.Differs() {
+			continue
+		}
+		changed++
+		fmt.Fprintf(w, "  %s (%s)\n", n.NodeID, strings.Join(n.Changed, ", "))
+		fmt.Fprintf(w, "    A: %s\n", formatNodeSummary(n.A))
+		fmt.Fprintf(w, "    B: %s\n", formatNodeSummary(n.B))
+	}
+	if changed == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+
+	fmt.Fprintln(w, "\n--- code ---")
+	switch {
+	case d.CodeDiffError != "":
+		fmt.Fprintf(w, "  (no diff: %s)\n", d.CodeDiffError)
+	case d.CodeDiff == "":
+		fmt.Fprintln(w, "  (no changes between final commits)")
+	default:
+		fmt.Fprint(w, d.CodeDiff)
+	}
+}
+
+func formatTraceCell(sa *runstate.StageAttempt) string {
+	if sa == nil {
+		return "-"
+	}
+	cell := fmt.Sprintf("%s %s", sa.NodeID, sa.Status)
+	if sa.MaxAttempts > 1 {
+		cell += fmt.Sprintf(" %d/%d", sa.Attempt, sa.MaxAttempts)
+	}
+	if sa.DurationMS > 0 {
+		cell += " " + formatDiffDuration(sa.DurationMS)
+	}
+	return cell
+}
+
+func formatNodeSummary(n *runstate.NodeSummary) string {
+	if n == nil {
+		return "not run"
+	}
+	s := fmt.Sprintf("status=%s attempts=%d retries=%d duration=%s", n.Status, n.Attempts, n.Retries, formatDiffDuration(n.DurationMS))
+	if n.Usage != nil {
+		s += fmt.Sprintf(" cost_usd=%.4f", n.Usage.CostUSD)
+	}
+	if n.FailureReason != "" {
+		s += " failure_reason=" + n.FailureReason
+	}
+	return s
+}
+
+func formatDiffDuration(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+)
+
+func writeDiffTestRun(t *testing.T, repo, sha, final, progress string) string {
+	t.Helper()
+	root := t.TempDir()
+	m, _ := json.Marshal(map[string]any{"run_id": filepath.Base(root), "repo_path": repo})
+	_ = os.WriteFile(filepath.Join(root, "manifest.json"), m, 0o644)
+	f := map[string]any{}
+	_ = json.Unmarshal([]byte(final), &f)
+	f["final_git_commit_sha"] = sha
+	b, _ := json.Marshal(f)
+	_ = os.WriteFile(filepath.Join(root, "final.json"), b, 0o644)
+	_ = os.WriteFile(filepath.Join(root, "progress.ndjson"), []byte(progress), 0o644)
+	return root
+}
+
+func gitHead(t *testing.T, repo string) string {
+	t.Helper()
+	out, err := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("rev-parse: %v", err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestAttractorRunsDiff_TextAndJSON(t *testing.T) {
+	repo := initTestRepo(t)
+	shaA := gitHead(t, repo)
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\nworld\n"), 0o644)
+	if out, err := exec.Command("git", "-C", repo, "commit", "-am", "change").CombinedOutput(); err != nil {
+		t.Fatalf("commit: %v\n%s", err, out)
+	}
+	shaB := gitHead(t, repo)
+
+	runA := writeDiffTestRun(t, repo, shaA, `{"status":"fail","failure_reason":"tests failed"}`,
+		`{"event":"stage_attempt_end","node_id":"impl","status":"fail","attempt":1,"max":2,"failure_reason":"tests failed"}
+{"event":"stage_attempt_end","node_id":"impl","status":"fail","attempt":2,"max":2,"failure_reason":"tests failed"}
+`)
+	runB := writeDiffTestRun(t, repo, shaB, `{"status":"success"}`,
+		`{"event":"stage_attempt_end","node_id":"impl","status":"success","attempt":1,"max":2}
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := runAttractorRunsDiff([]string{runA, runB}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit=%d stderr=%s", code, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"state=fail",
+		"failure_reason=tests failed",
+		"  impl success 1/2",
+		"! impl fail 2/2",
+		"impl (status, failure_reason, attempts, retries)",
+		"+world",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	stdout.Reset()
+	if code := runAttractorRunsDiff([]string{"--json", runA, runB}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit=%d stderr=%s", code, stderr.String())
+	}
+	var d runstate.RunDiff
+	if err := json.Unmarshal(stdout.Bytes(), &d); err != nil {
+		t.Fatalf("decode: %v\n%s", err, stdout.String())
+	}
+	if d.A.State != runstate.StateFail || d.B.State != runstate.StateSuccess || len(d.Trace) != 2 || !strings.Contains(d.CodeDiff, "+world") {
+		t.Fatalf("diff=%+v", d)
+	}
+}
+
+func TestAttractorRunsDiff_RequiresTwoRuns(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runAttractorRunsDiff([]string{t.TempDir()}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "usage") {
+		t.Fatalf("exit=%d stderr=%s", code, stderr.String())
+	}
+	if code := runAttractorRunsDiff([]string{t.TempDir(), "no-such-run"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "no-such-run") {
+		t.Fatalf("exit=%d stderr=%s", code, stderr.String())
+	}
+}
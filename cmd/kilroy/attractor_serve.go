@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
 	"github.com/danshapiro/kilroy/internal/server"
 )
 
 func attractorServe(args []string) {
 	addr := "127.0.0.1:8080"
+	authConfigPath := ""
+	runsDir := engine.DefaultRunsBaseDir()
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -19,15 +22,45 @@ func attractorServe(args []string) {
 				os.Exit(1)
 			}
 			addr = args[i]
+		case "--auth-config":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--auth-config requires a value")
+				os.Exit(1)
+			}
+			authConfigPath = args[i]
+		case "--runs-dir":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--runs-dir requires a value")
+				os.Exit(1)
+			}
+			runsDir = args[i]
 		default:
 			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
 			os.Exit(1)
 		}
 	}
 
-	srv := server.New(server.Config{
-		Addr: addr,
-	})
+	cfg := server.Config{Addr: addr, RunsDir: runsDir}
+	if authConfigPath != "" {
+		auth, err := server.LoadAuthConfig(authConfigPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.Auth = auth
+		if auth.AuditLog != "" {
+			f, err := os.OpenFile(auth.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			cfg.AuditLog = f
+		}
+	}
+	srv := server.New(cfg)
 
 	if err := srv.ListenAndServe(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
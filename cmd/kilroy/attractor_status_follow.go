@@ -212,6 +212,29 @@ func formatProgressEvent(ev map[string]any) string {
 			ts, event, nodeID,
 			evVal(ev, "attempt"), evVal(ev, "max"))
 
+	case "stage_usage":
+		return fmt.Sprintf("%s | %-24s | %s | in=%s out=%s cost=$%.4f | run cost=$%.4f",
+			ts, event, nodeID,
+			evVal(ev, "input_tokens"), evVal(ev, "output_tokens"),
+			evFloat(ev, "cost_usd"), evFloat(ev, "run_cost_usd"))
+
+	case "budget_exhausted":
+		return fmt.Sprintf("%s | %-24s | %s | %s cap: %s",
+			ts, event, nodeID,
+			evStr(ev, "scope"), evStr(ev, "reason"))
+
+	case "manager_steer":
+		line := fmt.Sprintf("%s | %-24s | %s | cycle=%s",
+			ts, event, nodeID, evVal(ev, "cycle"))
+		if note := evStr(ev, "note"); note != "" {
+			line += " | " + note
+		}
+		return line
+
+	case "context_compaction":
+		return fmt.Sprintf("%s | %-24s | %s | %s reclaimed=%s tokens",
+			ts, event, nodeID, evStr(ev, "strategy"), evVal(ev, "tokens_reclaimed"))
+
 	default:
 		if nodeID != "" {
 			return fmt.Sprintf("%s | %-24s | %s", ts, event, nodeID)
@@ -249,6 +272,13 @@ func evStr(ev map[string]any, key string) string {
 	return fmt.Sprint(v)
 }
 
+func evFloat(ev map[string]any, key string) float64 {
+	if f, ok := ev[key].(float64); ok {
+		return f
+	}
+	return 0
+}
+
 func evVal(ev map[string]any, key string) string {
 	v, ok := ev[key]
 	if !ok || v == nil {
@@ -331,7 +361,7 @@ func latestRunLogsRoot() (string, error) {
 	}
 	var dirs []dirEntry
 	for _, e := range entries {
-		if !e.IsDir() {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
 			continue
 		}
 		info, err := e.Info()
@@ -446,6 +476,22 @@ func printVerboseSnapshot(w io.Writer, s *runstate.Snapshot) {
 	if s.CXDBContextID != "" {
 		fmt.Fprintf(w, "cxdb_context_id=%s\n", s.CXDBContextID)
 	}
+	if u := s.Usage; u != nil {
+		fmt.Fprintf(w, "cost_usd=%.4f\n", u.CostUSD)
+		fmt.Fprintf(w, "input_tokens=%d\n", u.InputTokens)
+		fmt.Fprintf(w, "output_tokens=%d\n", u.OutputTokens)
+		if u.UnpricedCalls > 0 {
+			fmt.Fprintf(w, "unpriced_calls=%d\n", u.UnpricedCalls)
+		}
+		if len(u.Nodes) > 0 {
+			parts := make([]string, 0, len(u.Nodes))
+			for node, nu := range u.Nodes {
+				parts = append(parts, fmt.Sprintf("%s:$%.4f", node, nu.CostUSD))
+			}
+			sort.Strings(parts)
+			fmt.Fprintf(w, "node_cost_usd=%s\n", strings.Join(parts, ","))
+		}
+	}
 
 	if len(s.StageTrace) > 0 || len(s.EdgeTrace) > 0 {
 		fmt.Fprintln(w, "\n--- stage trace ---")
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/runstate"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
 func TestFollowProgress_EmitsFormattedEvents(t *testing.T) {
@@ -195,6 +196,39 @@ func TestFormatProgressEvent_AllEventTypes(t *testing.T) {
 			},
 			contains: []string{"branch_stale_warning", "impl_a", "idle=301000ms", "last=stage_attempt_start"},
 		},
+		{
+			name: "stage_usage",
+			event: map[string]any{
+				"ts": "2026-02-10T04:03:00Z", "event": "stage_usage",
+				"node_id": "implement_feature", "input_tokens": float64(1200), "output_tokens": float64(300),
+				"cost_usd": 0.0125, "run_cost_usd": 0.5,
+			},
+			contains: []string{"stage_usage", "implement_feature", "in=1200", "out=300", "cost=$0.0125", "run cost=$0.5000"},
+		},
+		{
+			name: "budget_exhausted",
+			event: map[string]any{
+				"ts": "2026-02-10T04:04:00Z", "event": "budget_exhausted",
+				"node_id": "implement_feature", "scope": "run", "reason": "cost $5.0100 reached max_usd $5.0000",
+			},
+			contains: []string{"budget_exhausted", "implement_feature", "run cap", "max_usd"},
+		},
+		{
+			name: "manager_steer",
+			event: map[string]any{
+				"ts": "2026-02-10T04:30:00Z", "event": "manager_steer",
+				"node_id": "supervisor", "cycle": float64(7), "note": "fix the failing test first",
+			},
+			contains: []string{"manager_steer", "supervisor", "cycle=7", "fix the failing test first"},
+		},
+		{
+			name: "context_compaction",
+			event: map[string]any{
+				"ts": "2026-02-10T04:45:00Z", "event": "context_compaction",
+				"node_id": "implement", "strategy": "summarize", "tokens_reclaimed": float64(41250),
+			},
+			contains: []string{"context_compaction", "implement", "summarize", "reclaimed=41250"},
+		},
 		{
 			name: "loop_restart",
 			event: map[string]any{
@@ -321,3 +355,31 @@ func TestPrintVerboseSnapshot_RunScopedLabelsOnly(t *testing.T) {
 		t.Fatalf("legacy review label must not be present: %s", got)
 	}
 }
+
+func TestPrintVerboseSnapshot_Usage(t *testing.T) {
+	s := &runstate.Snapshot{
+		Usage: &runtime.RunUsage{
+			UsageTotals: runtime.UsageTotals{InputTokens: 1500, OutputTokens: 200, CostUSD: 0.75, Calls: 3, UnpricedCalls: 1},
+			Nodes: map[string]runtime.UsageTotals{
+				"plan": {CostUSD: 0.25},
+				"impl": {CostUSD: 0.5},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	printVerboseSnapshot(&out, s)
+	got := out.String()
+
+	for _, want := range []string{
+		"cost_usd=0.7500\n",
+		"input_tokens=1500\n",
+		"output_tokens=200\n",
+		"unpriced_calls=1\n",
+		"node_cost_usd=impl:$0.5000,plan:$0.2500\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in: %s", want, got)
+		}
+	}
+}
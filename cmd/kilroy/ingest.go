@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
 	"github.com/danshapiro/kilroy/internal/attractor/ingest"
 )
 
@@ -25,15 +26,20 @@ type ingestOptions struct {
 	repoPath     string
 	validate     bool
 	maxTurns     int
+	repairRounds int
+	configPath   string
+	provider     string
 }
 
 func parseIngestArgs(args []string) (*ingestOptions, error) {
 	opts := &ingestOptions{
-		model:    "claude-sonnet-4-5",
-		validate: true,
+		model:        "claude-sonnet-4-5",
+		validate:     true,
+		repairRounds: ingest.DefaultRepairRounds,
 	}
 
 	var positional []string
+	modelSet := false
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--output", "-o":
@@ -48,6 +54,19 @@ func parseIngestArgs(args []string) (*ingestOptions, error) {
 				return nil, fmt.Errorf("--model requires a value")
 			}
 			opts.model = args[i]
+			modelSet = true
+		case "--config":
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("--config requires a value")
+			}
+			opts.configPath = args[i]
+		case "--provider":
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("--provider requires a value")
+			}
+			opts.provider = args[i]
 		case "--skill":
 			i++
 			if i >= len(args) {
@@ -70,6 +89,16 @@ func parseIngestArgs(args []string) (*ingestOptions, error) {
 				return nil, fmt.Errorf("--max-turns must be a positive integer")
 			}
 			opts.maxTurns = n
+		case "--repair-rounds":
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("--repair-rounds requires a value")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("--repair-rounds must be a non-negative integer")
+			}
+			opts.repairRounds = n
 		case "--no-validate":
 			opts.validate = false
 		default:
@@ -84,6 +113,12 @@ func parseIngestArgs(args []string) (*ingestOptions, error) {
 		return nil, fmt.Errorf("requirements text is required (positional argument)")
 	}
 	opts.requirements = strings.Join(positional, " ")
+	if opts.provider != "" && (opts.configPath == "" || !modelSet) {
+		return nil, fmt.Errorf("--provider requires --config and --model")
+	}
+	if opts.configPath != "" && opts.provider == "" {
+		return nil, fmt.Errorf("--config is only used with --provider")
+	}
 
 	if opts.repoPath == "" {
 		cwd, err := os.Getwd()
@@ -110,26 +145,52 @@ func attractorIngest(args []string) {
 		fmt.Fprintln(os.Stderr, "  --model         LLM model (default: claude-sonnet-4-5)")
 		fmt.Fprintln(os.Stderr, "  --skill         Path to skill .md file (default: repo/binary auto-detect)")
 		fmt.Fprintln(os.Stderr, "  --repo          Repository root (default: cwd)")
-		fmt.Fprintln(os.Stderr, "  --max-turns     Max agentic turns for Claude (default: 15)")
+		fmt.Fprintln(os.Stderr, "  --max-turns     Max agentic turns per request (default: 15)")
+		fmt.Fprintln(os.Stderr, "  --repair-rounds Validation repair rounds before giving up (default: 2, 0 disables)")
+		fmt.Fprintln(os.Stderr, "  --config        Run config (run.yaml) providing llm.providers, with --provider")
+		fmt.Fprintln(os.Stderr, "  --provider      Use this API provider instead of the claude CLI (needs --config and --model)")
 		fmt.Fprintln(os.Stderr, "  --no-validate   Skip .dot validation")
 		os.Exit(1)
 	}
 
-	dotContent, err := runIngest(opts)
+	result, err := runIngest(opts)
+	if result == nil || opts.outputPath == "" {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(result.DotContent)
+		return
+	}
+
+	// A draft that still fails validation is written too, together with the
+	// report, so it can be fixed by hand.
+	if werr := writeIngestOutput(opts, result); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+}
 
-	if opts.outputPath != "" {
-		if err := os.WriteFile(opts.outputPath, []byte(dotContent), 0o644); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-		fmt.Fprintf(os.Stderr, "wrote %s (%d bytes)\n", opts.outputPath, len(dotContent))
-	} else {
-		fmt.Print(dotContent)
+// writeIngestOutput writes the graph to --output and, when the graph was
+// validated, the repair report beside it.
+func writeIngestOutput(opts *ingestOptions, result *ingest.Result) error {
+	if err := os.WriteFile(opts.outputPath, []byte(result.DotContent), 0o644); err != nil {
+		return err
 	}
+	fmt.Fprintf(os.Stderr, "wrote %s (%d bytes)\n", opts.outputPath, len(result.DotContent))
+	if !opts.validate {
+		return nil
+	}
+	reportPath := ingest.ReportPath(opts.outputPath)
+	if err := result.WriteReport(reportPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s (%d repair round(s))\n", reportPath, result.RepairRounds)
+	return nil
 }
 
 func resolveDefaultIngestSkillPath(repoPath string) string {
@@ -268,18 +329,29 @@ func defaultGoModCacheRoot() string {
 	return filepath.Join(gopath, "pkg", "mod")
 }
 
-func runIngest(opts *ingestOptions) (string, error) {
+// runIngest runs ingestion. The result is non-nil with a non-nil error when a
+// graph was produced but still fails validation.
+func runIngest(opts *ingestOptions) (*ingest.Result, error) {
 	if strings.TrimSpace(opts.skillPath) == "" {
 		candidates := defaultIngestSkillCandidates(opts.repoPath)
 		if len(candidates) == 0 {
-			return "", fmt.Errorf("no default skill file found; pass --skill <path>")
+			return nil, fmt.Errorf("no default skill file found; pass --skill <path>")
 		}
-		return "", fmt.Errorf("no default skill file found; checked: %s; pass --skill <path>", strings.Join(candidates, ", "))
+		return nil, fmt.Errorf("no default skill file found; checked: %s; pass --skill <path>", strings.Join(candidates, ", "))
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
 	defer cancel()
 
+	var cfg *engine.RunConfigFile
+	if opts.configPath != "" {
+		loaded, err := engine.LoadRunConfigFile(opts.configPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
 	result, err := ingest.Run(ctx, ingest.Options{
 		Requirements: opts.requirements,
 		SkillPath:    opts.skillPath,
@@ -287,14 +359,17 @@ func runIngest(opts *ingestOptions) (string, error) {
 		RepoPath:     opts.repoPath,
 		Validate:     opts.validate,
 		MaxTurns:     opts.maxTurns,
+		RepairRounds: opts.repairRounds,
+		Provider:     opts.provider,
+		Config:       cfg,
 	})
 	if err != nil {
-		return "", err
+		return result, err
 	}
 
 	for _, w := range result.Warnings {
 		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
 	}
 
-	return result.DotContent, nil
+	return result, nil
 }
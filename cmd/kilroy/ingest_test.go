@@ -72,6 +72,9 @@ func TestParseIngestArgs(t *testing.T) {
 				if o.maxTurns != 10 {
 					t.Errorf("maxTurns = %d, want 10", o.maxTurns)
 				}
+				if o.repairRounds != 2 {
+					t.Errorf("repairRounds = %d, want default 2", o.repairRounds)
+				}
 			},
 		},
 		{
@@ -84,6 +87,39 @@ func TestParseIngestArgs(t *testing.T) {
 			args:    []string{"--max-turns", "abc", "Build a solitaire game"},
 			wantErr: true,
 		},
+		{
+			name: "provider with config and model",
+			args: []string{"--config", "run.yaml", "--provider", "openai", "--model", "gpt-5.2", "Build a solitaire game"},
+			check: func(t *testing.T, o *ingestOptions) {
+				if o.provider != "openai" || o.configPath != "run.yaml" || o.model != "gpt-5.2" {
+					t.Errorf("provider=%q config=%q model=%q", o.provider, o.configPath, o.model)
+				}
+			},
+		},
+		{
+			name:    "provider without model",
+			args:    []string{"--config", "run.yaml", "--provider", "openai", "Build a solitaire game"},
+			wantErr: true,
+		},
+		{
+			name:    "config without provider",
+			args:    []string{"--config", "run.yaml", "Build a solitaire game"},
+			wantErr: true,
+		},
+		{
+			name: "repair-rounds flag",
+			args: []string{"--repair-rounds", "0", "Build a solitaire game"},
+			check: func(t *testing.T, o *ingestOptions) {
+				if o.repairRounds != 0 {
+					t.Errorf("repairRounds = %d, want 0", o.repairRounds)
+				}
+			},
+		},
+		{
+			name:    "repair-rounds negative",
+			args:    []string{"--repair-rounds", "-1", "Build a solitaire game"},
+			wantErr: true,
+		},
 		{
 			name:    "max-turns zero",
 			args:    []string{"--max-turns", "0", "Build a solitaire game"},
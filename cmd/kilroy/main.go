@@ -16,6 +16,7 @@ import (
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
 	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/review"
 	"github.com/danshapiro/kilroy/internal/attractor/validate"
 	"github.com/danshapiro/kilroy/internal/dotenv"
 	"github.com/danshapiro/kilroy/internal/providerspec"
@@ -110,20 +111,22 @@ func loadEnvFile(args []string) []string {
 func usage() {
 	fmt.Fprintln(os.Stderr, "usage:")
 	fmt.Fprintln(os.Stderr, "  kilroy --version")
-	fmt.Fprintln(os.Stderr, "  kilroy [--env-file <path>] attractor run [--detach] [--allow-test-shim] [--confirm-stale-build] [--no-cxdb] [--force-model <provider=model>] --graph <file.dot> --config <run.yaml> [--run-id <id>] [--logs-root <dir>]")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --logs-root <dir>")
+	fmt.Fprintln(os.Stderr, "  kilroy [--env-file <path>] attractor run [--detach] [--dry-run [--outcomes <outcomes.yaml>]] [--allow-test-shim] [--confirm-stale-build] [--no-cxdb] [--no-cache] [--force-model <provider=model>] [--param <name=value>] --graph <file.dot> --config <run.yaml> [--run-id <id>] [--logs-root <dir>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --logs-root <dir> [--from-node <node_id>] [--fork]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --cxdb <http_base_url> --context-id <id>")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor resume --run-branch <attractor/run/...> [--repo <path>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor status [--logs-root <dir> | --latest] [--json] [-v|--verbose] [--follow|-f] [--cxdb] [--raw] [--watch] [--interval <sec>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor stop --logs-root <dir> [--grace-ms <ms>] [--force]")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --graph <file.dot>")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --batch <file.dot> [<file.dot> ...] [--json]")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor ingest [--output <file.dot>] [--model <model>] [--skill <skill.md>] [--repo <path>] [--max-turns <n>] <requirements>")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor serve [--addr <host:port>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --graph <file.dot> [--routing]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor validate --batch <file.dot> [<file.dot> ...] [--json] [--routing]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor ingest [--output <file.dot>] [--model <model>] [--skill <skill.md>] [--repo <path>] [--max-turns <n>] [--repair-rounds <n>] [--config <run.yaml> --provider <name>] <requirements>")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor serve [--addr <host:port>] [--auth-config <auth.yaml>] [--runs-dir <dir>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor modeldb suggest [--refresh] [--ttl <duration>] [--provider <name>]")
-	fmt.Fprintln(os.Stderr, "  kilroy attractor review --graph <file.dot> [--output <file>] [--json] [--max-turns <n>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor review --graph <file.dot> [--output <file>] [--json] [--max-turns <n>] [--config <run.yaml> --provider <name> --model <model>]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor render [--graph <file.dot>] [--logs-root <dir>] [--format svg|html|mermaid] [--output <file>]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor runs list [--json]")
 	fmt.Fprintln(os.Stderr, "  kilroy attractor runs prune [--before YYYY-MM-DD] [--graph PATTERN] [--label KEY=VALUE] [--orphans] [--dry-run | --yes]")
+	fmt.Fprintln(os.Stderr, "  kilroy attractor runs diff <runA> <runB> [--json] [--repo <path>]")
 }
 
 func attractor(args []string) {
@@ -150,6 +153,8 @@ func attractor(args []string) {
 		attractorModelDB(args[1:])
 	case "review":
 		attractorReview(args[1:])
+	case "render":
+		attractorRender(args[1:])
 	case "runs":
 		attractorRuns(args[1:])
 	default:
@@ -167,19 +172,34 @@ func attractorRun(args []string) {
 	var allowTestShim bool
 	var confirmStaleBuild bool
 	var noCXDB bool
+	var noCache bool
 	var skipCLIHeadlessWarning bool
 	var forceModelSpecs []string
+	var paramSpecs []string
+	var dryRun bool
+	var outcomesPath string
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--detach":
 			detach = true
+		case "--dry-run":
+			dryRun = true
+		case "--outcomes":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--outcomes requires a value")
+				os.Exit(1)
+			}
+			outcomesPath = args[i]
 		case "--allow-test-shim":
 			allowTestShim = true
 		case "--confirm-stale-build":
 			confirmStaleBuild = true
 		case "--no-cxdb":
 			noCXDB = true
+		case "--no-cache":
+			noCache = true
 		case skipCLIHeadlessWarningFlag:
 			skipCLIHeadlessWarning = true
 		case "--force-model":
@@ -189,6 +209,13 @@ func attractorRun(args []string) {
 				os.Exit(1)
 			}
 			forceModelSpecs = append(forceModelSpecs, args[i])
+		case "--param":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--param requires a value in the form name=value")
+				os.Exit(1)
+			}
+			paramSpecs = append(paramSpecs, args[i])
 		case "--graph":
 			i++
 			if i >= len(args) {
@@ -227,6 +254,22 @@ func attractorRun(args []string) {
 		usage()
 		os.Exit(1)
 	}
+	if outcomesPath != "" && !dryRun {
+		fmt.Fprintln(os.Stderr, "--outcomes is only used with --dry-run")
+		os.Exit(1)
+	}
+	var dryRunScript *engine.DryRunScript
+	if dryRun {
+		dryRunScript = &engine.DryRunScript{}
+		if outcomesPath != "" {
+			script, err := engine.LoadDryRunScript(outcomesPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			dryRunScript = script
+		}
+	}
 	if err := ensureFreshKilroyBuild(confirmStaleBuild); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -236,6 +279,11 @@ func attractorRun(args []string) {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	params, canonicalParamSpecs, err := parseParamFlags(paramSpecs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	if detach {
 		cfg, err := engine.LoadRunConfigFile(configPath)
@@ -291,10 +339,27 @@ func attractorRun(args []string) {
 		if noCXDB {
 			childArgs = append(childArgs, "--no-cxdb")
 		}
+		if noCache {
+			childArgs = append(childArgs, "--no-cache")
+		}
+		if dryRun {
+			childArgs = append(childArgs, "--dry-run")
+		}
+		if outcomesPath != "" {
+			absOutcomes, err := filepath.Abs(outcomesPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			childArgs = append(childArgs, "--outcomes", absOutcomes)
+		}
 		childArgs = append(childArgs, skipCLIHeadlessWarningFlag)
 		for _, spec := range canonicalForceSpecs {
 			childArgs = append(childArgs, "--force-model", spec)
 		}
+		for _, spec := range canonicalParamSpecs {
+			childArgs = append(childArgs, "--param", spec)
+		}
 
 		if err := launchDetached(childArgs, logsRoot); err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -314,7 +379,7 @@ func attractorRun(args []string) {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	if !skipCLIHeadlessWarning && runConfigUsesCLIProviders(cfg) {
+	if !skipCLIHeadlessWarning && !dryRun && runConfigUsesCLIProviders(cfg) {
 		if !confirmCLIHeadlessWarning(os.Stdin, os.Stderr) {
 			fmt.Fprintln(os.Stderr, "preflight aborted: declined provider CLI headless-risk warning")
 			os.Exit(1)
@@ -324,12 +389,21 @@ func attractorRun(args []string) {
 	// Default: no deadline. CLI runs (especially with provider CLIs) can take hours.
 	ctx, cleanupSignalCtx := signalCancelContext()
 
+	absGraphPath, err := filepath.Abs(graphPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	res, err := engine.RunWithConfig(ctx, dotSource, cfg, engine.RunOptions{
+		GraphPath:     absGraphPath,
 		RunID:         runID,
 		LogsRoot:      logsRoot,
 		AllowTestShim: allowTestShim,
 		DisableCXDB:   noCXDB,
+		NoCache:       noCache,
 		ForceModels:   forceModels,
+		Params:        params,
+		DryRun:        dryRunScript,
 		OnCXDBStartup: func(info *engine.CXDBStartupInfo) {
 			if info == nil {
 				return
@@ -360,6 +434,9 @@ func attractorRun(args []string) {
 	for _, w := range res.Warnings {
 		fmt.Fprintf(os.Stderr, "WARNING: %s\n", w)
 	}
+	if cov := res.DryRunCoverage; cov != nil {
+		printDryRunCoverage(os.Stdout, cov)
+	}
 
 	if string(res.FinalStatus) == "success" {
 		os.Exit(0)
@@ -367,6 +444,18 @@ func attractorRun(args []string) {
 	os.Exit(1)
 }
 
+// printDryRunCoverage summarizes the coverage report a dry run wrote to
+// dry_run_coverage.json.
+func printDryRunCoverage(w io.Writer, cov *engine.DryRunCoverage) {
+	fmt.Fprintf(w, "dry_run_edges_exercised=%d/%d\n", len(cov.Edges)-len(cov.UnexercisedEdges), len(cov.Edges))
+	for _, e := range cov.UnexercisedEdges {
+		fmt.Fprintf(w, "unexercised_edge=%s\n", e)
+	}
+	for _, id := range cov.UnvisitedNodes {
+		fmt.Fprintf(w, "unvisited_node=%s\n", id)
+	}
+}
+
 func parseForceModelFlags(specs []string) (map[string]string, []string, error) {
 	if len(specs) == 0 {
 		return nil, nil, nil
@@ -404,6 +493,38 @@ func parseForceModelFlags(specs []string) (map[string]string, []string, error) {
 	return overrides, canonicalSpecs, nil
 }
 
+// parseParamFlags turns repeated --param name=value flags into a map plus
+// canonical name-sorted specs for re-launching a detached child. Values are
+// type-checked later against the graph's declared params.
+func parseParamFlags(specs []string) (map[string]string, []string, error) {
+	if len(specs) == 0 {
+		return nil, nil, nil
+	}
+	params := map[string]string{}
+	for _, raw := range specs {
+		name, value, ok := strings.Cut(raw, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, nil, fmt.Errorf("--param %q is invalid; expected name=value", raw)
+		}
+		if prev, exists := params[name]; exists {
+			return nil, nil, fmt.Errorf("--param %q specified multiple times (%q then %q)", name, prev, value)
+		}
+		params[name] = value
+	}
+
+	keys := make([]string, 0, len(params))
+	for name := range params {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	canonicalSpecs := make([]string, 0, len(keys))
+	for _, name := range keys {
+		canonicalSpecs = append(canonicalSpecs, name+"="+params[name])
+	}
+	return params, canonicalSpecs, nil
+}
+
 func normalizeRunProviderKey(provider string) string {
 	return providerspec.CanonicalProviderKey(provider)
 }
@@ -459,6 +580,7 @@ func attractorValidate(args []string) {
 	var batchFiles []string
 	var batchMode bool
 	var jsonOutput bool
+	var routing bool
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -478,6 +600,8 @@ func attractorValidate(args []string) {
 			}
 		case "--json":
 			jsonOutput = true
+		case "--routing":
+			routing = true
 		default:
 			// Allow positional file arguments when in batch mode context
 			// (e.g. when --batch was not yet seen but a .dot was given).
@@ -491,7 +615,7 @@ func attractorValidate(args []string) {
 	}
 
 	if batchMode {
-		attractorValidateBatch(batchFiles, jsonOutput)
+		attractorValidateBatch(batchFiles, jsonOutput, routing)
 		return
 	}
 
@@ -512,21 +636,33 @@ func attractorValidate(args []string) {
 		fmt.Fprintf(os.Stderr, "WARNING: model catalog unavailable, model ID checks skipped: %v\n", catErr)
 		cat = nil
 	}
-	_, diags, err := engine.PrepareWithOptions(dotSource, engine.PrepareOptions{Catalog: cat})
+	g, diags, err := engine.PrepareWithOptions(dotSource, engine.PrepareOptions{Catalog: cat, SourcePath: graphPath})
+	if routing && g != nil {
+		diags = append(diags, review.AnalyzeRouting(g)...)
+	}
 	if err != nil {
 		for _, d := range diags {
-			fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", d.Severity, d.Message, d.Rule)
+			fmt.Fprintf(os.Stderr, "%s: %s%s (%s)\n", d.Severity, diagnosticLocationPrefix(d), d.Message, d.Rule)
 		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	fmt.Printf("ok: %s\n", filepath.Base(graphPath))
 	for _, d := range diags {
-		fmt.Printf("%s: %s (%s)\n", d.Severity, d.Message, d.Rule)
+		fmt.Printf("%s: %s%s (%s)\n", d.Severity, diagnosticLocationPrefix(d), d.Message, d.Rule)
 	}
 	os.Exit(0)
 }
 
+// diagnosticLocationPrefix renders "file:line: " for diagnostics that carry a
+// source position.
+func diagnosticLocationPrefix(d validate.Diagnostic) string {
+	if loc := d.Location(); loc != "" {
+		return loc + ": "
+	}
+	return ""
+}
+
 // batchFileResult holds per-file validate results for batch mode.
 type batchFileResult struct {
 	File     string                `json:"file"`
@@ -537,7 +673,8 @@ type batchFileResult struct {
 
 // attractorValidateBatch runs validate against each file in files and emits a
 // summary.  Exit codes: 0 = all clean, 1 = any errors, 2 = warnings-only.
-func attractorValidateBatch(files []string, jsonOutput bool) {
+// With routing set, review.AnalyzeRouting findings are included.
+func attractorValidateBatch(files []string, jsonOutput, routing bool) {
 	if len(files) == 0 {
 		fmt.Fprintln(os.Stderr, "--batch requires at least one file path")
 		usage()
@@ -561,7 +698,10 @@ func attractorValidateBatch(files []string, jsonOutput bool) {
 			results = append(results, res)
 			continue
 		}
-		_, diags, prepErr := engine.Prepare(dotSource)
+		g, diags, prepErr := engine.PrepareWithOptions(dotSource, engine.PrepareOptions{SourcePath: f})
+		if routing && g != nil {
+			diags = append(diags, review.AnalyzeRouting(g)...)
+		}
 		// Collect diagnostics even when Prepare returns an error.
 		for _, d := range diags {
 			switch d.Severity {
@@ -638,8 +778,19 @@ func attractorResume(args []string) {
 	var contextID string
 	var runBranch string
 	var repoPath string
+	var fromNode string
+	var fork bool
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
+		case "--from-node":
+			i++
+			if i >= len(args) {
+				fmt.Fprintln(os.Stderr, "--from-node requires a value")
+				os.Exit(1)
+			}
+			fromNode = args[i]
+		case "--fork":
+			fork = true
 		case "--logs-root":
 			i++
 			if i >= len(args) {
@@ -684,6 +835,10 @@ func attractorResume(args []string) {
 		usage()
 		os.Exit(1)
 	}
+	if (fromNode != "" || fork) && logsRoot == "" {
+		fmt.Fprintln(os.Stderr, "--from-node and --fork require --logs-root")
+		os.Exit(1)
+	}
 	// Default: no deadline. Resume may replay long stages or rehydrate large artifacts.
 	ctx, cleanupSignalCtx := signalCancelContext()
 	var (
@@ -691,6 +846,8 @@ func attractorResume(args []string) {
 		err error
 	)
 	switch {
+	case logsRoot != "" && (fromNode != "" || fork):
+		res, err = engine.ResumeWithOverrides(ctx, logsRoot, engine.ResumeOverrides{FromNode: fromNode, Fork: fork})
 	case logsRoot != "":
 		res, err = engine.Resume(ctx, logsRoot)
 	case cxdbBaseURL != "" && contextID != "":
@@ -119,6 +119,38 @@ func TestAttractorValidateBatch_JSONOutput(t *testing.T) {
 	}
 }
 
+// TestAttractorValidateBatch_Routing verifies that --routing adds the static
+// routing findings to the batch JSON and that they count as warnings.
+func TestAttractorValidateBatch_Routing(t *testing.T) {
+	bin := buildKilroyBinary(t)
+	f := testdataBatchFile(t, "routing_gap.dot")
+
+	code, out := runKilroy(t, bin, "attractor", "validate", "--batch", f)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 without --routing, got %d\n%s", code, out)
+	}
+
+	code, out = runKilroy(t, bin, "attractor", "validate", "--batch", f, "--json", "--routing")
+	if code != 2 {
+		t.Fatalf("expected exit code 2 (routing warnings), got %d\n%s", code, out)
+	}
+	var results []struct {
+		Warnings []struct {
+			Rule   string `json:"rule"`
+			NodeID string `json:"node_id"`
+		} `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("JSON parse failed: %v\nOutput:\n%s", err, out)
+	}
+	if len(results) != 1 || len(results[0].Warnings) != 1 {
+		t.Fatalf("results=%+v", results)
+	}
+	if w := results[0].Warnings[0]; w.Rule != "routing_unhandled_outcome" || w.NodeID != "work" {
+		t.Fatalf("warning=%+v", w)
+	}
+}
+
 // TestAttractorValidateBatch_MissingFile verifies that a missing file is
 // reported as an error and exit code 1 is returned.
 func TestAttractorValidateBatch_MissingFile(t *testing.T) {
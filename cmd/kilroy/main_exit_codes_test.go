@@ -710,6 +710,32 @@ func TestParseForceModelFlags_RejectsDuplicateProvider(t *testing.T) {
 	}
 }
 
+func TestParseParamFlags_CanonicalizesAndKeepsValues(t *testing.T) {
+	got, specs, err := parseParamFlags([]string{"target_dir=src/app", "query=a=b"})
+	if err != nil {
+		t.Fatalf("parseParamFlags: %v", err)
+	}
+	want := map[string]string{"target_dir": "src/app", "query": "a=b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("params: got %#v want %#v", got, want)
+	}
+	if wantSpecs := []string{"query=a=b", "target_dir=src/app"}; !reflect.DeepEqual(specs, wantSpecs) {
+		t.Fatalf("canonical specs: got %#v want %#v", specs, wantSpecs)
+	}
+}
+
+func TestParseParamFlags_RejectsInvalidShapeAndDuplicates(t *testing.T) {
+	if _, _, err := parseParamFlags([]string{"target_dir"}); err == nil {
+		t.Fatalf("expected parse error for missing '='")
+	}
+	if _, _, err := parseParamFlags([]string{"=x"}); err == nil {
+		t.Fatalf("expected parse error for empty name")
+	}
+	if _, _, err := parseParamFlags([]string{"n=1", "n=2"}); err == nil {
+		t.Fatalf("expected parse error for duplicate param")
+	}
+}
+
 func TestAttractorRun_RealProfileRejectsShimOverride(t *testing.T) {
 	bin := buildKilroyBinary(t)
 	repo := initTestRepo(t)
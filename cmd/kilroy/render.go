@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/render"
+)
+
+func attractorRender(args []string) {
+	var graphPath, logsRoot, format, outputPath string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--graph", "--logs-root", "--format", "--output", "-o":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--graph":
+				graphPath = args[i]
+			case "--logs-root":
+				logsRoot = args[i]
+			case "--format":
+				format = args[i]
+			default:
+				outputPath = args[i]
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+
+	if graphPath == "" && logsRoot == "" {
+		usage()
+		os.Exit(1)
+	}
+	if format == "" {
+		format = renderFormatForPath(outputPath)
+	}
+
+	var (
+		g   *model.Graph
+		err error
+	)
+	if graphPath != "" {
+		g, err = loadRenderGraph(graphPath)
+	} else {
+		// A run's logs root keeps the graph it ran, so --logs-root alone is enough.
+		g, err = loadRunRenderGraph(logsRoot)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var opts render.Options
+	if logsRoot != "" {
+		o, err := render.LoadOverlay(logsRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.Overlay = o
+	}
+	out, err := render.Render(g, format, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if outputPath != "" {
+		if err := os.WriteFile(outputPath, []byte(out), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %s\n", outputPath)
+	} else {
+		fmt.Print(out)
+	}
+}
+
+// renderFormatForPath picks the format from the output file's extension,
+// defaulting to SVG.
+func renderFormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return "html"
+	case ".mmd", ".mermaid":
+		return "mermaid"
+	}
+	return "svg"
+}
+
+// loadRenderGraph runs the same transforms as a real run so includes and
+// params are expanded. Validation errors don't stop a render: a broken graph
+// is exactly the kind worth looking at.
+func loadRenderGraph(path string) (*model.Graph, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, _, err := engine.PrepareWithOptions(b, engine.PrepareOptions{SourcePath: path})
+	if g == nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// loadRunRenderGraph loads the graph a run executed, with its includes
+// expanded from the snapshot taken when the run started.
+func loadRunRenderGraph(logsRoot string) (*model.Graph, error) {
+	g, _, err := engine.PrepareRunGraph(logsRoot, engine.PrepareOptions{})
+	if g == nil {
+		return nil, err
+	}
+	return g, nil
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
 	"github.com/danshapiro/kilroy/internal/attractor/review"
 )
 
@@ -16,6 +17,7 @@ func attractorReview(args []string) {
 	var outputPath string
 	var jsonOutput bool
 	var maxTurns int
+	var configPath, provider, model string
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -33,6 +35,21 @@ func attractorReview(args []string) {
 				os.Exit(1)
 			}
 			outputPath = args[i]
+		case "--config", "--provider", "--model":
+			flag := args[i]
+			i++
+			if i >= len(args) {
+				fmt.Fprintf(os.Stderr, "%s requires a value\n", flag)
+				os.Exit(1)
+			}
+			switch flag {
+			case "--config":
+				configPath = args[i]
+			case "--provider":
+				provider = args[i]
+			default:
+				model = args[i]
+			}
 		case "--json":
 			jsonOutput = true
 		case "--max-turns":
@@ -58,6 +75,20 @@ func attractorReview(args []string) {
 		os.Exit(1)
 	}
 
+	if (provider != "" || configPath != "" || model != "") && (provider == "" || configPath == "" || model == "") {
+		fmt.Fprintln(os.Stderr, "--provider, --config and --model must be used together")
+		os.Exit(1)
+	}
+	var cfg *engine.RunConfigFile
+	if configPath != "" {
+		loaded, err := engine.LoadRunConfigFile(configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg = loaded
+	}
+
 	repoPath, _ := os.Getwd()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
@@ -67,6 +98,9 @@ func attractorReview(args []string) {
 		GraphPath: graphPath,
 		RepoPath:  repoPath,
 		MaxTurns:  maxTurns,
+		Provider:  provider,
+		Model:     model,
+		Config:    cfg,
 	})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,277 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// CompactionStrategy selects how a Session shrinks its history when it nears
+// the profile's context window.
+type CompactionStrategy string
+
+const (
+	// CompactionSummarize replaces older tool rounds with an LLM-written summary.
+	CompactionSummarize CompactionStrategy = "summarize"
+	// CompactionDropToolOutputs keeps older tool rounds but elides their outputs.
+	CompactionDropToolOutputs CompactionStrategy = "drop_tool_outputs"
+	// CompactionKeepLastRounds removes older tool rounds entirely.
+	CompactionKeepLastRounds CompactionStrategy = "keep_last_rounds"
+)
+
+// ParseCompactionStrategy normalizes a strategy name. The empty string is
+// returned unchanged and means compaction is disabled.
+func ParseCompactionStrategy(s string) (CompactionStrategy, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	v = strings.ReplaceAll(v, "-", "_")
+	switch CompactionStrategy(v) {
+	case "", CompactionSummarize, CompactionDropToolOutputs, CompactionKeepLastRounds:
+		return CompactionStrategy(v), nil
+	default:
+		return "", fmt.Errorf("unknown context compaction strategy %q (want summarize|drop_tool_outputs|keep_last_rounds)", s)
+	}
+}
+
+// CompactionConfig enables automatic history compaction for a Session.
+type CompactionConfig struct {
+	Strategy CompactionStrategy
+
+	// Threshold is the fraction of ContextWindowSize() at which compaction
+	// fires. Defaults to 0.7 so it runs before the 80% usage warning.
+	Threshold float64
+
+	// KeepRounds is the number of most recent tool rounds that are always kept
+	// verbatim. Defaults to 4.
+	KeepRounds int
+}
+
+func (c *CompactionConfig) applyDefaults() {
+	if c.Threshold <= 0 || c.Threshold > 1 {
+		c.Threshold = 0.7
+	}
+	if c.KeepRounds <= 0 {
+		c.KeepRounds = 4
+	}
+}
+
+const compactionSummaryPrompt = `You are compacting the transcript of an autonomous coding session so it fits in the model's context window.
+Summarize the transcript below for the agent that will continue the work. Keep: files read or changed and why, commands run and their important results, errors and how they were resolved, decisions made, and what remains to be done. Drop verbatim file contents and long tool outputs. Respond with the summary only.`
+
+// compactedToolOutput replaces a tool result dropped during compaction.
+func compactedToolOutput(chars int) string {
+	return fmt.Sprintf("[tool output elided during context compaction: %d chars]", chars)
+}
+
+func approxTokenCount(msgs []llm.Message) int {
+	total := 0
+	for _, m := range msgs {
+		total += messageCharCount(m)
+	}
+	return int(math.Round(float64(total) / 4.0))
+}
+
+// maybeCompact compacts the session history in place when the next request
+// (system prompt plus history) would exceed the configured threshold, or
+// unconditionally when force is set (after a context-length error). It
+// reports whether any tokens were reclaimed.
+func (s *Session) maybeCompact(ctx context.Context, sys string, force bool) bool {
+	if s == nil || s.cfg.Compaction == nil || s.cfg.Compaction.Strategy == "" {
+		return false
+	}
+	cw := s.profile.ContextWindowSize()
+	if cw <= 0 {
+		return false
+	}
+	cfg := *s.cfg.Compaction
+
+	s.mu.Lock()
+	history := append([]Turn{}, s.history...)
+	s.mu.Unlock()
+
+	sysMsg := llm.System(sys)
+	before := approxTokenCount(append([]llm.Message{sysMsg}, turnMessages(history)...))
+	if !force && float64(before) <= float64(cw)*cfg.Threshold {
+		return false
+	}
+
+	cut := compactionCutIndex(history, cfg.KeepRounds)
+	if cut <= 0 {
+		return false
+	}
+
+	strategy := cfg.Strategy
+	var compacted []Turn
+	switch strategy {
+	case CompactionSummarize:
+		summary, err := s.summarizeTurns(ctx, history[:cut])
+		if err != nil {
+			s.emit(EventWarning, map[string]any{
+				"message":  fmt.Sprintf("context compaction summary failed; dropping tool outputs instead: %v", err),
+				"strategy": string(strategy),
+			})
+			strategy = CompactionDropToolOutputs
+			compacted = dropToolOutputs(history[:cut])
+			break
+		}
+		compacted = keepUserInputs(history[:cut])
+		compacted = append(compacted, Turn{Kind: TurnSummary, Message: llm.User("Summary of earlier work in this session (older turns were compacted to fit the context window):\n\n" + summary)})
+	case CompactionDropToolOutputs:
+		compacted = dropToolOutputs(history[:cut])
+	case CompactionKeepLastRounds:
+		compacted = keepUserInputs(history[:cut])
+		compacted = append(compacted, Turn{Kind: TurnSummary, Message: llm.User(fmt.Sprintf("[%d earlier turns were removed to fit the context window; re-read files if you need their current contents]", cut-len(compacted)))})
+	default:
+		return false
+	}
+	next := append(compacted, history[cut:]...)
+
+	after := approxTokenCount(append([]llm.Message{sysMsg}, turnMessages(next)...))
+	if after >= before {
+		return false
+	}
+
+	s.mu.Lock()
+	s.history = next
+	s.mu.Unlock()
+
+	s.emit(EventContextCompaction, map[string]any{
+		"strategy":            string(strategy),
+		"forced":              force,
+		"tokens_before":       before,
+		"tokens_after":        after,
+		"tokens_reclaimed":    before - after,
+		"turns_before":        len(history),
+		"turns_after":         len(next),
+		"context_window_size": cw,
+	})
+	return true
+}
+
+// compactionCutIndex returns the history index where the last keepRounds tool
+// rounds begin. A round starts at an assistant turn, so cutting there never
+// separates tool calls from their results. Zero means there is nothing old
+// enough to compact.
+func compactionCutIndex(history []Turn, keepRounds int) int {
+	seen := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Kind != TurnAssistant {
+			continue
+		}
+		seen++
+		if seen == keepRounds {
+			return i
+		}
+	}
+	return 0
+}
+
+func turnMessages(turns []Turn) []llm.Message {
+	out := make([]llm.Message, 0, len(turns))
+	for _, t := range turns {
+		if t.Kind == TurnSteering || t.Kind == TurnSummary {
+			out = append(out, llm.User(t.Message.Text()))
+			continue
+		}
+		out = append(out, t.Message)
+	}
+	return out
+}
+
+// keepUserInputs returns the user inputs from turns, so the task the agent
+// was given survives compaction verbatim.
+func keepUserInputs(turns []Turn) []Turn {
+	var out []Turn
+	for _, t := range turns {
+		if t.Kind == TurnUserInput {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func dropToolOutputs(turns []Turn) []Turn {
+	out := make([]Turn, 0, len(turns))
+	for _, t := range turns {
+		if t.Kind != TurnTool {
+			out = append(out, t)
+			continue
+		}
+		m := t.Message
+		parts := make([]llm.ContentPart, len(m.Content))
+		copy(parts, m.Content)
+		for i, p := range parts {
+			if p.Kind != llm.ContentToolResult || p.ToolResult == nil {
+				continue
+			}
+			tr := *p.ToolResult
+			n := messageCharCount(llm.Message{Content: []llm.ContentPart{p}})
+			tr.Content = compactedToolOutput(n)
+			tr.ImageData = nil
+			tr.ImageMediaType = ""
+			parts[i].ToolResult = &tr
+		}
+		m.Content = parts
+		out = append(out, Turn{Kind: t.Kind, Message: m})
+	}
+	return out
+}
+
+func (s *Session) summarizeTurns(ctx context.Context, turns []Turn) (string, error) {
+	var b strings.Builder
+	for _, t := range turns {
+		b.WriteString("### ")
+		b.WriteString(string(t.Kind))
+		b.WriteString("\n")
+		for _, p := range t.Message.Content {
+			switch p.Kind {
+			case llm.ContentText:
+				b.WriteString(p.Text)
+				b.WriteString("\n")
+			case llm.ContentToolCall:
+				if p.ToolCall != nil {
+					fmt.Fprintf(&b, "tool_call %s %s\n", p.ToolCall.Name, truncateForSummary(string(p.ToolCall.Arguments)))
+				}
+			case llm.ContentToolResult:
+				if p.ToolResult != nil {
+					fmt.Fprintf(&b, "tool_result %s: %s\n", p.ToolResult.Name, truncateForSummary(fmt.Sprint(p.ToolResult.Content)))
+				}
+			}
+		}
+	}
+	req := llm.Request{
+		Model:    s.profile.Model(),
+		Provider: s.profile.ID(),
+		Messages: []llm.Message{llm.System(compactionSummaryPrompt), llm.User(b.String())},
+	}
+	if len(s.cfg.ProviderOptions) > 0 {
+		req.ProviderOptions = s.cfg.ProviderOptions
+	}
+	policy := llm.DefaultRetryPolicy()
+	if s.cfg.LLMRetryPolicy != nil {
+		policy = *s.cfg.LLMRetryPolicy
+	}
+	resp, err := llm.Retry(ctx, policy, s.cfg.LLMSleep, nil, func() (llm.Response, error) {
+		return s.client.Complete(ctx, req)
+	})
+	if err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(resp.Text())
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// truncateForSummary keeps the summarization request itself bounded; the
+// head of a long tool output is usually the informative part.
+func truncateForSummary(s string) string {
+	const max = 2000
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + fmt.Sprintf("... [%d more chars]", len(s)-max)
+}
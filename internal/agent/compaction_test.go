@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// readLoopAdapter asks for read_file on big.txt a fixed number of times, then
+// finishes. Summarization requests are answered with a canned summary, and an
+// optional overflow limit makes oversized requests fail like a provider would.
+type readLoopAdapter struct {
+	name          string
+	rounds        int
+	overflowChars int
+
+	mu        sync.Mutex
+	requests  []llm.Request
+	calls     int
+	summaries int
+}
+
+func (a *readLoopAdapter) Name() string { return a.name }
+
+func (a *readLoopAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	_ = ctx
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, req)
+	if len(req.Messages) > 0 && strings.Contains(req.Messages[0].Text(), "compacting the transcript") {
+		a.summaries++
+		return llm.Response{Provider: a.name, Model: req.Model, Message: llm.Assistant("Read big.txt several times; it is filler text.")}, nil
+	}
+	if a.overflowChars > 0 {
+		n := 0
+		for _, m := range req.Messages {
+			if m.Role != llm.RoleSystem {
+				n += messageCharCount(m)
+			}
+		}
+		if n > a.overflowChars {
+			return llm.Response{}, llm.ErrorFromHTTPStatus(a.name, 400, "maximum context length exceeded", nil, nil)
+		}
+	}
+	if a.calls >= a.rounds {
+		return llm.Response{Provider: a.name, Model: req.Model, Message: llm.Assistant("done")}, nil
+	}
+	a.calls++
+	call := llm.ToolCallData{
+		ID:        fmt.Sprintf("c%d", a.calls),
+		Name:      "read_file",
+		Arguments: json.RawMessage(fmt.Sprintf(`{"file_path":"big.txt","offset":%d}`, a.calls)),
+		Type:      "function",
+	}
+	return llm.Response{Provider: a.name, Model: req.Model, Message: llm.Message{
+		Role:    llm.RoleAssistant,
+		Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &call}},
+	}}, nil
+}
+
+func (a *readLoopAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	return nil, errors.New("stream not implemented in readLoopAdapter")
+}
+
+func (a *readLoopAdapter) lastRequest() llm.Request {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests[len(a.requests)-1]
+}
+
+func runCompactionSession(t *testing.T, adapter *readLoopAdapter, cw int, cfg *CompactionConfig) ([]SessionEvent, error) {
+	t.Helper()
+	dir := t.TempDir()
+	var lines []string
+	for i := 0; i < 60; i++ {
+		lines = append(lines, strings.Repeat("filler text ", 6))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := llm.NewClient()
+	c.Register(adapter)
+	sess, err := NewSession(c, tinyProfile{id: adapter.name, mod: "m", cw: cw}, NewLocalExecutionEnvironment(dir), SessionConfig{Compaction: cfg})
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, runErr := sess.ProcessInput(ctx, "summarize big.txt")
+	sess.Close()
+	var events []SessionEvent
+	for ev := range sess.Events() {
+		events = append(events, ev)
+	}
+	return events, runErr
+}
+
+func compactionEvents(events []SessionEvent) []SessionEvent {
+	var out []SessionEvent
+	for _, ev := range events {
+		if ev.Kind == EventContextCompaction {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func requestText(req llm.Request) string {
+	var b strings.Builder
+	for _, m := range req.Messages {
+		b.WriteString(m.Text())
+		for _, p := range m.Content {
+			if p.ToolResult != nil {
+				b.WriteString(fmt.Sprint(p.ToolResult.Content))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestParseCompactionStrategy(t *testing.T) {
+	for in, want := range map[string]CompactionStrategy{
+		"":                  "",
+		"summarize":         CompactionSummarize,
+		"Drop-Tool-Outputs": CompactionDropToolOutputs,
+		"keep_last_rounds":  CompactionKeepLastRounds,
+	} {
+		got, err := ParseCompactionStrategy(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseCompactionStrategy(%q)=%q,%v want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCompactionStrategy("forget_everything"); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
+
+func TestSession_Compaction_DisabledByDefault(t *testing.T) {
+	a := &readLoopAdapter{name: "tiny", rounds: 4}
+	events, err := runCompactionSession(t, a, 1000, nil)
+	if err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	if got := compactionEvents(events); len(got) != 0 {
+		t.Fatalf("unexpected compaction events: %v", got)
+	}
+}
+
+func TestSession_Compaction_DropToolOutputs(t *testing.T) {
+	a := &readLoopAdapter{name: "tiny", rounds: 4}
+	events, err := runCompactionSession(t, a, 1000, &CompactionConfig{Strategy: CompactionDropToolOutputs, KeepRounds: 1})
+	if err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	got := compactionEvents(events)
+	if len(got) == 0 {
+		t.Fatalf("expected a %s event", EventContextCompaction)
+	}
+	ev := got[0]
+	if ev.Data["strategy"] != string(CompactionDropToolOutputs) {
+		t.Fatalf("strategy=%v", ev.Data["strategy"])
+	}
+	if r, _ := ev.Data["tokens_reclaimed"].(int); r <= 0 {
+		t.Fatalf("tokens_reclaimed=%v want > 0", ev.Data["tokens_reclaimed"])
+	}
+
+	last := a.lastRequest()
+	text := requestText(last)
+	if !strings.Contains(text, "tool output elided during context compaction") {
+		t.Fatalf("last request has no elided tool outputs")
+	}
+	// The most recent round is kept verbatim, so its read_file output survives.
+	if !strings.Contains(text, "filler text") {
+		t.Fatalf("most recent tool output should be kept verbatim")
+	}
+	// Tool calls and results stay paired after compaction.
+	calls, results := 0, 0
+	for _, m := range last.Messages {
+		for _, p := range m.Content {
+			if p.Kind == llm.ContentToolCall {
+				calls++
+			}
+			if p.Kind == llm.ContentToolResult {
+				results++
+			}
+		}
+	}
+	if calls != results || calls != 4 {
+		t.Fatalf("tool calls=%d results=%d want 4 each", calls, results)
+	}
+}
+
+func TestSession_Compaction_KeepLastRounds(t *testing.T) {
+	a := &readLoopAdapter{name: "tiny", rounds: 4}
+	events, err := runCompactionSession(t, a, 1000, &CompactionConfig{Strategy: CompactionKeepLastRounds, KeepRounds: 1})
+	if err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	if len(compactionEvents(events)) == 0 {
+		t.Fatalf("expected a %s event", EventContextCompaction)
+	}
+	last := a.lastRequest()
+	text := requestText(last)
+	if !strings.Contains(text, "summarize big.txt") {
+		t.Fatalf("original user input must survive compaction")
+	}
+	if !strings.Contains(text, "earlier turns were removed") {
+		t.Fatalf("missing removal note in compacted history")
+	}
+	calls := 0
+	for _, m := range last.Messages {
+		for _, p := range m.Content {
+			if p.Kind == llm.ContentToolCall {
+				calls++
+			}
+		}
+	}
+	if calls >= 4 {
+		t.Fatalf("tool calls in last request=%d; older rounds should have been removed", calls)
+	}
+}
+
+func TestSession_Compaction_Summarize(t *testing.T) {
+	a := &readLoopAdapter{name: "tiny", rounds: 4}
+	events, err := runCompactionSession(t, a, 1000, &CompactionConfig{Strategy: CompactionSummarize, KeepRounds: 1})
+	if err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	got := compactionEvents(events)
+	if len(got) == 0 || got[0].Data["strategy"] != string(CompactionSummarize) {
+		t.Fatalf("compaction events=%v", got)
+	}
+	if a.summaries == 0 {
+		t.Fatalf("expected a summarization request")
+	}
+	if text := requestText(a.lastRequest()); !strings.Contains(text, "Read big.txt several times") {
+		t.Fatalf("summary missing from compacted history")
+	}
+}
+
+func TestSession_Compaction_ForcedAfterContextLengthError(t *testing.T) {
+	// Threshold 1.0 keeps proactive compaction out of the way; the provider
+	// rejects histories over ~6000 chars (about one read of big.txt), so only the forced path can recover.
+	a := &readLoopAdapter{name: "tiny", rounds: 3, overflowChars: 6000}
+	events, err := runCompactionSession(t, a, 100000, &CompactionConfig{Strategy: CompactionDropToolOutputs, Threshold: 1, KeepRounds: 1})
+	if err != nil {
+		t.Fatalf("ProcessInput: %v", err)
+	}
+	got := compactionEvents(events)
+	if len(got) == 0 || got[0].Data["forced"] != true {
+		t.Fatalf("compaction events=%v; want a forced compaction", got)
+	}
+}
@@ -255,6 +255,14 @@ func (e *LocalExecutionEnvironment) Grep(pattern string, path string, globFilter
 }
 
 func (e *LocalExecutionEnvironment) ExecCommand(ctx context.Context, command string, timeoutMS int, workingDir string, envVars map[string]string) (ExecResult, error) {
+	return e.execCommand(ctx, command, timeoutMS, workingDir, envVars, nil)
+}
+
+// commandWrapper rewrites a prepared shell command before it starts (e.g. to
+// run it inside a sandbox). The returned cleanup runs after the process exits.
+type commandWrapper func(cmd *exec.Cmd) (cleanup func(), err error)
+
+func (e *LocalExecutionEnvironment) execCommand(ctx context.Context, command string, timeoutMS int, workingDir string, envVars map[string]string, wrap commandWrapper) (ExecResult, error) {
 	if timeoutMS <= 0 {
 		timeoutMS = 10_000
 	}
@@ -291,6 +299,16 @@ func (e *LocalExecutionEnvironment) ExecCommand(ctx context.Context, command str
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
+	if wrap != nil {
+		cleanup, err := wrap(cmd)
+		if err != nil {
+			return ExecResult{ExitCode: 127}, err
+		}
+		if cleanup != nil {
+			defer cleanup()
+		}
+	}
+
 	if err := cmd.Start(); err != nil {
 		return ExecResult{ExitCode: 127}, err
 	}
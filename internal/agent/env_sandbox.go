@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SandboxConfig describes the isolation applied by SandboxedExecutionEnvironment.
+type SandboxConfig struct {
+	// WritablePaths are directories that stay writable in addition to the
+	// environment's root directory. Everything else is mounted read-only, and
+	// /tmp is replaced with a private tmpfs.
+	WritablePaths []string
+
+	// DenyNetwork runs commands in an empty network namespace (loopback only).
+	DenyNetwork bool
+
+	// MemoryLimitBytes and CPULimit (in cores) are enforced through a cgroup v2
+	// child group when the host delegates one; zero means unlimited. See
+	// SandboxedExecutionEnvironment.ResourceLimitsError.
+	MemoryLimitBytes int64
+	CPULimit         float64
+}
+
+// SandboxedExecutionEnvironment runs shell commands inside unprivileged
+// user/mount (and optionally network) namespaces, bubblewrap-style: the root
+// filesystem is read-only and only the worktree and configured paths are
+// writable. File tools are held to the same writable set.
+type SandboxedExecutionEnvironment struct {
+	*LocalExecutionEnvironment
+	Sandbox SandboxConfig
+
+	writable  []string
+	cgroup    *sandboxCgroupParent
+	cgroupErr error
+}
+
+// NewSandboxedExecutionEnvironment wraps local so that its commands run in a
+// sandbox. It fails when the host cannot create the namespaces.
+func NewSandboxedExecutionEnvironment(local *LocalExecutionEnvironment, cfg SandboxConfig) (*SandboxedExecutionEnvironment, error) {
+	if local == nil {
+		return nil, fmt.Errorf("sandbox: local execution environment is nil")
+	}
+	if err := SandboxSupported(); err != nil {
+		return nil, err
+	}
+	writable := []string{}
+	for _, p := range append([]string{local.RootDir}, cfg.WritablePaths...) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("sandbox: writable path %q: %w", p, err)
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		writable = append(writable, abs)
+	}
+	e := &SandboxedExecutionEnvironment{
+		LocalExecutionEnvironment: local,
+		Sandbox:                   cfg,
+		writable:                  writable,
+	}
+	if cfg.MemoryLimitBytes > 0 || cfg.CPULimit > 0 {
+		e.cgroup, e.cgroupErr = findSandboxCgroupParent()
+	}
+	return e, nil
+}
+
+// ResourceLimitsError reports why configured CPU/memory limits cannot be
+// enforced on this host, or nil when they are (or none were requested).
+// Commands still run sandboxed without the limits.
+func (e *SandboxedExecutionEnvironment) ResourceLimitsError() error {
+	return e.cgroupErr
+}
+
+func (e *SandboxedExecutionEnvironment) WriteFile(path string, content string) (string, error) {
+	if err := e.checkWritable(path); err != nil {
+		return "", err
+	}
+	return e.LocalExecutionEnvironment.WriteFile(path, content)
+}
+
+func (e *SandboxedExecutionEnvironment) EditFile(path string, oldString string, newString string, replaceAll bool) (string, error) {
+	if err := e.checkWritable(path); err != nil {
+		return "", err
+	}
+	return e.LocalExecutionEnvironment.EditFile(path, oldString, newString, replaceAll)
+}
+
+func (e *SandboxedExecutionEnvironment) ExecCommand(ctx context.Context, command string, timeoutMS int, workingDir string, envVars map[string]string) (ExecResult, error) {
+	return e.execCommand(ctx, command, timeoutMS, workingDir, envVars, func(cmd *exec.Cmd) (func(), error) {
+		return e.wrapCommand(cmd)
+	})
+}
+
+// checkWritable rejects file tool writes outside the writable set, matching
+// what a shell command inside the sandbox could do.
+func (e *SandboxedExecutionEnvironment) checkWritable(path string) error {
+	abs := e.resolve(path)
+	// Resolve the deepest existing ancestor so symlinks cannot escape.
+	dir, rest := abs, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			abs = filepath.Join(resolved, rest)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+	for _, w := range e.writable {
+		if pathWithin(abs, w) {
+			return nil
+		}
+	}
+	return fmt.Errorf("sandbox: %s is outside the writable paths (%s)", path, strings.Join(e.writable, ", "))
+}
+
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,422 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The sandbox re-executes the current binary with sandboxInitEnvKey set. The
+// init hook below then runs inside the fresh namespaces: it builds the mount
+// layout, drops its capabilities and execs the real shell command. This is the
+// usual re-exec pattern for container runtimes; Go cannot run code between
+// clone and exec in the child.
+const sandboxInitEnvKey = "KILROY_AGENT_SANDBOX_INIT"
+
+// sandboxSetupExitCode is returned when the sandbox could not be built, so it
+// is distinguishable from the command's own failures.
+const sandboxSetupExitCode = 125
+
+// sandboxUID is the in-sandbox uid used when the host user is root, so the
+// command does not regain capabilities in the user namespace.
+const sandboxUID = 1000
+
+const (
+	capNetAdmin = 12
+	capSysAdmin = 21
+
+	prSetNoNewPrivs       = 38
+	prCapAmbient          = 47
+	prCapAmbientClearAll  = 4
+	oPath                 = 0x200000
+	stNoSUID              = 0x2
+	stNoDev               = 0x4
+	stNoExec              = 0x8
+	iffUp                 = 0x1
+	iffRunning            = 0x40
+	sandboxCgroupV2Root   = "/sys/fs/cgroup"
+	sandboxCPUPeriodMicro = 100000
+)
+
+type sandboxSpec struct {
+	Args        []string `json:"args"`
+	Dir         string   `json:"dir"`
+	Writable    []string `json:"writable"`
+	DenyNetwork bool     `json:"deny_network"`
+}
+
+func init() {
+	raw, ok := os.LookupEnv(sandboxInitEnvKey)
+	if !ok {
+		return
+	}
+	_ = os.Unsetenv(sandboxInitEnvKey)
+	err := sandboxInit(raw)
+	fmt.Fprintf(os.Stderr, "kilroy sandbox: %v\n", err)
+	os.Exit(sandboxSetupExitCode)
+}
+
+// SandboxSupported reports whether this host can create the user and mount
+// namespaces the sandbox needs.
+func SandboxSupported() error {
+	if b, err := os.ReadFile("/proc/sys/kernel/unprivileged_userns_clone"); err == nil && strings.TrimSpace(string(b)) == "0" && os.Getuid() != 0 {
+		return fmt.Errorf("sandbox: unprivileged user namespaces are disabled (kernel.unprivileged_userns_clone=0)")
+	}
+	if b, err := os.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil && strings.TrimSpace(string(b)) == "0" {
+		return fmt.Errorf("sandbox: user namespaces are disabled (user.max_user_namespaces=0)")
+	}
+	if _, err := os.Stat("/proc/self/exe"); err != nil {
+		return fmt.Errorf("sandbox: /proc/self/exe unavailable: %w", err)
+	}
+	return nil
+}
+
+func (e *SandboxedExecutionEnvironment) wrapCommand(cmd *exec.Cmd) (func(), error) {
+	args := append([]string{}, cmd.Args...)
+	if len(args) > 0 {
+		if p, err := exec.LookPath(args[0]); err == nil {
+			args[0] = p
+		}
+	}
+	spec, err := json.Marshal(sandboxSpec{
+		Args:        args,
+		Dir:         cmd.Dir,
+		Writable:    e.writable,
+		DenyNetwork: e.Sandbox.DenyNetwork,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{"kilroy-sandbox"}
+	cmd.Env = append(cmd.Env, sandboxInitEnvKey+"="+string(spec))
+
+	uid, gid := os.Getuid(), os.Getgid()
+	innerUID, innerGID := uid, gid
+	if uid == 0 {
+		innerUID, innerGID = sandboxUID, sandboxUID
+	}
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if e.Sandbox.DenyNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	attr := &syscall.SysProcAttr{
+		Setpgid:                    true,
+		Cloneflags:                 flags,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: innerUID, HostID: uid, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: innerGID, HostID: gid, Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		AmbientCaps:                []uintptr{capSysAdmin, capNetAdmin},
+	}
+	cmd.SysProcAttr = attr
+
+	if e.cgroup == nil {
+		return nil, nil
+	}
+	fd, cleanup, err := e.cgroup.newChild(e.Sandbox.MemoryLimitBytes, e.Sandbox.CPULimit)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: create cgroup: %w", err)
+	}
+	attr.UseCgroupFD = true
+	attr.CgroupFD = fd
+	return cleanup, nil
+}
+
+// sandboxInit runs in the re-executed child. It only returns on failure.
+func sandboxInit(raw string) error {
+	// Credentials and no_new_privs are per thread; keep everything on the
+	// thread that will call execve.
+	runtime.LockOSThread()
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		return fmt.Errorf("decode spec: %w", err)
+	}
+	if len(spec.Args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	if err := syscall.Mount("none", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	mounts, err := readMountPoints("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+
+	// Hold the writable directories open so they can be bound back after a
+	// fresh tmpfs hides anything that lives under /tmp.
+	fds := make([]int, len(spec.Writable))
+	for i, p := range spec.Writable {
+		fd, err := syscall.Open(p, oPath|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open writable path %s: %w", p, err)
+		}
+		fds[i] = fd
+	}
+	privateTmp := true
+	for _, p := range spec.Writable {
+		if p == "/tmp" || p == "/" {
+			privateTmp = false
+		}
+	}
+	if privateTmp {
+		if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("mount /tmp: %w", err)
+		}
+	}
+	for i, p := range spec.Writable {
+		_ = os.MkdirAll(p, 0o755)
+		if err := syscall.Mount(fmt.Sprintf("/proc/self/fd/%d", fds[i]), p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind writable path %s: %w", p, err)
+		}
+		_ = syscall.Close(fds[i])
+	}
+
+	for _, mp := range mounts {
+		if skipReadOnlyRemount(mp, spec.Writable, privateTmp) {
+			continue
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(mp, &st); err != nil {
+			if mp == "/" {
+				return fmt.Errorf("statfs /: %w", err)
+			}
+			continue
+		}
+		flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY)
+		// Locked flags must be carried over or the kernel rejects the remount.
+		if st.Flags&stNoSUID != 0 {
+			flags |= syscall.MS_NOSUID
+		}
+		if st.Flags&stNoDev != 0 {
+			flags |= syscall.MS_NODEV
+		}
+		if st.Flags&stNoExec != 0 {
+			flags |= syscall.MS_NOEXEC
+		}
+		if err := syscall.Mount("none", mp, "", flags, ""); err != nil {
+			if mp != "/" && (errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EINVAL)) {
+				continue
+			}
+			return fmt.Errorf("remount %s read-only: %w", mp, err)
+		}
+	}
+
+	if spec.DenyNetwork {
+		if err := sandboxLoopbackUp(); err != nil {
+			return fmt.Errorf("bring up loopback: %w", err)
+		}
+	}
+	if spec.Dir != "" {
+		if err := syscall.Chdir(spec.Dir); err != nil {
+			return fmt.Errorf("chdir %s: %w", spec.Dir, err)
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		return fmt.Errorf("clear ambient capabilities: %w", errno)
+	}
+	return syscall.Exec(spec.Args[0], spec.Args, os.Environ())
+}
+
+// skipReadOnlyRemount keeps kernel filesystems, the private /tmp and the
+// writable paths (and anything mounted beneath them) as they are.
+func skipReadOnlyRemount(mp string, writable []string, privateTmp bool) bool {
+	for _, prefix := range []string{"/proc", "/sys", "/dev"} {
+		if pathWithin(mp, prefix) {
+			return true
+		}
+	}
+	if privateTmp && pathWithin(mp, "/tmp") {
+		return true
+	}
+	for _, w := range writable {
+		if pathWithin(mp, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// readMountPoints returns the mount points from a mountinfo file, shortest
+// first so parents are remounted before their children.
+func readMountPoints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	seen := map[string]bool{}
+	var out []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mp := unescapeMountInfo(fields[4])
+		if !seen[mp] {
+			seen[mp] = true
+			out = append(out, mp)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i]) < len(out[j]) })
+	return out, nil
+}
+
+// unescapeMountInfo decodes the octal escapes (\040 etc.) used in mountinfo.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// sandboxLoopbackUp enables lo in a new network namespace so local servers
+// and tests still work without external connectivity.
+func sandboxLoopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = syscall.Close(fd) }()
+	var ifr [40]byte
+	copy(ifr[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); errno != 0 {
+		return errno
+	}
+	flags := (*uint16)(unsafe.Pointer(&ifr[syscall.IFNAMSIZ]))
+	*flags |= iffUp | iffRunning
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// sandboxCgroupParent is a delegated cgroup v2 directory under which each
+// sandboxed command gets its own child group.
+type sandboxCgroupParent struct {
+	dir string
+	seq atomic.Int64
+}
+
+func findSandboxCgroupParent() (*sandboxCgroupParent, error) {
+	if _, err := os.Stat(filepath.Join(sandboxCgroupV2Root, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not mounted at %s", sandboxCgroupV2Root)
+	}
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	rel := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			rel = strings.TrimPrefix(line, "0::")
+		}
+	}
+	if rel == "" {
+		return nil, fmt.Errorf("no cgroup v2 membership in /proc/self/cgroup")
+	}
+	dir := filepath.Join(sandboxCgroupV2Root, rel)
+	control := filepath.Join(dir, "cgroup.subtree_control")
+	enabled, err := os.ReadFile(control)
+	if err != nil {
+		return nil, fmt.Errorf("cgroup %s is not delegated: %w", dir, err)
+	}
+	have := strings.Fields(string(enabled))
+	var missing []string
+	for _, c := range []string{"cpu", "memory"} {
+		if !containsString(have, c) {
+			missing = append(missing, "+"+c)
+		}
+	}
+	if len(missing) > 0 {
+		if err := os.WriteFile(control, []byte(strings.Join(missing, " ")), 0o644); err != nil {
+			return nil, fmt.Errorf("enable %s in %s: %w", strings.Join(missing, " "), control, err)
+		}
+	}
+	return &sandboxCgroupParent{dir: dir}, nil
+}
+
+func (p *sandboxCgroupParent) newChild(memoryBytes int64, cpus float64) (int, func(), error) {
+	dir := filepath.Join(p.dir, fmt.Sprintf("kilroy-sandbox-%d-%d", os.Getpid(), p.seq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return -1, nil, err
+	}
+	remove := func() {
+		// Kill stragglers (e.g. daemonized children) so the group can go.
+		_ = os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0o644)
+		for i := 0; i < 50; i++ {
+			if err := os.Remove(dir); err == nil || errors.Is(err, os.ErrNotExist) {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if memoryBytes > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(memoryBytes, 10)), 0o644); err != nil {
+			remove()
+			return -1, nil, err
+		}
+		_ = os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0o644)
+	}
+	if cpus > 0 {
+		quota := int64(cpus * sandboxCPUPeriodMicro)
+		if quota < 1000 {
+			quota = 1000
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, sandboxCPUPeriodMicro)), 0o644); err != nil {
+			remove()
+			return -1, nil, err
+		}
+	}
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		remove()
+		return -1, nil, err
+	}
+	return fd, func() {
+		_ = syscall.Close(fd)
+		remove()
+	}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadMountPoints_UnescapesAndSortsParentsFirst(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "mountinfo")
+	content := strings.Join([]string{
+		`30 1 0:27 / /home/a\040b rw - ext4 /dev/x rw`,
+		`22 1 8:1 / / rw - ext4 /dev/root rw`,
+		`25 22 0:5 / /proc rw - proc proc rw`,
+	}, "\n")
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readMountPoints(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/", "/proc", "/home/a b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("mount points=%q want %q", got, want)
+	}
+}
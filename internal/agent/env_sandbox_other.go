@@ -0,0 +1,25 @@
+//go:build !linux
+
+package agent
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+type sandboxCgroupParent struct{}
+
+// SandboxSupported reports whether this host can run sandboxed commands. The
+// sandbox relies on Linux namespaces.
+func SandboxSupported() error {
+	return fmt.Errorf("sandbox: not supported on %s (requires linux namespaces)", runtime.GOOS)
+}
+
+func findSandboxCgroupParent() (*sandboxCgroupParent, error) {
+	return nil, fmt.Errorf("cgroups are not available on %s", runtime.GOOS)
+}
+
+func (e *SandboxedExecutionEnvironment) wrapCommand(cmd *exec.Cmd) (func(), error) {
+	return nil, SandboxSupported()
+}
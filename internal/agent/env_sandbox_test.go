@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSandbox(t *testing.T, cfg SandboxConfig) (*SandboxedExecutionEnvironment, string) {
+	t.Helper()
+	if err := SandboxSupported(); err != nil {
+		t.Skipf("sandbox unsupported: %v", err)
+	}
+	dir := t.TempDir()
+	env, err := NewSandboxedExecutionEnvironment(NewLocalExecutionEnvironment(dir), cfg)
+	if err != nil {
+		t.Fatalf("NewSandboxedExecutionEnvironment: %v", err)
+	}
+	// Probe once: CI containers often forbid nested user namespaces even when
+	// the sysctls allow them.
+	res, err := env.ExecCommand(context.Background(), "true", 10_000, "", nil)
+	if err != nil || res.ExitCode != 0 {
+		t.Skipf("sandbox cannot start here: err=%v exit=%d stderr=%s", err, res.ExitCode, res.Stderr)
+	}
+	return env, dir
+}
+
+func TestSandboxedExecutionEnvironment_WorktreeWritableRootReadOnly(t *testing.T) {
+	outside := t.TempDir()
+	env, dir := newTestSandbox(t, SandboxConfig{})
+
+	res, err := env.ExecCommand(context.Background(), "echo hi > inside.txt && cat inside.txt", 10_000, "", nil)
+	// bash -lc runs login profiles, which may print their own noise.
+	if err != nil || res.ExitCode != 0 || !strings.HasSuffix(res.Stdout, "hi\n") {
+		t.Fatalf("write in worktree: err=%v exit=%d stdout=%q stderr=%q", err, res.ExitCode, res.Stdout, res.Stderr)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "inside.txt")); strings.TrimSpace(string(b)) != "hi" {
+		t.Fatalf("worktree write not visible on host: %q", string(b))
+	}
+
+	// A sibling temp dir lives under the private /tmp, so the host copy must
+	// stay untouched; a path under the host root must be read-only.
+	target := filepath.Join(outside, "escape.txt")
+	_, _ = env.ExecCommand(context.Background(), "echo x > "+shellEscape(target), 10_000, "", nil)
+	if _, err := os.Stat(target); err == nil {
+		t.Fatalf("sandboxed command wrote outside the worktree: %s", target)
+	}
+	res, _ = env.ExecCommand(context.Background(), "touch /usr/kilroy-sandbox-probe", 10_000, "", nil)
+	if res.ExitCode == 0 {
+		_ = os.Remove("/usr/kilroy-sandbox-probe")
+		t.Fatalf("expected read-only root; touch /usr succeeded")
+	}
+	if !strings.Contains(strings.ToLower(res.Stderr), "read-only") {
+		t.Fatalf("stderr=%q want read-only file system error", res.Stderr)
+	}
+}
+
+func TestSandboxedExecutionEnvironment_PrivateTmpAndWritablePaths(t *testing.T) {
+	extra := t.TempDir()
+	env, _ := newTestSandbox(t, SandboxConfig{WritablePaths: []string{extra}})
+
+	res, err := env.ExecCommand(context.Background(), "echo ok > /tmp/scratch && cat /tmp/scratch && echo y > "+shellEscape(filepath.Join(extra, "y.txt")), 10_000, "", nil)
+	if err != nil || res.ExitCode != 0 {
+		t.Fatalf("err=%v exit=%d stderr=%q", err, res.ExitCode, res.Stderr)
+	}
+	if _, err := os.Stat("/tmp/scratch"); err == nil {
+		t.Fatalf("/tmp inside the sandbox must be private")
+	}
+	if _, err := os.Stat(filepath.Join(extra, "y.txt")); err != nil {
+		t.Fatalf("write to configured writable path missing: %v", err)
+	}
+}
+
+func TestSandboxedExecutionEnvironment_DenyNetwork(t *testing.T) {
+	env, _ := newTestSandbox(t, SandboxConfig{DenyNetwork: true})
+
+	res, err := env.ExecCommand(context.Background(), "echo ---; cat /proc/net/dev", 10_000, "", nil)
+	if err != nil || res.ExitCode != 0 {
+		t.Fatalf("err=%v exit=%d stderr=%q", err, res.ExitCode, res.Stderr)
+	}
+	_, table, _ := strings.Cut(res.Stdout, "---\n")
+	var ifaces []string
+	for _, line := range strings.Split(table, "\n") {
+		if name, _, ok := strings.Cut(line, ":"); ok {
+			ifaces = append(ifaces, strings.TrimSpace(name))
+		}
+	}
+	if len(ifaces) != 1 || ifaces[0] != "lo" {
+		t.Fatalf("interfaces=%v want only lo", ifaces)
+	}
+}
+
+func TestSandboxedExecutionEnvironment_CannotRegainPrivileges(t *testing.T) {
+	env, _ := newTestSandbox(t, SandboxConfig{})
+
+	res, _ := env.ExecCommand(context.Background(), "grep CapEff /proc/self/status", 10_000, "", nil)
+	if !strings.Contains(res.Stdout, "0000000000000000") {
+		t.Fatalf("sandboxed shell has capabilities: %q", res.Stdout)
+	}
+	res, _ = env.ExecCommand(context.Background(), "mount -o remount,rw / 2>&1 || echo denied", 10_000, "", nil)
+	if !strings.Contains(res.Stdout, "denied") {
+		t.Fatalf("remount rw should fail inside the sandbox: %q", res.Stdout)
+	}
+}
+
+func TestSandboxedExecutionEnvironment_FileToolsRespectWritablePaths(t *testing.T) {
+	if err := SandboxSupported(); err != nil {
+		t.Skipf("sandbox unsupported: %v", err)
+	}
+	dir := t.TempDir()
+	outside := t.TempDir()
+	env, err := NewSandboxedExecutionEnvironment(NewLocalExecutionEnvironment(dir), SandboxConfig{})
+	if err != nil {
+		t.Fatalf("NewSandboxedExecutionEnvironment: %v", err)
+	}
+	if _, err := env.WriteFile("sub/a.txt", "a"); err != nil {
+		t.Fatalf("WriteFile inside worktree: %v", err)
+	}
+	if _, err := env.WriteFile(filepath.Join(outside, "b.txt"), "b"); err == nil {
+		t.Fatalf("WriteFile outside worktree should fail")
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.WriteFile("link/c.txt", "c"); err == nil {
+		t.Fatalf("WriteFile through a symlink out of the worktree should fail")
+	}
+	if _, err := env.EditFile("sub/a.txt", "a", "z", false); err != nil {
+		t.Fatalf("EditFile inside worktree: %v", err)
+	}
+}
+
+func TestSandboxedExecutionEnvironment_ResourceLimits(t *testing.T) {
+	env, _ := newTestSandbox(t, SandboxConfig{MemoryLimitBytes: 64 << 20, CPULimit: 0.5})
+	if err := env.ResourceLimitsError(); err != nil {
+		t.Skipf("cgroup limits unavailable: %v", err)
+	}
+	res, err := env.ExecCommand(context.Background(), "cat /sys/fs/cgroup$(cut -d: -f3 /proc/self/cgroup)/memory.max", 10_000, "", nil)
+	if err != nil || !strings.HasSuffix(res.Stdout, "67108864\n") {
+		t.Fatalf("memory.max=%q err=%v stderr=%q", res.Stdout, err, res.Stderr)
+	}
+}
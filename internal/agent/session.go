@@ -56,6 +56,11 @@ type SessionConfig struct {
 	// Nil means use llm.DefaultRetryPolicy().
 	LLMRetryPolicy *llm.RetryPolicy
 	LLMSleep       llm.SleepFunc
+
+	// Compaction, when non-nil with a non-empty Strategy, shrinks older history
+	// before a request would exceed Compaction.Threshold of the profile's
+	// context window, and once more after a context-length error.
+	Compaction *CompactionConfig
 }
 
 // ErrTurnLimit indicates the session exceeded its configured MaxTurns budget.
@@ -87,6 +92,11 @@ func (c *SessionConfig) applyDefaults() {
 	if c.LoopDetectionWindow <= 0 {
 		c.LoopDetectionWindow = 10
 	}
+	if c.Compaction != nil {
+		cc := *c.Compaction
+		cc.applyDefaults()
+		c.Compaction = &cc
+	}
 }
 
 type Session struct {
@@ -445,6 +455,7 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 	errorToolRepeats := 0
 	loopWarned := false
 	ctxWarned := false
+	forcedCompaction := false
 
 	for round := 0; round < s.cfg.MaxToolRoundsPerInput; round++ {
 		select {
@@ -453,20 +464,18 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 			return "", ctx.Err()
 		default:
 		}
+		if s.maybeCompact(ctx, sys, false) {
+			// Compacted history is well under the window again; re-arm the
+			// usage warning for the next time it grows.
+			ctxWarned = false
+		}
 		s.mu.Lock()
 		s.turns++
 		turns := s.turns
 		historyTurns := append([]Turn{}, s.history...)
 		s.mu.Unlock()
 
-		history := make([]llm.Message, 0, len(historyTurns))
-		for _, t := range historyTurns {
-			if t.Kind == TurnSteering {
-				history = append(history, llm.User(t.Message.Text()))
-				continue
-			}
-			history = append(history, t.Message)
-		}
+		history := turnMessages(historyTurns)
 
 		if s.cfg.MaxTurns > 0 && turns > s.cfg.MaxTurns {
 			s.emit(EventTurnLimit, map[string]any{"max_turns": s.cfg.MaxTurns})
@@ -499,10 +508,15 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 		})
 		if err != nil {
 			s.emit(EventError, map[string]any{"error": err.Error()})
-			// Spec: context overflow should emit a warning (no automatic compaction).
+			// Spec: context overflow should emit a warning. With compaction
+			// enabled, compact and retry once per overflow before giving up.
 			var cle *llm.ContextLengthError
 			if errors.As(err, &cle) {
 				s.emit(EventWarning, map[string]any{"message": "Context length exceeded"})
+				if !forcedCompaction && s.maybeCompact(ctx, sys, true) {
+					forcedCompaction = true
+					continue
+				}
 			}
 			// Spec: non-retryable/unrecoverable errors transition the session to CLOSED.
 			var le llm.Error
@@ -512,6 +526,8 @@ func (s *Session) processOneInput(ctx context.Context, input string) (string, er
 			return "", err
 		}
 
+		forcedCompaction = false
+
 		// Context window awareness: emit a warning when we exceed ~80% of the profile's context window.
 		if !ctxWarned {
 			if s.maybeWarnContextUsage(req.Messages) {
@@ -9,10 +9,11 @@ const (
 	TurnSteering  TurnKind = "STEERING"
 	TurnAssistant TurnKind = "ASSISTANT"
 	TurnTool      TurnKind = "TOOL"
+	TurnSummary   TurnKind = "SUMMARY"
 )
 
-// Turn is the Session's typed history item. Steering turns are kept distinct for observability,
-// but are converted to user-role messages when building the LLM request.
+// Turn is the Session's typed history item. Steering and summary turns are kept distinct for
+// observability, but are converted to user-role messages when building the LLM request.
 type Turn struct {
 	Kind    TurnKind
 	Message llm.Message
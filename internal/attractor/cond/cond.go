@@ -7,18 +7,127 @@ import (
 	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
-// Evaluate evaluates a minimal AND-only condition language used on edges.
+// Evaluate evaluates an edge condition.
 //
-// Grammar (per attractor-spec.md Section 10):
+// The base grammar is the AND-only language of attractor-spec.md Section 10:
 //
 //	ConditionExpr ::= Clause ( '&&' Clause )*
 //	Clause        ::= Key Operator Literal
 //	Key           ::= 'outcome' | 'preferred_label' | 'context.' Path
 //	Operator      ::= '=' | '!='
 //
-// Missing keys resolve to empty string. Comparisons are exact string comparisons.
+// Expressions that use any extended syntax are parsed with the extended grammar:
+//
+//	Expr     ::= AndExpr ( '||' AndExpr )*
+//	AndExpr  ::= Unary ( '&&' Unary )*
+//	Unary    ::= '!' Unary | '(' Expr ')' | Clause
+//	Clause   ::= Key [ Operator Literal | 'in' List ]
+//	Operator ::= '=' | '!=' | '<' | '<=' | '>' | '>=' | '=~' | 'contains'
+//	List     ::= '[' Literal ( ',' Literal )* ']'
+//
+// Missing keys resolve to empty string. '=' and '!=' are exact string
+// comparisons. Numeric operators compare as float64 and are false when the
+// resolved value is not a number. '=~' is an unanchored Go regexp match.
+// Literals may be single- or double-quoted to include delimiters.
 func Evaluate(condition string, outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
+	expr, err := Parse(condition)
+	if err != nil {
+		return false, err
+	}
+	return expr.Eval(outcome, ctx)
+}
+
+// Expr is a parsed edge condition.
+type Expr struct {
+	// legacy holds the raw expression when it uses only the base grammar, so
+	// it evaluates exactly as it always has.
+	legacy string
+	root   node
+}
+
+// Clause is a single Key/Operator/Literal comparison within an Expr. Bare-key
+// truthiness checks have an empty Op.
+type Clause struct {
+	Key     string
+	Op      string
+	Literal string
+	List    []string
+}
+
+// Parse parses a condition expression without evaluating it.
+func Parse(condition string) (*Expr, error) {
 	condition = strings.TrimSpace(condition)
+	if !UsesExtendedSyntax(condition) {
+		return &Expr{legacy: condition}, nil
+	}
+	p := &parser{src: condition}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return &Expr{root: root}, nil
+}
+
+// UsesExtendedSyntax reports whether a condition needs the extended grammar
+// (||, !, parentheses, numeric comparisons, contains, in, =~).
+func UsesExtendedSyntax(condition string) bool {
+	if strings.Contains(condition, "||") || strings.Contains(condition, "=~") || strings.ContainsAny(condition, "<>") {
+		return true
+	}
+	for _, clause := range strings.Split(condition, "&&") {
+		clause = strings.TrimSpace(clause)
+		if strings.HasPrefix(clause, "!") || strings.HasPrefix(clause, "(") {
+			return true
+		}
+		rest := strings.TrimLeft(clause, keyChars)
+		if rest == clause || rest == "" || !isSpace(rest[0]) {
+			continue
+		}
+		rest = strings.TrimSpace(rest)
+		if hasWord(rest, "contains") || hasWord(rest, "in") {
+			return true
+		}
+	}
+	return false
+}
+
+// Eval evaluates the expression against an outcome and context.
+func (x *Expr) Eval(outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
+	if x == nil {
+		return true, nil
+	}
+	if x.root == nil {
+		return evalLegacy(x.legacy, outcome, ctx)
+	}
+	return x.root.eval(outcome, ctx)
+}
+
+// Clauses returns every comparison in the expression, in source order.
+func (x *Expr) Clauses() []Clause {
+	if x == nil {
+		return nil
+	}
+	if x.root == nil {
+		var out []Clause
+		for _, raw := range strings.Split(x.legacy, "&&") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			out = append(out, legacyClause(raw))
+		}
+		return out
+	}
+	var out []Clause
+	x.root.clauses(&out)
+	return out
+}
+
+func evalLegacy(condition string, outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
 	if condition == "" {
 		return true, nil
 	}
@@ -39,6 +148,16 @@ func Evaluate(condition string, outcome runtime.Outcome, ctx *runtime.Context) (
 	return true, nil
 }
 
+func legacyClause(clause string) Clause {
+	for _, op := range []string{"!=", "="} {
+		if strings.Contains(clause, op) {
+			parts := strings.SplitN(clause, op, 2)
+			return Clause{Key: strings.TrimSpace(parts[0]), Op: op, Literal: strings.TrimSpace(parts[1])}
+		}
+	}
+	return Clause{Key: clause}
+}
+
 func evalClause(clause string, outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
 	if strings.Contains(clause, "!=") {
 		parts := strings.SplitN(clause, "!=", 2)
@@ -62,16 +181,20 @@ func evalClause(clause string, outcome runtime.Outcome, ctx *runtime.Context) (b
 		want = canonicalizeCompareValue(k, want)
 		return got == want, nil
 	}
-	// Bare key: truthy if non-empty and not "false"/"0" (best-effort).
-	got := resolveKey(strings.TrimSpace(clause), outcome, ctx)
-	if got == "" {
-		return false, nil
+	return truthy(resolveKey(strings.TrimSpace(clause), outcome, ctx)), nil
+}
+
+// truthy reports whether a bare key's value counts as set: non-empty and not
+// "false"/"0"/"no" (best-effort).
+func truthy(v string) bool {
+	if v == "" {
+		return false
 	}
-	switch strings.ToLower(got) {
+	switch strings.ToLower(v) {
 	case "false", "0", "no":
-		return false, nil
+		return false
 	default:
-		return true, nil
+		return true
 	}
 }
 
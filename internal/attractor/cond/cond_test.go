@@ -156,3 +156,126 @@ func TestEvaluate_OutcomeAliasesMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluate_ExtendedOperators(t *testing.T) {
+	ctx := runtime.NewContext()
+	ctx.Set("retries", 3)
+	ctx.Set("failed_tests", "0")
+	ctx.Set("failure_class", "transient_infra")
+	ctx.Set("summary", "2 tests failed in pkg/foo")
+	ctx.Set("flag", "false")
+
+	out := runtime.Outcome{Status: runtime.StatusFail, PreferredLabel: "Fix (retry)"}
+
+	cases := []struct {
+		cond string
+		want bool
+	}{
+		{"outcome=success || outcome=fail", true},
+		{"outcome=success || preferred_label=Yes", false},
+		{"outcome=fail && context.retries < 5", true},
+		{"context.retries<=3 && context.retries>=3", true},
+		{"context.retries > 3", false},
+		{"context.failed_tests > 0", false},
+		{"context.missing < 10", false},
+		{"context.summary < 10", false},
+		{"context.summary contains \"tests failed\"", true},
+		{"context.summary contains pkg/bar", false},
+		{"context.failure_class in [transient_infra, budget_exhausted]", true},
+		{"context.failure_class in ['deterministic']", false},
+		{"outcome in [success, failure]", true},
+		{"context.summary =~ ^[0-9]+ tests", true},
+		{"context.summary =~ 'pkg/(bar|baz)'", false},
+		{"!context.flag", true},
+		{"!(outcome=fail)", false},
+		{"!outcome=success && outcome!=success", true},
+		{"(outcome=success || outcome=fail) && context.retries < 4", true},
+		{"outcome=success || (outcome=fail && context.failure_class!=transient_infra)", false},
+		{"preferred_label=Fix (retry) || outcome=success", true},
+		{"(preferred_label=Fix (retry)) && context.retries>1", true},
+	}
+	for _, tc := range cases {
+		got, err := Evaluate(tc.cond, out, ctx)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error: %v", tc.cond, err)
+		}
+		if got != tc.want {
+			t.Fatalf("Evaluate(%q)=%v, want %v", tc.cond, got, tc.want)
+		}
+	}
+}
+
+func TestParse_ExtendedSyntaxErrors(t *testing.T) {
+	bad := []string{
+		"outcome>success",
+		"context.retries < ",
+		"(outcome=success",
+		"outcome=success ||",
+		"|| outcome=success",
+		"context.x in a, b",
+		"context.x in [a, b",
+		"context.x in [a,,b]",
+		"context.x =~ (",
+		"context.x contains",
+		"context.x contains 'open",
+		"!",
+		"()",
+	}
+	for _, c := range bad {
+		if _, err := Parse(c); err == nil {
+			t.Errorf("Parse(%q): expected error", c)
+		}
+		if _, err := Evaluate(c, runtime.Outcome{Status: runtime.StatusSuccess}, runtime.NewContext()); err == nil {
+			t.Errorf("Evaluate(%q): expected error", c)
+		}
+	}
+}
+
+// TestEvaluate_BaseGrammarUnchanged pins expressions that only use the base
+// grammar, including odd inputs the legacy splitter accepts, so the extended
+// parser never changes how existing graphs route.
+func TestEvaluate_BaseGrammarUnchanged(t *testing.T) {
+	ctx := runtime.NewContext()
+	ctx.Set("k", "a!=b")
+	out := runtime.Outcome{Status: runtime.StatusSuccess, PreferredLabel: "[Y] Yes"}
+
+	cases := []struct {
+		cond string
+		want bool
+	}{
+		{"=", true},
+		{"&&", true},
+		{"a && && b", false},
+		{"outcome=", false},
+		{"outcome=\"success\"", false},
+		{"preferred_label=[Y] Yes", true},
+		{"context.k=a!=b", true},
+		{"outcome=success&&preferred_label=[Y] Yes", true},
+	}
+	for _, tc := range cases {
+		if UsesExtendedSyntax(tc.cond) {
+			t.Fatalf("UsesExtendedSyntax(%q)=true, want base grammar", tc.cond)
+		}
+		got, err := Evaluate(tc.cond, out, ctx)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error: %v", tc.cond, err)
+		}
+		if got != tc.want {
+			t.Fatalf("Evaluate(%q)=%v, want %v", tc.cond, got, tc.want)
+		}
+	}
+}
+
+func TestExpr_Clauses(t *testing.T) {
+	x, err := Parse("!(outcome=fail || context.n >= 2) && context.tag in [a, b]")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := x.Clauses()
+	if len(got) != 3 {
+		t.Fatalf("clauses=%+v", got)
+	}
+	if got[0].Key != "outcome" || got[1].Op != ">=" || got[1].Literal != "2" || got[2].Op != "in" || len(got[2].List) != 2 {
+		t.Fatalf("clauses=%+v", got)
+	}
+}
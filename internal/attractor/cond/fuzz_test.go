@@ -71,6 +71,27 @@ func FuzzConditionEval(f *testing.F) {
 	f.Add("a && && b")          // double &&
 	f.Add("context.")           // incomplete context key
 
+	// Seeds from TestEvaluate_ExtendedOperators.
+	f.Add("outcome=success || outcome=fail")
+	f.Add("outcome=fail && context.retries < 5")
+	f.Add("context.retries<=3 && context.retries>=3")
+	f.Add("context.summary contains \"tests failed\"")
+	f.Add("context.failure_class in [transient_infra, budget_exhausted]")
+	f.Add("context.summary =~ ^[0-9]+ tests")
+	f.Add("!context.flag")
+	f.Add("!(outcome=fail)")
+	f.Add("(outcome=success || outcome=fail) && context.retries < 4")
+	f.Add("preferred_label=Fix (retry) || outcome=success")
+
+	// Seed: malformed extended inputs.
+	f.Add("(outcome=success")
+	f.Add("outcome=success ||")
+	f.Add("context.x in [a,,b]")
+	f.Add("context.x =~ (")
+	f.Add("context.x contains 'open")
+	f.Add("!!!")
+	f.Add("((((")
+
 	f.Fuzz(func(t *testing.T, condition string) {
 		// The invariant: Evaluate must never panic.
 		// It may return an error for malformed conditions — that is correct behavior.
@@ -89,7 +110,16 @@ func FuzzConditionEval(f *testing.F) {
 		ctx := runtime.NewContext()
 		ctx.Set("tests_passed", true)
 		ctx.Set("context.loop_state", "active")
+		ctx.Set("retries", 2)
 
 		_, _ = Evaluate(condition, out, ctx)
+
+		// Anything Parse accepts (and therefore lint accepts) must evaluate
+		// without error, or a graph that validates could fail at routing time.
+		if expr, err := Parse(condition); err == nil {
+			if _, err := expr.Eval(out, ctx); err != nil {
+				t.Fatalf("Parse(%q) succeeded but Eval failed: %v", condition, err)
+			}
+		}
 	})
 }
@@ -0,0 +1,379 @@
+package cond
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+const keyChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_.-"
+
+type node interface {
+	eval(outcome runtime.Outcome, ctx *runtime.Context) (bool, error)
+	clauses(out *[]Clause)
+}
+
+type orNode []node
+
+func (n orNode) eval(outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
+	for _, c := range n {
+		ok, err := c.eval(outcome, ctx)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (n orNode) clauses(out *[]Clause) {
+	for _, c := range n {
+		c.clauses(out)
+	}
+}
+
+type andNode []node
+
+func (n andNode) eval(outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
+	for _, c := range n {
+		ok, err := c.eval(outcome, ctx)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (n andNode) clauses(out *[]Clause) {
+	for _, c := range n {
+		c.clauses(out)
+	}
+}
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
+	ok, err := n.inner.eval(outcome, ctx)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+func (n notNode) clauses(out *[]Clause) { n.inner.clauses(out) }
+
+type clauseNode struct {
+	Clause
+	num float64
+	re  *regexp.Regexp
+}
+
+func (n *clauseNode) clauses(out *[]Clause) { *out = append(*out, n.Clause) }
+
+func (n *clauseNode) eval(outcome runtime.Outcome, ctx *runtime.Context) (bool, error) {
+	got := resolveKey(n.Key, outcome, ctx)
+	switch n.Op {
+	case "":
+		return truthy(got), nil
+	case "=":
+		return got == canonicalizeCompareValue(n.Key, n.Literal), nil
+	case "!=":
+		return got != canonicalizeCompareValue(n.Key, n.Literal), nil
+	case "contains":
+		return strings.Contains(got, n.Literal), nil
+	case "in":
+		for _, item := range n.List {
+			if got == canonicalizeCompareValue(n.Key, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "=~":
+		return n.re.MatchString(got), nil
+	case "<", "<=", ">", ">=":
+		v, err := strconv.ParseFloat(strings.TrimSpace(got), 64)
+		if err != nil {
+			return false, nil
+		}
+		switch n.Op {
+		case "<":
+			return v < n.num, nil
+		case "<=":
+			return v <= n.num, nil
+		case ">":
+			return v > n.num, nil
+		default:
+			return v >= n.num, nil
+		}
+	}
+	return false, fmt.Errorf("invalid operator %q", n.Op)
+}
+
+type parser struct {
+	src   string
+	pos   int
+	depth int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid condition %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	out := orNode{first}
+	for p.consume("||") {
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, next)
+	}
+	if len(out) == 1 {
+		return first, nil
+	}
+	return out, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	out := andNode{first}
+	for p.consume("&&") {
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, next)
+	}
+	if len(out) == 1 {
+		return first, nil
+	}
+	return out, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], "!") && !strings.HasPrefix(p.src[p.pos:], "!=") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	}
+	if p.consume("(") {
+		p.depth++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("missing ')'")
+		}
+		p.depth--
+		return inner, nil
+	}
+	return p.parseClause()
+}
+
+func (p *parser) parseClause() (node, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && strings.IndexByte(keyChars, p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	key := p.src[start:p.pos]
+	if key == "" {
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+		return nil, p.errorf("expected key, found %q", p.src[p.pos:p.pos+1])
+	}
+	n := &clauseNode{Clause: Clause{Key: key}}
+
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	switch {
+	case hasWord(rest, "in"):
+		p.pos += len("in")
+		n.Op = "in"
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		n.List = list
+		return n, nil
+	case hasWord(rest, "contains"):
+		n.Op = "contains"
+	case strings.HasPrefix(rest, "=~"):
+		n.Op = "=~"
+	case strings.HasPrefix(rest, "!="):
+		n.Op = "!="
+	case strings.HasPrefix(rest, "<="):
+		n.Op = "<="
+	case strings.HasPrefix(rest, ">="):
+		n.Op = ">="
+	case strings.HasPrefix(rest, "<"):
+		n.Op = "<"
+	case strings.HasPrefix(rest, ">"):
+		n.Op = ">"
+	case strings.HasPrefix(rest, "="):
+		n.Op = "="
+	default:
+		// Bare key: truthiness check.
+		return n, nil
+	}
+	p.pos += len(n.Op)
+
+	lit, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	if lit == "" && n.Op != "=" && n.Op != "!=" {
+		return nil, p.errorf("missing literal after %q", n.Op)
+	}
+	n.Literal = lit
+	switch n.Op {
+	case "=~":
+		re, err := regexp.Compile(lit)
+		if err != nil {
+			return nil, p.errorf("invalid regexp %q: %v", lit, err)
+		}
+		n.re = re
+	case "<", "<=", ">", ">=":
+		v, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, p.errorf("operator %q requires a numeric literal, got %q", n.Op, lit)
+		}
+		n.num = v
+	}
+	return n, nil
+}
+
+// parseLiteral reads a quoted literal, or raw text up to the next '&&', '||',
+// or a ')' that closes an enclosing group. Parentheses balanced within the
+// literal itself are kept, so labels like "Fix (retry)" need no quoting.
+func (p *parser) parseLiteral() (string, error) {
+	p.skipSpace()
+	if !p.eof() && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		return p.parseQuoted()
+	}
+	start := p.pos
+	nested := 0
+	for !p.eof() {
+		rest := p.src[p.pos:]
+		if strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||") {
+			break
+		}
+		switch rest[0] {
+		case '(':
+			nested++
+		case ')':
+			if nested == 0 && p.depth > 0 {
+				return strings.TrimSpace(p.src[start:p.pos]), nil
+			}
+			if nested > 0 {
+				nested--
+			}
+		}
+		p.pos++
+	}
+	return strings.TrimSpace(p.src[start:p.pos]), nil
+}
+
+func (p *parser) parseQuoted() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for !p.eof() {
+		ch := p.src[p.pos]
+		p.pos++
+		switch {
+		case ch == '\\' && !p.eof():
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		case ch == quote:
+			return b.String(), nil
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", p.errorf("unterminated quoted literal")
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if !p.consume("[") {
+		return nil, p.errorf("'in' requires a [..] list")
+	}
+	var items []string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("missing ']'")
+		}
+		var item string
+		if p.src[p.pos] == '"' || p.src[p.pos] == '\'' {
+			q, err := p.parseQuoted()
+			if err != nil {
+				return nil, err
+			}
+			item = q
+		} else {
+			start := p.pos
+			for !p.eof() && p.src[p.pos] != ',' && p.src[p.pos] != ']' {
+				p.pos++
+			}
+			item = strings.TrimSpace(p.src[start:p.pos])
+			if item == "" {
+				return nil, p.errorf("empty list item")
+			}
+		}
+		items = append(items, item)
+		if p.consume(",") {
+			continue
+		}
+		if p.consume("]") {
+			return items, nil
+		}
+		return nil, p.errorf("expected ',' or ']' in list")
+	}
+}
+
+func hasWord(s, word string) bool {
+	if !strings.HasPrefix(s, word) {
+		return false
+	}
+	if len(s) == len(word) {
+		return true
+	}
+	return strings.IndexByte(keyChars, s[len(word)]) < 0
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
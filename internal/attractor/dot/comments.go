@@ -47,9 +47,13 @@ func stripComments(src []byte) ([]byte, error) {
 				continue
 			}
 			if next == '*' {
-				// Block comment: skip until closing */.
+				// Block comment: skip until closing */, keeping newlines so
+				// line numbers still match the original source.
 				i += 2
 				for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+					if src[i] == '\n' {
+						out = append(out, '\n')
+					}
 					i++
 				}
 				if i+1 >= len(src) {
@@ -1,6 +1,7 @@
 package dot
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 )
@@ -67,6 +68,14 @@ func (l *lexer) next() (token, error) {
 	return token{}, fmt.Errorf("dot lexer: unexpected character %q at %d", ch, l.i)
 }
 
+// line returns the 1-based line of byte offset pos.
+func (l *lexer) line(pos int) int {
+	if pos > len(l.src) {
+		pos = len(l.src)
+	}
+	return 1 + bytes.Count(l.src[:pos], []byte{'\n'})
+}
+
 func (l *lexer) skipSpace() {
 	for l.i < len(l.src) {
 		r := rune(l.src[l.i])
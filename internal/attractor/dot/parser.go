@@ -249,6 +249,7 @@ func (p *parser) parseStatements(g *model.Graph, sc *scope) error {
 				continue
 			}
 
+			pos := model.Position{Line: p.lx.line(tok.pos)}
 			if p.peek.typ == tokenSymbol && p.peek.lit == "->" {
 				// Edge statement.
 				from := tok.lit
@@ -289,6 +290,7 @@ func (p *parser) parseStatements(g *model.Graph, sc *scope) error {
 
 				for i := 0; i+1 < len(chain); i++ {
 					e := model.NewEdge(chain[i], chain[i+1])
+					e.Pos = pos
 					// Defaults first, then explicit attrs.
 					for k, v := range sc.edgeDefaults {
 						e.Attrs[k] = v
@@ -317,6 +319,7 @@ func (p *parser) parseStatements(g *model.Graph, sc *scope) error {
 
 			n := model.NewNode(tok.lit)
 			n.Order = len(g.Nodes)
+			n.Pos = pos
 			for k, v := range sc.nodeDefaults {
 				n.Attrs[k] = v
 			}
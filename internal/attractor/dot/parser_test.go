@@ -155,3 +155,28 @@ func contains(xs []string, want string) bool {
 }
 
 var _ = model.Graph{} // keep the import honest as the package evolves
+
+func TestParse_RecordsDeclarationLines(t *testing.T) {
+	src := []byte(`digraph P {
+    /* block
+       comment */
+    start [shape=Mdiamond]
+    work  [prompt="do it"]
+    start -> work
+    work -> exit
+    exit  [shape=Msquare]
+}
+`)
+	g, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	for id, want := range map[string]int{"start": 4, "work": 5, "exit": 8} {
+		if got := g.Nodes[id].Pos.Line; got != want {
+			t.Fatalf("%s line: got %d want %d", id, got, want)
+		}
+	}
+	if got := g.Edges[1].Pos.Line; got != 7 {
+		t.Fatalf("edge work->exit line: got %d want 7", got)
+	}
+}
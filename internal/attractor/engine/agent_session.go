@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// readOnlyAgentTools are the tools a ReadOnly session may call.
+var readOnlyAgentTools = map[string]bool{
+	"read_file":       true,
+	"read_many_files": true,
+	"list_dir":        true,
+	"grep":            true,
+	"glob":            true,
+}
+
+// AgentSessionOptions configures an agent session that runs outside a
+// pipeline, such as the ones `attractor ingest` and `attractor review` use.
+type AgentSessionOptions struct {
+	Provider string
+	Model    string
+	WorkDir  string
+	// MaxToolRounds bounds tool rounds per input; zero keeps the agent default.
+	MaxToolRounds int
+	// ReadOnly restricts the session to tools that inspect WorkDir.
+	ReadOnly bool
+	// SystemPrompt is appended to the provider profile's system prompt.
+	SystemPrompt string
+	// Client replaces the API client built from the run config (tests).
+	Client *llm.Client
+}
+
+// NewAgentSession starts an agent session against an API-backend provider
+// from cfg. cfg may be nil when opts.Client is set and the provider is one of
+// the built-in openai/anthropic/google profiles.
+func NewAgentSession(cfg *RunConfigFile, opts AgentSessionOptions) (*agent.Session, error) {
+	provider := normalizeProviderKey(opts.Provider)
+	if provider == "" {
+		return nil, fmt.Errorf("provider is required")
+	}
+	if strings.TrimSpace(opts.Model) == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	runtimes, err := resolveProviderRuntimes(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile agent.ProviderProfile
+	rt, ok := runtimes[provider]
+	switch {
+	case ok && rt.Backend != BackendAPI:
+		return nil, fmt.Errorf("llm.providers.%s must use backend=api (got %q)", provider, rt.Backend)
+	case ok:
+		profile, err = profileForRuntimeProvider(rt, opts.Model)
+	case opts.Client != nil:
+		profile, err = profileForProvider(provider, opts.Model)
+	default:
+		return nil, fmt.Errorf("provider %q is not configured under llm.providers", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := opts.Client
+	if client == nil {
+		if env := strings.TrimSpace(rt.API.DefaultAPIKeyEnv); env != "" && strings.TrimSpace(os.Getenv(env)) == "" {
+			return nil, fmt.Errorf("provider %s: %s is not set", provider, env)
+		}
+		if client, err = newAPIClientFromProviderRuntimes(runtimes); err != nil {
+			return nil, err
+		}
+	}
+
+	sessCfg := agent.SessionConfig{
+		MaxToolRoundsPerInput:   opts.MaxToolRounds,
+		UserInstructionOverride: opts.SystemPrompt,
+	}
+	if opts.ReadOnly {
+		sessCfg.ToolCallFilter = func(toolName, _, _ string) string {
+			if readOnlyAgentTools[toolName] {
+				return ""
+			}
+			return fmt.Sprintf("tool %s is not available in this read-only session", toolName)
+		}
+	}
+	return agent.NewSession(client, profile, agent.NewLocalExecutionEnvironment(opts.WorkDir), sessCfg)
+}
@@ -0,0 +1,412 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// failureClassCostBudgetExhausted marks outcomes that were refused because a
+// configured spend cap (RunConfigFile.Budget) was reached. Unlike
+// failureClassBudgetExhausted (a model running out of turns/tokens inside one
+// call), retrying or escalating cannot help, so it is neither retryable nor
+// escalatable.
+const failureClassCostBudgetExhausted = "cost_budget_exhausted"
+
+const (
+	budgetScopeRun  = "run"
+	budgetScopeNode = "node"
+)
+
+// budgetTracker accumulates LLM token usage and estimated cost for a run and
+// enforces the run-wide and per-node caps. One tracker is shared by the main
+// engine and every branch/child engine it spawns. Per-node totals are keyed by
+// node ID and accumulate across retries and repeat visits.
+type budgetTracker struct {
+	mu      sync.Mutex
+	cfg     BudgetConfig
+	catalog *modeldb.Catalog
+	total   runtime.UsageTotals
+	nodes   map[string]runtime.UsageTotals
+}
+
+func newBudgetTracker(cfg BudgetConfig, catalog *modeldb.Catalog) *budgetTracker {
+	return &budgetTracker{
+		cfg:     cfg,
+		catalog: catalog,
+		nodes:   map[string]runtime.UsageTotals{},
+	}
+}
+
+// record adds one LLM call to the run and node totals. Cost is estimated from
+// the model catalog's per-token pricing; calls for unpriced models are counted
+// in UnpricedCalls and add tokens but no cost.
+func (b *budgetTracker) record(nodeID string, provider string, modelID string, inputTokens int64, outputTokens int64) {
+	if b == nil {
+		return
+	}
+	if inputTokens < 0 {
+		inputTokens = 0
+	}
+	if outputTokens < 0 {
+		outputTokens = 0
+	}
+	cost, priced := b.estimateCost(provider, modelID, inputTokens, outputTokens)
+	add := runtime.UsageTotals{
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		CostUSD:      cost,
+		Calls:        1,
+	}
+	if !priced {
+		add.UnpricedCalls = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = addUsageTotals(b.total, add)
+	nodeID = strings.TrimSpace(nodeID)
+	if nodeID != "" {
+		b.nodes[nodeID] = addUsageTotals(b.nodes[nodeID], add)
+	}
+}
+
+func (b *budgetTracker) estimateCost(provider string, modelID string, inputTokens int64, outputTokens int64) (float64, bool) {
+	entry, ok := modeldb.FindProviderModel(b.catalog, provider, modelID)
+	if !ok || entry.InputCostPerToken == nil || entry.OutputCostPerToken == nil {
+		return 0, false
+	}
+	cost := float64(inputTokens) * (*entry.InputCostPerToken)
+	cost += float64(outputTokens) * (*entry.OutputCostPerToken)
+	return cost, true
+}
+
+// check returns a *budgetExhaustedError when the run-wide caps or the caps for
+// nodeID have been reached, and nil while there is budget left.
+func (b *budgetTracker) check(nodeID string) *budgetExhaustedError {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if reason := budgetLimitReason(b.cfg.BudgetLimits, b.total); reason != "" {
+		return &budgetExhaustedError{Scope: budgetScopeRun, NodeID: nodeID, Reason: reason}
+	}
+	nodeID = strings.TrimSpace(nodeID)
+	if nodeID == "" {
+		return nil
+	}
+	if reason := budgetLimitReason(b.nodeLimitsLocked(nodeID), b.nodes[nodeID]); reason != "" {
+		return &budgetExhaustedError{Scope: budgetScopeNode, NodeID: nodeID, Reason: reason}
+	}
+	return nil
+}
+
+// runExhausted reports whether a run-wide cap has been reached.
+func (b *budgetTracker) runExhausted() (string, bool) {
+	if b == nil {
+		return "", false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reason := budgetLimitReason(b.cfg.BudgetLimits, b.total)
+	return reason, reason != ""
+}
+
+// nodeLimitsLocked merges budget.per_node with any budget.nodes.<id> override;
+// override fields win individually. Caller must hold b.mu.
+func (b *budgetTracker) nodeLimitsLocked(nodeID string) BudgetLimits {
+	limits := b.cfg.PerNode
+	override, ok := b.cfg.Nodes[nodeID]
+	if !ok {
+		return limits
+	}
+	if override.MaxUSD != nil {
+		limits.MaxUSD = override.MaxUSD
+	}
+	if override.MaxInputTokens != nil {
+		limits.MaxInputTokens = override.MaxInputTokens
+	}
+	if override.MaxOutputTokens != nil {
+		limits.MaxOutputTokens = override.MaxOutputTokens
+	}
+	return limits
+}
+
+func (b *budgetTracker) nodeUsage(nodeID string) runtime.UsageTotals {
+	if b == nil {
+		return runtime.UsageTotals{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nodes[strings.TrimSpace(nodeID)]
+}
+
+func (b *budgetTracker) totalUsage() runtime.UsageTotals {
+	if b == nil {
+		return runtime.UsageTotals{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// snapshot returns a copy of the accumulated usage, or nil when no tracker is
+// configured.
+func (b *budgetTracker) snapshot() *runtime.RunUsage {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := &runtime.RunUsage{UsageTotals: b.total}
+	if len(b.nodes) > 0 {
+		out.Nodes = make(map[string]runtime.UsageTotals, len(b.nodes))
+		for id, u := range b.nodes {
+			out.Nodes[id] = u
+		}
+	}
+	return out
+}
+
+// restore seeds the tracker with usage persisted by an earlier process (resume)
+// so caps keep counting spend from before the restart.
+func (b *budgetTracker) restore(u *runtime.RunUsage) {
+	if b == nil || u == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = u.UsageTotals
+	b.nodes = map[string]runtime.UsageTotals{}
+	for id, nu := range u.Nodes {
+		b.nodes[id] = nu
+	}
+}
+
+func addUsageTotals(a runtime.UsageTotals, b runtime.UsageTotals) runtime.UsageTotals {
+	return runtime.UsageTotals{
+		InputTokens:   a.InputTokens + b.InputTokens,
+		OutputTokens:  a.OutputTokens + b.OutputTokens,
+		CostUSD:       a.CostUSD + b.CostUSD,
+		Calls:         a.Calls + b.Calls,
+		UnpricedCalls: a.UnpricedCalls + b.UnpricedCalls,
+	}
+}
+
+// budgetLimitReason returns a human-readable description of the first cap in
+// limits that usage has reached, or "" when all caps have headroom.
+func budgetLimitReason(limits BudgetLimits, usage runtime.UsageTotals) string {
+	if limits.MaxUSD != nil && usage.CostUSD >= *limits.MaxUSD {
+		return fmt.Sprintf("cost $%.4f reached max_usd $%.4f", usage.CostUSD, *limits.MaxUSD)
+	}
+	if limits.MaxInputTokens != nil && usage.InputTokens >= *limits.MaxInputTokens {
+		return fmt.Sprintf("input tokens %d reached max_input_tokens %d", usage.InputTokens, *limits.MaxInputTokens)
+	}
+	if limits.MaxOutputTokens != nil && usage.OutputTokens >= *limits.MaxOutputTokens {
+		return fmt.Sprintf("output tokens %d reached max_output_tokens %d", usage.OutputTokens, *limits.MaxOutputTokens)
+	}
+	return ""
+}
+
+// budgetExhaustedError is returned instead of making an LLM call once a spend
+// cap has been reached. It implements llm.Error as non-retryable so llm.Retry
+// and agent sessions give up immediately.
+type budgetExhaustedError struct {
+	Scope  string
+	NodeID string
+	Reason string
+}
+
+func (e *budgetExhaustedError) Error() string {
+	if e.Scope == budgetScopeNode {
+		return fmt.Sprintf("llm spend cap reached for node %s: %s", e.NodeID, e.Reason)
+	}
+	return fmt.Sprintf("llm spend cap reached for run: %s", e.Reason)
+}
+
+func (e *budgetExhaustedError) Provider() string           { return "" }
+func (e *budgetExhaustedError) StatusCode() int            { return 0 }
+func (e *budgetExhaustedError) Retryable() bool            { return false }
+func (e *budgetExhaustedError) RetryAfter() *time.Duration { return nil }
+
+// budgetExhaustedOutcome is the stage outcome for a node refused by a spend cap.
+func budgetExhaustedOutcome(err *budgetExhaustedError) runtime.Outcome {
+	return runtime.Outcome{
+		Status:        runtime.StatusFail,
+		FailureReason: err.Error(),
+		Meta: map[string]any{
+			"failure_class":     failureClassCostBudgetExhausted,
+			"failure_signature": fmt.Sprintf("cost_budget_exhausted|%s|%s", err.Scope, err.NodeID),
+			"budget_scope":      err.Scope,
+		},
+		ContextUpdates: map[string]any{"failure_class": failureClassCostBudgetExhausted},
+	}
+}
+
+type budgetScopeKey struct{}
+
+type budgetScope struct {
+	tracker *budgetTracker
+	nodeID  string
+}
+
+// withBudgetScope attaches the tracker and node ID to ctx so the API client
+// middleware can attribute usage and refuse calls once a cap is reached.
+func withBudgetScope(ctx context.Context, tracker *budgetTracker, nodeID string) context.Context {
+	if tracker == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetScopeKey{}, budgetScope{tracker: tracker, nodeID: nodeID})
+}
+
+func budgetScopeFromContext(ctx context.Context) (budgetScope, bool) {
+	if ctx == nil {
+		return budgetScope{}, false
+	}
+	scope, ok := ctx.Value(budgetScopeKey{}).(budgetScope)
+	return scope, ok && scope.tracker != nil
+}
+
+// newBudgetMiddleware returns client middleware that enforces the spend caps
+// before each call and records token usage after it. Calls made without a
+// budget scope on the context pass through untouched.
+func newBudgetMiddleware() llm.Middleware {
+	return llm.MiddlewareFunc{
+		Complete: func(ctx context.Context, req llm.Request, next llm.CompleteFunc) (llm.Response, error) {
+			scope, ok := budgetScopeFromContext(ctx)
+			if !ok {
+				return next(ctx, req)
+			}
+			if err := scope.tracker.check(scope.nodeID); err != nil {
+				return llm.Response{}, err
+			}
+			resp, err := next(ctx, req)
+			if err != nil {
+				return resp, err
+			}
+			scope.tracker.record(scope.nodeID, firstNonEmpty(resp.Provider, req.Provider), firstNonEmpty(resp.Model, req.Model), int64(resp.Usage.InputTokens), int64(resp.Usage.OutputTokens))
+			return resp, nil
+		},
+		Stream: func(ctx context.Context, req llm.Request, next llm.StreamFunc) (llm.Stream, error) {
+			scope, ok := budgetScopeFromContext(ctx)
+			if !ok {
+				return next(ctx, req)
+			}
+			if err := scope.tracker.check(scope.nodeID); err != nil {
+				return nil, err
+			}
+			inner, err := next(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			out := llm.NewChanStream(func() { _ = inner.Close() })
+			go func() {
+				defer out.CloseSend()
+				for ev := range inner.Events() {
+					if ev.Type == llm.StreamEventFinish && ev.Usage != nil {
+						provider, modelID := req.Provider, req.Model
+						if ev.Response != nil {
+							provider = firstNonEmpty(ev.Response.Provider, provider)
+							modelID = firstNonEmpty(ev.Response.Model, modelID)
+						}
+						scope.tracker.record(scope.nodeID, provider, modelID, int64(ev.Usage.InputTokens), int64(ev.Usage.OutputTokens))
+					}
+					out.Send(ev)
+				}
+			}()
+			return out, nil
+		},
+	}
+}
+
+// recordCLIUsage sums the usage reported in a CLI's JSON stdout log and records
+// it as one call. Claude stream-json repeats an assistant message once per
+// content block, so its usage is de-duplicated by message ID; Codex reports
+// usage once per turn.completed event.
+func recordCLIUsage(tracker *budgetTracker, nodeID string, provider string, modelID string, stdoutLog []byte) {
+	if tracker == nil || len(stdoutLog) == 0 {
+		return
+	}
+	byMessage := map[string]cliUsage{}
+	var total cliUsage
+	seen := false
+	for _, line := range bytes.Split(stdoutLog, []byte("\n")) {
+		ev, err := parseCLIStreamLine(line)
+		if err != nil || ev == nil {
+			continue
+		}
+		switch {
+		case ev.Type == "assistant" && ev.Message != nil && ev.Message.Usage != nil:
+			seen = true
+			if id := strings.TrimSpace(ev.Message.ID); id != "" {
+				byMessage[id] = *ev.Message.Usage
+				continue
+			}
+			total.InputTokens += ev.Message.Usage.InputTokens
+			total.OutputTokens += ev.Message.Usage.OutputTokens
+		case ev.Type == "turn.completed" && ev.Usage != nil:
+			seen = true
+			total.InputTokens += ev.Usage.InputTokens
+			total.OutputTokens += ev.Usage.OutputTokens
+		}
+	}
+	if !seen {
+		return
+	}
+	for _, u := range byMessage {
+		total.InputTokens += u.InputTokens
+		total.OutputTokens += u.OutputTokens
+	}
+	tracker.record(nodeID, provider, modelID, total.InputTokens, total.OutputTokens)
+}
+
+// reportStageUsage emits a stage_usage progress event and CXDB turn when the
+// stage recorded LLM usage since before was captured. Node figures are
+// cumulative for the node ID; run figures are cumulative for the run.
+func (e *Engine) reportStageUsage(ctx context.Context, nodeID string, before runtime.UsageTotals) {
+	if e == nil || e.budget == nil {
+		return
+	}
+	node := e.budget.nodeUsage(nodeID)
+	if node.Calls == before.Calls {
+		return
+	}
+	total := e.budget.totalUsage()
+	e.appendProgress(map[string]any{
+		"event":             "stage_usage",
+		"node_id":           nodeID,
+		"input_tokens":      node.InputTokens,
+		"output_tokens":     node.OutputTokens,
+		"cost_usd":          node.CostUSD,
+		"calls":             node.Calls,
+		"unpriced_calls":    node.UnpricedCalls,
+		"run_input_tokens":  total.InputTokens,
+		"run_output_tokens": total.OutputTokens,
+		"run_cost_usd":      total.CostUSD,
+	})
+	e.cxdbStageUsage(ctx, nodeID, node, total)
+}
+
+func (e *Engine) appendBudgetExhausted(err *budgetExhaustedError) {
+	if e == nil || err == nil {
+		return
+	}
+	total := e.budget.totalUsage()
+	e.appendProgress(map[string]any{
+		"event":         "budget_exhausted",
+		"node_id":       err.NodeID,
+		"scope":         err.Scope,
+		"reason":        err.Reason,
+		"run_cost_usd":  total.CostUSD,
+		"input_tokens":  total.InputTokens,
+		"output_tokens": total.OutputTokens,
+	})
+}
@@ -0,0 +1,444 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+func budgetTestCatalog() *modeldb.Catalog {
+	in := 0.000002
+	out := 0.00001
+	return &modeldb.Catalog{Models: map[string]modeldb.ModelEntry{
+		"openai/gpt-5": {Provider: "openai", InputCostPerToken: &in, OutputCostPerToken: &out},
+	}}
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestBudgetTracker_RecordsCostFromCatalogPricing(t *testing.T) {
+	b := newBudgetTracker(BudgetConfig{}, budgetTestCatalog())
+	b.record("impl", "openai", "gpt-5", 1000, 100)
+	b.record("impl", "openai", "unknown-model", 500, 50)
+	b.record("review", "openai", "openai/gpt-5", 1000, 0)
+
+	total := b.totalUsage()
+	if total.InputTokens != 2500 || total.OutputTokens != 150 || total.Calls != 3 {
+		t.Fatalf("total=%+v", total)
+	}
+	if total.UnpricedCalls != 1 {
+		t.Fatalf("unpriced_calls=%d want 1", total.UnpricedCalls)
+	}
+	// 1000*2e-6 + 100*1e-5 + 1000*2e-6 = 0.005
+	if diff := total.CostUSD - 0.005; diff > 1e-12 || diff < -1e-12 {
+		t.Fatalf("cost_usd=%v want 0.005", total.CostUSD)
+	}
+	impl := b.nodeUsage("impl")
+	if impl.Calls != 2 || impl.InputTokens != 1500 {
+		t.Fatalf("impl usage=%+v", impl)
+	}
+}
+
+func TestBudgetTracker_CheckRunAndNodeCaps(t *testing.T) {
+	cfg := BudgetConfig{
+		BudgetLimits: BudgetLimits{MaxUSD: float64Ptr(1)},
+		PerNode:      BudgetLimits{MaxInputTokens: int64Ptr(1000)},
+		Nodes: map[string]BudgetLimits{
+			"big": {MaxInputTokens: int64Ptr(5000)},
+		},
+	}
+	b := newBudgetTracker(cfg, budgetTestCatalog())
+	b.record("small", "openai", "gpt-5", 1000, 0)
+	b.record("big", "openai", "gpt-5", 1000, 0)
+
+	if err := b.check("small"); err == nil || err.Scope != budgetScopeNode {
+		t.Fatalf("small: got %v want node-scope exhaustion", err)
+	}
+	if err := b.check("big"); err != nil {
+		t.Fatalf("big: override should leave headroom, got %v", err)
+	}
+
+	b.record("big", "openai", "gpt-5", 0, 100000) // $1.00 of output
+	err := b.check("big")
+	if err == nil || err.Scope != budgetScopeRun {
+		t.Fatalf("big: got %v want run-scope exhaustion", err)
+	}
+	if !strings.Contains(err.Error(), "max_usd") {
+		t.Fatalf("error=%q want max_usd reason", err.Error())
+	}
+	if _, exhausted := b.runExhausted(); !exhausted {
+		t.Fatalf("runExhausted=false want true")
+	}
+}
+
+func TestBudgetTracker_NilIsInert(t *testing.T) {
+	var b *budgetTracker
+	b.record("a", "openai", "gpt-5", 10, 10)
+	if err := b.check("a"); err != nil {
+		t.Fatalf("nil tracker check: %v", err)
+	}
+	if b.snapshot() != nil {
+		t.Fatalf("nil tracker snapshot should be nil")
+	}
+}
+
+type usageAdapter struct {
+	name  string
+	calls atomic.Int32
+}
+
+func (a *usageAdapter) Name() string { return a.name }
+func (a *usageAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	_ = ctx
+	a.calls.Add(1)
+	return llm.Response{
+		Provider: a.name,
+		Model:    req.Model,
+		Message:  llm.Assistant("ok"),
+		Usage:    llm.Usage{InputTokens: 600, OutputTokens: 40, TotalTokens: 640},
+	}, nil
+}
+func (a *usageAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	_ = ctx
+	s := llm.NewChanStream(nil)
+	go func() {
+		defer s.CloseSend()
+		a.calls.Add(1)
+		resp := llm.Response{Provider: a.name, Model: req.Model, Usage: llm.Usage{InputTokens: 600, OutputTokens: 40}}
+		s.Send(llm.StreamEvent{Type: llm.StreamEventFinish, Usage: &resp.Usage, Response: &resp})
+	}()
+	return s, nil
+}
+
+func TestBudgetMiddleware_RecordsUsageAndRefusesOnceCapped(t *testing.T) {
+	adapter := &usageAdapter{name: "openai"}
+	client := llm.NewClient()
+	client.Register(adapter)
+	client.Use(newBudgetMiddleware())
+
+	b := newBudgetTracker(BudgetConfig{BudgetLimits: BudgetLimits{MaxInputTokens: int64Ptr(1000)}}, budgetTestCatalog())
+	ctx := withBudgetScope(context.Background(), b, "impl")
+	req := llm.Request{Provider: "openai", Model: "gpt-5", Messages: []llm.Message{llm.User("hi")}}
+
+	if _, err := client.Complete(ctx, req); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if _, err := client.Complete(ctx, req); err != nil {
+		t.Fatalf("second call: %v", err)
+	}
+	_, err := client.Complete(ctx, req)
+	var be *budgetExhaustedError
+	if !errors.As(err, &be) {
+		t.Fatalf("third call: got %v want budgetExhaustedError", err)
+	}
+	if adapter.calls.Load() != 2 {
+		t.Fatalf("adapter calls=%d want 2 (capped call must not reach provider)", adapter.calls.Load())
+	}
+	if got := b.nodeUsage("impl"); got.InputTokens != 1200 || got.Calls != 2 {
+		t.Fatalf("impl usage=%+v", got)
+	}
+
+	// The refusal is final: not retried by llm.Retry, not failed over, and
+	// classified as a cost budget failure.
+	if shouldFailoverLLMError(err) {
+		t.Fatalf("budget exhaustion must not trigger failover")
+	}
+	if cls, _ := classifyAPIError(err); cls != failureClassCostBudgetExhausted {
+		t.Fatalf("failure class=%q want %q", cls, failureClassCostBudgetExhausted)
+	}
+	retryCalls := 0
+	_, rerr := llm.Retry(context.Background(), llm.RetryPolicy{MaxRetries: 3}, nil, nil, func() (llm.Response, error) {
+		retryCalls++
+		return client.Complete(ctx, req)
+	})
+	if rerr == nil || retryCalls != 1 {
+		t.Fatalf("llm.Retry calls=%d err=%v; want 1 call and an error", retryCalls, rerr)
+	}
+}
+
+func TestBudgetMiddleware_RecordsStreamUsage(t *testing.T) {
+	client := llm.NewClient()
+	client.Register(&usageAdapter{name: "openai"})
+	client.Use(newBudgetMiddleware())
+
+	b := newBudgetTracker(BudgetConfig{}, budgetTestCatalog())
+	ctx := withBudgetScope(context.Background(), b, "impl")
+	st, err := client.Stream(ctx, llm.Request{Provider: "openai", Model: "gpt-5", Messages: []llm.Message{llm.User("hi")}})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	for range st.Events() {
+	}
+	_ = st.Close()
+	if got := b.totalUsage(); got.InputTokens != 600 || got.OutputTokens != 40 || got.Calls != 1 {
+		t.Fatalf("usage=%+v", got)
+	}
+}
+
+func TestRecordCLIUsage_DedupesClaudeMessagesAndSumsCodexTurns(t *testing.T) {
+	claude := strings.Join([]string{
+		`{"type":"system","subtype":"init"}`,
+		`{"type":"assistant","message":{"id":"m1","model":"gpt-5","content":[{"type":"text","text":"a"}],"usage":{"input_tokens":100,"output_tokens":5}}}`,
+		`{"type":"assistant","message":{"id":"m1","model":"gpt-5","content":[{"type":"tool_use","id":"t1","name":"Bash"}],"usage":{"input_tokens":100,"output_tokens":20}}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]}}`,
+		`{"type":"assistant","message":{"id":"m2","model":"gpt-5","content":[{"type":"text","text":"done"}],"usage":{"input_tokens":200,"output_tokens":10}}}`,
+		`{"type":"result","usage":{"input_tokens":300,"output_tokens":30}}`,
+	}, "\n")
+	b := newBudgetTracker(BudgetConfig{}, budgetTestCatalog())
+	recordCLIUsage(b, "impl", "openai", "gpt-5", []byte(claude))
+	if got := b.nodeUsage("impl"); got.InputTokens != 300 || got.OutputTokens != 30 || got.Calls != 1 {
+		t.Fatalf("claude usage=%+v want 300/30 in one call", got)
+	}
+
+	codex := strings.Join([]string{
+		`{"type":"thread.started","thread_id":"x"}`,
+		`{"type":"turn.completed","usage":{"input_tokens":50,"cached_input_tokens":10,"output_tokens":7}}`,
+		`{"type":"turn.completed","usage":{"input_tokens":60,"output_tokens":8}}`,
+	}, "\n")
+	b = newBudgetTracker(BudgetConfig{}, budgetTestCatalog())
+	recordCLIUsage(b, "impl", "openai", "gpt-5", []byte(codex))
+	if got := b.nodeUsage("impl"); got.InputTokens != 110 || got.OutputTokens != 15 {
+		t.Fatalf("codex usage=%+v want 110/15", got)
+	}
+
+	b = newBudgetTracker(BudgetConfig{}, budgetTestCatalog())
+	recordCLIUsage(b, "impl", "openai", "gpt-5", []byte("plain text output\n"))
+	if got := b.totalUsage(); got.Calls != 0 {
+		t.Fatalf("non-json output should record nothing, got %+v", got)
+	}
+}
+
+// usageRecordingBackend stands in for a provider backend: every call records
+// fixed usage against the stage's node so the engine's caps can be exercised.
+type usageRecordingBackend struct {
+	calls map[string]int
+}
+
+func (b *usageRecordingBackend) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+	_ = ctx
+	_ = prompt
+	b.calls[node.ID]++
+	exec.Engine.budget.record(node.ID, "openai", "gpt-5", 1000, 100)
+	return "ok", &runtime.Outcome{Status: runtime.StatusSuccess}, nil
+}
+
+func newBudgetTestEngine(t *testing.T, dot string, budget BudgetConfig) (*Engine, *usageRecordingBackend) {
+	t.Helper()
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	g, _, err := Prepare([]byte(dot))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	opts := RunOptions{RepoPath: repo, RunID: "budget", LogsRoot: t.TempDir()}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	backend := &usageRecordingBackend{calls: map[string]int{}}
+	eng := newBaseEngine(g, []byte(dot), opts)
+	eng.CodergenBackend = backend
+	eng.budget = newBudgetTracker(budget, budgetTestCatalog())
+	return eng, backend
+}
+
+func progressEventsOfType(t *testing.T, logsRoot string, event string) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, ev := range readProgressEvents(t, filepath.Join(logsRoot, "progress.ndjson")) {
+		if ev["event"] == event {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func TestRun_RunBudgetExhaustedStopsBeforeNextLLMStage(t *testing.T) {
+	dot := `
+digraph G {
+  start [shape=Mdiamond]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5, prompt="a"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5, prompt="b"]
+  exit [shape=Msquare]
+  start -> a -> b -> exit
+}
+`
+	eng, backend := newBudgetTestEngine(t, dot, BudgetConfig{BudgetLimits: BudgetLimits{MaxInputTokens: int64Ptr(1000)}})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := eng.run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "spend cap reached") {
+		t.Fatalf("run error=%v want spend cap abort", err)
+	}
+	if backend.calls["a"] != 1 || backend.calls["b"] != 0 {
+		t.Fatalf("backend calls=%v want a once and b never", backend.calls)
+	}
+
+	final, err := os.ReadFile(filepath.Join(eng.LogsRoot, "final.json"))
+	if err != nil {
+		t.Fatalf("read final.json: %v", err)
+	}
+	var fo runtime.FinalOutcome
+	if err := json.Unmarshal(final, &fo); err != nil {
+		t.Fatalf("decode final.json: %v", err)
+	}
+	if fo.Status != runtime.FinalFail {
+		t.Fatalf("final status=%q want fail", fo.Status)
+	}
+	if fo.Usage == nil || fo.Usage.InputTokens != 1000 || fo.Usage.Nodes["a"].Calls != 1 {
+		t.Fatalf("final usage=%+v", fo.Usage)
+	}
+	if diff := fo.Usage.CostUSD - 0.003; diff > 1e-12 || diff < -1e-12 {
+		t.Fatalf("final cost_usd=%v want 0.003", fo.Usage.CostUSD)
+	}
+
+	usage := progressEventsOfType(t, eng.LogsRoot, "stage_usage")
+	if len(usage) != 1 || usage[0]["node_id"] != "a" {
+		t.Fatalf("stage_usage events=%v", usage)
+	}
+	exhausted := progressEventsOfType(t, eng.LogsRoot, "budget_exhausted")
+	if len(exhausted) != 1 || exhausted[0]["scope"] != budgetScopeRun || exhausted[0]["node_id"] != "b" {
+		t.Fatalf("budget_exhausted events=%v", exhausted)
+	}
+}
+
+func TestRun_NodeBudgetExhaustedFailsOnlyThatNode(t *testing.T) {
+	dot := `
+digraph G {
+  start [shape=Mdiamond]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5, prompt="a"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5, prompt="b"]
+  exit [shape=Msquare]
+  start -> a
+  a -> a [condition="outcome=success", label="again"]
+  a -> b [condition="outcome=fail"]
+  a -> exit
+  b -> exit
+}
+`
+	eng, backend := newBudgetTestEngine(t, dot, BudgetConfig{
+		Nodes: map[string]BudgetLimits{"a": {MaxOutputTokens: int64Ptr(200)}},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := eng.run(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q want success", res.FinalStatus)
+	}
+	if backend.calls["a"] != 2 || backend.calls["b"] != 1 {
+		t.Fatalf("backend calls=%v want a twice then b once", backend.calls)
+	}
+	b, err := os.ReadFile(filepath.Join(eng.LogsRoot, "a", "status.json"))
+	if err != nil {
+		t.Fatalf("read a/status.json: %v", err)
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if out.Status != runtime.StatusFail || classifyFailureClass(out) != failureClassCostBudgetExhausted {
+		t.Fatalf("a outcome=%+v want fail with %s", out, failureClassCostBudgetExhausted)
+	}
+	if shouldRetryOutcome(out, classifyFailureClass(out)) {
+		t.Fatalf("cost budget failures must not be retried")
+	}
+
+	cp, err := runtime.LoadCheckpoint(filepath.Join(eng.LogsRoot, "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	restored := restoreRunUsage(cp)
+	if restored == nil || restored.Calls != 3 || restored.Nodes["b"].Calls != 1 {
+		t.Fatalf("checkpoint llm_usage=%+v", restored)
+	}
+}
+
+func TestLoadRunConfigFile_BudgetSection(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "run.yaml")
+	if err := os.WriteFile(p, []byte(`
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+modeldb:
+  openrouter_model_info_path: /tmp/openrouter.json
+budget:
+  max_usd: 12.5
+  max_output_tokens: 200000
+  per_node:
+    max_usd: 2
+  nodes:
+    implement:
+      max_usd: 5
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadRunConfigFile(p)
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if cfg.Budget.MaxUSD == nil || *cfg.Budget.MaxUSD != 12.5 {
+		t.Fatalf("budget.max_usd=%v", cfg.Budget.MaxUSD)
+	}
+	if cfg.Budget.MaxOutputTokens == nil || *cfg.Budget.MaxOutputTokens != 200000 {
+		t.Fatalf("budget.max_output_tokens=%v", cfg.Budget.MaxOutputTokens)
+	}
+	if cfg.Budget.PerNode.MaxUSD == nil || *cfg.Budget.PerNode.MaxUSD != 2 {
+		t.Fatalf("budget.per_node.max_usd=%v", cfg.Budget.PerNode.MaxUSD)
+	}
+	if v := cfg.Budget.Nodes["implement"].MaxUSD; v == nil || *v != 5 {
+		t.Fatalf("budget.nodes.implement.max_usd=%v", v)
+	}
+
+	// The snapshotted JSON form must round-trip through the strict decoder.
+	jb, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jp := filepath.Join(dir, "run_config.json")
+	if err := os.WriteFile(jp, jb, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadRunConfigFile(jp)
+	if err != nil {
+		t.Fatalf("reload json: %v", err)
+	}
+	if again.Budget.MaxUSD == nil || *again.Budget.MaxUSD != 12.5 {
+		t.Fatalf("json budget.max_usd=%v", again.Budget.MaxUSD)
+	}
+}
+
+func TestValidateConfig_RejectsNegativeBudget(t *testing.T) {
+	cfg := validMinimalRunConfigForTest()
+	cfg.Budget.Nodes = map[string]BudgetLimits{"impl": {MaxInputTokens: int64Ptr(-1)}}
+	err := validateConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "budget.nodes.impl.max_input_tokens") {
+		t.Fatalf("validateConfig err=%v", err)
+	}
+}
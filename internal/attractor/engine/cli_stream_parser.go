@@ -14,6 +14,8 @@ import (
 type cliStreamEvent struct {
 	Type    string      `json:"type"`
 	Message *cliMessage `json:"message,omitempty"`
+	// Usage is top-level on Codex turn.completed events.
+	Usage *cliUsage `json:"usage,omitempty"`
 }
 
 // cliMessage is the "message" field of an assistant or user stream event.
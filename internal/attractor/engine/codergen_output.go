@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/jsonschemautil"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// failureClassSchemaViolation marks codergen attempts whose structured output
+// did not match the node's output_schema. It is retryable: the next attempt
+// is told what was wrong.
+const failureClassSchemaViolation = "schema_violation"
+
+// codergenOutputFileName is where the validated object is kept in the stage
+// logs directory.
+const codergenOutputFileName = "output.json"
+
+func outputSchemaErrorContextKey(nodeID string) string {
+	return "internal.output_schema_error." + nodeID
+}
+
+// loadOutputSchema returns the node's output_schema, given inline as a JSON
+// object or as a path relative to the worktree. A nil schema means the node
+// has none.
+func loadOutputSchema(exec *Execution, node *model.Node) (map[string]any, error) {
+	raw := strings.TrimSpace(node.Attr("output_schema", ""))
+	if raw == "" {
+		return nil, nil
+	}
+	src := []byte(raw)
+	if !strings.HasPrefix(raw, "{") {
+		path := raw
+		if !filepath.IsAbs(path) && exec != nil {
+			path = filepath.Join(exec.WorktreeDir, path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("output_schema: %w", err)
+		}
+		src = b
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(src, &schema); err != nil {
+		return nil, fmt.Errorf("output_schema is not a JSON object: %w", err)
+	}
+	if _, err := jsonschemautil.CompileMapSchema(schema, jsonschema.Draft2020); err != nil {
+		return nil, fmt.Errorf("output_schema: %w", err)
+	}
+	return schema, nil
+}
+
+// codergenOutputPath is the file an agent writes its structured output to.
+// It lives under the run-scoped .ai directory so it is not mistaken for a
+// project file.
+func codergenOutputPath(exec *Execution, node *model.Node) string {
+	wt := exec.WorktreeDir
+	if abs, err := filepath.Abs(wt); err == nil {
+		wt = abs
+	}
+	runID := ""
+	if exec.Engine != nil {
+		runID = exec.Engine.Options.RunID
+	}
+	if strings.TrimSpace(runID) == "" {
+		runID = inferRunIDForStatusFallback(wt)
+	}
+	return filepath.Join(runScopedWorktreeRoot(wt, runID), "outputs", node.ID+".json")
+}
+
+func buildOutputSchemaPromptPreamble(exec *Execution, node *model.Node, schema map[string]any, outputPath string) string {
+	b, _ := json.MarshalIndent(schema, "", "  ")
+	var sb strings.Builder
+	sb.WriteString("Structured output:\n")
+	sb.WriteString(fmt.Sprintf("- When you finish, write a single JSON object matching the schema below to %s.\n", outputPath))
+	sb.WriteString("- If you cannot write files, reply with only that JSON object.\n")
+	sb.WriteString("```json\n")
+	sb.Write(b)
+	sb.WriteString("\n```\n")
+	if exec != nil && exec.Context != nil {
+		if prev := strings.TrimSpace(exec.Context.GetString(outputSchemaErrorContextKey(node.ID), "")); prev != "" {
+			sb.WriteString(fmt.Sprintf("- Your previous output was rejected: %s\n", prev))
+			sb.WriteString("  Fix the output so it matches the schema exactly.\n")
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// readCodergenOutput validates the object the agent wrote to outputPath or,
+// when there is no such file, the JSON object in its reply.
+func readCodergenOutput(schema map[string]any, outputPath, resp string) (map[string]any, error) {
+	var raw string
+	if b, err := os.ReadFile(outputPath); err == nil {
+		raw = string(b)
+	} else {
+		start := strings.Index(resp, "{")
+		end := strings.LastIndex(resp, "}")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("no JSON object written to %s or found in the reply", outputPath)
+		}
+		raw = resp[start : end+1]
+	}
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("output must be a JSON object, got %T", v)
+	}
+	compiled, err := jsonschemautil.CompileMapSchema(schema, jsonschema.Draft2020)
+	if err != nil {
+		return nil, err
+	}
+	if err := compiled.Validate(obj); err != nil {
+		return nil, fmt.Errorf("output does not match output_schema: %w", err)
+	}
+	return obj, nil
+}
+
+// outputContextUpdates exposes the object as <node>.output and each field,
+// flattened through nested objects, as <node>.output.<path>.
+func outputContextUpdates(nodeID string, obj map[string]any) map[string]any {
+	prefix := nodeID + ".output"
+	out := map[string]any{prefix: obj}
+	var walk func(p string, m map[string]any)
+	walk = func(p string, m map[string]any) {
+		for k, v := range m {
+			key := p + "." + k
+			out[key] = v
+			if sub, ok := v.(map[string]any); ok {
+				walk(key, sub)
+			}
+		}
+	}
+	walk(prefix, obj)
+	return out
+}
+
+func schemaViolationOutcome(nodeID string, err error) runtime.Outcome {
+	return runtime.Outcome{
+		Status:        runtime.StatusFail,
+		FailureReason: err.Error(),
+		Meta: map[string]any{
+			"failure_class":     failureClassSchemaViolation,
+			"failure_signature": "schema_violation|" + nodeID,
+		},
+		ContextUpdates: map[string]any{"failure_class": failureClassSchemaViolation},
+	}
+}
+
+// stageReportedFailure reports whether the backend or the agent's status.json
+// already failed the stage, in which case a missing output is not the problem.
+func stageReportedFailure(out *runtime.Outcome, statusPath string) bool {
+	if out == nil {
+		b, err := os.ReadFile(statusPath)
+		if err != nil {
+			return false
+		}
+		parsed, err := runtime.DecodeOutcomeJSON(b)
+		if err != nil {
+			return false
+		}
+		out = &parsed
+	}
+	return out.Status == runtime.StatusFail || out.Status == runtime.StatusRetry
+}
+
+// mergeStatusFileContextUpdates adds updates to a status.json the agent wrote,
+// since the engine treats that file as authoritative over the handler outcome.
+func mergeStatusFileContextUpdates(statusPath string, updates map[string]any) error {
+	b, err := os.ReadFile(statusPath)
+	if err != nil {
+		return nil
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		return err
+	}
+	if out.ContextUpdates == nil {
+		out.ContextUpdates = map[string]any{}
+	}
+	for k, v := range updates {
+		out.ContextUpdates[k] = v
+	}
+	return writeJSON(statusPath, out)
+}
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// scriptedOutputBackend replies to the "plan" node with successive canned
+// replies and records the prompts it was given.
+type scriptedOutputBackend struct {
+	replies []string
+	prompts []string
+}
+
+func (b *scriptedOutputBackend) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+	if node.ID != "plan" {
+		return (&SimulatedCodergenBackend{}).Run(ctx, exec, node, prompt)
+	}
+	b.prompts = append(b.prompts, prompt)
+	reply := b.replies[0]
+	if len(b.replies) > 1 {
+		b.replies = b.replies[1:]
+	}
+	return reply, nil, nil
+}
+
+const outputSchemaGraph = `
+digraph P {
+  graph [goal="plan", retry.backoff.initial_delay_ms=1, retry.backoff.jitter=false]
+  start [shape=Mdiamond]
+  plan [shape=box, llm_provider=openai, llm_model=gpt-5.2, auto_status=true, max_retries=1, prompt="Assess the change",
+        output_schema="{\"type\":\"object\",\"required\":[\"risk\",\"files\"],\"properties\":{\"risk\":{\"enum\":[\"low\",\"high\"]},\"files\":{\"type\":\"array\"},\"meta\":{\"type\":\"object\"}}}"]
+  careful [shape=box, llm_provider=openai, llm_model=gpt-5.2, auto_status=true, prompt="Review $goal carefully"]
+  exit [shape=Msquare]
+  start -> plan
+  plan -> careful [condition="context.plan.output.risk=high"]
+  plan -> exit
+  careful -> exit
+}
+`
+
+func runOutputSchemaGraph(t *testing.T, replies ...string) (*Engine, *scriptedOutputBackend, *Result) {
+	t.Helper()
+	repo := initFanInMergeRepo(t)
+	g, _, err := Prepare([]byte(outputSchemaGraph))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	opts := RunOptions{RepoPath: repo, RunID: "output-schema", LogsRoot: t.TempDir()}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	backend := &scriptedOutputBackend{replies: replies}
+	eng := newBaseEngine(g, []byte(outputSchemaGraph), opts)
+	eng.CodergenBackend = backend
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := eng.run(ctx)
+	if err != nil && res == nil {
+		t.Fatalf("run: %v", err)
+	}
+	return eng, backend, res
+}
+
+func TestCodergenOutputSchema_RetriesWithErrorThenExposesFields(t *testing.T) {
+	eng, backend, res := runOutputSchemaGraph(t,
+		`{"risk":"medium","files":[]}`,
+		"Done.\n```json\n"+`{"risk":"high","files":["a.go"],"meta":{"owner":"core"}}`+"\n```")
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res.FinalStatus)
+	}
+	if len(backend.prompts) != 2 {
+		t.Fatalf("plan prompts=%d want 2", len(backend.prompts))
+	}
+	if !strings.Contains(backend.prompts[0], `"required": [`) || strings.Contains(backend.prompts[0], "previous output was rejected") {
+		t.Fatalf("first prompt:\n%s", backend.prompts[0])
+	}
+	if !strings.Contains(backend.prompts[1], "previous output was rejected") || !strings.Contains(backend.prompts[1], "risk") {
+		t.Fatalf("retry prompt missing validation error:\n%s", backend.prompts[1])
+	}
+
+	if got := eng.Context.GetString("plan.output.risk", ""); got != "high" {
+		t.Fatalf("plan.output.risk=%q", got)
+	}
+	if got := eng.Context.GetString("plan.output.meta.owner", ""); got != "core" {
+		t.Fatalf("plan.output.meta.owner=%q", got)
+	}
+	if _, err := os.Stat(filepath.Join(res.LogsRoot, "careful", "status.json")); err != nil {
+		t.Fatalf("condition on plan.output.risk did not route to careful: %v", err)
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "plan", codergenOutputFileName))
+}
+
+func TestCodergenOutputSchema_PrefersWrittenFileAndFailsAfterRetries(t *testing.T) {
+	_, backend, res := runOutputSchemaGraph(t, `not json`)
+	if len(backend.prompts) != 2 {
+		t.Fatalf("plan prompts=%d want 2", len(backend.prompts))
+	}
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "plan", "status.json"))
+	if err != nil {
+		t.Fatalf("read status.json: %v", err)
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Status != runtime.StatusFail || readFailureClassHint(out) != failureClassSchemaViolation {
+		t.Fatalf("outcome=%+v", out)
+	}
+
+	exec := &Execution{WorktreeDir: t.TempDir()}
+	path := codergenOutputPath(exec, &model.Node{ID: "plan"})
+	_ = os.MkdirAll(filepath.Dir(path), 0o755)
+	_ = os.WriteFile(path, []byte(`{"risk":"low","files":[]}`), 0o644)
+	schema := map[string]any{"type": "object", "required": []any{"risk"}}
+	obj, err := readCodergenOutput(schema, path, `{"ignored":true}`)
+	if err != nil || obj["risk"] != "low" {
+		t.Fatalf("obj=%v err=%v", obj, err)
+	}
+}
@@ -36,6 +36,10 @@ type CodergenRouter struct {
 	apiOnce   sync.Once
 	apiClient *llm.Client
 	apiErr    error
+
+	// placeholders are the run-level paths the cassette redacts; see
+	// setRunPaths.
+	placeholders map[string]string
 }
 
 func NewCodergenRouter(cfg *RunConfigFile, catalog *modeldb.Catalog) *CodergenRouter {
@@ -105,6 +109,9 @@ func (r *CodergenRouter) Run(ctx context.Context, exec *Execution, node *model.N
 	case BackendAPI:
 		return r.runAPI(ctx, exec, node, prov, modelID, prompt)
 	case BackendCLI:
+		if err := checkSandboxUnsupported(exec, node, "a CLI agent", false); err != nil {
+			return "", nil, err
+		}
 		return r.runCLI(ctx, exec, node, prov, modelID, prompt)
 	default:
 		return "", nil, fmt.Errorf("invalid backend for provider %s: %q", prov, backend)
@@ -131,29 +138,257 @@ func (r *CodergenRouter) backendForProvider(provider string) BackendKind {
 	return ""
 }
 
+// setRunPaths records the top-level run paths the cassette redacts. It must
+// be called before the first API stage runs.
+func (r *CodergenRouter) setRunPaths(opts RunOptions) {
+	r.placeholders = cassettePlaceholders(opts)
+}
+
 func (r *CodergenRouter) ensureAPIClient() (*llm.Client, error) {
 	r.apiOnce.Do(func() {
-		if len(r.providerRuntimes) > 0 && r.apiClientFactory != nil {
-			client, err := r.apiClientFactory(r.providerRuntimes)
-			if err != nil {
-				r.apiErr = err
+		mode := llm.CassetteOff
+		if r.cfg != nil {
+			mode, r.apiErr = llm.ParseCassetteMode(r.cfg.LLM.Replay)
+			if r.apiErr != nil {
 				return
 			}
-			if len(client.ProviderNames()) > 0 {
-				r.apiClient = client
+		}
+		if mode == llm.CassetteReplay {
+			r.apiClient = r.newReplayAPIClient()
+		} else {
+			r.apiClient, r.apiErr = r.newAPIClient()
+		}
+		if r.apiErr != nil || r.apiClient == nil {
+			return
+		}
+		// Usage accounting + spend caps; inert unless runAPI scopes the ctx.
+		r.apiClient.Use(newBudgetMiddleware())
+		if mode != llm.CassetteOff {
+			// Innermost, so budgets and failover see recorded usage and errors.
+			cas, err := llm.NewCassette(r.cfg.LLM.Cassette, mode, llm.CassetteOptions{Placeholders: r.placeholders})
+			if err != nil {
+				r.apiClient, r.apiErr = nil, fmt.Errorf("llm.cassette: %w", err)
 				return
 			}
+			r.apiClient.Use(cas)
 		}
-		r.apiClient, r.apiErr = llmclient.NewFromEnv()
 	})
 	return r.apiClient, r.apiErr
 }
 
+func (r *CodergenRouter) newAPIClient() (*llm.Client, error) {
+	if len(r.providerRuntimes) > 0 && r.apiClientFactory != nil {
+		client, err := r.apiClientFactory(r.providerRuntimes)
+		if err != nil {
+			return nil, err
+		}
+		if len(client.ProviderNames()) > 0 {
+			return client, nil
+		}
+	}
+	return llmclient.NewFromEnv()
+}
+
+// newReplayAPIClient registers a keyless stand-in for every API provider;
+// the cassette answers before any of them is reached.
+func (r *CodergenRouter) newReplayAPIClient() *llm.Client {
+	c := llm.NewClient()
+	for _, key := range sortedKeys(r.providerRuntimes) {
+		if r.providerRuntimes[key].Backend == BackendAPI {
+			c.Register(llm.NewReplayProviderAdapter(key))
+		}
+	}
+	if r.cfg != nil {
+		for key, pc := range r.cfg.LLM.Providers {
+			key = normalizeProviderKey(key)
+			if _, ok := r.providerRuntimes[key]; !ok && pc.Backend == BackendAPI {
+				c.Register(llm.NewReplayProviderAdapter(key))
+			}
+		}
+	}
+	return c
+}
+
+// cassettePlaceholders names the run-specific strings that differ between a
+// recording and its replay. They come from the top-level run, not from a
+// stage's Execution: parallel branches and loop restarts work under
+// LogsRoot, so their paths are recorded relative to {{cassette:logs_root}}
+// and replay the same whichever stage reaches the API first.
+func cassettePlaceholders(opts RunOptions) map[string]string {
+	abs := func(p string) string {
+		if strings.TrimSpace(p) == "" {
+			return ""
+		}
+		if a, err := filepath.Abs(p); err == nil {
+			return a
+		}
+		return filepath.Clean(p)
+	}
+	return map[string]string{
+		"logs_root": abs(opts.LogsRoot),
+		"worktree":  abs(opts.WorktreeDir),
+		"repo":      abs(opts.RepoPath),
+		"run_id":    opts.RunID,
+	}
+}
+
+// nodeRequestLimits reads the reasoning_effort and max_tokens attributes for
+// an API request; unset or invalid values are nil.
+func nodeRequestLimits(node *model.Node) (*string, *int) {
+	var reasoningPtr *string
+	if reasoning := strings.TrimSpace(node.Attr("reasoning_effort", "")); reasoning != "" {
+		reasoningPtr = &reasoning
+	}
+	var maxTokensPtr *int
+	if v, err := strconv.Atoi(strings.TrimSpace(node.Attr("max_tokens", ""))); err == nil && v > 0 {
+		maxTokensPtr = &v
+	}
+	return reasoningPtr, maxTokensPtr
+}
+
+// judgeFanIn answers the fan-in judge on the node's provider and model with a
+// single call that needs no tools: the prompt carries every branch's diff.
+// API providers get one request. CLI providers run in a scratch directory
+// under the fan-in's stage directory instead of the worktree.
+func (r *CodergenRouter) judgeFanIn(ctx context.Context, execCtx *Execution, node *model.Node, prompt string) (string, error) {
+	prov := normalizeProviderKey(node.Attr("llm_provider", ""))
+	modelID := strings.TrimSpace(node.Attr("llm_model", ""))
+	if prov == "" || modelID == "" {
+		return "", fmt.Errorf("missing llm_provider or llm_model on node %s", node.ID)
+	}
+	if execCtx != nil && execCtx.Engine != nil {
+		if forcedModelID, forced := forceModelForProvider(execCtx.Engine.Options.ForceModels, prov); forced {
+			modelID = forcedModelID
+		}
+	}
+	backend := r.backendForProvider(prov)
+	if isCLIOnlyModel(modelID) {
+		backend = BackendCLI
+	}
+	switch backend {
+	case BackendAPI:
+	case BackendCLI:
+		return r.judgeFanInCLI(ctx, execCtx, node, prov, modelID, prompt)
+	default:
+		return "", fmt.Errorf("no backend configured for provider %s", prov)
+	}
+	client, err := r.ensureAPIClient()
+	if err != nil {
+		return "", err
+	}
+	if execCtx != nil && execCtx.Engine != nil {
+		ctx = withBudgetScope(ctx, execCtx.Engine.budget, node.ID)
+	}
+	reasoningPtr, maxTokensPtr := nodeRequestLimits(node)
+	req := llm.Request{
+		Provider:        prov,
+		Model:           modelID,
+		Messages:        []llm.Message{llm.User(prompt)},
+		ReasoningEffort: reasoningPtr,
+		MaxTokens:       maxTokensPtr,
+	}
+	policy := attractorLLMRetryPolicy(execCtx, node.ID, prov, modelID)
+	resp, err := llm.Retry(ctx, policy, nil, nil, func() (llm.Response, error) {
+		return client.Complete(ctx, req)
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+// judgeFanInCLI runs the judge through the provider CLI from a scratch
+// directory, <fan-in stage>/judge, which holds nothing but the invocation's
+// own artifacts.
+func (r *CodergenRouter) judgeFanInCLI(ctx context.Context, execCtx *Execution, node *model.Node, prov, modelID, prompt string) (string, error) {
+	if err := checkSandboxUnsupported(execCtx, node, "a CLI judge", false); err != nil {
+		return "", err
+	}
+	judgeExec := *execCtx
+	judgeExec.LogsRoot = filepath.Join(execCtx.LogsRoot, node.ID, "judge")
+	judgeExec.WorktreeDir = judgeExec.LogsRoot
+	if err := os.MkdirAll(judgeExec.WorktreeDir, 0o755); err != nil {
+		return "", err
+	}
+	judgeNode := model.NewNode(node.ID)
+	for _, k := range []string{"llm_provider", "llm_model", "reasoning_effort", "max_tokens"} {
+		if v, ok := node.Attrs[k]; ok {
+			judgeNode.Attrs[k] = v
+		}
+	}
+	stdout, out, err := r.runCLI(ctx, &judgeExec, judgeNode, prov, modelID, prompt)
+	if err != nil {
+		return "", err
+	}
+	if out != nil && out.Status == runtime.StatusFail {
+		return "", fmt.Errorf("%s", out.FailureReason)
+	}
+	return cliReplyText(filepath.Join(judgeExec.LogsRoot, node.ID), stdout), nil
+}
+
+// cliReplyText extracts a CLI's final answer: Codex's structured output,
+// else the result or last assistant message of a stream-json event stream,
+// else stdout as is.
+func cliReplyText(stageDir, stdout string) string {
+	if b, err := os.ReadFile(filepath.Join(stageDir, "output.json")); err == nil {
+		var structured struct {
+			Final string `json:"final"`
+		}
+		if json.Unmarshal(b, &structured) == nil && strings.TrimSpace(structured.Final) != "" {
+			return structured.Final
+		}
+	}
+	var result, assistant string
+	for _, line := range strings.Split(stdout, "\n") {
+		ev, err := parseCLIStreamLine([]byte(line))
+		if err != nil || ev == nil {
+			continue
+		}
+		if ev.Message != nil && ev.Message.Role == "assistant" {
+			if text := extractAssistantText(ev.Message); text != "" {
+				assistant = text
+			}
+			continue
+		}
+		// Claude ends with {"type":"result","result":...}; Gemini streams
+		// {"type":"message","role":"assistant","content":...} deltas.
+		var flat struct {
+			Result  string `json:"result"`
+			Role    string `json:"role"`
+			Content any    `json:"content"`
+			Delta   bool   `json:"delta"`
+		}
+		_ = json.Unmarshal([]byte(line), &flat)
+		switch {
+		case ev.Type == "result" && flat.Result != "":
+			result = flat.Result
+		case ev.Type == "message" && flat.Role == "assistant":
+			if text, ok := flat.Content.(string); ok {
+				if flat.Delta {
+					assistant += text
+				} else {
+					assistant = text
+				}
+			}
+		}
+	}
+	switch {
+	case result != "":
+		return result
+	case assistant != "":
+		return assistant
+	}
+	return stdout
+}
+
 func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *model.Node, provider string, modelID string, prompt string) (string, *runtime.Outcome, error) {
 	client, err := r.ensureAPIClient()
 	if err != nil {
 		return "", nil, err
 	}
+	if execCtx != nil && execCtx.Engine != nil {
+		ctx = withBudgetScope(ctx, execCtx.Engine.budget, node.ID)
+	}
 	contract := buildStageStatusContract(execCtx.WorktreeDir)
 	mode := strings.ToLower(strings.TrimSpace(node.Attr("codergen_mode", "")))
 	if mode == "" {
@@ -165,21 +400,14 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 		return "", &runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
 	}
 
-	reasoning := strings.TrimSpace(node.Attr("reasoning_effort", ""))
-	var reasoningPtr *string
-	if reasoning != "" {
-		reasoningPtr = &reasoning
-	}
-	maxTokensStr := strings.TrimSpace(node.Attr("max_tokens", ""))
-	var maxTokensPtr *int
-	if maxTokensStr != "" {
-		if v, err := strconv.Atoi(maxTokensStr); err == nil && v > 0 {
-			maxTokensPtr = &v
-		}
-	}
+	reasoningPtr, maxTokensPtr := nodeRequestLimits(node)
 
 	switch mode {
 	case "one_shot":
+		outputSchema, err := loadOutputSchema(execCtx, node)
+		if err != nil {
+			return "", nil, err
+		}
 		text, used, err := r.withFailoverText(ctx, execCtx, node, client, provider, modelID, func(prov string, mid string) (string, error) {
 			req := llm.Request{
 				Provider:        prov,
@@ -188,10 +416,41 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 				ReasoningEffort: reasoningPtr,
 				MaxTokens:       maxTokensPtr,
 			}
+			if outputSchema != nil {
+				req.ResponseFormat = &llm.ResponseFormat{Type: "json_schema", JSONSchema: outputSchema, Strict: true}
+			}
 			if err := writeJSON(filepath.Join(stageDir, "api_request.json"), req); err != nil {
 				warnEngine(execCtx, fmt.Sprintf("write api_request.json: %v", err))
 			}
 			policy := attractorLLMRetryPolicy(execCtx, node.ID, prov, mid)
+			if outputSchema != nil {
+				res, err := llm.GenerateObject(ctx, llm.GenerateObjectOptions{
+					GenerateOptions: llm.GenerateOptions{
+						Client:          client,
+						Provider:        prov,
+						Model:           mid,
+						Messages:        req.Messages,
+						ReasoningEffort: reasoningPtr,
+						MaxTokens:       maxTokensPtr,
+						RetryPolicy:     &policy,
+					},
+					Schema: outputSchema,
+					Strict: true,
+				})
+				// A reply that doesn't match the schema is handed back as text;
+				// the codergen handler reports it so the retry sees the error.
+				var noObject *llm.NoObjectGeneratedError
+				if errors.As(err, &noObject) {
+					return noObject.RawText, nil
+				}
+				if err != nil {
+					return "", err
+				}
+				if err := writeJSON(filepath.Join(stageDir, "api_response.json"), res.Response.Raw); err != nil {
+					warnEngine(execCtx, fmt.Sprintf("write api_response.json: %v", err))
+				}
+				return res.Text, nil
+			}
 			resp, err := llm.Retry(ctx, policy, nil, nil, func() (llm.Response, error) {
 				return client.Complete(ctx, req)
 			})
@@ -222,7 +481,11 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			stageEnv[k] = v
 		}
 		overrides := buildAgentLoopOverrides(artifactPolicyFromExecution(execCtx), stageEnv)
-		env := agent.NewLocalExecutionEnvironmentWithPolicy(execCtx.WorktreeDir, overrides, []string{"CLAUDECODE"})
+		local := agent.NewLocalExecutionEnvironmentWithPolicy(execCtx.WorktreeDir, overrides, []string{"CLAUDECODE"})
+		env, err := buildAgentLoopEnvironment(execCtx, node, local, stageDir, contract)
+		if err != nil {
+			return "", nil, err
+		}
 		text, used, err := r.withFailoverText(ctx, execCtx, node, client, provider, modelID, func(prov string, mid string) (string, error) {
 			var profile agent.ProviderProfile
 			var profileErr error
@@ -235,8 +498,8 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 				return "", profileErr
 			}
 			sessCfg := agent.SessionConfig{}
-			if reasoning != "" {
-				sessCfg.ReasoningEffort = reasoning
+			if reasoningPtr != nil {
+				sessCfg.ReasoningEffort = *reasoningPtr
 			}
 			if maxTokensPtr != nil {
 				sessCfg.MaxTokens = maxTokensPtr
@@ -262,6 +525,11 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 			if maxCommandTimeoutMS > 0 {
 				sessCfg.MaxCommandTimeoutMS = maxCommandTimeoutMS
 			}
+			compaction, err := resolveAgentLoopCompaction(execCtx, node)
+			if err != nil {
+				return "", err
+			}
+			sessCfg.Compaction = compaction
 			// Give lots of room for transient LLM errors before failing the stage.
 			policy := attractorLLMRetryPolicy(execCtx, node.ID, prov, mid)
 			sessCfg.LLMRetryPolicy = &policy
@@ -307,6 +575,17 @@ func (r *CodergenRouter) runAPI(ctx context.Context, execCtx *Execution, node *m
 					if execCtx != nil && execCtx.Engine != nil {
 						executeToolHookForEvent(ctx, execCtx, node, ev, stageDir)
 					}
+					if ev.Kind == agent.EventContextCompaction && execCtx != nil && execCtx.Engine != nil {
+						execCtx.Engine.appendProgress(map[string]any{
+							"event":            "context_compaction",
+							"node_id":          node.ID,
+							"strategy":         ev.Data["strategy"],
+							"forced":           ev.Data["forced"],
+							"tokens_before":    ev.Data["tokens_before"],
+							"tokens_after":     ev.Data["tokens_after"],
+							"tokens_reclaimed": ev.Data["tokens_reclaimed"],
+						})
+					}
 					eventsMu.Lock()
 					events = append(events, ev)
 					eventsMu.Unlock()
@@ -532,6 +811,10 @@ func shouldFailoverLLMError(err error) bool {
 	if errors.Is(err, agent.ErrTurnLimit) {
 		return false
 	}
+	var be *budgetExhaustedError
+	if errors.As(err, &be) {
+		return false
+	}
 	if strings.Contains(strings.ToLower(err.Error()), "turn limit reached") {
 		return false
 	}
@@ -879,6 +1162,35 @@ func resolveAgentLoopCommandTimeouts(execCtx *Execution, node *model.Node) (int,
 	return defaultCommandTimeoutMS, maxCommandTimeoutMS
 }
 
+// resolveAgentLoopCompaction reads context_compaction and its tuning attrs,
+// preferring the node's values over graph-level defaults. It returns nil when
+// compaction is not enabled.
+func resolveAgentLoopCompaction(execCtx *Execution, node *model.Node) (*agent.CompactionConfig, error) {
+	attr := func(key string) string {
+		if node != nil {
+			if v := strings.TrimSpace(node.Attr(key, "")); v != "" {
+				return v
+			}
+		}
+		if execCtx != nil && execCtx.Graph != nil {
+			return strings.TrimSpace(execCtx.Graph.Attrs[key])
+		}
+		return ""
+	}
+	strategy, err := agent.ParseCompactionStrategy(attr("context_compaction"))
+	if err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		return nil, nil
+	}
+	return &agent.CompactionConfig{
+		Strategy:   strategy,
+		Threshold:  parseFloat(attr("context_compaction_threshold"), 0),
+		KeepRounds: parseInt(attr("context_compaction_keep_rounds"), 0),
+	}, nil
+}
+
 func parsePositiveIntAttr(node *model.Node, key string) int {
 	if node == nil {
 		return 0
@@ -1375,6 +1687,9 @@ func (r *CodergenRouter) runCLI(ctx context.Context, execCtx *Execution, node *m
 		warnEngine(execCtx, fmt.Sprintf("read stdout.log: %v", rerr))
 	} else {
 		outStr = string(outBytes)
+		if execCtx != nil && execCtx.Engine != nil {
+			recordCLIUsage(execCtx.Engine.budget, node.ID, providerKey, modelID, outBytes)
+		}
 	}
 	if runErr != nil {
 		// Codex CLI reports stream disconnects as a generic "exit status 1", but
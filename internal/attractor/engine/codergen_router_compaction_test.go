@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+func TestResolveAgentLoopCompaction_DisabledByDefault(t *testing.T) {
+	got, err := resolveAgentLoopCompaction(&Execution{Graph: model.NewGraph("g")}, model.NewNode("n"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("compaction=%+v want nil", got)
+	}
+}
+
+func TestResolveAgentLoopCompaction_NodeAttrsOverrideGraph(t *testing.T) {
+	g := model.NewGraph("g")
+	g.Attrs["context_compaction"] = "summarize"
+	g.Attrs["context_compaction_threshold"] = "0.6"
+	g.Attrs["context_compaction_keep_rounds"] = "8"
+	node := model.NewNode("n")
+	node.Attrs["context_compaction"] = "drop-tool-outputs"
+	node.Attrs["context_compaction_keep_rounds"] = "2"
+
+	got, err := resolveAgentLoopCompaction(&Execution{Graph: g}, node)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got == nil || got.Strategy != agent.CompactionDropToolOutputs {
+		t.Fatalf("compaction=%+v want drop_tool_outputs", got)
+	}
+	if got.Threshold != 0.6 {
+		t.Fatalf("threshold=%v want 0.6 from graph", got.Threshold)
+	}
+	if got.KeepRounds != 2 {
+		t.Fatalf("keep_rounds=%d want 2", got.KeepRounds)
+	}
+}
+
+func TestResolveAgentLoopCompaction_RejectsUnknownStrategy(t *testing.T) {
+	node := model.NewNode("n")
+	node.Attrs["context_compaction"] = "truncate_everything"
+	if _, err := resolveAgentLoopCompaction(&Execution{Graph: model.NewGraph("g")}, node); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+func TestCodergenRouter_RecordThenReplayCassette(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "llm.cassette.jsonl")
+	runtimes := map[string]ProviderRuntime{"openai": {Key: "openai", Backend: BackendAPI}}
+	optsFor := func(logsRoot string) RunOptions {
+		return RunOptions{LogsRoot: logsRoot, WorktreeDir: logsRoot + "/worktree", RunID: "run-" + filepath.Base(logsRoot)}
+	}
+	// A parallel branch works in its own worktree under the logs root.
+	const branchWorktree = "/parallel/fan/pass1/01-a/worktree"
+	complete := func(client *llm.Client, text string) (llm.Response, error) {
+		return client.Complete(context.Background(), llm.Request{Provider: "openai", Model: "gpt-5.4", Messages: []llm.Message{llm.User(text)}})
+	}
+
+	cfg := &RunConfigFile{}
+	cfg.LLM.Replay = "record"
+	cfg.LLM.Cassette = cassette
+	rec := NewCodergenRouterWithRuntimes(cfg, nil, runtimes)
+	rec.apiClientFactory = func(map[string]ProviderRuntime) (*llm.Client, error) {
+		c := llm.NewClient()
+		c.Register(&okAdapter{name: "openai"})
+		return c, nil
+	}
+	rec.setRunPaths(optsFor("/runs/a"))
+	client, err := rec.ensureAPIClient()
+	if err != nil {
+		t.Fatalf("record client: %v", err)
+	}
+	for _, text := range []string{"status at /runs/a/worktree", "branch at /runs/a" + branchWorktree} {
+		if _, err := complete(client, text); err != nil {
+			t.Fatalf("record Complete: %v", err)
+		}
+	}
+	b, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "/runs/a") || !strings.Contains(string(b), "{{cassette:logs_root}}"+branchWorktree) {
+		t.Fatalf("branch paths not recorded relative to the run's logs root:\n%s", b)
+	}
+
+	// Replay needs neither keys nor the live factory.
+	t.Setenv("OPENAI_API_KEY", "")
+	cfg = &RunConfigFile{}
+	cfg.LLM.Replay = "replay"
+	cfg.LLM.Cassette = cassette
+	rep := NewCodergenRouterWithRuntimes(cfg, nil, runtimes)
+	rep.apiClientFactory = nil
+	rep.setRunPaths(optsFor("/runs/b"))
+	client, err = rep.ensureAPIClient()
+	if err != nil {
+		t.Fatalf("replay client: %v", err)
+	}
+	for _, text := range []string{"status at /runs/b/worktree", "branch at /runs/b" + branchWorktree} {
+		resp, err := complete(client, text)
+		if err != nil || resp.Text() != "ok" {
+			t.Fatalf("replay Complete: text=%q err=%v", resp.Text(), err)
+		}
+	}
+	if _, err := complete(client, "again"); err == nil || !strings.Contains(err.Error(), "no recording left") {
+		t.Fatalf("expected cassette miss, got %v", err)
+	}
+}
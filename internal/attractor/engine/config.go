@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/danshapiro/kilroy/internal/llm"
 	"github.com/danshapiro/kilroy/internal/providerspec"
 
 	"gopkg.in/yaml.v3"
@@ -45,6 +46,56 @@ type RuntimePolicyConfig struct {
 	MaxLLMRetries        *int `json:"max_llm_retries,omitempty" yaml:"max_llm_retries,omitempty"`
 }
 
+// BudgetLimits caps LLM spend. Nil fields are unlimited.
+type BudgetLimits struct {
+	MaxUSD          *float64 `json:"max_usd,omitempty" yaml:"max_usd,omitempty"`
+	MaxInputTokens  *int64   `json:"max_input_tokens,omitempty" yaml:"max_input_tokens,omitempty"`
+	MaxOutputTokens *int64   `json:"max_output_tokens,omitempty" yaml:"max_output_tokens,omitempty"`
+}
+
+// BudgetConfig holds run-wide caps plus optional per-node caps. PerNode applies
+// to every node; Nodes overrides it for specific node IDs.
+type BudgetConfig struct {
+	BudgetLimits `json:",inline" yaml:",inline"`
+	PerNode      BudgetLimits            `json:"per_node,omitempty" yaml:"per_node,omitempty"`
+	Nodes        map[string]BudgetLimits `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+}
+
+// SandboxConfig selects the execution sandbox for agent_loop shell and file
+// tools. Mode and Network are a floor: the sandbox and sandbox_network node
+// or graph attributes can enable the sandbox or deny the network, but not
+// relax what is configured here.
+type SandboxConfig struct {
+	// Mode is off (default) or strict: read-only root, private /tmp, writable
+	// worktree and stage logs, network denied unless Network is allow.
+	Mode          string   `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Network       string   `json:"network,omitempty" yaml:"network,omitempty"`
+	WritablePaths []string `json:"writable_paths,omitempty" yaml:"writable_paths,omitempty"`
+	MemoryMB      int      `json:"memory_mb,omitempty" yaml:"memory_mb,omitempty"`
+	CPUs          float64  `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+}
+
+// HumanConfig selects how wait.human gates reach a person. An empty
+// Interviewer keeps the caller's choice (the server's web UI, or
+// auto-approve for the CLI); "webhook" posts questions to a chat webhook.
+type HumanConfig struct {
+	Interviewer string             `json:"interviewer,omitempty" yaml:"interviewer,omitempty"`
+	Webhook     HumanWebhookConfig `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+}
+
+// HumanWebhookConfig configures the webhook interviewer. Questions are POSTed
+// to URL as a Slack/Teams-compatible message signed with the secret read from
+// SecretEnv. Answers arrive on the server's signed callback endpoint, or are
+// polled from ReplyURL when it is set.
+type HumanWebhookConfig struct {
+	URL            string `json:"url,omitempty" yaml:"url,omitempty"`
+	SecretEnv      string `json:"secret_env,omitempty" yaml:"secret_env,omitempty"`
+	TimeoutMS      int    `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`
+	CallbackURL    string `json:"callback_url,omitempty" yaml:"callback_url,omitempty"`
+	ReplyURL       string `json:"reply_url,omitempty" yaml:"reply_url,omitempty"`
+	PollIntervalMS int    `json:"poll_interval_ms,omitempty" yaml:"poll_interval_ms,omitempty"`
+}
+
 type PromptProbeConfig struct {
 	Enabled     *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty"`
 	Transports  []string `json:"transports,omitempty" yaml:"transports,omitempty"`
@@ -104,6 +155,11 @@ type RunConfigFile struct {
 	LLM struct {
 		CLIProfile string                    `json:"cli_profile" yaml:"cli_profile"`
 		Providers  map[string]ProviderConfig `json:"providers" yaml:"providers"`
+
+		// Replay records API-backend LLM traffic to Cassette (record) or
+		// serves it back from Cassette without network access (replay).
+		Replay   string `json:"replay,omitempty" yaml:"replay,omitempty"`
+		Cassette string `json:"cassette,omitempty" yaml:"cassette,omitempty"`
 	} `json:"llm" yaml:"llm"`
 
 	ModelDB struct {
@@ -129,8 +185,11 @@ type RunConfigFile struct {
 	} `json:"setup,omitempty" yaml:"setup,omitempty"`
 
 	RuntimePolicy RuntimePolicyConfig `json:"runtime_policy,omitempty" yaml:"runtime_policy,omitempty"`
+	Budget        BudgetConfig        `json:"budget,omitempty" yaml:"budget,omitempty"`
 	Preflight     PreflightConfig     `json:"preflight,omitempty" yaml:"preflight,omitempty"`
 	Inputs        InputConfig         `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Sandbox       SandboxConfig       `json:"sandbox,omitempty" yaml:"sandbox,omitempty"`
+	Human         HumanConfig         `json:"human,omitempty" yaml:"human,omitempty"`
 }
 
 func LoadRunConfigFile(path string) (*RunConfigFile, error) {
@@ -162,6 +221,14 @@ func LoadRunConfigFile(path string) (*RunConfigFile, error) {
 		return nil, err
 	}
 	cfg.Inputs.Materialize.FanIn.PromoteRunScoped = normalizedPromote
+	// A relative cassette is relative to the config file, not to wherever
+	// kilroy was started.
+	if c := strings.TrimSpace(cfg.LLM.Cassette); c != "" && !filepath.IsAbs(c) {
+		cfg.LLM.Cassette = filepath.Join(filepath.Dir(path), c)
+		if abs, err := filepath.Abs(cfg.LLM.Cassette); err == nil {
+			cfg.LLM.Cassette = abs
+		}
+	}
 	applyConfigDefaults(&cfg)
 	if err := validateConfig(&cfg); err != nil {
 		return nil, err
@@ -339,6 +406,13 @@ func validateConfig(cfg *RunConfigFile) error {
 	default:
 		return fmt.Errorf("invalid llm.cli_profile: %q (want real|test_shim)", cfg.LLM.CLIProfile)
 	}
+	replay, err := llm.ParseCassetteMode(cfg.LLM.Replay)
+	if err != nil {
+		return fmt.Errorf("llm.replay: %w", err)
+	}
+	if replay != llm.CassetteOff && strings.TrimSpace(cfg.LLM.Cassette) == "" {
+		return fmt.Errorf("llm.cassette is required when llm.replay=%s", replay)
+	}
 	for prov, pc := range cfg.LLM.Providers {
 		canonical := providerspec.CanonicalProviderKey(prov)
 		builtin, hasBuiltin := providerspec.Builtin(canonical)
@@ -379,6 +453,35 @@ func validateConfig(cfg *RunConfigFile) error {
 			return fmt.Errorf("runtime_policy.stall_check_interval_ms must be > 0 when stall_timeout_ms > 0")
 		}
 	}
+	if err := validateBudgetLimits("budget", cfg.Budget.BudgetLimits); err != nil {
+		return err
+	}
+	if err := validateBudgetLimits("budget.per_node", cfg.Budget.PerNode); err != nil {
+		return err
+	}
+	for nodeID, limits := range cfg.Budget.Nodes {
+		if strings.TrimSpace(nodeID) == "" {
+			return fmt.Errorf("budget.nodes keys must be non-empty node ids")
+		}
+		if err := validateBudgetLimits("budget.nodes."+nodeID, limits); err != nil {
+			return err
+		}
+	}
+	if _, err := parseSandboxMode(cfg.Sandbox.Mode); err != nil {
+		return fmt.Errorf("sandbox.mode: %w", err)
+	}
+	if _, err := parseSandboxNetwork(cfg.Sandbox.Network); err != nil {
+		return fmt.Errorf("sandbox.network: %w", err)
+	}
+	if cfg.Sandbox.MemoryMB < 0 {
+		return fmt.Errorf("sandbox.memory_mb must be >= 0")
+	}
+	if cfg.Sandbox.CPUs < 0 {
+		return fmt.Errorf("sandbox.cpus must be >= 0")
+	}
+	if err := validateHumanConfig(cfg.Human); err != nil {
+		return err
+	}
 	if cfg.Preflight.PromptProbes.TimeoutMS != nil && *cfg.Preflight.PromptProbes.TimeoutMS < 0 {
 		return fmt.Errorf("preflight.prompt_probes.timeout_ms must be >= 0")
 	}
@@ -452,3 +555,16 @@ func firstNonEmpty(values ...string) string {
 	}
 	return ""
 }
+
+func validateBudgetLimits(prefix string, limits BudgetLimits) error {
+	if limits.MaxUSD != nil && *limits.MaxUSD < 0 {
+		return fmt.Errorf("%s.max_usd must be >= 0", prefix)
+	}
+	if limits.MaxInputTokens != nil && *limits.MaxInputTokens < 0 {
+		return fmt.Errorf("%s.max_input_tokens must be >= 0", prefix)
+	}
+	if limits.MaxOutputTokens != nil && *limits.MaxOutputTokens < 0 {
+		return fmt.Errorf("%s.max_output_tokens must be >= 0", prefix)
+	}
+	return nil
+}
@@ -1060,3 +1060,80 @@ preflight:
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestLoadRunConfigFile_Sandbox(t *testing.T) {
+	dir := t.TempDir()
+	write := func(sandbox string) string {
+		yml := filepath.Join(dir, "run.yaml")
+		if err := os.WriteFile(yml, []byte(`
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+llm:
+  providers:
+    openai:
+      backend: api
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+sandbox:
+`+sandbox), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return yml
+	}
+
+	cfg, err := LoadRunConfigFile(write("  mode: strict\n  network: allow\n  memory_mb: 2048\n  cpus: 1.5\n"))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if cfg.Sandbox.Mode != "strict" || cfg.Sandbox.Network != "allow" || cfg.Sandbox.MemoryMB != 2048 || cfg.Sandbox.CPUs != 1.5 {
+		t.Fatalf("sandbox=%+v", cfg.Sandbox)
+	}
+
+	_, err = LoadRunConfigFile(write("  mode: jail\n"))
+	if err == nil || !strings.Contains(err.Error(), "sandbox.mode") {
+		t.Fatalf("expected sandbox.mode error, got %v", err)
+	}
+}
+
+func TestLoadRunConfigFile_LLMReplay(t *testing.T) {
+	dir := t.TempDir()
+	write := func(llmExtra string) string {
+		yml := filepath.Join(dir, "run.yaml")
+		if err := os.WriteFile(yml, []byte(`
+version: 1
+repo:
+  path: /tmp/repo
+cxdb:
+  binary_addr: 127.0.0.1:9009
+  http_base_url: http://127.0.0.1:9010
+llm:
+`+llmExtra+`  providers:
+    openai:
+      backend: api
+modeldb:
+  openrouter_model_info_path: /tmp/catalog.json
+`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return yml
+	}
+
+	cfg, err := LoadRunConfigFile(write("  replay: replay\n  cassette: testdata/run.cassette.jsonl\n"))
+	if err != nil {
+		t.Fatalf("LoadRunConfigFile: %v", err)
+	}
+	if want := filepath.Join(dir, "testdata", "run.cassette.jsonl"); cfg.LLM.Replay != "replay" || cfg.LLM.Cassette != want {
+		t.Fatalf("llm=%+v want cassette %s (relative to the config file)", cfg.LLM, want)
+	}
+
+	if _, err := LoadRunConfigFile(write("  replay: record\n")); err == nil || !strings.Contains(err.Error(), "llm.cassette") {
+		t.Fatalf("expected llm.cassette error, got %v", err)
+	}
+	if _, err := LoadRunConfigFile(write("  replay: rewind\n  cassette: c.jsonl\n")); err == nil || !strings.Contains(err.Error(), "llm.replay") {
+		t.Fatalf("expected llm.replay error, got %v", err)
+	}
+}
@@ -2,8 +2,10 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/danshapiro/kilroy/internal/attractor/model"
@@ -331,3 +333,77 @@ func (e *Engine) cxdbRunFailed(ctx context.Context, nodeID string, sha string, r
 	})
 	return turnID, err
 }
+
+// cxdbStageUsage emits cumulative LLM usage for a node and for the run.
+func (e *Engine) cxdbStageUsage(ctx context.Context, nodeID string, node runtime.UsageTotals, total runtime.UsageTotals) {
+	if e == nil || e.CXDB == nil {
+		return
+	}
+	_, _, _ = e.CXDB.Append(ctx, "com.kilroy.attractor.StageUsage", 1, map[string]any{
+		"run_id":            e.Options.RunID,
+		"node_id":           nodeID,
+		"timestamp_ms":      nowMS(),
+		"input_tokens":      node.InputTokens,
+		"output_tokens":     node.OutputTokens,
+		"cost_usd":          node.CostUSD,
+		"calls":             node.Calls,
+		"run_input_tokens":  total.InputTokens,
+		"run_output_tokens": total.OutputTokens,
+		"run_cost_usd":      total.CostUSD,
+	})
+}
+
+// cxdbManagerSteer records a manager_loop intervention pushed into its child pipeline.
+func (e *Engine) cxdbManagerSteer(ctx context.Context, nodeID string, cycle int, condition string, d steerDirective) {
+	if e == nil || e.CXDB == nil {
+		return
+	}
+	updates := make([]string, 0, len(d.ContextUpdates))
+	for k, v := range d.ContextUpdates {
+		updates = append(updates, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(updates)
+	_, _, _ = e.CXDB.Append(ctx, "com.kilroy.attractor.ManagerSteer", 1, map[string]any{
+		"run_id":          e.Options.RunID,
+		"node_id":         nodeID,
+		"timestamp_ms":    nowMS(),
+		"cycle":           cycle,
+		"condition":       condition,
+		"fidelity":        d.Fidelity,
+		"note":            d.Note,
+		"context_updates": updates,
+	})
+}
+
+// cxdbFanInJudged records the LLM judge verdict for a fan-in node.
+func (e *Engine) cxdbFanInJudged(ctx context.Context, nodeID string, v fanInJudgeVerdict) {
+	if e == nil || e.CXDB == nil {
+		return
+	}
+	_, _, _ = e.CXDB.Append(ctx, "com.kilroy.attractor.FanInJudged", 1, map[string]any{
+		"run_id":          e.Options.RunID,
+		"node_id":         nodeID,
+		"timestamp_ms":    nowMS(),
+		"winner":          v.Winner,
+		"scores":          v.scoreStrings(),
+		"rationale":       v.Rationale,
+		"judge_model":     v.Model,
+		"fallback_reason": v.FallbackReason,
+	})
+}
+
+// cxdbStageCacheHit records a stage whose result was restored from the stage cache.
+func (e *Engine) cxdbStageCacheHit(ctx context.Context, nodeID string, entry *stageCacheEntry) {
+	if e == nil || e.CXDB == nil || entry == nil {
+		return
+	}
+	_, _, _ = e.CXDB.Append(ctx, "com.kilroy.attractor.StageCacheHit", 1, map[string]any{
+		"run_id":        e.Options.RunID,
+		"node_id":       nodeID,
+		"timestamp_ms":  nowMS(),
+		"cache_key":     entry.Key,
+		"source_run_id": entry.RunID,
+		"tree_sha":      entry.TreeSHA,
+		"status":        string(entry.Outcome.Status),
+	})
+}
@@ -0,0 +1,321 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// dryRunCoverageFile is written to the base logs root of a dry run.
+const dryRunCoverageFile = "dry_run_coverage.json"
+
+// DryRunStep is one scripted result for a node. In YAML a step is either a
+// bare string or a mapping:
+//
+//	impl: [fail, success]
+//	review: [{status: fail, failure_class: transient_infra}, success]
+//	approve: ["[R] Revise", "[A] Approve"]
+//
+// For codergen and tool nodes a bare string is the outcome status; for human
+// gates it is the answer (option key, label, or free text).
+type DryRunStep struct {
+	Status         string         `yaml:"status"`
+	PreferredLabel string         `yaml:"preferred_label"`
+	FailureClass   string         `yaml:"failure_class"`
+	ContextUpdates map[string]any `yaml:"context_updates"`
+	Answer         string         `yaml:"answer"`
+}
+
+func (s *DryRunStep) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		s.Status = n.Value
+		return nil
+	}
+	type plain DryRunStep
+	return n.Decode((*plain)(s))
+}
+
+// DryRunScript holds the scripted steps of a dry run, keyed by node ID. Each
+// execution of a node consumes its next step; once a node's steps run out the
+// last one repeats. Nodes without a script succeed.
+type DryRunScript struct {
+	Nodes map[string][]DryRunStep
+
+	mu   sync.Mutex
+	used map[string]int
+}
+
+// LoadDryRunScript reads a dry-run script from a YAML file.
+func LoadDryRunScript(path string) (*DryRunScript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseDryRunScript(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseDryRunScript decodes a YAML mapping of node ID to step list.
+func ParseDryRunScript(b []byte) (*DryRunScript, error) {
+	nodes := map[string][]DryRunStep{}
+	if err := yaml.Unmarshal(b, &nodes); err != nil {
+		return nil, err
+	}
+	for id, steps := range nodes {
+		if len(steps) == 0 {
+			return nil, fmt.Errorf("node %s: empty step list", id)
+		}
+		for i, st := range steps {
+			if strings.TrimSpace(st.Status) == "" && strings.TrimSpace(st.Answer) == "" {
+				return nil, fmt.Errorf("node %s step %d: status or answer is required", id, i+1)
+			}
+		}
+	}
+	return &DryRunScript{Nodes: nodes}, nil
+}
+
+// checkNodes rejects scripts that name nodes the graph does not have, which
+// are almost always typos.
+func (s *DryRunScript) checkNodes(g *model.Graph) error {
+	var unknown []string
+	for id := range s.Nodes {
+		if g.Nodes[id] == nil {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("dry-run script names unknown node(s): %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (s *DryRunScript) next(nodeID string) (DryRunStep, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steps := s.Nodes[nodeID]
+	if len(steps) == 0 {
+		return DryRunStep{}, false
+	}
+	if s.used == nil {
+		s.used = map[string]int{}
+	}
+	i := min(s.used[nodeID], len(steps)-1)
+	s.used[nodeID]++
+	return steps[i], true
+}
+
+// outcome returns the next scripted outcome for a codergen or tool node.
+func (s *DryRunScript) outcome(nodeID string) runtime.Outcome {
+	step, ok := s.next(nodeID)
+	if !ok {
+		return runtime.Outcome{Status: runtime.StatusSuccess, Notes: "dry-run: unscripted stage succeeded"}
+	}
+	st, err := runtime.ParseStageStatus(step.Status)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "dry-run: " + err.Error()}
+	}
+	out := runtime.Outcome{
+		Status:         st,
+		PreferredLabel: step.PreferredLabel,
+		ContextUpdates: map[string]any{},
+		Notes:          "dry-run: scripted " + string(st),
+	}
+	for k, v := range step.ContextUpdates {
+		out.ContextUpdates[k] = v
+	}
+	if st == runtime.StatusFail || st == runtime.StatusRetry {
+		out.FailureReason = "dry-run: scripted " + string(st)
+	}
+	if fc := strings.TrimSpace(step.FailureClass); fc != "" {
+		out.Meta = map[string]any{"failure_class": fc}
+		out.ContextUpdates["failure_class"] = fc
+	}
+	return out
+}
+
+// install swaps every stage that would spend tokens or touch the outside
+// world for a scripted stub: the codergen backend, tool and http nodes and
+// the interviewer. Routing, retries, restarts and checkpoints run unchanged.
+func (s *DryRunScript) install(e *Engine) {
+	e.CodergenBackend = &dryRunBackend{script: s}
+	e.Registry.Register("tool", &dryRunToolHandler{script: s})
+	e.Registry.Register("http", &dryRunToolHandler{script: s})
+	e.Interviewer = &dryRunInterviewer{script: s}
+}
+
+type dryRunBackend struct{ script *DryRunScript }
+
+func (b *dryRunBackend) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+	out := b.script.outcome(node.ID)
+	return "[dry-run] scripted response for stage: " + node.ID, &out, nil
+}
+
+type dryRunToolHandler struct{ script *DryRunScript }
+
+func (h *dryRunToolHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	return h.script.outcome(node.ID), nil
+}
+
+// dryRunInterviewer answers human gates from the script. Unscripted gates
+// take the first option, answer yes, or reply with placeholder text.
+type dryRunInterviewer struct{ script *DryRunScript }
+
+func (i *dryRunInterviewer) Ask(q Question) Answer {
+	step, ok := i.script.next(q.Stage)
+	if !ok {
+		switch q.Type {
+		case QuestionFreeText:
+			return Answer{Text: "dry-run"}
+		case QuestionMultiSelect:
+			if len(q.Options) > 0 {
+				return Answer{Values: []string{q.Options[0].Key}}
+			}
+		}
+		return (&AutoApproveInterviewer{}).Ask(q)
+	}
+	answer := step.Answer
+	if answer == "" {
+		answer = step.Status
+	}
+	if q.Type == QuestionFreeText {
+		return Answer{Text: answer}
+	}
+	return Answer{Value: answer}
+}
+
+func (i *dryRunInterviewer) AskMultiple(questions []Question) []Answer {
+	answers := make([]Answer, len(questions))
+	for idx, q := range questions {
+		answers[idx] = i.Ask(q)
+	}
+	return answers
+}
+
+func (i *dryRunInterviewer) Inform(message string, stage string) {}
+
+// DryRunCoverage reports which parts of the graph a dry run exercised.
+type DryRunCoverage struct {
+	Edges                 []DryRunEdgeCoverage `json:"edges"`
+	UnexercisedEdges      []DryRunEdgeCoverage `json:"unexercised_edges"`
+	UnexercisedConditions []DryRunEdgeCoverage `json:"unexercised_conditions"`
+	UnvisitedNodes        []string             `json:"unvisited_nodes"`
+}
+
+// DryRunEdgeCoverage counts how often one graph edge was taken.
+type DryRunEdgeCoverage struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Label      string `json:"label,omitempty"`
+	Condition  string `json:"condition,omitempty"`
+	Traversals int    `json:"traversals"`
+}
+
+func (c DryRunEdgeCoverage) String() string {
+	s := c.From + " -> " + c.To
+	if c.Condition != "" {
+		s += " [" + c.Condition + "]"
+	} else if c.Label != "" {
+		s += " [" + c.Label + "]"
+	}
+	return s
+}
+
+// computeDryRunCoverage reads every progress.ndjson under logsRoot (restart
+// and parallel branch directories included) and matches edge_selected events
+// to graph edges. Edges out of a fan-out count once per start of their target.
+func computeDryRunCoverage(g *model.Graph, logsRoot string) (*DryRunCoverage, error) {
+	type edgeKey struct{ from, to, label, condition string }
+	taken := map[edgeKey]int{}
+	starts := map[string]int{}
+	visited := map[string]bool{}
+	fanOut := map[string]bool{}
+
+	err := filepath.WalkDir(logsRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "worktree" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != "progress.ndjson" {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for sc.Scan() {
+			var ev map[string]any
+			if json.Unmarshal(sc.Bytes(), &ev) != nil {
+				continue
+			}
+			switch eventFieldString(ev, "event") {
+			case "edge_selected":
+				from, to := eventFieldString(ev, "from_node"), eventFieldString(ev, "to_node")
+				taken[edgeKey{from, to, eventFieldString(ev, "label"), eventFieldString(ev, "condition")}]++
+				visited[from], visited[to] = true, true
+			case "stage_attempt_start":
+				id := eventFieldString(ev, "node_id")
+				starts[id]++
+				visited[id] = true
+			case "implicit_fan_out":
+				fanOut[eventFieldString(ev, "source_node")] = true
+			}
+		}
+		return sc.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reg := NewDefaultRegistry()
+	cov := &DryRunCoverage{
+		Edges:                 []DryRunEdgeCoverage{},
+		UnexercisedEdges:      []DryRunEdgeCoverage{},
+		UnexercisedConditions: []DryRunEdgeCoverage{},
+		UnvisitedNodes:        []string{},
+	}
+	for _, e := range g.Edges {
+		if e == nil {
+			continue
+		}
+		ec := DryRunEdgeCoverage{From: e.From, To: e.To, Label: e.Label(), Condition: e.Condition()}
+		ec.Traversals = taken[edgeKey{ec.From, ec.To, ec.Label, ec.Condition}]
+		if _, isParallel := reg.Resolve(g.Nodes[e.From]).(*ParallelHandler); (isParallel || fanOut[e.From]) && visited[e.From] {
+			ec.Traversals += starts[e.To]
+		}
+		cov.Edges = append(cov.Edges, ec)
+		if ec.Traversals == 0 {
+			cov.UnexercisedEdges = append(cov.UnexercisedEdges, ec)
+			if ec.Condition != "" {
+				cov.UnexercisedConditions = append(cov.UnexercisedConditions, ec)
+			}
+		}
+	}
+	for id := range g.Nodes {
+		if !visited[id] {
+			cov.UnvisitedNodes = append(cov.UnvisitedNodes, id)
+		}
+	}
+	sort.Strings(cov.UnvisitedNodes)
+	return cov, nil
+}
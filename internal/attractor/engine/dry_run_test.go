@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestParseDryRunScript(t *testing.T) {
+	s, err := ParseDryRunScript([]byte(`
+impl: [fail, success]
+review:
+  - {status: retry, failure_class: transient_infra, context_updates: {tries: 1}}
+gate: ["[A] Approve"]
+`))
+	if err != nil {
+		t.Fatalf("ParseDryRunScript: %v", err)
+	}
+	if got := s.outcome("impl"); got.Status != runtime.StatusFail || got.FailureReason == "" {
+		t.Fatalf("impl #1=%+v", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := s.outcome("impl"); got.Status != runtime.StatusSuccess {
+			t.Fatalf("impl #%d=%+v (last step should repeat)", i+2, got)
+		}
+	}
+	got := s.outcome("review")
+	if got.Status != runtime.StatusRetry || got.Meta["failure_class"] != "transient_infra" || got.ContextUpdates["tries"] != 1 {
+		t.Fatalf("review=%+v", got)
+	}
+	if got := s.outcome("other"); got.Status != runtime.StatusSuccess {
+		t.Fatalf("unscripted=%+v", got)
+	}
+	if ans := (&dryRunInterviewer{script: s}).Ask(Question{Stage: "gate"}); ans.Value != "[A] Approve" {
+		t.Fatalf("gate answer=%+v", ans)
+	}
+
+	if _, err := ParseDryRunScript([]byte("impl: []\n")); err == nil {
+		t.Fatal("expected error for empty step list")
+	}
+	if _, err := ParseDryRunScript([]byte("impl: [{failure_class: x}]\n")); err == nil {
+		t.Fatal("expected error for step without status")
+	}
+}
+
+func TestRunWithConfig_DryRunScriptsOutcomesAndReportsCoverage(t *testing.T) {
+	repo := initTestRepo(t)
+	logsRoot := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "tool-ran")
+
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = repo
+	cfg.LLM.Providers = map[string]ProviderConfig{"openai": {Backend: BackendAPI}}
+	cfg.Git.RunBranchPrefix = "attractor/run"
+
+	dot := []byte(`
+digraph G {
+  graph [goal="dry run"]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  impl   [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="implement"]
+  fix    [shape=parallelogram, tool_command="touch ` + marker + `"]
+  review [shape=hexagon, question="Ship it?"]
+
+  start -> impl
+  impl -> review [condition="outcome=success"]
+  impl -> exit [condition="outcome=partial_success"]
+  impl -> fix
+  fix -> impl
+  review -> exit [label="[A] Approve"]
+  review -> fix [label="[R] Revise"]
+}
+`)
+	script, err := ParseDryRunScript([]byte("impl: [fail, success]\nreview: [A]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "dry-run", LogsRoot: logsRoot, DryRun: script})
+	if err != nil {
+		t.Fatalf("RunWithConfig: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%s", res.FinalStatus)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("dry run executed the tool command (stat err=%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(logsRoot, "final.json")); err != nil {
+		t.Fatalf("final.json: %v", err)
+	}
+	if n := len(progressEventsOfType(t, logsRoot, "edge_selected")); n != 5 {
+		t.Fatalf("edge_selected events=%d want 5", n)
+	}
+
+	cov := res.DryRunCoverage
+	if cov == nil {
+		t.Fatal("missing dry-run coverage")
+	}
+	var unexercised []string
+	for _, e := range cov.UnexercisedEdges {
+		unexercised = append(unexercised, e.String())
+	}
+	if got := strings.Join(unexercised, "; "); got != "impl -> exit [outcome=partial_success]; review -> fix [[R] Revise]" {
+		t.Fatalf("unexercised edges=%q", got)
+	}
+	if len(cov.UnexercisedConditions) != 1 || cov.UnexercisedConditions[0].Condition != "outcome=partial_success" {
+		t.Fatalf("unexercised conditions=%+v", cov.UnexercisedConditions)
+	}
+	if len(cov.UnvisitedNodes) != 0 {
+		t.Fatalf("unvisited nodes=%v", cov.UnvisitedNodes)
+	}
+	if _, err := os.Stat(filepath.Join(logsRoot, dryRunCoverageFile)); err != nil {
+		t.Fatalf("coverage report: %v", err)
+	}
+}
+
+func TestRunWithConfig_DryRunRejectsUnknownScriptNodes(t *testing.T) {
+	cfg := &RunConfigFile{Version: 1}
+	cfg.Repo.Path = initTestRepo(t)
+	script, err := ParseDryRunScript([]byte("imp: [fail]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := []byte(`digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit }`)
+	_, err = RunWithConfig(context.Background(), dot, cfg, RunOptions{LogsRoot: t.TempDir(), DryRun: script})
+	if err == nil || !strings.Contains(err.Error(), "unknown node(s): imp") {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -27,6 +27,19 @@ import (
 type RunOptions struct {
 	RepoPath string
 
+	// GraphPath is the DOT file the run was started from, when known. Include
+	// nodes resolve their src relative to it; resume reuses it.
+	GraphPath string
+
+	// ReadGraphFile reads include fragments and prompt files while the graph
+	// is prepared (see PrepareOptions.ReadFile); nil reads from disk. The
+	// server uses it to keep graphs inside its allowed directories.
+	ReadGraphFile func(path string) ([]byte, error)
+
+	// Params supplies values for the graph's declared params (see the graph
+	// "params" attribute). The resolved set is recorded in manifest.json.
+	Params map[string]string
+
 	// RunID is a globally unique filesystem-safe identifier. If empty, one is generated (ULID).
 	RunID string
 
@@ -88,6 +101,17 @@ type RunOptions struct {
 	// Arbitrary key/value metadata written to manifest.json under "labels".
 	// Use to fingerprint runs for later querying or pruning (e.g. source=test).
 	Labels map[string]string
+
+	// DryRun, when set, makes RunWithConfig simulate the run: codergen, tool
+	// and human nodes take their outcomes from the script, provider preflight
+	// and CXDB are skipped, and an edge coverage report is written.
+	DryRun *DryRunScript
+
+	// NoCache disables stage memoization (nodes with cache=true) for the run.
+	NoCache bool
+
+	// StageCacheDir defaults to DefaultStageCacheDir().
+	StageCacheDir string
 }
 
 func (o *RunOptions) applyDefaults() error {
@@ -136,6 +160,9 @@ type Engine struct {
 
 	// Original DOT input (pre-transforms), captured for replay/resume.
 	DotSource []byte
+	// graphSources snapshots the files DotSource was expanded from; nil when
+	// the graph was prepared by the caller.
+	graphSources *graphSources
 
 	// Optional: config used to start the run (metaspec run config schema). Snapshotted to logs_root for resume.
 	RunConfig *RunConfigFile
@@ -165,6 +192,10 @@ type Engine struct {
 	// handlers access it via Execution.Artifacts.
 	Artifacts *ArtifactStore
 
+	// LLM usage/cost accounting and spend caps (run config budget). Shared with
+	// branch and child engines; nil when the run was not started from a config.
+	budget *budgetTracker
+
 	// Model catalog snapshot metadata (metaspec).
 	ModelCatalogSHA    string
 	ModelCatalogSource string
@@ -215,6 +246,15 @@ type Engine struct {
 	forceNextFidelityUsed bool        // true once the override has been consumed
 	lastResolvedFidelity  string      // last resolved LLM fidelity for checkpoint/resume
 	lastResolvedThreadKey string      // thread key when fidelity=full (best-effort)
+
+	// Manager steering: non-nil only for child pipelines run by a
+	// stack.manager_loop node that has the steer action enabled.
+	steering *steerInbox
+	steer    steerState
+
+	// Stage memoization: cache keys of stages executed (not replayed) since
+	// their last checkpoint, stored once the checkpoint commit exists.
+	pendingStageCache map[string]string
 }
 
 // nextParallelPassCount increments and returns the dispatch count for nodeID.
@@ -262,6 +302,8 @@ type Result struct {
 	FinalCommitSHA string
 	Warnings       []string
 	CXDBUIURL      string
+	// DryRunCoverage is set for dry runs.
+	DryRunCoverage *DryRunCoverage
 }
 
 type PrepareOptions struct {
@@ -277,6 +319,18 @@ type PrepareOptions struct {
 	// checks (stylesheet_unknown_model, stylesheet_noncanonical_model_id) are
 	// enabled. When nil, those checks are silently skipped.
 	Catalog *modeldb.Catalog
+	// SourcePath is the DOT file's path, if known. Include src paths resolve
+	// relative to its directory (else RepoPath, else the working directory),
+	// and diagnostics report it as the file.
+	SourcePath string
+	// Params supplies values for the graph's declared params. A non-nil map
+	// makes missing required params an error; nil (validate-only callers)
+	// expands defaults and leaves required params unexpanded.
+	Params map[string]string
+	// ReadFile loads include fragments and prompt files by resolved path. Nil
+	// reads from disk; callers use it to snapshot those files for a run, to
+	// replay a snapshot, or to restrict which paths a graph may read.
+	ReadFile func(path string) ([]byte, error)
 }
 
 // Prepare parses/transforms/validates a graph.
@@ -297,14 +351,49 @@ func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []
 	if err != nil {
 		return nil, nil, err
 	}
+	for _, n := range g.Nodes {
+		n.Pos.File = opts.SourcePath
+	}
+	for _, e := range g.Edges {
+		e.Pos.File = opts.SourcePath
+	}
 
-	// Built-in transforms: prompt_file resolution, stylesheet, $goal expansion.
-	// prompt_file runs first so loaded content gets stylesheet defaults and $goal expansion.
+	// Built-in transforms: includes, prompt_file resolution, params, stylesheet,
+	// $goal expansion. Includes run first so spliced nodes get all of the others.
+	// prompt_file runs next so loaded content gets params, stylesheet defaults
+	// and $goal expansion.
+	if len(includeNodeIDs(g)) > 0 {
+		base := opts.RepoPath
+		if opts.SourcePath != "" {
+			base = filepath.Dir(opts.SourcePath)
+		}
+		if base, err = filepath.Abs(base); err != nil {
+			return g, nil, err
+		}
+		if err := expandIncludes(g, includeSource{dir: base, display: opts.SourcePath, readFile: opts.ReadFile}); err != nil {
+			diags := []validate.Diagnostic{{
+				Rule:     "include",
+				Severity: validate.SeverityError,
+				Message:  err.Error(),
+			}}
+			return g, diags, fmt.Errorf("include expansion: %w", err)
+		}
+	}
 	if opts.RepoPath != "" {
-		if err := expandPromptFiles(g, opts.RepoPath); err != nil {
+		if err := expandPromptFiles(g, opts.RepoPath, opts.ReadFile); err != nil {
 			return g, nil, fmt.Errorf("prompt_file expansion: %w", err)
 		}
 	}
+	params, err := resolveGraphParams(g, opts.Params)
+	if err != nil {
+		diags := []validate.Diagnostic{{
+			Rule:     "graph_params",
+			Severity: validate.SeverityError,
+			Message:  err.Error(),
+		}}
+		return g, diags, fmt.Errorf("params: %w", err)
+	}
+	expandGraphParams(g, params)
 	if raw := strings.TrimSpace(g.Attrs["model_stylesheet"]); raw != "" {
 		rules, err := style.ParseStylesheet(raw)
 		if err != nil {
@@ -339,7 +428,11 @@ func PrepareWithOptions(dotSource []byte, opts PrepareOptions) (*model.Graph, []
 	var errs []string
 	for _, d := range diags {
 		if d.Severity == validate.SeverityError {
-			errs = append(errs, d.Rule+": "+d.Message)
+			msg := d.Rule + ": " + d.Message
+			if d.File != "" {
+				msg += " (" + d.Location() + ")"
+			}
+			errs = append(errs, msg)
 		}
 	}
 	if len(errs) > 0 {
@@ -354,15 +447,23 @@ func Run(ctx context.Context, dotSource []byte, opts RunOptions) (*Result, error
 		return nil, err
 	}
 	reg := NewDefaultRegistry()
+	sources := newGraphSources(opts.GraphPath, opts.RepoPath)
 	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{
 		RepoPath:   opts.RepoPath,
 		KnownTypes: reg.KnownTypes(),
+		SourcePath: opts.GraphPath,
+		Params:     suppliedGraphParams(opts.Params),
+		ReadFile:   sources.recordFrom(opts.ReadGraphFile),
 	})
 	if err != nil {
 		return nil, err
 	}
+	if opts.Params, err = resolveGraphParams(g, suppliedGraphParams(opts.Params)); err != nil {
+		return nil, err
+	}
 
 	eng := newBaseEngine(g, dotSource, opts)
+	eng.graphSources = sources
 	eng.Registry = reg
 	eng.CodergenBackend = &SimulatedCodergenBackend{}
 
@@ -441,6 +542,11 @@ func (e *Engine) run(ctx context.Context) (res *Result, err error) {
 			return nil, err
 		}
 	}
+	if e.graphSources != nil {
+		if err := e.graphSources.save(e.LogsRoot); err != nil {
+			return nil, err
+		}
+	}
 	if err := e.cxdbRunStarted(runCtx, baseSHA); err != nil {
 		return nil, err
 	}
@@ -603,6 +709,16 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 			}, nil
 		}
 
+		// Once a run-wide spend cap is reached, stop before the next LLM stage
+		// rather than failing it and routing onward.
+		if pr, ok := e.Registry.Resolve(node).(ProviderRequiringHandler); ok && pr.RequiresProvider() {
+			if reason, exhausted := e.budget.runExhausted(); exhausted {
+				berr := &budgetExhaustedError{Scope: budgetScopeRun, NodeID: node.ID, Reason: reason}
+				e.appendBudgetExhausted(berr)
+				return nil, fmt.Errorf("run aborted: %s", berr.Error())
+			}
+		}
+
 		e.cxdbStageStarted(ctx, node)
 		out, err := e.executeWithRetry(ctx, node, nodeRetries)
 		if err != nil {
@@ -675,13 +791,13 @@ func (e *Engine) runLoop(ctx context.Context, current string, completed []string
 		e.lastCheckpointSHA = sha
 		e.cxdbCheckpointSaved(ctx, node.ID, out.Status, sha)
 
-		// Kilroy v1: explicit parallel nodes control the next hop via context.
+		// Kilroy v1: explicit parallel and map nodes control the next hop via context.
 		isExplicitParallel := false
-		if t := strings.TrimSpace(node.TypeOverride()); t == "parallel" || (t == "" && shapeToType(node.Shape()) == "parallel") {
+		if t := strings.TrimSpace(node.TypeOverride()); isJoinHopNodeType(t) || (t == "" && shapeToType(node.Shape()) == "parallel") {
 			isExplicitParallel = true
 			join := strings.TrimSpace(e.Context.GetString("parallel.join_node", ""))
 			if join == "" {
-				return nil, fmt.Errorf("parallel node missing parallel.join_node in context")
+				return nil, fmt.Errorf("%s node missing parallel.join_node in context", node.ID)
 			}
 			e.incomingEdge = nil
 			current = join
@@ -922,6 +1038,9 @@ func (e *Engine) loopRestart(ctx context.Context, targetNodeID string, fromNodeI
 	if len(e.DotSource) > 0 {
 		_ = os.WriteFile(filepath.Join(newLogsRoot, "graph.dot"), e.DotSource, 0o644)
 	}
+	if e.graphSources != nil {
+		_ = e.graphSources.save(newLogsRoot)
+	}
 
 	// NOTE: loopFailureSignatures is intentionally NOT reset across loop restarts.
 	// If the same deterministic failure persists after a restart, the counter should
@@ -1009,6 +1128,19 @@ func (e *Engine) executeNode(ctx context.Context, node *model.Node) (runtime.Out
 		_ = writeJSON(filepath.Join(stageDir, "status.json"), out)
 		return out, nil
 	}
+	_ = os.Remove(filepath.Join(stageDir, stageCacheHitFileName))
+	cacheKey, cached := e.lookupStageCache(ctx, node, h)
+	// Spend caps are enforced before any LLM-backed stage starts; the API
+	// client middleware re-checks before every call made within the stage.
+	if pr, ok := h.(ProviderRequiringHandler); ok && pr.RequiresProvider() && cached == nil {
+		if berr := e.budget.check(node.ID); berr != nil {
+			e.appendBudgetExhausted(berr)
+			out := budgetExhaustedOutcome(berr)
+			_ = writeJSON(filepath.Join(stageDir, "status.json"), out)
+			return out, nil
+		}
+	}
+	usageBefore := e.budget.nodeUsage(node.ID)
 	var (
 		out runtime.Outcome
 		err error
@@ -1028,6 +1160,10 @@ func (e *Engine) executeNode(ctx context.Context, node *model.Node) (runtime.Out
 			}
 		}()
 
+		if cached != nil {
+			out = cached.Outcome
+			return
+		}
 		out, err = h.Execute(ctx, &Execution{
 			Graph:       e.Graph,
 			Context:     e.Context,
@@ -1037,6 +1173,7 @@ func (e *Engine) executeNode(ctx context.Context, node *model.Node) (runtime.Out
 			Artifacts:   e.Artifacts,
 		}, node)
 	}()
+	e.reportStageUsage(ctx, node.ID, usageBefore)
 	if err != nil {
 		// Preserve any metadata (failure_class, failure_signature) the handler
 		// attached to the outcome. Only override Status and FailureReason.
@@ -1111,6 +1248,9 @@ func (e *Engine) executeNode(ctx context.Context, node *model.Node) (runtime.Out
 		}
 		_ = writeJSON(filepath.Join(stageDir, "status.json"), out)
 	}
+	if cached == nil {
+		e.deferStageCacheStore(node.ID, cacheKey, out)
+	}
 	return out, nil
 }
 
@@ -1528,6 +1668,7 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 			return "", fmt.Errorf("handler-provided checkpoint sha does not match HEAD (head=%s meta=%s)", head, sha)
 		}
 	}
+	e.storeStageCache(nodeID, sha, out)
 	cp := runtime.NewCheckpoint()
 	cp.Timestamp = time.Now().UTC()
 	cp.CurrentNode = nodeID
@@ -1553,6 +1694,9 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 			cp.Extra["last_thread_key"] = e.lastResolvedThreadKey
 		}
 	}
+	if usage := e.budget.snapshot(); usage != nil {
+		cp.Extra["llm_usage"] = usage
+	}
 	cp.Extra[artifactPolicyResolvedExtraKey] = artifactPolicyResolvedEnvelope{
 		Version: artifactPolicyResolvedVersion,
 		Policy:  normalizeResolvedArtifactPolicy(e.ArtifactPolicy),
@@ -1560,6 +1704,9 @@ func (e *Engine) checkpoint(nodeID string, out runtime.Outcome, completed []stri
 	if err := cp.Save(filepath.Join(e.LogsRoot, "checkpoint.json")); err != nil {
 		return "", err
 	}
+	if err := saveCheckpointHistory(e.LogsRoot, cp, out); err != nil {
+		return "", err
+	}
 	return sha, nil
 }
 
@@ -1580,6 +1727,8 @@ func (e *Engine) writeManifest(baseSHA string) error {
 		"logs_root":  e.LogsRoot,
 		"worktree":   e.WorktreeDir,
 		"graph_dot":  filepath.Join(e.LogsRoot, "graph.dot"),
+		"graph_path": e.Options.GraphPath,
+		"params":     e.Options.Params,
 		"started_at": time.Now().UTC().Format(time.RFC3339Nano),
 		"repo_path":  e.Options.RepoPath,
 		"kilroy_v1":  true,
@@ -1672,6 +1821,9 @@ func (e *Engine) persistTerminalOutcome(ctx context.Context, final runtime.Final
 	if strings.TrimSpace(final.CXDBHeadTurnID) == "" && e.CXDB != nil {
 		final.CXDBHeadTurnID = strings.TrimSpace(e.CXDB.HeadTurnID)
 	}
+	if final.Usage == nil {
+		final.Usage = e.budget.snapshot()
+	}
 
 	primaryPath := ""
 	for _, p := range e.finalOutcomePaths() {
@@ -2111,6 +2263,15 @@ func selectAllEligibleEdges(g *model.Graph, from string, out runtime.Outcome, ct
 	return edges, nil
 }
 
+// BestEdge returns the edge the engine follows when several are eligible and
+// they do not fan out. edges is left in its original order.
+func BestEdge(edges []*model.Edge) *model.Edge {
+	if len(edges) == 0 {
+		return nil
+	}
+	return bestEdge(append([]*model.Edge(nil), edges...))
+}
+
 func bestEdge(edges []*model.Edge) *model.Edge {
 	// metaspec: weight desc, to_node asc, then edge declaration order asc.
 	sort.SliceStable(edges, func(i, j int) bool {
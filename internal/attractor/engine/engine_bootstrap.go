@@ -23,6 +23,9 @@ func newBaseEngine(g *model.Graph, dotSource []byte, opts RunOptions) *Engine {
 	if opts.Interviewer != nil {
 		e.Interviewer = opts.Interviewer
 	}
+	if hook, ok := e.Interviewer.(*WebhookInterviewer); ok && hook.Warn == nil {
+		hook.Warn = e.Warn
+	}
 	e.RunBranch = buildRunBranch(opts.RunBranchPrefix, opts.RunID)
 	return e
 }
@@ -6,10 +6,12 @@ import "github.com/danshapiro/kilroy/internal/attractor/runtime"
 // transient_infra: temporary infrastructure issues (API timeouts, rate limits)
 // budget_exhausted: model ran out of turn/token budget (may succeed with retry or escalation)
 // compilation_loop: model stuck in fix-regress cycle (may succeed with different approach on retry)
+// schema_violation: output did not match output_schema (retried with the validation error in the prompt)
 var retryableFailureClasses = map[string]bool{
 	failureClassTransientInfra:  true,
 	failureClassBudgetExhausted: true,
 	failureClassCompilationLoop: true,
+	failureClassSchemaViolation: true,
 }
 
 func shouldRetryOutcome(out runtime.Outcome, failureClass string) bool {
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// fanInJudgeMaxDiffBytes caps each branch diff embedded in the judge prompt.
+const fanInJudgeMaxDiffBytes = 24 * 1024
+
+// fanInJudgeVerdict is what the judge model returns, plus bookkeeping about
+// how the fan-in ended up choosing.
+type fanInJudgeVerdict struct {
+	Winner    string             `json:"winner"`
+	Scores    map[string]float64 `json:"scores,omitempty"`
+	Rationale string             `json:"rationale,omitempty"`
+
+	Model          string `json:"judge_model,omitempty"`
+	FallbackReason string `json:"fallback_reason,omitempty"`
+}
+
+// fanInJudgeEnabled reports whether a fan-in node asks for LLM winner
+// selection (fan_in.judge_prompt set).
+func fanInJudgeEnabled(node *model.Node) bool {
+	return node != nil && strings.TrimSpace(node.Attr("fan_in.judge_prompt", "")) != ""
+}
+
+// fanInJudger is implemented by codergen backends that can answer the fan-in
+// judge. The judge is a single model call that must not run in the worktree;
+// its artifacts stay in the fan-in node's stage directory.
+type fanInJudger interface {
+	judgeFanIn(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, error)
+}
+
+// judgeFanInWinner asks the node's configured model to pick the best branch.
+// Any judge failure (backend error, unparseable reply, unknown winner) falls
+// back to the heuristic winner; the reason is kept in the verdict so it is
+// visible in context and CXDB.
+func judgeFanInWinner(ctx context.Context, exec *Execution, node *model.Node, results []parallelBranchResult, heuristic parallelBranchResult) (parallelBranchResult, fanInJudgeVerdict) {
+	verdict := fanInJudgeVerdict{Winner: heuristic.BranchKey}
+	provider := strings.TrimSpace(node.Attr("llm_provider", ""))
+	modelID := strings.TrimSpace(node.Attr("llm_model", ""))
+	if provider == "" || modelID == "" {
+		// Validation rejects this (fan_in_judge); keep the run going anyway.
+		verdict.FallbackReason = "fan_in.judge_prompt requires llm_provider and llm_model on the fan-in node"
+		return heuristic, verdict
+	}
+	verdict.Model = provider + "/" + modelID
+	candidates := map[string]parallelBranchResult{}
+	for _, r := range results {
+		if r.Outcome.Status != runtime.StatusFail {
+			candidates[r.BranchKey] = r
+		}
+	}
+	if len(candidates) < 2 {
+		verdict.FallbackReason = "fewer than two candidate branches"
+		return heuristic, verdict
+	}
+	judge, ok := exec.Engine.CodergenBackend.(fanInJudger)
+	if !ok {
+		verdict.FallbackReason = "the codergen backend cannot run the judge"
+		return heuristic, verdict
+	}
+
+	stageDir := filepath.Join(exec.LogsRoot, node.ID)
+	if err := os.MkdirAll(stageDir, 0o755); err != nil {
+		verdict.FallbackReason = err.Error()
+		return heuristic, verdict
+	}
+	prompt := buildFanInJudgePrompt(exec, node, results)
+	_ = os.WriteFile(filepath.Join(stageDir, "judge_prompt.md"), []byte(prompt), 0o644)
+
+	resp, err := judge.judgeFanIn(ctx, exec, node, prompt)
+	_ = os.WriteFile(filepath.Join(stageDir, "judge_response.md"), []byte(resp), 0o644)
+	if err != nil {
+		verdict.FallbackReason = "judge call failed: " + err.Error()
+		return heuristic, verdict
+	}
+	parsed, err := parseFanInJudgeResponse(resp)
+	if err != nil {
+		verdict.FallbackReason = err.Error()
+		return heuristic, verdict
+	}
+	winner, ok := candidates[parsed.Winner]
+	if !ok {
+		verdict.FallbackReason = fmt.Sprintf("judge picked %q, which is not a candidate branch", parsed.Winner)
+		verdict.Scores, verdict.Rationale = parsed.Scores, parsed.Rationale
+		return heuristic, verdict
+	}
+	verdict.Winner = winner.BranchKey
+	verdict.Scores = parsed.Scores
+	verdict.Rationale = parsed.Rationale
+	return winner, verdict
+}
+
+func buildFanInJudgePrompt(exec *Execution, node *model.Node, results []parallelBranchResult) string {
+	var b strings.Builder
+	b.WriteString("You are judging the results of parallel branches that attempted the same task.\n")
+	b.WriteString("Pick the single best branch.\n\n")
+	b.WriteString("## Judging instructions\n\n")
+	b.WriteString(strings.TrimSpace(node.Attr("fan_in.judge_prompt", "")))
+	b.WriteString("\n")
+	if rubric := strings.TrimSpace(node.Attr("fan_in.judge_rubric", "")); rubric != "" {
+		b.WriteString("\n## Rubric\n\n")
+		b.WriteString(rubric)
+		b.WriteString("\n")
+	}
+
+	ordered := append([]parallelBranchResult{}, results...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].BranchKey < ordered[j].BranchKey })
+	var keys []string
+	for _, r := range ordered {
+		b.WriteString(fmt.Sprintf("\n## Branch %s\n\n", r.BranchKey))
+		status, _ := json.MarshalIndent(r.Outcome, "", "  ")
+		b.WriteString("status.json:\n```json\n")
+		b.Write(status)
+		b.WriteString("\n```\n")
+		if r.Outcome.Status == runtime.StatusFail {
+			b.WriteString("This branch failed and cannot be chosen.\n")
+			continue
+		}
+		keys = append(keys, r.BranchKey)
+		if notes := strings.TrimSpace(r.Outcome.Notes); notes != "" {
+			b.WriteString("\nNotes: " + notes + "\n")
+		}
+		if strings.TrimSpace(r.HeadSHA) == "" {
+			continue
+		}
+		diff, err := gitutil.Diff(exec.WorktreeDir, "HEAD", r.HeadSHA)
+		if err != nil {
+			b.WriteString(fmt.Sprintf("\nDiff unavailable: %v\n", err))
+			continue
+		}
+		if len(diff) > fanInJudgeMaxDiffBytes {
+			diff = diff[:fanInJudgeMaxDiffBytes] + fmt.Sprintf("\n... [diff truncated at %d bytes]\n", fanInJudgeMaxDiffBytes)
+		}
+		b.WriteString("\nDiff against the fan-out base:\n```diff\n")
+		b.WriteString(diff)
+		b.WriteString("\n```\n")
+	}
+
+	b.WriteString("\n## Response format\n\n")
+	b.WriteString("Everything you need is above; do not run tools or read or edit files.\n")
+	b.WriteString("Reply with only a JSON object, no other text:\n")
+	b.WriteString(`{"winner":"<branch key>","scores":{"<branch key>":<0-10>},"rationale":"<one paragraph>"}`)
+	b.WriteString("\nScore every candidate branch. Candidate branch keys: " + strings.Join(keys, ", ") + "\n")
+	return b.String()
+}
+
+// parseFanInJudgeResponse extracts the verdict object from a model reply,
+// tolerating surrounding prose and markdown fences.
+func parseFanInJudgeResponse(resp string) (fanInJudgeVerdict, error) {
+	var v fanInJudgeVerdict
+	start := strings.Index(resp, "{")
+	end := strings.LastIndex(resp, "}")
+	if start < 0 || end < start {
+		return v, fmt.Errorf("judge response contains no JSON object")
+	}
+	if err := json.Unmarshal([]byte(resp[start:end+1]), &v); err != nil {
+		return v, fmt.Errorf("judge response is not valid JSON: %w", err)
+	}
+	v.Winner = strings.TrimSpace(v.Winner)
+	if v.Winner == "" {
+		return v, fmt.Errorf("judge response has no winner")
+	}
+	return v, nil
+}
+
+func (v fanInJudgeVerdict) scoreStrings() []string {
+	out := make([]string, 0, len(v.Scores))
+	for _, k := range sortedKeys(v.Scores) {
+		out = append(out, fmt.Sprintf("%s=%g", k, v.Scores[k]))
+	}
+	return out
+}
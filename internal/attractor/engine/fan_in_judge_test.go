@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/llm"
+)
+
+// judgeBackend answers the fan-in judge call with a canned reply and records
+// the prompt it was given.
+type judgeBackend struct {
+	reply  string
+	prompt string
+	node   *model.Node
+}
+
+func (b *judgeBackend) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+	return (&SimulatedCodergenBackend{}).Run(ctx, exec, node, prompt)
+}
+
+func (b *judgeBackend) judgeFanIn(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, error) {
+	b.prompt, b.node = prompt, node
+	return b.reply, nil
+}
+
+const judgeGraph = `
+digraph P {
+  graph [goal="best of two"]
+  start [shape=Mdiamond]
+  par [shape=component]
+  a [shape=parallelogram, tool_command="echo alpha > a.txt"]
+  b [shape=parallelogram, tool_command="echo beta > b.txt"]
+  join [shape=tripleoctagon, llm_provider=openai, llm_model=gpt-5.2,
+        fan_in.judge_prompt="Prefer the branch that writes beta", fan_in.judge_rubric="correctness over style"]
+  exit [shape=Msquare]
+  start -> par
+  par -> a -> join
+  par -> b -> join
+  join -> exit
+}
+`
+
+func runJudgeGraph(t *testing.T, reply string) (*Engine, *judgeBackend, *Result) {
+	t.Helper()
+	repo := initFanInMergeRepo(t)
+	g, _, err := Prepare([]byte(judgeGraph))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	opts := RunOptions{RepoPath: repo, RunID: "judge", LogsRoot: t.TempDir()}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	backend := &judgeBackend{reply: reply}
+	eng := newBaseEngine(g, []byte(judgeGraph), opts)
+	eng.CodergenBackend = backend
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := eng.run(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return eng, backend, res
+}
+
+func TestFanInJudge_SelectsJudgeWinnerAndRecordsVerdict(t *testing.T) {
+	eng, backend, res := runJudgeGraph(t, "Here is my verdict:\n```json\n"+
+		`{"winner":"b","scores":{"a":4,"b":9},"rationale":"b writes beta as asked"}`+"\n```")
+
+	if backend.node == nil || backend.node.ID != "join" || backend.node.Attr("llm_model", "") != "gpt-5.2" {
+		t.Fatalf("judge node=%+v", backend.node)
+	}
+	for _, want := range []string{"Prefer the branch that writes beta", "correctness over style", "## Branch a", "+alpha", "+beta", "Candidate branch keys: a, b"} {
+		if !strings.Contains(backend.prompt, want) {
+			t.Fatalf("judge prompt missing %q:\n%s", want, backend.prompt)
+		}
+	}
+
+	out := readJoinOutcome(t, res.LogsRoot)
+	if got := out.ContextUpdates["parallel.fan_in.best_id"]; got != "b" {
+		t.Fatalf("best_id=%v want b", got)
+	}
+	scores, _ := out.ContextUpdates["parallel.fan_in.judge_scores"].(map[string]any)
+	if scores["b"] != float64(9) || scores["a"] != float64(4) {
+		t.Fatalf("judge_scores=%v", out.ContextUpdates["parallel.fan_in.judge_scores"])
+	}
+	if got := out.ContextUpdates["parallel.fan_in.judge_rationale"]; got != "b writes beta as asked" {
+		t.Fatalf("judge_rationale=%v", got)
+	}
+	files := runCmdOut(t, eng.Options.RepoPath, "git", "ls-tree", "-r", "--name-only", res.FinalCommitSHA)
+	if !strings.Contains(files, "b.txt") || strings.Contains(files, "a.txt") {
+		t.Fatalf("final tree should carry only branch b:\n%s", files)
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "join", "judge_prompt.md"))
+	if len(progressEventsOfType(t, res.LogsRoot, "fan_in_judged")) != 1 {
+		t.Fatal("missing fan_in_judged progress event")
+	}
+}
+
+func TestFanInJudge_FallsBackToHeuristicOnBadVerdict(t *testing.T) {
+	for reply, wantReason := range map[string]string{
+		"I like both.":          "no JSON object",
+		`{"winner":"c"}`:        `judge picked "c"`,
+		`{"scores":{"a":1}}`:    "no winner",
+		`{"winner": "b", oops}`: "not valid JSON",
+	} {
+		_, _, res := runJudgeGraph(t, reply)
+		out := readJoinOutcome(t, res.LogsRoot)
+		if got := out.ContextUpdates["parallel.fan_in.best_id"]; got != "a" {
+			t.Fatalf("reply %q: best_id=%v want heuristic winner a", reply, got)
+		}
+		reason, _ := out.ContextUpdates["parallel.fan_in.judge_fallback_reason"].(string)
+		if !strings.Contains(reason, wantReason) {
+			t.Fatalf("reply %q: fallback_reason=%q want %q", reply, reason, wantReason)
+		}
+		if b, _ := os.ReadFile(filepath.Join(res.LogsRoot, "join", "judge_response.md")); string(b) != reply {
+			t.Fatalf("judge_response.md=%q", b)
+		}
+	}
+}
+
+func TestCodergenRouter_JudgeFanInRunsOutsideTheWorktree(t *testing.T) {
+	logsRoot, worktree := t.TempDir(), t.TempDir()
+	cli := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(cli, []byte(`#!/usr/bin/env bash
+pwd > cwd.txt
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"thinking"}]}}'
+echo '{"type":"result","subtype":"success","result":"{\"winner\":\"b\"}"}'
+`), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &RunConfigFile{}
+	cfg.LLM.CLIProfile = "test_shim"
+	cfg.LLM.Providers = map[string]ProviderConfig{
+		"openai":    {Backend: BackendAPI},
+		"anthropic": {Backend: BackendCLI, Executable: cli},
+	}
+	r := NewCodergenRouterWithRuntimes(cfg, nil, nil)
+	r.apiClientFactory = func(map[string]ProviderRuntime) (*llm.Client, error) {
+		c := llm.NewClient()
+		c.Register(&okAdapter{name: "openai"})
+		return c, nil
+	}
+	r.providerRuntimes = map[string]ProviderRuntime{"openai": {Key: "openai", Backend: BackendAPI}}
+	exec := &Execution{LogsRoot: logsRoot, WorktreeDir: worktree, Engine: &Engine{Options: RunOptions{AllowTestShim: true}}}
+	node := model.NewNode("join")
+	node.Attrs["llm_provider"] = "openai"
+	node.Attrs["llm_model"] = "gpt-5.2"
+	if got, err := r.judgeFanIn(context.Background(), exec, node, "pick one"); err != nil || got != "ok" {
+		t.Fatalf("API judge=%q err=%v", got, err)
+	}
+
+	node.Attrs["llm_provider"] = "anthropic"
+	node.Attrs["llm_model"] = "claude-sonnet-4-5"
+	got, err := r.judgeFanIn(context.Background(), exec, node, "pick one")
+	if err != nil || got != `{"winner":"b"}` {
+		t.Fatalf("CLI judge=%q err=%v", got, err)
+	}
+	scratch := filepath.Join(logsRoot, "join", "judge")
+	cwd, err := os.ReadFile(filepath.Join(scratch, "cwd.txt"))
+	if err != nil {
+		t.Fatalf("CLI judge did not run in %s: %v", scratch, err)
+	}
+	if real, _ := filepath.EvalSymlinks(scratch); strings.TrimSpace(string(cwd)) != real {
+		t.Fatalf("CLI judge ran in %s want %s", cwd, real)
+	}
+	assertExists(t, filepath.Join(scratch, "join", "cli_invocation.json"))
+	if entries, _ := os.ReadDir(worktree); len(entries) != 0 {
+		t.Fatalf("CLI judge touched the worktree: %v", entries)
+	}
+}
+
+func TestFanInJudge_FallsBackWithoutAJudgeBackend(t *testing.T) {
+	g := model.NewGraph("g")
+	node := model.NewNode("join")
+	node.Attrs["fan_in.judge_prompt"] = "pick"
+	results := []parallelBranchResult{{BranchKey: "a"}, {BranchKey: "b"}}
+	exec := &Execution{Graph: g, LogsRoot: t.TempDir(), Engine: &Engine{CodergenBackend: &SimulatedCodergenBackend{}}}
+
+	_, v := judgeFanInWinner(context.Background(), exec, node, results, results[0])
+	if v.Model != "" || !strings.Contains(v.FallbackReason, "llm_provider and llm_model") {
+		t.Fatalf("verdict=%+v", v)
+	}
+	node.Attrs["llm_provider"] = "openai"
+	node.Attrs["llm_model"] = "gpt-5.2"
+	_, v = judgeFanInWinner(context.Background(), exec, node, results, results[0])
+	if v.Model != "openai/gpt-5.2" || v.Winner != "a" || !strings.Contains(v.FallbackReason, "cannot run the judge") {
+		t.Fatalf("verdict=%+v", v)
+	}
+}
@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+const (
+	// fanInMergeModeSelect fast-forwards the run branch to the single best
+	// branch (the default).
+	fanInMergeModeSelect = "select"
+	// fanInMergeModeMergeAll merges every successful branch head onto the
+	// run branch.
+	fanInMergeModeMergeAll = "merge_all"
+
+	// fanInConflictStatus is the custom outcome a merge_all fan-in returns
+	// when some branches could not be merged and an outgoing edge routes on
+	// condition="outcome=conflict".
+	fanInConflictStatus runtime.StageStatus = "conflict"
+)
+
+func fanInMergeMode(node *model.Node) string {
+	if node == nil {
+		return fanInMergeModeSelect
+	}
+	mode := strings.ToLower(strings.TrimSpace(node.Attr("merge_mode", "")))
+	if mode == "" {
+		return fanInMergeModeSelect
+	}
+	return mode
+}
+
+// fanInMergeConflict records one branch whose head could not be merged
+// cleanly onto the run branch.
+type fanInMergeConflict struct {
+	BranchKey  string   `json:"branch_key"`
+	BranchName string   `json:"branch_name,omitempty"`
+	HeadSHA    string   `json:"head_sha"`
+	Files      []string `json:"files"`
+}
+
+func (c fanInMergeConflict) toMap() map[string]any {
+	return map[string]any{
+		"branch_key":  c.BranchKey,
+		"branch_name": c.BranchName,
+		"head_sha":    c.HeadSHA,
+		"files":       append([]string{}, c.Files...),
+	}
+}
+
+// executeFanInMergeAll merges each successful branch head onto the run branch
+// in branch-key order with a no-ff merge. A branch that conflicts with what
+// has already been merged is aborted and reported; the remaining branches
+// are still merged so the run branch carries every non-conflicting change.
+func executeFanInMergeAll(exec *Execution, node *model.Node, results []parallelBranchResult) (runtime.Outcome, error) {
+	var mergeable []parallelBranchResult
+	for _, r := range results {
+		if r.Outcome.Status != runtime.StatusSuccess && r.Outcome.Status != runtime.StatusPartialSuccess {
+			continue
+		}
+		if strings.TrimSpace(r.HeadSHA) == "" {
+			continue
+		}
+		mergeable = append(mergeable, r)
+	}
+	if len(mergeable) == 0 {
+		return parallelAllFailOutcome(results), nil
+	}
+	sort.SliceStable(mergeable, func(i, j int) bool {
+		return mergeable[i].BranchKey < mergeable[j].BranchKey
+	})
+
+	var merged []parallelBranchResult
+	var conflicts []fanInMergeConflict
+	if len(mergeable) == 1 {
+		if err := gitutil.FastForwardFFOnly(exec.WorktreeDir, mergeable[0].HeadSHA); err != nil {
+			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+		}
+		merged = mergeable
+	} else {
+		for _, r := range mergeable {
+			msg := fmt.Sprintf("attractor: %s merge branch %s", node.ID, r.BranchKey)
+			mergeErr := gitutil.MergeNoFF(exec.WorktreeDir, r.HeadSHA, msg)
+			if mergeErr == nil {
+				merged = append(merged, r)
+				continue
+			}
+			files, err := gitutil.ConflictedFiles(exec.WorktreeDir)
+			if abortErr := gitutil.MergeAbort(exec.WorktreeDir); abortErr != nil || err != nil || len(files) == 0 {
+				// Not a content conflict (or the tree is now in an unknown
+				// state); surface the original git error.
+				return runtime.Outcome{
+					Status:        runtime.StatusFail,
+					FailureReason: fmt.Sprintf("merge branch %s: %v", r.BranchKey, mergeErr),
+				}, nil
+			}
+			conflicts = append(conflicts, fanInMergeConflict{
+				BranchKey:  r.BranchKey,
+				BranchName: r.BranchName,
+				HeadSHA:    r.HeadSHA,
+				Files:      files,
+			})
+		}
+	}
+
+	// See FanInHandler.Execute: merges only move tracked content, so carry
+	// over ignored files from each merged branch worktree as well.
+	for _, r := range merged {
+		if strings.TrimSpace(r.WorktreeDir) == "" {
+			continue
+		}
+		if err := gitutil.CopyIgnoredFiles(r.WorktreeDir, exec.WorktreeDir, ".ai/runs/"); err != nil {
+			exec.Engine.appendProgress(map[string]any{
+				"event":      "fan_in_ignored_files_warning",
+				"node_id":    node.ID,
+				"branch_key": r.BranchKey,
+				"warning":    err.Error(),
+			})
+		}
+	}
+
+	lineageRunHead, failed := mergeFanInLineage(exec, results)
+	if failed != nil {
+		return *failed, nil
+	}
+
+	mergedKeys := make([]string, 0, len(merged))
+	mergedSet := map[string]bool{}
+	for _, r := range merged {
+		mergedKeys = append(mergedKeys, r.BranchKey)
+		mergedSet[r.BranchKey] = true
+	}
+	losers := []map[string]any{}
+	for _, r := range results {
+		if mergedSet[r.BranchKey] {
+			continue
+		}
+		losers = append(losers, map[string]any{
+			"branch_key":        r.BranchKey,
+			"branch_name":       r.BranchName,
+			"head_sha":          r.HeadSHA,
+			"status":            string(r.Outcome.Status),
+			"logs_root":         r.LogsRoot,
+			"cxdb_context_id":   r.CXDBContextID,
+			"cxdb_head_turn_id": r.CXDBHeadTurnID,
+		})
+	}
+	conflictMeta := make([]map[string]any, 0, len(conflicts))
+	for _, c := range conflicts {
+		conflictMeta = append(conflictMeta, c.toMap())
+	}
+
+	contextUpdates := map[string]any{
+		"parallel.fan_in.merged":    mergedKeys,
+		"parallel.fan_in.conflicts": conflictMeta,
+		"parallel.fan_in.losers":    losers,
+	}
+	if len(merged) > 0 {
+		best := merged[0]
+		contextUpdates["parallel.fan_in.best_id"] = best.BranchKey
+		contextUpdates["parallel.fan_in.best_outcome"] = best.Outcome
+		contextUpdates["parallel.fan_in.best_head_sha"] = best.HeadSHA
+		contextUpdates["parallel.fan_in.best_cxdb_context_id"] = best.CXDBContextID
+		contextUpdates["parallel.fan_in.best_cxdb_head_turn_id"] = best.CXDBHeadTurnID
+	}
+	if strings.TrimSpace(lineageRunHead) != "" {
+		contextUpdates["input_lineage.run_head_revision"] = strings.TrimSpace(lineageRunHead)
+	}
+
+	if len(conflicts) == 0 {
+		return runtime.Outcome{
+			Status:         runtime.StatusSuccess,
+			Notes:          fmt.Sprintf("fan-in merged %d branch(es): %s", len(merged), strings.Join(mergedKeys, ", ")),
+			ContextUpdates: contextUpdates,
+		}, nil
+	}
+
+	contextUpdates["parallel.fan_in.conflict_node"] = node.ID
+	exec.Engine.appendProgress(map[string]any{
+		"event":     "fan_in_merge_conflict",
+		"node_id":   node.ID,
+		"merged":    mergedKeys,
+		"conflicts": conflictMeta,
+	})
+	reason := fanInConflictSummary(conflicts)
+	out := runtime.Outcome{
+		Status:         fanInConflictStatus,
+		Notes:          fmt.Sprintf("fan-in merged %d branch(es); %s", len(merged), reason),
+		ContextUpdates: contextUpdates,
+		Meta:           map[string]any{"conflicts": conflictMeta},
+	}
+	if exec.Engine != nil && hasMatchingOutgoingCondition(exec.Engine.Graph, node.ID, out, exec.Context) {
+		return out, nil
+	}
+	// No conflict route: this is a deterministic failure, retrying the same
+	// merge would conflict again.
+	out.Status = runtime.StatusFail
+	out.FailureReason = reason
+	out.Meta["failure_class"] = failureClassDeterministic
+	out.ContextUpdates["failure_class"] = failureClassDeterministic
+	return out, nil
+}
+
+func fanInConflictSummary(conflicts []fanInMergeConflict) string {
+	parts := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		parts = append(parts, fmt.Sprintf("%s (%s)", c.BranchKey, strings.Join(c.Files, ", ")))
+	}
+	return "merge conflicts in " + strings.Join(parts, "; ")
+}
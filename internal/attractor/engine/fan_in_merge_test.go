@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func initFanInMergeRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	_ = os.WriteFile(filepath.Join(repo, "shared.txt"), []byte("base\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+	return repo
+}
+
+func readJoinOutcome(t *testing.T, logsRoot string) runtime.Outcome {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(logsRoot, "join", "status.json"))
+	if err != nil {
+		t.Fatalf("read join status.json: %v", err)
+	}
+	out, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		t.Fatalf("decode join status.json: %v", err)
+	}
+	return out
+}
+
+func TestRun_FanInMergeAll_MergesEveryDisjointBranch(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	dot := []byte(`
+digraph P {
+  graph [goal="merge all"]
+  start [shape=Mdiamond]
+  par [shape=component]
+  a [shape=parallelogram, tool_command="echo a > a.txt"]
+  b [shape=parallelogram, tool_command="echo b > b.txt"]
+  c [shape=parallelogram, tool_command="echo c > c.txt"]
+  join [shape=tripleoctagon, merge_mode=merge_all]
+  exit [shape=Msquare]
+
+  start -> par
+  par -> a -> join
+  par -> b -> join
+  par -> c -> join
+  join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res.FinalStatus)
+	}
+
+	files := runCmdOut(t, repo, "git", "ls-tree", "-r", "--name-only", res.FinalCommitSHA)
+	for _, f := range []string{"a.txt", "b.txt", "c.txt"} {
+		if !strings.Contains(files, f) {
+			t.Fatalf("final tree missing %s:\n%s", f, files)
+		}
+	}
+	merges := strings.TrimSpace(runCmdOut(t, repo, "git", "rev-list", "--merges", "--count", res.RunBranch))
+	if merges != "3" {
+		t.Fatalf("merge commits=%s want 3", merges)
+	}
+
+	out := readJoinOutcome(t, res.LogsRoot)
+	merged, _ := out.ContextUpdates["parallel.fan_in.merged"].([]any)
+	if len(merged) != 3 {
+		t.Fatalf("parallel.fan_in.merged=%v", out.ContextUpdates["parallel.fan_in.merged"])
+	}
+	if conflicts, _ := out.ContextUpdates["parallel.fan_in.conflicts"].([]any); len(conflicts) != 0 {
+		t.Fatalf("unexpected conflicts: %v", conflicts)
+	}
+}
+
+func TestRun_FanInMergeAll_RoutesConflictsToResolver(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	dot := []byte(`
+digraph P {
+  graph [goal="merge all with conflict"]
+  start [shape=Mdiamond]
+  par [shape=component]
+  a [shape=parallelogram, tool_command="echo a > a.txt"]
+  b [shape=parallelogram, tool_command="echo from-b > shared.txt"]
+  c [shape=parallelogram, tool_command="echo from-c > shared.txt"]
+  join [shape=tripleoctagon, merge_mode=merge_all]
+  resolve [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="resolve the merge"]
+  exit [shape=Msquare]
+
+  start -> par
+  par -> a -> join
+  par -> b -> join
+  par -> c -> join
+  join -> resolve [condition="outcome=conflict"]
+  join -> exit
+  resolve -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	out := readJoinOutcome(t, res.LogsRoot)
+	if out.Status != fanInConflictStatus {
+		t.Fatalf("join status=%q want %q", out.Status, fanInConflictStatus)
+	}
+	conflicts, _ := out.Meta["conflicts"].([]any)
+	if len(conflicts) != 1 {
+		t.Fatalf("conflicts=%v", out.Meta["conflicts"])
+	}
+	c, _ := conflicts[0].(map[string]any)
+	if c["branch_key"] != "c" {
+		t.Fatalf("conflict=%v", c)
+	}
+	if files, _ := c["files"].([]any); len(files) != 1 || files[0] != "shared.txt" {
+		t.Fatalf("conflict files=%v", c["files"])
+	}
+
+	// Non-conflicting branches are merged before the resolver runs.
+	files := runCmdOut(t, repo, "git", "ls-tree", "-r", "--name-only", res.FinalCommitSHA)
+	if !strings.Contains(files, "a.txt") {
+		t.Fatalf("final tree missing a.txt:\n%s", files)
+	}
+	if got := runCmdOut(t, repo, "git", "show", res.FinalCommitSHA+":shared.txt"); strings.TrimSpace(got) != "from-b" {
+		t.Fatalf("shared.txt=%q want from-b", got)
+	}
+
+	prompt, err := os.ReadFile(filepath.Join(res.LogsRoot, "resolve", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read resolver prompt: %v", err)
+	}
+	for _, want := range []string{"Fan-in merge conflict handoff", "branch_key=c", "conflicted_files=shared.txt", "resolve the merge"} {
+		if !strings.Contains(string(prompt), want) {
+			t.Fatalf("resolver prompt missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestRun_FanInMergeAll_FailsWithoutConflictRoute(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	dot := []byte(`
+digraph P {
+  graph [goal="merge all unrouted"]
+  start [shape=Mdiamond]
+  par [shape=component]
+  b [shape=parallelogram, tool_command="echo from-b > shared.txt"]
+  c [shape=parallelogram, tool_command="echo from-c > shared.txt"]
+  join [shape=tripleoctagon, merge_mode=merge_all]
+  exit [shape=Msquare]
+
+  start -> par
+  par -> b -> join
+  par -> c -> join
+  join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	_, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err == nil || !strings.Contains(err.Error(), "merge conflicts in c (shared.txt)") {
+		t.Fatalf("Run() error=%v want merge conflict failure", err)
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// graphParamsAttr declares a graph's run-time parameters:
+//
+//	params="target_dir:string=., max_iters:int=5, ticket:string"
+//
+// Each entry is name:type with an optional =default; entries without a default
+// are required at run time.
+const graphParamsAttr = "params"
+
+type graphParamType string
+
+const (
+	graphParamString graphParamType = "string"
+	graphParamInt    graphParamType = "int"
+	graphParamFloat  graphParamType = "float"
+	graphParamBool   graphParamType = "bool"
+)
+
+type graphParam struct {
+	Name       string
+	Type       graphParamType
+	Default    string
+	HasDefault bool
+}
+
+var graphParamNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedGraphParams are expanded by the engine itself.
+var reservedGraphParams = map[string]bool{"goal": true, "base_sha": true}
+
+func parseGraphParams(raw string) ([]graphParam, error) {
+	var out []graphParam
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		decl, def, hasDefault := strings.Cut(entry, "=")
+		name, typ, ok := strings.Cut(decl, ":")
+		name = strings.TrimSpace(name)
+		p := graphParam{Name: name, Type: graphParamString, Default: strings.TrimSpace(def), HasDefault: hasDefault}
+		if ok {
+			p.Type = graphParamType(strings.ToLower(strings.TrimSpace(typ)))
+		}
+		if !graphParamNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("param %q: invalid name", entry)
+		}
+		if reservedGraphParams[name] {
+			return nil, fmt.Errorf("param %q: $%s is reserved", name, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("param %q declared more than once", name)
+		}
+		seen[name] = true
+		switch p.Type {
+		case graphParamString, graphParamInt, graphParamFloat, graphParamBool:
+		default:
+			return nil, fmt.Errorf("param %q: unknown type %q (want string|int|float|bool)", name, p.Type)
+		}
+		if p.HasDefault {
+			if err := p.check(p.Default); err != nil {
+				return nil, fmt.Errorf("param %q default: %w", name, err)
+			}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (p graphParam) check(v string) error {
+	var err error
+	switch p.Type {
+	case graphParamInt:
+		_, err = strconv.Atoi(v)
+	case graphParamFloat:
+		_, err = strconv.ParseFloat(v, 64)
+	case graphParamBool:
+		_, err = strconv.ParseBool(v)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", v, p.Type)
+	}
+	return nil
+}
+
+// resolveGraphParams merges supplied values over the declared defaults and
+// type-checks them. Values for undeclared params are rejected. When supplied
+// is nil (validate-only callers), params without a default are left out
+// instead of failing.
+func resolveGraphParams(g *model.Graph, supplied map[string]string) (map[string]string, error) {
+	decls, err := parseGraphParams(g.Attrs[graphParamsAttr])
+	if err != nil {
+		return nil, err
+	}
+	declared := map[string]graphParam{}
+	for _, p := range decls {
+		declared[p.Name] = p
+	}
+	var unknown []string
+	for k := range supplied {
+		if _, ok := declared[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown param(s) %s (graph declares: %s)", strings.Join(unknown, ", "), strings.TrimSpace(g.Attrs[graphParamsAttr]))
+	}
+
+	values := map[string]string{}
+	var missing []string
+	for _, p := range decls {
+		v, ok := supplied[p.Name]
+		switch {
+		case ok:
+			v = strings.TrimSpace(v)
+		case p.HasDefault:
+			v = p.Default
+		case supplied == nil:
+			continue
+		default:
+			missing = append(missing, p.Name)
+			continue
+		}
+		if err := p.check(v); err != nil {
+			return nil, fmt.Errorf("param %s: %w", p.Name, err)
+		}
+		values[p.Name] = v
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required param(s): %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// expandGraphParams substitutes $name for every resolved param across graph,
+// node and edge attributes.
+func expandGraphParams(g *model.Graph, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	for k, v := range g.Attrs {
+		if k != graphParamsAttr {
+			g.Attrs[k] = substituteVars(v, values)
+		}
+	}
+	for _, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		for k, v := range n.Attrs {
+			n.Attrs[k] = substituteVars(v, values)
+		}
+	}
+	for _, e := range g.Edges {
+		if e == nil {
+			continue
+		}
+		for k, v := range e.Attrs {
+			e.Attrs[k] = substituteVars(v, values)
+		}
+	}
+}
+
+// suppliedGraphParams marks a run's params as supplied, so required params
+// without a value fail instead of staying unexpanded.
+func suppliedGraphParams(in map[string]string) map[string]string {
+	if in == nil {
+		return map[string]string{}
+	}
+	return in
+}
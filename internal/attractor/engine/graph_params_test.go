@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+const paramsGraph = `digraph p {
+    graph [goal="fix $ticket", params="target_dir:string=., max_iters:int=5, ticket:string"]
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    work  [llm_provider=openai, llm_model=gpt-5.2, prompt="Work in $target_dir on $ticket for up to $max_iters iterations; keep $unbound"]
+    lint  [shape=parallelogram, tool_command="make -C $target_dir lint"]
+    start -> work -> lint -> exit
+}
+`
+
+func TestParseGraphParams(t *testing.T) {
+	got, err := parseGraphParams("target_dir:string=., max_iters:int=5, ticket, ratio:float=0.5, dry:bool")
+	if err != nil {
+		t.Fatalf("parseGraphParams: %v", err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("got %d params: %+v", len(got), got)
+	}
+	if p := got[2]; p.Name != "ticket" || p.Type != graphParamString || p.HasDefault {
+		t.Fatalf("ticket=%+v", p)
+	}
+	if p := got[1]; p.Type != graphParamInt || p.Default != "5" || !p.HasDefault {
+		t.Fatalf("max_iters=%+v", p)
+	}
+
+	for _, bad := range []string{
+		"n:int=five",
+		"n:uint",
+		"9lives",
+		"goal:string",
+		"a, a",
+	} {
+		if _, err := parseGraphParams(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestPrepare_GraphParamsExpandSuppliedAndDefaultValues(t *testing.T) {
+	g, _, err := PrepareWithOptions([]byte(paramsGraph), PrepareOptions{
+		Params: map[string]string{"ticket": "KIL-42", "max_iters": "3"},
+	})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	if got, want := g.Nodes["work"].Prompt(), "Work in . on KIL-42 for up to 3 iterations; keep $unbound"; got != want {
+		t.Fatalf("prompt=%q want %q", got, want)
+	}
+	if got := g.Nodes["lint"].Attr("tool_command", ""); got != "make -C . lint" {
+		t.Fatalf("tool_command=%q", got)
+	}
+	if got := g.Attrs["goal"]; got != "fix KIL-42" {
+		t.Fatalf("goal=%q", got)
+	}
+}
+
+func TestPrepare_GraphParamsRejectMissingUnknownAndMistyped(t *testing.T) {
+	cases := map[string]map[string]string{
+		"missing required param(s): ticket": {},
+		"unknown param(s) tikcet":           {"tikcet": "x"},
+		`"lots" is not a valid int`:         {"ticket": "x", "max_iters": "lots"},
+	}
+	for want, params := range cases {
+		_, diags, err := PrepareWithOptions([]byte(paramsGraph), PrepareOptions{Params: params})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("params %v: err=%v want %q", params, err, want)
+		}
+		if len(diags) != 1 || diags[0].Rule != "graph_params" {
+			t.Fatalf("diags=%+v", diags)
+		}
+	}
+}
+
+func TestPrepare_GraphParamsValidateOnlyLeavesRequiredUnexpanded(t *testing.T) {
+	g, _, err := PrepareWithOptions([]byte(paramsGraph), PrepareOptions{})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	if got := g.Nodes["work"].Prompt(); !strings.Contains(got, "on $ticket for up to 5") {
+		t.Fatalf("prompt=%q", got)
+	}
+}
+
+func TestResume_ReusesRecordedGraphParams(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initTestRepo(t)
+
+	dot := []byte(`
+digraph P {
+  graph [goal="params", params="ticket:string, rounds:int=2"]
+  start [shape=Mdiamond]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="handle $ticket in $rounds rounds"]
+  exit [shape=Msquare]
+  start -> a -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo, Params: map[string]string{"ticket": "KIL-7"}})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "manifest.json"))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var m struct {
+		Params map[string]string `json:"params"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("unmarshal manifest: %v", err)
+	}
+	if want := map[string]string{"ticket": "KIL-7", "rounds": "2"}; !reflect.DeepEqual(m.Params, want) {
+		t.Fatalf("manifest params=%v want %v", m.Params, want)
+	}
+
+	cpPath := filepath.Join(res.LogsRoot, "checkpoint.json")
+	cp, err := runtime.LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	cp.CurrentNode = "start"
+	cp.CompletedNodes = []string{"start"}
+	if err := cp.Save(cpPath); err != nil {
+		t.Fatalf("Save checkpoint: %v", err)
+	}
+	if _, err := Resume(ctx, res.LogsRoot); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	prompt, err := os.ReadFile(filepath.Join(res.LogsRoot, "a", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read prompt: %v", err)
+	}
+	if !strings.Contains(string(prompt), "handle KIL-7 in 2 rounds") {
+		t.Fatalf("prompt=%q", prompt)
+	}
+}
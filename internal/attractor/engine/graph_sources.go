@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// graphSourcesFileName sits next to graph.dot in the logs root and snapshots
+// the include fragments and prompt files the run's graph was prepared from.
+// graph.dot keeps the raw source, so without it resume and render would
+// re-read files that may have changed or moved since the run started.
+const graphSourcesFileName = "graph_sources.json"
+
+type graphSources struct {
+	// SourcePath and RepoPath are the absolute paths the graph was prepared
+	// with; include and prompt_file paths resolve against them.
+	SourcePath string            `json:"source_path,omitempty"`
+	RepoPath   string            `json:"repo_path,omitempty"`
+	Files      map[string]string `json:"files"`
+}
+
+func newGraphSources(sourcePath, repoPath string) *graphSources {
+	abs := func(p string) string {
+		if p == "" {
+			return ""
+		}
+		if a, err := filepath.Abs(p); err == nil {
+			return a
+		}
+		return p
+	}
+	return &graphSources{SourcePath: abs(sourcePath), RepoPath: abs(repoPath), Files: map[string]string{}}
+}
+
+// recordFrom returns a PrepareOptions.ReadFile that reads through read (nil
+// reads from disk) and keeps a copy of every file it returns.
+func (gs *graphSources) recordFrom(read func(path string) ([]byte, error)) func(path string) ([]byte, error) {
+	if read == nil {
+		read = os.ReadFile
+	}
+	return func(path string) ([]byte, error) {
+		b, err := read(path)
+		if err == nil {
+			gs.Files[filepath.Clean(path)] = string(b)
+		}
+		return b, err
+	}
+}
+
+// readFile serves only the snapshotted files.
+func (gs *graphSources) readFile(path string) ([]byte, error) {
+	if s, ok := gs.Files[filepath.Clean(path)]; ok {
+		return []byte(s), nil
+	}
+	return nil, fmt.Errorf("%s is not in the run's %s", path, graphSourcesFileName)
+}
+
+func (gs *graphSources) save(logsRoot string) error {
+	return writeJSON(filepath.Join(logsRoot, graphSourcesFileName), gs)
+}
+
+// loadGraphSources reads a run's snapshot; it returns nil, nil for runs
+// started before snapshots existed.
+func loadGraphSources(logsRoot string) (*graphSources, error) {
+	b, err := os.ReadFile(filepath.Join(logsRoot, graphSourcesFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var gs graphSources
+	if err := json.Unmarshal(b, &gs); err != nil {
+		return nil, fmt.Errorf("%s: %w", graphSourcesFileName, err)
+	}
+	if gs.Files == nil {
+		gs.Files = map[string]string{}
+	}
+	return &gs, nil
+}
+
+// PrepareRunGraph prepares the graph a run executed from its logs root:
+// graph.dot plus the files snapshotted in graph_sources.json, so fragments
+// edited or deleted after the run started do not change it. Runs without a
+// snapshot resolve includes from the manifest's graph_path on disk. Empty
+// SourcePath, RepoPath and ReadFile options are filled in from the snapshot.
+func PrepareRunGraph(logsRoot string, opts PrepareOptions) (*model.Graph, []validate.Diagnostic, error) {
+	dotSource, err := os.ReadFile(filepath.Join(logsRoot, "graph.dot"))
+	if err != nil {
+		return nil, nil, err
+	}
+	gs, err := loadGraphSources(logsRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if gs != nil {
+		if opts.SourcePath == "" {
+			opts.SourcePath = gs.SourcePath
+		}
+		if opts.RepoPath == "" {
+			opts.RepoPath = gs.RepoPath
+		}
+		if opts.ReadFile == nil {
+			opts.ReadFile = gs.readFile
+		}
+	} else if opts.SourcePath == "" {
+		if m, err := loadManifest(filepath.Join(logsRoot, "manifest.json")); err == nil {
+			opts.SourcePath = m.GraphPath
+		}
+	}
+	return PrepareWithOptions(dotSource, opts)
+}
@@ -74,8 +74,10 @@ func NewDefaultRegistry() *HandlerRegistry {
 	reg.Register("conditional", &ConditionalHandler{})
 	reg.Register("wait.human", &WaitHumanHandler{})
 	reg.Register("parallel", &ParallelHandler{})
+	reg.Register("map", &MapHandler{})
 	reg.Register("parallel.fan_in", &FanInHandler{})
 	reg.Register("tool", &ToolHandler{})
+	reg.Register("http", &HTTPHandler{})
 	reg.Register("stack.manager_loop", &ManagerLoopHandler{})
 	reg.defaultHandler = &CodergenHandler{}
 	reg.Register("codergen", reg.defaultHandler)
@@ -306,6 +308,44 @@ func buildManualBoxFanInPromptPreamble(exec *Execution, node *model.Node) string
 	return strings.TrimSpace(b.String())
 }
 
+// buildMergeConflictPromptPreamble hands the branches a merge_all fan-in could
+// not merge to the node it routed to on outcome=conflict.
+func buildMergeConflictPromptPreamble(exec *Execution, node *model.Node) string {
+	if exec == nil || exec.Context == nil || node == nil {
+		return ""
+	}
+	conflictNode := strings.TrimSpace(exec.Context.GetString("parallel.fan_in.conflict_node", ""))
+	if conflictNode == "" || conflictNode != strings.TrimSpace(exec.Context.GetString("previous_node", "")) {
+		return ""
+	}
+	raw, ok := exec.Context.Get("parallel.fan_in.conflicts")
+	if !ok || raw == nil {
+		return ""
+	}
+	var conflicts []fanInMergeConflict
+	b, err := json.Marshal(raw)
+	if err != nil || json.Unmarshal(b, &conflicts) != nil || len(conflicts) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Fan-in merge conflict handoff:\n")
+	sb.WriteString(fmt.Sprintf("- Fan-in node %s merged every other branch onto the current branch, but the branches below conflict with it.\n", conflictNode))
+	if wt := strings.TrimSpace(exec.WorktreeDir); wt != "" {
+		sb.WriteString(fmt.Sprintf("- Current worktree: %s\n", wt))
+	}
+	sb.WriteString("- Unmerged branches:\n")
+	for _, c := range conflicts {
+		sb.WriteString(fmt.Sprintf("  - branch_key=%s head_sha=%s conflicted_files=%s\n",
+			strings.TrimSpace(c.BranchKey),
+			strings.TrimSpace(c.HeadSHA),
+			strings.Join(c.Files, ","),
+		))
+	}
+	sb.WriteString("- For each branch, run `git merge --no-ff <head_sha>`, resolve the conflicted files so that both sides' intent is preserved,\n")
+	sb.WriteString("  `git add` them and finish with `git commit --no-edit`. Do not discard either side's changes wholesale.\n")
+	return strings.TrimSpace(sb.String())
+}
+
 func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
 	stageDir := filepath.Join(exec.LogsRoot, node.ID)
 	stageStatusPath := filepath.Join(stageDir, "status.json")
@@ -323,6 +363,9 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	if basePrompt == "" {
 		basePrompt = node.Label()
 	}
+	if exec != nil {
+		basePrompt = interpolateContextVars(basePrompt, exec.Context)
+	}
 
 	// Fidelity preamble (attractor-spec context fidelity): when fidelity is not `full`, synthesize
 	// a context carryover preamble at execution time.
@@ -424,6 +467,35 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 			}
 		}
 	}
+	if preamble := buildMergeConflictPromptPreamble(exec, node); preamble != "" {
+		if strings.TrimSpace(promptText) == "" {
+			promptText = preamble
+		} else {
+			promptText = preamble + "\n\n" + strings.TrimSpace(promptText)
+		}
+		exec.Engine.appendProgress(map[string]any{
+			"event":   "fan_in_merge_conflict_handoff",
+			"node_id": node.ID,
+		})
+	}
+	outputSchema, err := loadOutputSchema(exec, node)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
+	outputPath := ""
+	if outputSchema != nil {
+		outputPath = codergenOutputPath(exec, node)
+		_ = os.Remove(outputPath)
+		_ = os.MkdirAll(filepath.Dir(outputPath), 0o755)
+		promptText = strings.TrimSpace(promptText) + "\n\n" + buildOutputSchemaPromptPreamble(exec, node, outputSchema, outputPath)
+	}
+	// Manager steering is appended last so the supervisor's guidance is the
+	// final instruction the agent reads.
+	if exec != nil && exec.Engine != nil {
+		if steer := exec.Engine.steeringPromptPreamble(); steer != "" {
+			promptText = strings.TrimSpace(promptText) + "\n\n" + steer
+		}
+	}
 	if exec != nil && exec.Engine != nil && strings.TrimSpace(contract.PrimaryPath) != "" {
 		exec.Engine.appendProgress(map[string]any{
 			"event":                "status_contract",
@@ -484,6 +556,29 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 		})
 	}
 
+	// Validated structured output is merged into whichever outcome wins below.
+	var outputUpdates map[string]any
+	if outputSchema != nil && !stageReportedFailure(out, stageStatusPath) {
+		obj, verr := readCodergenOutput(outputSchema, outputPath, resp)
+		if verr != nil {
+			exec.Context.Set(outputSchemaErrorContextKey(node.ID), verr.Error())
+			_ = os.Remove(stageStatusPath)
+			return schemaViolationOutcome(node.ID, verr), nil
+		}
+		exec.Context.Set(outputSchemaErrorContextKey(node.ID), "")
+		_ = writeJSON(filepath.Join(stageDir, codergenOutputFileName), obj)
+		outputUpdates = outputContextUpdates(node.ID, obj)
+		if err := mergeStatusFileContextUpdates(stageStatusPath, outputUpdates); err != nil {
+			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+		}
+	}
+	withOutput := func(o runtime.Outcome) runtime.Outcome {
+		for k, v := range outputUpdates {
+			o.ContextUpdates[k] = v
+		}
+		return o
+	}
+
 	if out != nil {
 		// Spec §5.1: always set last_stage/last_response on handler completion.
 		if out.ContextUpdates == nil {
@@ -495,7 +590,7 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 		if _, ok := out.ContextUpdates["last_response"]; !ok {
 			out.ContextUpdates["last_response"] = truncate(resp, 200)
 		}
-		return *out, nil
+		return withOutput(*out), nil
 	}
 
 	// If the backend didn't return an explicit outcome, require a status.json signal unless
@@ -503,27 +598,27 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	if _, err := os.Stat(stageStatusPath); err == nil {
 		// The engine will parse the status.json after the handler returns.
 		// Spec §5.1: always set last_stage/last_response on handler completion.
-		return runtime.Outcome{
+		return withOutput(runtime.Outcome{
 			Status: runtime.StatusSuccess,
 			Notes:  "codergen completed (status.json written)",
 			ContextUpdates: map[string]any{
 				"last_stage":    node.ID,
 				"last_response": truncate(resp, 200),
 			},
-		}, nil
+		}), nil
 	}
 	autoStatus := strings.EqualFold(node.Attr("auto_status", "false"), "true")
 	if autoStatus {
-		return runtime.Outcome{
+		return withOutput(runtime.Outcome{
 			Status: runtime.StatusSuccess,
 			Notes:  "auto-status: handler completed without writing status",
 			ContextUpdates: map[string]any{
 				"last_stage":    node.ID,
 				"last_response": truncate(resp, 200),
 			},
-		}, nil
+		}), nil
 	}
-	return runtime.Outcome{
+	return withOutput(runtime.Outcome{
 		Status:        runtime.StatusFail,
 		FailureReason: "missing status.json (auto_status=false)",
 		Notes:         "codergen completed without an outcome or status.json",
@@ -531,7 +626,7 @@ func (h *CodergenHandler) Execute(ctx context.Context, exec *Execution, node *mo
 			"last_stage":    node.ID,
 			"last_response": truncate(resp, 200),
 		},
-	}, nil
+	}), nil
 }
 
 type WaitHumanHandler struct{}
@@ -565,6 +660,14 @@ func (h *WaitHumanHandler) Execute(ctx context.Context, exec *Execution, node *m
 		})
 	}
 
+	qtype, err := ParseHumanQuestionType(node.Attr("human.question_type", ""))
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
+	if qtype != QuestionSingleSelect {
+		return executeTypedHumanGate(ctx, exec, node, qtype, options)
+	}
+
 	q := Question{
 		Type:    QuestionSingleSelect,
 		Text:    node.Attr("question", node.Label()),
@@ -621,15 +724,19 @@ func (h *WaitHumanHandler) Execute(ctx context.Context, exec *Execution, node *m
 	// Spec §9.6: emit InterviewCompleted CXDB event.
 	exec.Engine.cxdbInterviewCompleted(ctx, node.ID, ans.Value, interviewDurationMS)
 
+	updates := map[string]any{
+		"human.gate.selected": selected.To,
+		"human.gate.label":    selected.Label,
+	}
+	if key := strings.TrimSpace(node.Attr("human.input_key", "")); key != "" {
+		updates[key] = selected.Label
+	}
 	return runtime.Outcome{
 		Status:           runtime.StatusSuccess,
 		SuggestedNextIDs: []string{selected.To},
 		PreferredLabel:   selected.Label,
-		ContextUpdates: map[string]any{
-			"human.gate.selected": selected.To,
-			"human.gate.label":    selected.Label,
-		},
-		Notes: "human gate selected",
+		ContextUpdates:   updates,
+		Notes:            "human gate selected",
 	}, nil
 }
 
@@ -669,6 +776,9 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 	if cmdStr == "" {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "no tool_command specified"}, nil
 	}
+	if err := checkSandboxUnsupported(execCtx, node, "a tool command", true); err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
 	if toolCommandAbsPathRE.MatchString(cmdStr) {
 		warnEngine(execCtx, fmt.Sprintf("tool_command for node %q contains 'cd /…' which overrides worktree CWD %q", node.ID, execCtx.WorktreeDir))
 	}
@@ -722,7 +832,7 @@ func (h *ToolHandler) Execute(ctx context.Context, execCtx *Execution, node *mod
 	defer cancel()
 	cmd := exec.CommandContext(cctx, "bash", "-c", cmdStr)
 	cmd.Dir = execCtx.WorktreeDir
-	cmd.Env = buildBaseNodeEnv(artifactPolicyFromExecution(execCtx))
+	cmd.Env = mergeEnvWithOverrides(buildBaseNodeEnv(artifactPolicyFromExecution(execCtx)), mapItemEnv(execCtx.Context))
 	// Avoid hanging on interactive reads; tool_command doesn't provide a way to supply stdin.
 	cmd.Stdin = strings.NewReader("")
 	stdoutPath := filepath.Join(stageDir, "stdout.log")
@@ -0,0 +1,383 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/oklog/ulid/v2"
+)
+
+// HTTPHandler (type=http) makes one HTTP request and routes on the response.
+//
+// Attributes:
+//   - http.url (required), http.method (default GET, or POST with a body)
+//   - http.headers: a JSON object, or one "Name: value" per line
+//   - http.body: request body
+//   - http.expect_status: comma-separated codes or classes (default 2xx)
+//   - http.extract: comma-separated key=$.json.path pairs copied into context
+//   - timeout: request timeout (default 60s)
+//
+// $context.<key> references in the URL, headers and body are expanded.
+type HTTPHandler struct{}
+
+const (
+	httpRequestFileName  = "http_request.json"
+	httpResponseFileName = "http_response.json"
+
+	defaultHTTPTimeout   = 60 * time.Second
+	maxHTTPResponseBytes = 10 << 20
+)
+
+func (h *HTTPHandler) Execute(ctx context.Context, execCtx *Execution, node *model.Node) (runtime.Outcome, error) {
+	stageDir := filepath.Join(execCtx.LogsRoot, node.ID)
+	if err := checkSandboxUnsupported(execCtx, node, "an http request", true); err != nil {
+		return httpFailureOutcome(err.Error(), failureClassDeterministic, nil), nil
+	}
+	req, err := buildHTTPNodeRequest(ctx, execCtx.Context, node)
+	if err != nil {
+		return httpFailureOutcome(err.Error(), failureClassDeterministic, nil), nil
+	}
+	expect, err := parseHTTPExpectStatus(node.Attr("http.expect_status", ""))
+	if err != nil {
+		return httpFailureOutcome(err.Error(), failureClassDeterministic, nil), nil
+	}
+	extract, err := parseHTTPExtract(node.Attr("http.extract", ""))
+	if err != nil {
+		return httpFailureOutcome(err.Error(), failureClassDeterministic, nil), nil
+	}
+	timeout := parseDuration(node.Attr("timeout", ""), 0)
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	reqBody := interpolateContextVars(node.Attr("http.body", ""), execCtx.Context)
+	if err := writeJSON(filepath.Join(stageDir, httpRequestFileName), map[string]any{
+		"method":     req.Method,
+		"url":        req.URL.Redacted(),
+		"headers":    redactHTTPHeaders(req.Header),
+		"body":       reqBody,
+		"timeout_ms": timeout.Milliseconds(),
+	}); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("write %s: %v", httpRequestFileName, err))
+	}
+	callID := ulid.Make().String()
+	if execCtx.Engine != nil && execCtx.Engine.CXDB != nil {
+		argsJSON, _ := json.Marshal(map[string]any{
+			"method":  req.Method,
+			"url":     req.URL.Redacted(),
+			"timeout": timeout.String(),
+		})
+		if _, _, err := execCtx.Engine.CXDB.Append(ctx, "com.kilroy.attractor.ToolCall", 1, map[string]any{
+			"run_id":         execCtx.Engine.Options.RunID,
+			"node_id":        node.ID,
+			"tool_name":      "http",
+			"call_id":        callID,
+			"arguments_json": string(argsJSON),
+		}); err != nil {
+			execCtx.Engine.Warn(fmt.Sprintf("cxdb append ToolCall failed (node=%s call_id=%s): %v", node.ID, callID, err))
+		}
+	}
+	recordResult := func(output string, isError bool) {
+		if execCtx.Engine == nil || execCtx.Engine.CXDB == nil {
+			return
+		}
+		if _, _, err := execCtx.Engine.CXDB.Append(ctx, "com.kilroy.attractor.ToolResult", 1, map[string]any{
+			"run_id":    execCtx.Engine.Options.RunID,
+			"node_id":   node.ID,
+			"tool_name": "http",
+			"call_id":   callID,
+			"output":    truncate(output, 8_000),
+			"is_error":  isError,
+		}); err != nil {
+			execCtx.Engine.Warn(fmt.Sprintf("cxdb append ToolResult failed (node=%s call_id=%s): %v", node.ID, callID, err))
+		}
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req.WithContext(cctx))
+	if err != nil {
+		reason := fmt.Sprintf("http %s %s: %v", req.Method, req.URL.Redacted(), err)
+		if errors.Is(cctx.Err(), context.DeadlineExceeded) {
+			reason = fmt.Sprintf("http %s %s timed out after %s", req.Method, req.URL.Redacted(), timeout)
+		}
+		_ = writeJSON(filepath.Join(stageDir, httpResponseFileName), map[string]any{
+			"error":       err.Error(),
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+		recordResult(reason, true)
+		return httpFailureOutcome(reason, failureClassTransientInfra, nil), nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseBytes))
+	dur := time.Since(start)
+	if err := writeJSON(filepath.Join(stageDir, httpResponseFileName), map[string]any{
+		"status_code": resp.StatusCode,
+		"headers":     redactHTTPHeaders(resp.Header),
+		"body":        string(body),
+		"duration_ms": dur.Milliseconds(),
+	}); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("write %s: %v", httpResponseFileName, err))
+	}
+	if readErr != nil {
+		reason := fmt.Sprintf("http %s %s: reading response: %v", req.Method, req.URL.Redacted(), readErr)
+		recordResult(reason, true)
+		return httpFailureOutcome(reason, failureClassTransientInfra, nil), nil
+	}
+
+	updates := map[string]any{
+		"http.status_code": resp.StatusCode,
+		"http.response":    truncate(string(body), 8_000),
+	}
+	if !httpStatusExpected(resp.StatusCode, expect) {
+		reason := fmt.Sprintf("http %s %s returned %s", req.Method, req.URL.Redacted(), resp.Status)
+		class := failureClassDeterministic
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+			class = failureClassTransientInfra
+		}
+		recordResult(string(body), true)
+		return httpFailureOutcome(reason, class, updates), nil
+	}
+	if len(extract) > 0 {
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			reason := fmt.Sprintf("http.extract: response is not JSON: %v", err)
+			recordResult(string(body), true)
+			return httpFailureOutcome(reason, failureClassDeterministic, updates), nil
+		}
+		for _, x := range extract {
+			v, err := evalJSONPath(doc, x.path)
+			if err != nil {
+				reason := fmt.Sprintf("http.extract %s=%s: %v", x.key, x.path, err)
+				recordResult(string(body), true)
+				return httpFailureOutcome(reason, failureClassDeterministic, updates), nil
+			}
+			updates[x.key] = v
+		}
+	}
+	recordResult(string(body), false)
+	return runtime.Outcome{
+		Status:         runtime.StatusSuccess,
+		ContextUpdates: updates,
+		Notes:          fmt.Sprintf("http %s %s", req.Method, resp.Status),
+	}, nil
+}
+
+func httpFailureOutcome(reason, class string, updates map[string]any) runtime.Outcome {
+	if updates == nil {
+		updates = map[string]any{}
+	}
+	updates["failure_class"] = class
+	return runtime.Outcome{
+		Status:         runtime.StatusFail,
+		FailureReason:  reason,
+		Meta:           map[string]any{"failure_class": class},
+		ContextUpdates: updates,
+	}
+}
+
+func buildHTTPNodeRequest(ctx context.Context, rc *runtime.Context, node *model.Node) (*http.Request, error) {
+	url := strings.TrimSpace(interpolateContextVars(node.Attr("http.url", ""), rc))
+	if url == "" {
+		return nil, fmt.Errorf("no http.url specified")
+	}
+	body := interpolateContextVars(node.Attr("http.body", ""), rc)
+	method := strings.ToUpper(strings.TrimSpace(node.Attr("http.method", "")))
+	if method == "" {
+		method = http.MethodGet
+		if body != "" {
+			method = http.MethodPost
+		}
+	}
+	var reader io.Reader
+	if body != "" {
+		reader = bytes.NewReader([]byte(body))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	headers, err := parseHTTPHeaders(interpolateContextVars(node.Attr("http.headers", ""), rc))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" && json.Valid([]byte(body)) {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// parseHTTPHeaders accepts a JSON object of strings or "Name: value" lines.
+func parseHTTPHeaders(raw string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	out := map[string]string{}
+	if raw == "" {
+		return out, nil
+	}
+	if strings.HasPrefix(raw, "{") {
+		if err := json.Unmarshal([]byte(raw), &out); err != nil {
+			return nil, fmt.Errorf("http.headers is not a JSON object of strings: %w", err)
+		}
+		return out, nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(raw, `\n`, "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("http.headers: expected \"Name: value\", got %q", line)
+		}
+		out[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
+
+// parseHTTPExpectStatus parses codes ("200") and classes ("2xx"). Each entry
+// is returned as a three-character pattern where 'x' matches any digit.
+func parseHTTPExpectStatus(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return []string{"2xx"}, nil
+	}
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		p := strings.ToLower(strings.TrimSpace(part))
+		if p == "" {
+			continue
+		}
+		if len(p) != 3 || p[0] < '1' || p[0] > '5' || strings.Trim(p[1:], "0123456789x") != "" {
+			return nil, fmt.Errorf("http.expect_status: invalid status %q", part)
+		}
+		out = append(out, p)
+	}
+	if len(out) == 0 {
+		return []string{"2xx"}, nil
+	}
+	return out, nil
+}
+
+func httpStatusExpected(code int, patterns []string) bool {
+	s := strconv.Itoa(code)
+	for _, p := range patterns {
+		if len(s) != len(p) {
+			continue
+		}
+		match := true
+		for i := range p {
+			if p[i] != 'x' && p[i] != s[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+type httpExtraction struct {
+	key  string
+	path string
+}
+
+func parseHTTPExtract(raw string) ([]httpExtraction, error) {
+	var out []httpExtraction
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, path, ok := strings.Cut(part, "=")
+		key, path = strings.TrimSpace(key), strings.TrimSpace(path)
+		if !ok || key == "" || !strings.HasPrefix(path, "$") {
+			return nil, fmt.Errorf("http.extract: expected key=$.path, got %q", part)
+		}
+		out = append(out, httpExtraction{key: key, path: path})
+	}
+	return out, nil
+}
+
+// evalJSONPath resolves the subset of JSONPath used by http.extract: $,
+// .field and [index], e.g. $.items[0].id.
+func evalJSONPath(doc any, path string) (any, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	cur := doc
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			field := rest[:end]
+			rest = rest[end:]
+			obj, ok := cur.(map[string]any)
+			if !ok || field == "" {
+				return nil, fmt.Errorf("cannot select field %q", field)
+			}
+			v, ok := obj[field]
+			if !ok {
+				return nil, fmt.Errorf("field %q not found", field)
+			}
+			cur = v
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in %q", path)
+			}
+			idx, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q", rest[1:end])
+			}
+			rest = rest[end+1:]
+			arr, ok := cur.([]any)
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("index %d out of range", idx)
+			}
+			cur = arr[idx]
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest[0], path)
+		}
+	}
+	return cur, nil
+}
+
+// redactHTTPHeaders returns headers for the stage logs with credentials masked.
+func redactHTTPHeaders(h http.Header) map[string]string {
+	out := map[string]string{}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strings.Join(h.Values(k), ", ")
+		lk := strings.ToLower(k)
+		switch {
+		case lk == "authorization", lk == "proxy-authorization", lk == "cookie", lk == "set-cookie",
+			strings.Contains(lk, "token"), strings.Contains(lk, "secret"), strings.Contains(lk, "api-key"), strings.Contains(lk, "apikey"):
+			v = "[redacted]"
+		}
+		out[k] = v
+	}
+	return out
+}
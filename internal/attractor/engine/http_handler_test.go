@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_HTTPNode_RetriesTransientStatusAndExtractsIntoContext(t *testing.T) {
+	var calls atomic.Int32
+	var gotBody, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		gotBody, gotAuth = string(b), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"state":"queued","items":[{"id":"d-42"}]}`))
+	}))
+	defer srv.Close()
+
+	repo := initFanInMergeRepo(t)
+	dot := []byte(fmt.Sprintf(`
+digraph P {
+  graph [goal="deploy", retry.backoff.initial_delay_ms=1, retry.backoff.jitter=false]
+  start [shape=Mdiamond]
+  deploy [type=http, max_retries=1, http.url="%s/deploy", http.headers="Authorization: Bearer secret-token",
+          http.body="{\"env\":\"$context.graph.goal\"}", http.extract="deploy.id=$.items[0].id, deploy.state=$.state"]
+  queued [shape=parallelogram, tool_command="echo queued > state.txt"]
+  exit [shape=Msquare]
+  start -> deploy
+  deploy -> queued [condition="context.deploy.state=queued"]
+  deploy -> exit
+  queued -> exit
+}
+`, strings.Replace(srv.URL, "http://", "http://ci:url-pass@", 1)))
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res.FinalStatus)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("requests=%d want 2 (503 retried once)", calls.Load())
+	}
+	if gotBody != `{"env":"deploy"}` || gotAuth != "Bearer secret-token" {
+		t.Fatalf("body=%q auth=%q", gotBody, gotAuth)
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "queued", "status.json"))
+
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "deploy", httpRequestFileName))
+	if err != nil {
+		t.Fatalf("read %s: %v", httpRequestFileName, err)
+	}
+	var logged struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+	}
+	_ = json.Unmarshal(b, &logged)
+	if logged.Method != http.MethodPost || logged.Headers["Authorization"] != "[redacted]" ||
+		strings.Contains(string(b), "url-pass") || !strings.Contains(logged.URL, "ci:xxxxx@") {
+		t.Fatalf("logged request=%s", b)
+	}
+	resp, _ := os.ReadFile(filepath.Join(res.LogsRoot, "deploy", httpResponseFileName))
+	if !strings.Contains(string(resp), `"status_code": 200`) {
+		t.Fatalf("logged response=%s", resp)
+	}
+}
+
+func TestHTTPHandler_UnexpectedClientErrorIsDeterministic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	g, _, err := Prepare([]byte(fmt.Sprintf(`
+digraph P {
+  start [shape=Mdiamond]
+  hook [type=http, http.url="%s/hook"]
+  exit [shape=Msquare]
+  start -> hook -> exit
+}
+`, srv.URL)))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	exec := &Execution{Graph: g, Context: runtime.NewContext(), LogsRoot: t.TempDir()}
+	_ = os.MkdirAll(filepath.Join(exec.LogsRoot, "hook"), 0o755)
+	out, err := (&HTTPHandler{}).Execute(context.Background(), exec, g.Nodes["hook"])
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if out.Status != runtime.StatusFail || readFailureClassHint(out) != failureClassDeterministic {
+		t.Fatalf("outcome=%+v", out)
+	}
+	if out.ContextUpdates["http.status_code"] != http.StatusNotFound {
+		t.Fatalf("http.status_code=%v", out.ContextUpdates["http.status_code"])
+	}
+
+	g.Nodes["hook"].Attrs["http.expect_status"] = "404"
+	out, _ = (&HTTPHandler{}).Execute(context.Background(), exec, g.Nodes["hook"])
+	if out.Status != runtime.StatusSuccess {
+		t.Fatalf("expected 404 to be accepted, got %+v", out)
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	var doc any
+	_ = json.Unmarshal([]byte(`{"a":{"b":[1,{"c":"x"}]},"n":2}`), &doc)
+	cases := map[string]any{
+		"$.a.b[1].c": "x",
+		"$.n":        float64(2),
+		"$.a.b[0]":   float64(1),
+	}
+	for path, want := range cases {
+		got, err := evalJSONPath(doc, path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("evalJSONPath(%s)=%v, %v want %v", path, got, err, want)
+		}
+	}
+	for _, path := range []string{"$.missing", "$.a.b[5]", "$.n.x"} {
+		if _, err := evalJSONPath(doc, path); err == nil {
+			t.Fatalf("evalJSONPath(%s): expected error", path)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/jsonschemautil"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// defaultHumanInputKey is the context key a typed human gate writes its
+// answer to when human.input_key is not set.
+const defaultHumanInputKey = "human.gate.answer"
+
+// humanGateMaxAttempts bounds how often a gate re-asks after an answer that
+// fails validation (bad JSON, schema mismatch, unknown option).
+const humanGateMaxAttempts = 3
+
+// ParseHumanQuestionType maps a human.question_type attribute value to a
+// QuestionType. Both the spec spelling (FREE_TEXT) and lower case
+// (free_text) are accepted; empty means SINGLE_SELECT.
+func ParseHumanQuestionType(v string) (QuestionType, error) {
+	switch strings.ToUpper(strings.TrimSpace(v)) {
+	case "", string(QuestionSingleSelect):
+		return QuestionSingleSelect, nil
+	case string(QuestionMultiSelect):
+		return QuestionMultiSelect, nil
+	case string(QuestionFreeText):
+		return QuestionFreeText, nil
+	case string(QuestionConfirm):
+		return QuestionConfirm, nil
+	case string(QuestionYesNo):
+		return QuestionYesNo, nil
+	default:
+		return "", fmt.Errorf("unknown human.question_type %q (want single_select|multi_select|free_text|confirm|yes_no)", v)
+	}
+}
+
+// ParseHumanSchema decodes a human.schema attribute (an inline JSON Schema
+// object) and checks that it compiles.
+func ParseHumanSchema(raw string) (map[string]any, error) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, fmt.Errorf("human.schema is not a JSON object: %w", err)
+	}
+	if _, err := jsonschemautil.CompileMapSchema(schema, jsonschema.Draft2020); err != nil {
+		return nil, fmt.Errorf("human.schema: %w", err)
+	}
+	return schema, nil
+}
+
+// ValidateHumanAnswer checks an answer against its question and returns the
+// value a typed human gate stores in context: the text for FREE_TEXT, the
+// decoded object when the question carries a schema, option labels for
+// MULTI_SELECT and "yes"/"no" for CONFIRM and YES_NO.
+func ValidateHumanAnswer(q Question, ans Answer) (any, error) {
+	switch q.Type {
+	case QuestionFreeText:
+		text := strings.TrimSpace(ans.Text)
+		if text == "" {
+			text = strings.TrimSpace(ans.Value)
+		}
+		schema, _ := q.Metadata["schema"].(map[string]any)
+		if schema == nil {
+			if text == "" {
+				return nil, fmt.Errorf("answer text is empty")
+			}
+			return text, nil
+		}
+		var v any
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("answer is not valid JSON: %w", err)
+		}
+		compiled, err := jsonschemautil.CompileMapSchema(schema, jsonschema.Draft2020)
+		if err != nil {
+			return nil, err
+		}
+		if err := compiled.Validate(v); err != nil {
+			return nil, fmt.Errorf("answer does not match schema: %w", err)
+		}
+		return v, nil
+	case QuestionMultiSelect:
+		vals := ans.Values
+		if len(vals) == 0 && strings.TrimSpace(ans.Value) != "" {
+			vals = strings.Split(ans.Value, ",")
+		}
+		labels := []string{}
+		for _, raw := range vals {
+			want := strings.TrimSpace(raw)
+			if want == "" {
+				continue
+			}
+			o, ok := findOption(q.Options, want)
+			if !ok {
+				return nil, fmt.Errorf("unknown option %q", want)
+			}
+			labels = append(labels, o.Label)
+		}
+		return labels, nil
+	case QuestionConfirm, QuestionYesNo:
+		switch strings.ToLower(strings.TrimSpace(ans.Value)) {
+		case "y", "yes", "true":
+			return "yes", nil
+		case "n", "no", "false":
+			return "no", nil
+		default:
+			return nil, fmt.Errorf("answer %q is not yes or no", ans.Value)
+		}
+	default:
+		return strings.TrimSpace(ans.Value), nil
+	}
+}
+
+func findOption(opts []Option, want string) (Option, bool) {
+	for _, o := range opts {
+		if strings.EqualFold(o.Key, want) || strings.EqualFold(o.Label, want) || (o.To != "" && strings.EqualFold(o.To, want)) {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
+
+// humanListOptions builds MULTI_SELECT options from human.options
+// ("postgres, sqlite, mysql"); keys are 1-based positions.
+func humanListOptions(raw string) []Option {
+	var opts []Option
+	for _, part := range strings.Split(raw, ",") {
+		label := strings.TrimSpace(part)
+		if label == "" {
+			continue
+		}
+		opts = append(opts, Option{Key: fmt.Sprintf("%d", len(opts)+1), Label: label})
+	}
+	return opts
+}
+
+// executeTypedHumanGate handles wait.human nodes whose human.question_type is
+// not SINGLE_SELECT. The answer is written to context under human.input_key;
+// routing then follows the node's edges as usual, except that CONFIRM/YES_NO
+// gates prefer an edge whose label starts with Y or N to match the answer.
+func executeTypedHumanGate(ctx context.Context, exec *Execution, node *model.Node, qtype QuestionType, edgeOptions []Option) (runtime.Outcome, error) {
+	q := Question{
+		Type:     qtype,
+		Text:     node.Attr("question", node.Label()),
+		Stage:    node.ID,
+		Metadata: map[string]any{},
+	}
+	inputKey := strings.TrimSpace(node.Attr("human.input_key", ""))
+	if inputKey == "" {
+		inputKey = defaultHumanInputKey
+	}
+	q.Metadata["input_key"] = inputKey
+	switch qtype {
+	case QuestionMultiSelect:
+		q.Options = humanListOptions(node.Attr("human.options", ""))
+		if len(q.Options) == 0 {
+			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "multi_select human gate has no human.options"}, nil
+		}
+	case QuestionConfirm, QuestionYesNo:
+		q.Options = edgeOptions
+	case QuestionFreeText:
+		if raw := strings.TrimSpace(node.Attr("human.schema", "")); raw != "" {
+			schema, err := ParseHumanSchema(raw)
+			if err != nil {
+				return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+			}
+			q.Metadata["schema"] = schema
+		}
+	}
+
+	interviewer := exec.Engine.Interviewer
+	if interviewer == nil {
+		interviewer = &AutoApproveInterviewer{}
+	}
+	var value any
+	for attempt := 1; ; attempt++ {
+		interviewStart := time.Now()
+		exec.Engine.cxdbInterviewStarted(ctx, node.ID, q.Text, string(q.Type))
+		ans := interviewer.Ask(q)
+		durationMS := time.Since(interviewStart).Milliseconds()
+		if ans.TimedOut {
+			exec.Engine.cxdbInterviewTimeout(ctx, node.ID, q.Text, durationMS)
+			dc := strings.TrimSpace(node.Attr("human.default_choice", ""))
+			if dc == "" {
+				return runtime.Outcome{Status: runtime.StatusRetry, FailureReason: "human gate timeout, no default"}, nil
+			}
+			ans = Answer{Value: dc, Text: dc, Values: []string{dc}}
+		} else if ans.Skipped {
+			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "human gate skipped interaction"}, nil
+		}
+		v, err := ValidateHumanAnswer(q, ans)
+		if err == nil {
+			exec.Engine.cxdbInterviewCompleted(ctx, node.ID, humanAnswerString(v), durationMS)
+			value = v
+			break
+		}
+		if attempt >= humanGateMaxAttempts || ans.TimedOut {
+			return runtime.Outcome{
+				Status:        runtime.StatusFail,
+				FailureReason: fmt.Sprintf("human gate answer rejected: %v", err),
+			}, nil
+		}
+		interviewer.Inform(fmt.Sprintf("Invalid answer: %v. Please try again.", err), node.ID)
+		q.Metadata["validation_error"] = err.Error()
+	}
+
+	out := runtime.Outcome{
+		Status: runtime.StatusSuccess,
+		ContextUpdates: map[string]any{
+			inputKey: value,
+		},
+		Notes: "human gate answered",
+	}
+	if yn, ok := value.(string); ok && (qtype == QuestionConfirm || qtype == QuestionYesNo) {
+		want := strings.ToUpper(yn[:1])
+		for _, o := range edgeOptions {
+			if o.Key == want {
+				out.SuggestedNextIDs = []string{o.To}
+				out.PreferredLabel = o.Label
+				out.ContextUpdates["human.gate.selected"] = o.To
+				out.ContextUpdates["human.gate.label"] = o.Label
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func humanAnswerString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// contextVarRe matches $context.<key> references in prompts. Keys may contain
+// dots, but a trailing dot (end of sentence) is not part of the key.
+var contextVarRe = regexp.MustCompile(`\$context\.([A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+)*)`)
+
+// interpolateContextVars replaces $context.<key> with the current context
+// value so answers collected at human gates (or any other context value) can
+// be used in later prompts. Unknown keys are left untouched.
+func interpolateContextVars(text string, ctx *runtime.Context) string {
+	if ctx == nil || !strings.Contains(text, "$context.") {
+		return text
+	}
+	return contextVarRe.ReplaceAllStringFunc(text, func(m string) string {
+		key := contextVarRe.FindStringSubmatch(m)[1]
+		v, ok := ctx.Get(key)
+		if !ok || v == nil {
+			return m
+		}
+		return humanAnswerString(v)
+	})
+}
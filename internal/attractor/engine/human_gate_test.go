@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestValidateHumanAnswer(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"engine"},
+		"properties": map[string]any{
+			"engine": map[string]any{"enum": []any{"postgres", "sqlite"}},
+		},
+	}
+	multi := Question{Type: QuestionMultiSelect, Options: humanListOptions("postgres, sqlite, mysql")}
+	cases := []struct {
+		name    string
+		q       Question
+		ans     Answer
+		want    any
+		wantErr string
+	}{
+		{"free text", Question{Type: QuestionFreeText}, Answer{Text: " use postgres, not sqlite "}, "use postgres, not sqlite", ""},
+		{"empty free text", Question{Type: QuestionFreeText}, Answer{}, nil, "empty"},
+		{"schema ok", Question{Type: QuestionFreeText, Metadata: map[string]any{"schema": schema}}, Answer{Text: `{"engine":"postgres"}`}, map[string]any{"engine": "postgres"}, ""},
+		{"schema mismatch", Question{Type: QuestionFreeText, Metadata: map[string]any{"schema": schema}}, Answer{Text: `{"engine":"oracle"}`}, nil, "does not match schema"},
+		{"schema bad json", Question{Type: QuestionFreeText, Metadata: map[string]any{"schema": schema}}, Answer{Text: `engine=postgres`}, nil, "not valid JSON"},
+		{"multi keys and labels", multi, Answer{Values: []string{"1", "mysql"}}, []string{"postgres", "mysql"}, ""},
+		{"multi comma value", multi, Answer{Value: "2,3"}, []string{"sqlite", "mysql"}, ""},
+		{"multi unknown", multi, Answer{Values: []string{"oracle"}}, nil, `unknown option "oracle"`},
+		{"yes", Question{Type: QuestionYesNo}, Answer{Value: "YES"}, "yes", ""},
+		{"confirm no", Question{Type: QuestionConfirm}, Answer{Value: "n"}, "no", ""},
+		{"yes_no garbage", Question{Type: QuestionYesNo}, Answer{Value: "maybe"}, nil, "not yes or no"},
+	}
+	for _, tc := range cases {
+		got, err := ValidateHumanAnswer(tc.q, tc.ans)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("%s: err=%v want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %#v, %v want %#v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestWaitHumanHandler_StructuredAnswerReasksUntilValid(t *testing.T) {
+	g := newTestGraph(t, "gate", "next", "next")
+	node := g.Nodes["gate"]
+	node.Attrs["human.question_type"] = "free_text"
+	node.Attrs["human.input_key"] = "db"
+	node.Attrs["human.schema"] = `{"type":"object","required":["engine"]}`
+
+	var asked []Question
+	answers := []Answer{{Text: "postgres please"}, {Text: `{"engine":"postgres"}`}}
+	exec := &Execution{Graph: g, Engine: &Engine{Interviewer: &CallbackInterviewer{Fn: func(q Question) Answer {
+		asked = append(asked, q)
+		a := answers[0]
+		answers = answers[1:]
+		return a
+	}}}}
+
+	out, err := (&WaitHumanHandler{}).Execute(context.Background(), exec, node)
+	if err != nil || out.Status != runtime.StatusSuccess {
+		t.Fatalf("out=%+v err=%v", out, err)
+	}
+	if len(asked) != 2 || asked[0].Type != QuestionFreeText || asked[0].Metadata["schema"] == nil {
+		t.Fatalf("asked=%+v", asked)
+	}
+	if e, _ := asked[1].Metadata["validation_error"].(string); !strings.Contains(e, "not valid JSON") {
+		t.Fatalf("second ask validation_error=%q", e)
+	}
+	if got := out.ContextUpdates["db"]; !reflect.DeepEqual(got, map[string]any{"engine": "postgres"}) {
+		t.Fatalf("db=%#v", got)
+	}
+}
+
+func TestWaitHumanHandler_TypedGateFailsAfterRepeatedInvalidAnswers(t *testing.T) {
+	g := newTestGraph(t, "gate", "next", "next")
+	node := g.Nodes["gate"]
+	node.Attrs["human.question_type"] = "multi_select"
+	node.Attrs["human.options"] = "a, b"
+	calls := 0
+	exec := &Execution{Graph: g, Engine: &Engine{Interviewer: &CallbackInterviewer{Fn: func(q Question) Answer {
+		calls++
+		return Answer{Values: []string{"z"}}
+	}}}}
+	out, _ := (&WaitHumanHandler{}).Execute(context.Background(), exec, node)
+	if out.Status != runtime.StatusFail || !strings.Contains(out.FailureReason, `unknown option "z"`) || calls != humanGateMaxAttempts {
+		t.Fatalf("out=%+v calls=%d", out, calls)
+	}
+}
+
+func TestWaitHumanHandler_YesNoRoutesOnAnswer(t *testing.T) {
+	g := newTestGraph(t, "gate", "[Y] Ship it", "ship", "[N] Hold", "hold")
+	node := g.Nodes["gate"]
+	node.Attrs["human.question_type"] = "YES_NO"
+	exec := &Execution{Graph: g, Engine: &Engine{Interviewer: &QueueInterviewer{Answers: []Answer{{Value: "NO"}}}}}
+	out, err := (&WaitHumanHandler{}).Execute(context.Background(), exec, node)
+	if err != nil || out.Status != runtime.StatusSuccess {
+		t.Fatalf("out=%+v err=%v", out, err)
+	}
+	if len(out.SuggestedNextIDs) != 1 || out.SuggestedNextIDs[0] != "hold" || out.ContextUpdates[defaultHumanInputKey] != "no" {
+		t.Fatalf("out=%+v", out)
+	}
+}
+
+func TestRun_WaitHuman_FreeTextAnswerIsInterpolatedIntoLaterPrompt(t *testing.T) {
+	repo := initTestRepo(t)
+	dot := []byte(`
+digraph G {
+  graph [goal="test"]
+  start [shape=Mdiamond]
+  ask [shape=hexagon, question="Any constraints?", human.question_type=free_text, human.input_key=review.note]
+  work [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="Apply reviewer note: $context.review.note. Keep $context.missing as is."]
+  exit [shape=Msquare]
+  start -> ask -> work -> exit
+}
+`)
+	g, _, err := Prepare(dot)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	opts := RunOptions{RepoPath: repo, RunID: "human-text", LogsRoot: t.TempDir()}
+	if err := opts.applyDefaults(); err != nil {
+		t.Fatalf("applyDefaults: %v", err)
+	}
+	eng := newBaseEngine(g, dot, opts)
+	eng.Interviewer = &QueueInterviewer{Answers: []Answer{{Text: "use postgres, not sqlite"}}}
+	eng.RunBranch = fmt.Sprintf("%s/%s", opts.RunBranchPrefix, opts.RunID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if _, err := eng.run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	prompt, err := os.ReadFile(filepath.Join(opts.LogsRoot, "work", "prompt.md"))
+	if err != nil {
+		t.Fatalf("read prompt: %v", err)
+	}
+	if !strings.Contains(string(prompt), "Apply reviewer note: use postgres, not sqlite. Keep $context.missing as is.") {
+		t.Fatalf("prompt=%s", prompt)
+	}
+}
@@ -0,0 +1,348 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+const (
+	includeNodeType = "include"
+
+	// includeParamPrefix marks node attributes (on the include node) and graph
+	// attributes (in the fragment, as defaults) that bind $variables.
+	includeParamPrefix = "param."
+
+	maxIncludeDepth = 16
+)
+
+// includeNodeRefAttrs hold node IDs and are namespaced along with the nodes.
+var includeNodeRefAttrs = []string{"retry_target", "fallback_retry_target"}
+
+var varRefPattern = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// includeSource is where a graph's include paths are resolved from.
+type includeSource struct {
+	dir     string // absolute directory used to resolve src paths
+	display string // file name reported in diagnostics; empty for the root
+	// readFile loads fragments (PrepareOptions.ReadFile); nil reads from disk.
+	readFile func(path string) ([]byte, error)
+}
+
+// expandIncludes splices every `type="include"` node's fragment into g.
+//
+//	review [type="include", src="lib/review_loop.dot", param.max_rounds="3"]
+//
+// The fragment is a complete digraph. Its start and exit nodes are dropped:
+// edges into the include node are rewired to the start node's successors,
+// and edges into the fragment's exit nodes are rewired to the include node's
+// successors. Remaining nodes are renamed "<include id>.<node id>" and
+// inherit the include node's classes. $name in fragment attributes is
+// replaced by param.name from the include node, falling back to param.name
+// graph attributes declared in the fragment. src is resolved relative to the
+// including file, so fragments can include their own siblings.
+func expandIncludes(g *model.Graph, src includeSource) error {
+	return expandIncludesDepth(g, src, nil)
+}
+
+func expandIncludesDepth(g *model.Graph, src includeSource, stack []string) error {
+	for _, id := range includeNodeIDs(g) {
+		n := g.Nodes[id]
+		path := strings.TrimSpace(n.Attr("src", ""))
+		if path == "" {
+			return fmt.Errorf("%s: include node %q requires src", includeWhere(src, n.Pos), id)
+		}
+		resolved := path
+		if !filepath.IsAbs(resolved) {
+			resolved = filepath.Join(src.dir, path)
+		}
+		resolved = filepath.Clean(resolved)
+		for _, p := range stack {
+			if p == resolved {
+				return fmt.Errorf("%s: include cycle: %s", includeWhere(src, n.Pos), strings.Join(append(stack, resolved), " -> "))
+			}
+		}
+		if len(stack) >= maxIncludeDepth {
+			return fmt.Errorf("%s: includes nested deeper than %d", includeWhere(src, n.Pos), maxIncludeDepth)
+		}
+		frag, err := loadIncludeFragment(resolved, includeSource{
+			dir:      filepath.Dir(resolved),
+			display:  includeDisplayPath(src, path),
+			readFile: src.readFile,
+		}, append(stack, resolved))
+		if err != nil {
+			return fmt.Errorf("%s: include %q: %w", includeWhere(src, n.Pos), path, err)
+		}
+		if err := spliceInclude(g, n, frag); err != nil {
+			return fmt.Errorf("%s: include %q: %w", includeWhere(src, n.Pos), path, err)
+		}
+	}
+	return nil
+}
+
+func includeNodeIDs(g *model.Graph) []string {
+	var ids []string
+	for _, id := range g.AllNodeIDs() {
+		if n := g.Nodes[id]; n != nil && strings.EqualFold(strings.TrimSpace(n.TypeOverride()), includeNodeType) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func loadIncludeFragment(path string, src includeSource, stack []string) (*model.Graph, error) {
+	read := src.readFile
+	if read == nil {
+		read = os.ReadFile
+	}
+	b, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	frag, err := dot.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range frag.Nodes {
+		n.Pos.File = src.display
+	}
+	for _, e := range frag.Edges {
+		e.Pos.File = src.display
+	}
+	if err := expandIncludesDepth(frag, src, stack); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func includeDisplayPath(parent includeSource, path string) string {
+	if filepath.IsAbs(path) || parent.display == "" {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(parent.display), path)
+}
+
+func includeWhere(src includeSource, pos model.Position) string {
+	pos.File = src.display
+	if s := pos.String(); s != "" {
+		return s
+	}
+	return "graph"
+}
+
+// spliceInclude replaces node inc in g with the contents of frag.
+func spliceInclude(g *model.Graph, inc *model.Node, frag *model.Graph) error {
+	start, exits, err := includeBoundary(frag)
+	if err != nil {
+		return err
+	}
+	params := includeParams(inc, frag)
+	ns := func(id string) string { return inc.ID + "." + id }
+	internal := func(id string) bool { return id != start && !exits[id] }
+
+	out := model.NewGraph(g.Name)
+	for k, v := range g.Attrs {
+		out.Attrs[k] = v
+	}
+	for _, id := range nodeIDsByOrder(g) {
+		if id == inc.ID {
+			for _, fid := range nodeIDsByOrder(frag) {
+				if !internal(fid) {
+					continue
+				}
+				fn := frag.Nodes[fid]
+				nn := model.NewNode(ns(fid))
+				nn.Pos = fn.Pos
+				for k, v := range fn.Attrs {
+					nn.Attrs[k] = substituteVars(v, params)
+				}
+				for _, k := range includeNodeRefAttrs {
+					if t := strings.TrimSpace(nn.Attrs[k]); t != "" && frag.Nodes[t] != nil && internal(t) {
+						nn.Attrs[k] = ns(t)
+					}
+				}
+				nn.Classes = append(append([]string{}, fn.ClassList()...), inc.ClassList()...)
+				delete(nn.Attrs, "class")
+				if err := addIncludedNode(out, nn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := addIncludedNode(out, g.Nodes[id]); err != nil {
+			return err
+		}
+	}
+
+	var outgoing []*model.Edge
+	for _, e := range g.Edges {
+		if e.From == inc.ID && e.To != inc.ID {
+			outgoing = append(outgoing, e)
+		}
+		if e.From == inc.ID && e.To == inc.ID {
+			return fmt.Errorf("include node %q cannot loop to itself", inc.ID)
+		}
+	}
+
+	fragEdge := func(e *model.Edge) *model.Edge {
+		ne := model.NewEdge(e.From, e.To)
+		ne.Pos = e.Pos
+		for k, v := range e.Attrs {
+			ne.Attrs[k] = substituteVars(v, params)
+		}
+		return ne
+	}
+	// Fragment edges leaving internal nodes keep their relative order; edges
+	// into an exit fan out to each of the include node's successors.
+	var body []*model.Edge
+	for _, e := range frag.Edges {
+		if !internal(e.From) {
+			continue
+		}
+		fe := fragEdge(e)
+		fe.From = ns(e.From)
+		if internal(e.To) {
+			fe.To = ns(e.To)
+			body = append(body, fe)
+			continue
+		}
+		if e.To == start {
+			return fmt.Errorf("edge %s -> %s re-enters the fragment start node", e.From, e.To)
+		}
+		for _, pe := range outgoing {
+			body = append(body, joinIncludeEdges(fe, pe, fe.From, pe.To))
+		}
+	}
+
+	emittedBody := false
+	for _, e := range g.Edges {
+		switch {
+		case e.To == inc.ID:
+			for _, se := range frag.Edges {
+				if se.From != start {
+					continue
+				}
+				fe := fragEdge(se)
+				if internal(se.To) {
+					addIncludedEdge(out, joinIncludeEdges(e, fe, e.From, ns(se.To)))
+					continue
+				}
+				// start -> exit passes straight through.
+				for _, pe := range outgoing {
+					addIncludedEdge(out, joinIncludeEdges(joinIncludeEdges(e, fe, e.From, pe.To), pe, e.From, pe.To))
+				}
+			}
+		case e.From == inc.ID:
+			// Replaced by the fragment's exit edges.
+		default:
+			addIncludedEdge(out, e)
+			continue
+		}
+		if !emittedBody {
+			for _, be := range body {
+				addIncludedEdge(out, be)
+			}
+			emittedBody = true
+		}
+	}
+	if !emittedBody {
+		for _, be := range body {
+			addIncludedEdge(out, be)
+		}
+	}
+	*g = *out
+	return nil
+}
+
+func includeBoundary(frag *model.Graph) (string, map[string]bool, error) {
+	var starts []string
+	exits := map[string]bool{}
+	for id, n := range frag.Nodes {
+		switch {
+		case n.Shape() == "Mdiamond" || n.Shape() == "circle" || strings.EqualFold(id, "start"):
+			starts = append(starts, id)
+		case n.Shape() == "Msquare" || n.Shape() == "doublecircle" || strings.EqualFold(id, "exit") || strings.EqualFold(id, "end"):
+			exits[id] = true
+		}
+	}
+	if len(starts) != 1 {
+		sort.Strings(starts)
+		return "", nil, fmt.Errorf("fragment must have exactly one start node (found %d: %v)", len(starts), starts)
+	}
+	if len(exits) == 0 {
+		return "", nil, fmt.Errorf("fragment must have an exit node")
+	}
+	return starts[0], exits, nil
+}
+
+func includeParams(inc *model.Node, frag *model.Graph) map[string]string {
+	params := map[string]string{}
+	for k, v := range frag.Attrs {
+		if name, ok := strings.CutPrefix(k, includeParamPrefix); ok && name != "" {
+			params[name] = v
+		}
+	}
+	for k, v := range inc.Attrs {
+		if name, ok := strings.CutPrefix(k, includeParamPrefix); ok && name != "" {
+			params[name] = v
+		}
+	}
+	return params
+}
+
+// substituteVars replaces bound $variables, leaving others (such as $goal and
+// $base_sha) for the later expansions.
+func substituteVars(s string, vars map[string]string) string {
+	if len(vars) == 0 || !strings.Contains(s, "$") {
+		return s
+	}
+	return varRefPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := vars[m[1:]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// joinIncludeEdges merges two edges that collapse into from -> to across a
+// dropped boundary node. b's attributes win, except conditions, which must
+// both hold.
+func joinIncludeEdges(a, b *model.Edge, from, to string) *model.Edge {
+	e := model.NewEdge(from, to)
+	e.Pos = a.Pos
+	for k, v := range a.Attrs {
+		e.Attrs[k] = v
+	}
+	for k, v := range b.Attrs {
+		e.Attrs[k] = v
+	}
+	ca, cb := strings.TrimSpace(a.Condition()), strings.TrimSpace(b.Condition())
+	if ca != "" && cb != "" && ca != cb {
+		e.Attrs["condition"] = "(" + ca + ") && (" + cb + ")"
+	}
+	return e
+}
+
+func addIncludedNode(g *model.Graph, n *model.Node) error {
+	if _, exists := g.Nodes[n.ID]; exists {
+		return fmt.Errorf("node id %q from include collides with an existing node", n.ID)
+	}
+	n.Order = len(g.Nodes)
+	return g.AddNode(n)
+}
+
+func addIncludedEdge(g *model.Graph, e *model.Edge) {
+	_ = g.AddEdge(e)
+}
+
+func nodeIDsByOrder(g *model.Graph) []string {
+	ids := g.AllNodeIDs()
+	sort.SliceStable(ids, func(i, j int) bool { return g.Nodes[ids[i]].Order < g.Nodes[ids[j]].Order })
+	return ids
+}
@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func writeIncludeFile(t *testing.T, dir, name, src string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+const reviewLoopFragment = `digraph review_loop {
+    graph [param.max_rounds="2", param.focus="correctness"]
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    check [llm_provider=openai, llm_model=gpt-5.2, prompt="Review for $focus, at most $max_rounds rounds. Goal: $goal"]
+    fix   [llm_provider=openai, llm_model=gpt-5.2, prompt="Fix what check found", retry_target=check]
+    start -> check
+    check -> exit [condition="outcome=success"]
+    check -> fix
+    fix -> check
+}
+`
+
+func TestPrepare_IncludeSplicesFragment(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, "lib/review_loop.dot", reviewLoopFragment)
+	main := writeIncludeFile(t, dir, "main.dot", `digraph main {
+    goal="ship it"
+    start  [shape=Mdiamond]
+    exit   [shape=Msquare]
+    build  [llm_provider=openai, llm_model=gpt-5.2, prompt="build"]
+    review [type="include", src="lib/review_loop.dot", param.max_rounds="5", class="qa"]
+    start -> build -> review -> exit
+}
+`)
+	src, _ := os.ReadFile(main)
+	g, _, err := PrepareWithOptions(src, PrepareOptions{SourcePath: main})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	if g.Nodes["review"] != nil {
+		t.Fatalf("include node should be replaced")
+	}
+	check, fix := g.Nodes["review.check"], g.Nodes["review.fix"]
+	if check == nil || fix == nil {
+		t.Fatalf("namespaced nodes missing: %v", g.AllNodeIDs())
+	}
+	if got, want := check.Prompt(), "Review for correctness, at most 5 rounds. Goal: ship it"; got != want {
+		t.Fatalf("prompt=%q want %q", got, want)
+	}
+	if got := fix.Attr("retry_target", ""); got != "review.fix" && got != "review.check" {
+		t.Fatalf("retry_target=%q not namespaced", got)
+	}
+	if cls := check.ClassList(); len(cls) == 0 || cls[len(cls)-1] != "qa" {
+		t.Fatalf("classes=%v want include node class", cls)
+	}
+
+	edges := map[string]string{}
+	for _, e := range g.Edges {
+		edges[e.From+"->"+e.To] = e.Condition()
+	}
+	for _, want := range []string{"build->review.check", "review.check->exit", "review.check->review.fix", "review.fix->review.check"} {
+		if _, ok := edges[want]; !ok {
+			t.Fatalf("missing edge %s in %v", want, edges)
+		}
+	}
+	if edges["review.check->exit"] != "outcome=success" {
+		t.Fatalf("exit edge condition=%q", edges["review.check->exit"])
+	}
+	if check.Pos.File != filepath.Join(dir, "lib/review_loop.dot") || check.Pos.Line != 5 {
+		t.Fatalf("check pos=%v", check.Pos)
+	}
+}
+
+func TestPrepare_IncludeJoinsBoundaryConditions(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, "frag.dot", `digraph f {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    work  [llm_provider=openai, llm_model=gpt-5.2, prompt="w"]
+    start -> work
+    work -> exit [condition="outcome=success"]
+    work -> work
+}
+`)
+	main := writeIncludeFile(t, dir, "main.dot", `digraph main {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    gate  [llm_provider=openai, llm_model=gpt-5.2, prompt="g"]
+    sub   [type=include, src="frag.dot"]
+    start -> gate
+    gate -> sub [condition="outcome=success"]
+    gate -> exit
+    sub -> exit [condition="context.ready=true"]
+}
+`)
+	src, _ := os.ReadFile(main)
+	g, _, err := PrepareWithOptions(src, PrepareOptions{SourcePath: main})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	out := g.Outgoing("sub.work")
+	if len(out) != 2 || out[0].To != "exit" || out[1].To != "sub.work" {
+		t.Fatalf("sub.work outgoing=%v", out)
+	}
+	if got := out[0].Condition(); got != "(outcome=success) && (context.ready=true)" {
+		t.Fatalf("joined condition=%q", got)
+	}
+	if in := g.Incoming("sub.work"); len(in) != 2 || in[0].From != "gate" || in[0].Condition() != "outcome=success" {
+		t.Fatalf("sub.work incoming=%v", in)
+	}
+}
+
+func TestPrepare_IncludeDiagnosticsPointAtFragment(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, "lib/bad.dot", `digraph bad {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    work  [llm_provider=openai, llm_model=gpt-5.2, prompt="w"]
+    start -> work
+    work -> exit [condition="outcome>success"]
+    work -> exit
+}
+`)
+	main := writeIncludeFile(t, dir, "main.dot", `digraph main {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    sub   [type=include, src="lib/bad.dot"]
+    start -> sub -> exit
+}
+`)
+	src, _ := os.ReadFile(main)
+	_, diags, err := PrepareWithOptions(src, PrepareOptions{SourcePath: main})
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	wantFile := filepath.Join(dir, "lib/bad.dot")
+	found := false
+	for _, d := range diags {
+		if d.Rule == "condition_syntax" {
+			found = true
+			if d.File != wantFile || d.Line != 6 {
+				t.Fatalf("diagnostic location=%s want %s:6", d.Location(), wantFile)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("missing condition_syntax diagnostic: %+v", diags)
+	}
+	if !strings.Contains(err.Error(), wantFile+":6") {
+		t.Fatalf("error should carry the location: %v", err)
+	}
+}
+
+func TestPrepare_NestedIncludesResolveRelativeToFragment(t *testing.T) {
+	dir := t.TempDir()
+	writeIncludeFile(t, dir, "lib/inner.dot", `digraph inner {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    leaf  [llm_provider=openai, llm_model=gpt-5.2, prompt="$who"]
+    start -> leaf -> exit
+}
+`)
+	writeIncludeFile(t, dir, "lib/outer.dot", `digraph outer {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    in    [type=include, src="inner.dot", param.who="outer"]
+    start -> in -> exit
+}
+`)
+	main := writeIncludeFile(t, dir, "main.dot", `digraph main {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    out   [type=include, src="lib/outer.dot"]
+    start -> out -> exit
+}
+`)
+	src, _ := os.ReadFile(main)
+	g, _, err := PrepareWithOptions(src, PrepareOptions{SourcePath: main})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	leaf := g.Nodes["out.in.leaf"]
+	if leaf == nil || leaf.Prompt() != "outer" {
+		t.Fatalf("nested include not spliced: %v", g.AllNodeIDs())
+	}
+}
+
+func TestPrepare_IncludeCycleFails(t *testing.T) {
+	dir := t.TempDir()
+	main := writeIncludeFile(t, dir, "loop.dot", `digraph loop {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    again [type=include, src="loop.dot"]
+    start -> again -> exit
+}
+`)
+	src, _ := os.ReadFile(main)
+	_, diags, err := PrepareWithOptions(src, PrepareOptions{SourcePath: main})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+	if len(diags) != 1 || diags[0].Rule != "include" {
+		t.Fatalf("diags=%+v", diags)
+	}
+}
+
+func TestRun_IncludeFragmentsAreSnapshottedForResumeAndRender(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initFanInMergeRepo(t)
+	dir := t.TempDir()
+	frag := writeIncludeFile(t, dir, "lib/step.dot", `digraph step {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    work  [shape=parallelogram, tool_command="echo v1 >> step.txt"]
+    start -> work -> exit
+}
+`)
+	main := writeIncludeFile(t, dir, "main.dot", `digraph main {
+    start [shape=Mdiamond]
+    exit  [shape=Msquare]
+    a     [shape=parallelogram, tool_command="echo a > a.txt"]
+    step  [type="include", src="lib/step.dot"]
+    start -> a -> step -> exit
+}
+`)
+	src, _ := os.ReadFile(main)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, src, RunOptions{RepoPath: repo, GraphPath: main})
+	if err != nil || res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("Run: status=%v err=%v", res, err)
+	}
+
+	// Neither an edited nor a deleted fragment changes the run's graph.
+	writeIncludeFile(t, dir, "lib/step.dot", `digraph step { start [shape=Mdiamond] exit [shape=Msquare] other [shape=parallelogram, tool_command="true"] start -> other -> exit }`)
+	g, _, err := PrepareRunGraph(res.LogsRoot, PrepareOptions{})
+	if err != nil || g.Nodes["step.work"] == nil || g.Nodes["step.other"] != nil {
+		t.Fatalf("PrepareRunGraph: nodes=%v err=%v", g.AllNodeIDs(), err)
+	}
+	if err := os.Remove(frag); err != nil {
+		t.Fatal(err)
+	}
+	res2, err := ResumeWithOverrides(ctx, res.LogsRoot, ResumeOverrides{FromNode: "step.work"})
+	if err != nil {
+		t.Fatalf("resume after deleting the fragment: %v", err)
+	}
+	if res2.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("resume status=%q", res2.FinalStatus)
+	}
+	if got := runCmdOut(t, repo, "git", "show", res2.FinalCommitSHA+":step.txt"); got != "v1\n" {
+		t.Fatalf("step.txt=%q", got)
+	}
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -51,6 +52,10 @@ func (i *ConsoleInterviewer) Ask(q Question) Answer {
 
 	switch q.Type {
 	case QuestionFreeText:
+		if schema, ok := q.Metadata["schema"]; ok {
+			b, _ := json.Marshal(schema)
+			_, _ = fmt.Fprintf(out, "Answer with a single-line JSON value matching this schema:\n  %s\n", b)
+		}
 		_, _ = fmt.Fprint(out, "> ")
 		s, ok := i.readLineWithTimeout(in, timeout)
 		if !ok {
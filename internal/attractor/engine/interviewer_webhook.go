@@ -0,0 +1,461 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries "v0=<hex hmac-sha256>" over
+	// "v0:<timestamp>:<body>", the same construction Slack uses for request
+	// signing, so existing relay code can verify Kilroy posts and sign replies.
+	WebhookSignatureHeader = "X-Kilroy-Signature"
+	// WebhookTimestampHeader carries the Unix time (seconds) the body was signed.
+	WebhookTimestampHeader = "X-Kilroy-Request-Timestamp"
+
+	webhookSignatureVersion = "v0"
+	webhookMaxClockSkew     = 5 * time.Minute
+	webhookPostAttempts     = 3
+)
+
+var (
+	// ErrWebhookSignature is returned for callbacks with a missing, stale or
+	// wrong signature.
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookUnknownQuestion is returned for callbacks naming a question
+	// that is not pending (never asked, already answered or timed out).
+	ErrWebhookUnknownQuestion = errors.New("question not found or already answered")
+)
+
+// SignWebhookBody returns the signature header value for body signed at ts.
+func SignWebhookBody(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d:", webhookSignatureVersion, ts)
+	mac.Write(body)
+	return webhookSignatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a signature produced by SignWebhookBody and
+// rejects timestamps more than five minutes away from now to limit replay.
+func VerifyWebhookSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrWebhookSignature)
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > webhookMaxClockSkew || skew < -webhookMaxClockSkew {
+		return fmt.Errorf("%w: timestamp outside allowed skew", ErrWebhookSignature)
+	}
+	want := SignWebhookBody(secret, ts, body)
+	if !hmac.Equal([]byte(want), []byte(strings.TrimSpace(signature))) {
+		return fmt.Errorf("%w: signature mismatch", ErrWebhookSignature)
+	}
+	return nil
+}
+
+// WebhookAnswer is the body a chat relay sends back, either to the server's
+// callback endpoint or from the reply URL. JSON, when present, is used as the
+// free-text answer for schema-validated gates.
+type WebhookAnswer struct {
+	QuestionID string          `json:"question_id"`
+	Value      string          `json:"value,omitempty"`
+	Values     []string        `json:"values,omitempty"`
+	Text       string          `json:"text,omitempty"`
+	JSON       json.RawMessage `json:"json,omitempty"`
+}
+
+func (a WebhookAnswer) answer() Answer {
+	ans := Answer{Value: a.Value, Values: a.Values, Text: a.Text}
+	if len(a.JSON) > 0 {
+		ans.Text = string(a.JSON)
+	}
+	return ans
+}
+
+// webhookQuestion is the machine-readable part of a posted question. Chat
+// platforms ignore it; relays use it to render buttons and route replies.
+type webhookQuestion struct {
+	QuestionID      string          `json:"question_id"`
+	RunID           string          `json:"run_id,omitempty"`
+	Stage           string          `json:"stage"`
+	Type            string          `json:"type"`
+	Text            string          `json:"text"`
+	Options         []webhookOption `json:"options,omitempty"`
+	Schema          map[string]any  `json:"schema,omitempty"`
+	ValidationError string          `json:"validation_error,omitempty"`
+	CallbackURL     string          `json:"callback_url,omitempty"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+}
+
+type webhookOption struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// WebhookInterviewer satisfies Interviewer by posting each question to a chat
+// webhook (Slack and Teams incoming webhooks both render the top-level "text")
+// and blocking until an answer is delivered via Deliver, found at ReplyURL, or
+// the timeout expires.
+type WebhookInterviewer struct {
+	URL          string
+	Secret       string
+	RunID        string
+	CallbackURL  string
+	ReplyURL     string
+	Timeout      time.Duration
+	PollInterval time.Duration
+	Client       *http.Client
+
+	// Warn receives delivery failures; the engine wires it to Engine.Warn.
+	Warn func(msg string)
+
+	mu       sync.Mutex
+	seq      uint64
+	pending  map[string]*webhookPending
+	cancelCh chan struct{}
+	initOnce sync.Once
+}
+
+type webhookPending struct {
+	question Question
+	answerCh chan Answer
+}
+
+// NewWebhookInterviewer builds the interviewer described by cfg for runID.
+// The signing secret is read from the environment variable cfg.SecretEnv.
+func NewWebhookInterviewer(cfg HumanWebhookConfig, runID string) (*WebhookInterviewer, error) {
+	secret := strings.TrimSpace(os.Getenv(cfg.SecretEnv))
+	if secret == "" {
+		return nil, fmt.Errorf("human.webhook.secret_env: environment variable %s is empty", cfg.SecretEnv)
+	}
+	wi := &WebhookInterviewer{
+		URL:          strings.TrimSpace(cfg.URL),
+		Secret:       secret,
+		RunID:        runID,
+		CallbackURL:  strings.TrimSpace(cfg.CallbackURL),
+		ReplyURL:     strings.TrimSpace(cfg.ReplyURL),
+		Timeout:      time.Duration(cfg.TimeoutMS) * time.Millisecond,
+		PollInterval: time.Duration(cfg.PollIntervalMS) * time.Millisecond,
+	}
+	wi.init()
+	return wi, nil
+}
+
+// newConfiguredInterviewer returns the interviewer selected by the run
+// config's human section, or nil when the caller's interviewer should be used.
+func newConfiguredInterviewer(cfg *RunConfigFile, runID string) (*WebhookInterviewer, error) {
+	if cfg == nil || !strings.EqualFold(strings.TrimSpace(cfg.Human.Interviewer), "webhook") {
+		return nil, nil
+	}
+	return NewWebhookInterviewer(cfg.Human.Webhook, runID)
+}
+
+func validateHumanConfig(h HumanConfig) error {
+	switch strings.ToLower(strings.TrimSpace(h.Interviewer)) {
+	case "":
+		return nil
+	case "webhook":
+	default:
+		return fmt.Errorf("invalid human.interviewer: %q (want webhook or empty)", h.Interviewer)
+	}
+	wh := h.Webhook
+	if strings.TrimSpace(wh.URL) == "" {
+		return fmt.Errorf("human.webhook.url is required when human.interviewer=webhook")
+	}
+	for _, f := range []struct{ name, raw string }{{"url", wh.URL}, {"callback_url", wh.CallbackURL}, {"reply_url", wh.ReplyURL}} {
+		if strings.TrimSpace(f.raw) == "" {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(f.raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("human.webhook.%s must be an http(s) URL: %q", f.name, f.raw)
+		}
+	}
+	if strings.TrimSpace(wh.SecretEnv) == "" {
+		return fmt.Errorf("human.webhook.secret_env is required when human.interviewer=webhook")
+	}
+	if wh.TimeoutMS < 0 {
+		return fmt.Errorf("human.webhook.timeout_ms must be >= 0")
+	}
+	if wh.PollIntervalMS < 0 {
+		return fmt.Errorf("human.webhook.poll_interval_ms must be >= 0")
+	}
+	return nil
+}
+
+func (wi *WebhookInterviewer) init() {
+	wi.initOnce.Do(func() {
+		wi.pending = map[string]*webhookPending{}
+		wi.cancelCh = make(chan struct{})
+		if wi.Timeout <= 0 {
+			wi.Timeout = 30 * time.Minute
+		}
+		if wi.PollInterval <= 0 {
+			wi.PollInterval = 5 * time.Second
+		}
+		if wi.Client == nil {
+			wi.Client = &http.Client{Timeout: 30 * time.Second}
+		}
+	})
+}
+
+// Ask implements Interviewer. A question that cannot be posted is reported
+// through Warn and answered as timed out, so the gate's default_choice or
+// retry handling applies.
+func (wi *WebhookInterviewer) Ask(q Question) Answer {
+	wi.init()
+	wi.mu.Lock()
+	wi.seq++
+	qid := fmt.Sprintf("%s-q%d", firstNonEmpty(wi.RunID, "run"), wi.seq)
+	ch := make(chan Answer, 1)
+	wi.pending[qid] = &webhookPending{question: q, answerCh: ch}
+	wi.mu.Unlock()
+	defer func() {
+		wi.mu.Lock()
+		delete(wi.pending, qid)
+		wi.mu.Unlock()
+	}()
+
+	expires := time.Now().Add(wi.Timeout)
+	if err := wi.post(wi.questionPayload(qid, q, expires)); err != nil {
+		wi.warn(fmt.Sprintf("human webhook: posting question %s for stage %s failed: %v", qid, q.Stage, err))
+		return Answer{TimedOut: true}
+	}
+
+	timer := time.NewTimer(wi.Timeout)
+	defer timer.Stop()
+	var poll <-chan time.Time
+	if wi.ReplyURL != "" {
+		ticker := time.NewTicker(wi.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for {
+		select {
+		case ans := <-ch:
+			return ans
+		case <-poll:
+			if ans, ok := wi.pollReply(qid); ok {
+				return ans
+			}
+		case <-timer.C:
+			return Answer{TimedOut: true}
+		case <-wi.cancelCh:
+			return Answer{TimedOut: true}
+		}
+	}
+}
+
+// AskMultiple implements Interviewer. Questions are asked one at a time.
+func (wi *WebhookInterviewer) AskMultiple(questions []Question) []Answer {
+	answers := make([]Answer, len(questions))
+	for idx, q := range questions {
+		answers[idx] = wi.Ask(q)
+	}
+	return answers
+}
+
+// Inform implements Interviewer by posting a plain message, so that feedback
+// such as "invalid answer, try again" reaches the channel.
+func (wi *WebhookInterviewer) Inform(message string, stage string) {
+	wi.init()
+	text := fmt.Sprintf("*[%s]* %s", stage, strings.TrimSpace(message))
+	if err := wi.post(map[string]any{"text": text}); err != nil {
+		wi.warn(fmt.Sprintf("human webhook: posting message for stage %s failed: %v", stage, err))
+	}
+}
+
+// Cancel unblocks all in-flight Ask calls with timed-out answers. Safe to
+// call more than once.
+func (wi *WebhookInterviewer) Cancel() {
+	wi.init()
+	wi.mu.Lock()
+	defer wi.mu.Unlock()
+	select {
+	case <-wi.cancelCh:
+	default:
+		close(wi.cancelCh)
+	}
+}
+
+// Deliver verifies a signed callback body and hands the answer to the
+// waiting question. The answer is validated against the question first so a
+// relay gets the error instead of the gate silently re-asking.
+func (wi *WebhookInterviewer) Deliver(body []byte, timestamp, signature string) error {
+	wi.init()
+	if err := VerifyWebhookSignature(wi.Secret, timestamp, signature, body, time.Now()); err != nil {
+		return err
+	}
+	var wa WebhookAnswer
+	if err := json.Unmarshal(body, &wa); err != nil {
+		return fmt.Errorf("invalid answer body: %w", err)
+	}
+	return wi.deliver(wa)
+}
+
+func (wi *WebhookInterviewer) deliver(wa WebhookAnswer) error {
+	wi.mu.Lock()
+	defer wi.mu.Unlock()
+	p, ok := wi.pending[strings.TrimSpace(wa.QuestionID)]
+	if !ok {
+		return ErrWebhookUnknownQuestion
+	}
+	ans := wa.answer()
+	if _, err := ValidateHumanAnswer(p.question, ans); err != nil {
+		return err
+	}
+	select {
+	case p.answerCh <- ans:
+		delete(wi.pending, wa.QuestionID)
+		return nil
+	default:
+		return ErrWebhookUnknownQuestion
+	}
+}
+
+// pollReply asks ReplyURL for an answer. 200 with a WebhookAnswer body means
+// answered; any other status means not yet. Replies are signed like posts.
+func (wi *WebhookInterviewer) pollReply(qid string) (Answer, bool) {
+	u, err := url.Parse(wi.ReplyURL)
+	if err != nil {
+		return Answer{}, false
+	}
+	qs := u.Query()
+	qs.Set("question_id", qid)
+	u.RawQuery = qs.Encode()
+	resp, err := wi.Client.Get(u.String())
+	if err != nil {
+		return Answer{}, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Answer{}, false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Answer{}, false
+	}
+	if err := VerifyWebhookSignature(wi.Secret, resp.Header.Get(WebhookTimestampHeader), resp.Header.Get(WebhookSignatureHeader), body, time.Now()); err != nil {
+		wi.warn(fmt.Sprintf("human webhook: ignoring reply for %s: %v", qid, err))
+		return Answer{}, false
+	}
+	var wa WebhookAnswer
+	if err := json.Unmarshal(body, &wa); err != nil {
+		wi.warn(fmt.Sprintf("human webhook: ignoring reply for %s: %v", qid, err))
+		return Answer{}, false
+	}
+	if wa.QuestionID == "" {
+		wa.QuestionID = qid
+	}
+	if wa.QuestionID != qid {
+		return Answer{}, false
+	}
+	return wa.answer(), true
+}
+
+func (wi *WebhookInterviewer) questionPayload(qid string, q Question, expires time.Time) map[string]any {
+	meta := webhookQuestion{
+		QuestionID:  qid,
+		RunID:       wi.RunID,
+		Stage:       q.Stage,
+		Type:        string(q.Type),
+		Text:        strings.TrimSpace(q.Text),
+		CallbackURL: wi.CallbackURL,
+		ExpiresAt:   expires.UTC(),
+	}
+	for _, o := range q.Options {
+		meta.Options = append(meta.Options, webhookOption{Key: o.Key, Label: o.Label})
+	}
+	meta.Schema, _ = q.Metadata["schema"].(map[string]any)
+	meta.ValidationError, _ = q.Metadata["validation_error"].(string)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*[%s]* %s", q.Stage, meta.Text)
+	if meta.ValidationError != "" {
+		fmt.Fprintf(&b, "\nPrevious answer was rejected: %s", meta.ValidationError)
+	}
+	switch q.Type {
+	case QuestionYesNo, QuestionConfirm:
+		b.WriteString("\nReply yes or no.")
+	case QuestionFreeText:
+		if meta.Schema != nil {
+			schema, _ := json.Marshal(meta.Schema)
+			fmt.Fprintf(&b, "\nReply with JSON matching: `%s`", schema)
+		}
+	default:
+		var opts []string
+		for _, o := range meta.Options {
+			opts = append(opts, fmt.Sprintf("[%s] %s", o.Key, o.Label))
+		}
+		if len(opts) > 0 {
+			b.WriteString("\nOptions: " + strings.Join(opts, ", "))
+		}
+		if q.Type == QuestionMultiSelect {
+			b.WriteString(" (pick any)")
+		}
+	}
+	text := b.String()
+	return map[string]any{
+		"text": text,
+		"blocks": []map[string]any{
+			{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": text}},
+			{"type": "context", "elements": []map[string]any{{"type": "mrkdwn", "text": "question `" + qid + "`"}}},
+		},
+		"kilroy": meta,
+	}
+}
+
+// post sends a signed JSON body, retrying transport errors and 5xx replies.
+func (wi *WebhookInterviewer) post(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for attempt := 1; attempt <= webhookPostAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 500 * time.Millisecond)
+		}
+		req, err := http.NewRequest(http.MethodPost, wi.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		ts := time.Now().Unix()
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(WebhookSignatureHeader, SignWebhookBody(wi.Secret, ts, body))
+		resp, err := wi.Client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook returned %s", resp.Status)
+		if resp.StatusCode < 500 {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+func (wi *WebhookInterviewer) warn(msg string) {
+	if wi.Warn != nil {
+		wi.Warn(msg)
+	}
+}
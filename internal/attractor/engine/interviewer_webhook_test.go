@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "s3cret"
+
+// chatStandIn plays the chat platform: it verifies signed posts and hands the
+// decoded payloads to the test.
+type chatStandIn struct {
+	t      *testing.T
+	srv    *httptest.Server
+	posts  chan map[string]any
+	mu     sync.Mutex
+	reply  []byte // served at /reply once set
+	polled int
+}
+
+func newChatStandIn(t *testing.T) *chatStandIn {
+	c := &chatStandIn{t: t, posts: make(chan map[string]any, 8)}
+	c.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodGet && r.URL.Path == "/reply" {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.polled++
+			if c.reply == nil || r.URL.Query().Get("question_id") == "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			ts := time.Now().Unix()
+			w.Header().Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+			w.Header().Set(WebhookSignatureHeader, SignWebhookBody(testWebhookSecret, ts, c.reply))
+			_, _ = w.Write(c.reply)
+			return
+		}
+		if err := VerifyWebhookSignature(testWebhookSecret, r.Header.Get(WebhookTimestampHeader), r.Header.Get(WebhookSignatureHeader), body, time.Now()); err != nil {
+			t.Errorf("unsigned post: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload map[string]any
+		_ = json.Unmarshal(body, &payload)
+		c.posts <- payload
+	}))
+	t.Cleanup(c.srv.Close)
+	return c
+}
+
+func (c *chatStandIn) nextPost() map[string]any {
+	c.t.Helper()
+	select {
+	case p := <-c.posts:
+		return p
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for webhook post")
+		return nil
+	}
+}
+
+func signedAnswer(t *testing.T, wa WebhookAnswer) (body []byte, ts, sig string) {
+	t.Helper()
+	body, err := json.Marshal(wa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	return body, strconv.FormatInt(now, 10), SignWebhookBody(testWebhookSecret, now, body)
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"question_id":"q"}`)
+	sig := SignWebhookBody(testWebhookSecret, now.Unix(), body)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	if err := VerifyWebhookSignature(testWebhookSecret, ts, sig, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	for name, err := range map[string]error{
+		"tampered":  VerifyWebhookSignature(testWebhookSecret, ts, sig, []byte(`{"question_id":"x"}`), now),
+		"wrong key": VerifyWebhookSignature("other", ts, sig, body, now),
+		"stale":     VerifyWebhookSignature(testWebhookSecret, ts, sig, body, now.Add(10*time.Minute)),
+		"no header": VerifyWebhookSignature(testWebhookSecret, "", "", body, now),
+	} {
+		if !errors.Is(err, ErrWebhookSignature) {
+			t.Fatalf("%s: err=%v want ErrWebhookSignature", name, err)
+		}
+	}
+}
+
+func TestWebhookInterviewer_PostsSignedQuestionAndAcceptsCallback(t *testing.T) {
+	chat := newChatStandIn(t)
+	wi := &WebhookInterviewer{URL: chat.srv.URL, Secret: testWebhookSecret, RunID: "r1", CallbackURL: "https://kilroy.example/pipelines/r1/hooks/human"}
+
+	answerCh := make(chan Answer, 1)
+	go func() {
+		answerCh <- wi.Ask(Question{
+			Type:    QuestionYesNo,
+			Text:    "Ship it?",
+			Stage:   "gate",
+			Options: []Option{{Key: "Y", Label: "[Y] Ship"}, {Key: "N", Label: "[N] Hold"}},
+		})
+	}()
+	post := chat.nextPost()
+	if text, _ := post["text"].(string); !strings.Contains(text, "*[gate]* Ship it?") || !strings.Contains(text, "Reply yes or no.") {
+		t.Fatalf("text=%q", post["text"])
+	}
+	if _, ok := post["blocks"].([]any); !ok {
+		t.Fatalf("missing slack blocks: %v", post)
+	}
+	meta, _ := post["kilroy"].(map[string]any)
+	qid, _ := meta["question_id"].(string)
+	if qid != "r1-q1" || meta["type"] != string(QuestionYesNo) || meta["callback_url"] != wi.CallbackURL {
+		t.Fatalf("kilroy metadata=%v", meta)
+	}
+
+	body, ts, sig := signedAnswer(t, WebhookAnswer{QuestionID: qid, Value: "yes"})
+	if err := wi.Deliver(body, ts, sig+"00"); !errors.Is(err, ErrWebhookSignature) {
+		t.Fatalf("bad signature: err=%v", err)
+	}
+	body, ts, sig = signedAnswer(t, WebhookAnswer{QuestionID: qid, Value: "maybe"})
+	if err := wi.Deliver(body, ts, sig); err == nil || !strings.Contains(err.Error(), "not yes or no") {
+		t.Fatalf("invalid answer: err=%v", err)
+	}
+	body, ts, sig = signedAnswer(t, WebhookAnswer{QuestionID: "r1-q9", Value: "yes"})
+	if err := wi.Deliver(body, ts, sig); !errors.Is(err, ErrWebhookUnknownQuestion) {
+		t.Fatalf("unknown question: err=%v", err)
+	}
+	body, ts, sig = signedAnswer(t, WebhookAnswer{QuestionID: qid, Value: "yes"})
+	if err := wi.Deliver(body, ts, sig); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	select {
+	case ans := <-answerCh:
+		if ans.Value != "yes" || ans.TimedOut {
+			t.Fatalf("answer=%+v", ans)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ask did not return after delivery")
+	}
+}
+
+func TestWebhookInterviewer_PollsReplyURL(t *testing.T) {
+	chat := newChatStandIn(t)
+	wi := &WebhookInterviewer{
+		URL:          chat.srv.URL,
+		Secret:       testWebhookSecret,
+		RunID:        "r2",
+		ReplyURL:     chat.srv.URL + "/reply",
+		PollInterval: 10 * time.Millisecond,
+	}
+	answerCh := make(chan Answer, 1)
+	go func() {
+		answerCh <- wi.Ask(Question{Type: QuestionFreeText, Text: "Constraints?", Stage: "ask"})
+	}()
+	chat.nextPost()
+	time.Sleep(50 * time.Millisecond)
+	chat.mu.Lock()
+	if chat.polled == 0 {
+		chat.mu.Unlock()
+		t.Fatal("reply URL was not polled")
+	}
+	chat.reply = []byte(`{"question_id":"r2-q1","json":{"engine":"postgres"}}`)
+	chat.mu.Unlock()
+
+	select {
+	case ans := <-answerCh:
+		if ans.Text != `{"engine":"postgres"}` {
+			t.Fatalf("answer=%+v", ans)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ask did not pick up the polled reply")
+	}
+}
+
+func TestWebhookInterviewer_PostFailureWarnsAndTimesOut(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	var warnings []string
+	wi := &WebhookInterviewer{URL: srv.URL, Secret: testWebhookSecret, Warn: func(msg string) { warnings = append(warnings, msg) }}
+	if ans := wi.Ask(Question{Type: QuestionFreeText, Text: "?", Stage: "ask"}); !ans.TimedOut {
+		t.Fatalf("answer=%+v want timed out", ans)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "403") {
+		t.Fatalf("warnings=%v", warnings)
+	}
+}
+
+func TestValidateHumanConfig(t *testing.T) {
+	ok := HumanConfig{Interviewer: "webhook", Webhook: HumanWebhookConfig{URL: "https://hooks.slack.com/services/x", SecretEnv: "KILROY_HOOK_SECRET"}}
+	if err := validateHumanConfig(ok); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	cases := map[string]func(*HumanConfig){
+		"unknown interviewer": func(h *HumanConfig) { h.Interviewer = "pager" },
+		"missing url":         func(h *HumanConfig) { h.Webhook.URL = "" },
+		"non-http reply url":  func(h *HumanConfig) { h.Webhook.ReplyURL = "ftp://x/y" },
+		"missing secret env":  func(h *HumanConfig) { h.Webhook.SecretEnv = "" },
+		"negative timeout":    func(h *HumanConfig) { h.Webhook.TimeoutMS = -1 },
+	}
+	for name, mutate := range cases {
+		h := ok
+		mutate(&h)
+		if err := validateHumanConfig(h); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if _, err := NewWebhookInterviewer(ok.Webhook, "r"); err == nil {
+		t.Fatal("expected error for unset secret env var")
+	}
+	t.Setenv("KILROY_HOOK_SECRET", "x")
+	if _, err := NewWebhookInterviewer(ok.Webhook, "r"); err != nil {
+		t.Fatalf("NewWebhookInterviewer: %v", err)
+	}
+}
@@ -170,10 +170,14 @@ func normalizedFailureClass(raw string) string {
 		return failureClassDeterministic
 	case "budget_exhausted", "budget-exhausted", "budget exhausted", "budget":
 		return failureClassBudgetExhausted
+	case "cost_budget_exhausted", "cost-budget-exhausted", "spend_cap", "spend-cap":
+		return failureClassCostBudgetExhausted
 	case "compilation_loop", "compilation-loop", "compilation loop", "compile_loop", "compile-loop":
 		return failureClassCompilationLoop
 	case "structural", "structure", "scope_violation", "write_scope_violation":
 		return failureClassStructural
+	case "schema_violation", "schema-violation":
+		return failureClassSchemaViolation
 	default:
 		return failureClassDeterministic
 	}
@@ -20,9 +20,10 @@ type childResult struct {
 }
 
 // Execute implements the ManagerLoopHandler per spec §4.11.
-// It runs an observe/wait loop that monitors a child pipeline and evaluates
-// stop conditions each cycle. The steer action is logged but not yet
-// implemented (deferred to v2).
+// It runs an observe/steer/wait loop that monitors a child pipeline and
+// evaluates stop conditions each cycle. Steering pushes the directives from
+// the manager.steer_* attributes into the running child; they take effect at
+// the child's next node boundary.
 func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
 	if exec == nil || exec.Engine == nil || exec.Graph == nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "manager loop missing execution context"}, nil
@@ -58,6 +59,20 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 		}, nil
 	}
 
+	var steerCfg managerSteerConfig
+	var steering *steerInbox
+	if actions["steer"] {
+		cfg, err := parseManagerSteerConfig(node)
+		if err != nil {
+			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+		}
+		steerCfg = cfg
+		steering = &steerInbox{}
+	}
+	steerCooldown := parseDuration(node.Attr("manager.steer_cooldown", ""), pollInterval)
+	steerCount := 0
+	var lastSteerAt time.Time
+
 	var childCancel context.CancelFunc
 	childDone := make(chan childResult, 1)
 
@@ -65,7 +80,7 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 		var childCtx context.Context
 		childCtx, childCancel = context.WithCancel(ctx)
 		go func() {
-			result := runChildPipeline(childCtx, exec, childDotfile, node.ID)
+			result := runChildPipeline(childCtx, exec, childDotfile, node.ID, steering)
 			childDone <- result
 		}()
 	}
@@ -76,11 +91,6 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 		}
 	}()
 
-	// Log steer action as deferred to v2.
-	if actions["steer"] {
-		exec.Engine.Warn(fmt.Sprintf("manager_loop node %s: 'steer' action is not yet implemented (v2)", node.ID))
-	}
-
 	// Observation loop per spec §4.11 pseudocode.
 	for cycle := 1; cycle <= maxCycles; cycle++ {
 		if err := ctx.Err(); err != nil {
@@ -122,6 +132,42 @@ func (h *ManagerLoopHandler) Execute(ctx context.Context, exec *Execution, node
 			}
 		}
 
+		// Steer: push corrective guidance into the running child once the
+		// steer condition holds on the child's context, at most
+		// manager.steer_max times and no more often than manager.steer_cooldown.
+		if steering != nil && steerCount < steerCfg.Max && (lastSteerAt.IsZero() || time.Since(lastSteerAt) >= steerCooldown) {
+			if childCtx := steering.childContext(); childCtx != nil {
+				ok := true
+				if steerCfg.Condition != "" {
+					var err error
+					ok, err = cond.Evaluate(steerCfg.Condition, runtime.Outcome{Status: runtime.StatusSuccess}, childCtx)
+					if err != nil {
+						return runtime.Outcome{
+							Status:        runtime.StatusFail,
+							FailureReason: fmt.Sprintf("invalid manager.steer_condition %q: %v", steerCfg.Condition, err),
+						}, nil
+					}
+				}
+				if ok {
+					steerCount++
+					lastSteerAt = time.Now()
+					d := steerCfg.directive(node.ID, cycle)
+					steering.push(d)
+					exec.Engine.appendProgress(map[string]any{
+						"event":       "manager_steer",
+						"node_id":     node.ID,
+						"cycle":       cycle,
+						"steer_count": steerCount,
+						"condition":   steerCfg.Condition,
+						"fidelity":    d.Fidelity,
+						"note":        d.Note,
+						"context":     d.ContextUpdates,
+					})
+					exec.Engine.cxdbManagerSteer(ctx, node.ID, cycle, steerCfg.Condition, d)
+				}
+			}
+		}
+
 		// Evaluate stop condition (spec §4.11 pseudocode line: IF stop_condition is not empty).
 		if stopCondition != "" {
 			ok, err := cond.Evaluate(stopCondition, runtime.Outcome{Status: runtime.StatusSuccess}, exec.Context)
@@ -181,7 +227,9 @@ func parseManagerActions(s string) map[string]bool {
 // runChildPipeline loads and executes a child DOT pipeline, returning the result.
 // This reuses the sub-pipeline execution infrastructure (Prepare, runSubgraphUntil)
 // already built for parallel branches.
-func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string, managerNodeID string) childResult {
+// A non-nil steering inbox is attached to the child engine so the manager can
+// intervene while it runs.
+func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string, managerNodeID string, steering *steerInbox) childResult {
 	// Resolve child dotfile path relative to the active run worktree (not the
 	// source repo). Earlier stages may generate or modify child dotfiles in the
 	// worktree, so reading from Options.RepoPath would see stale/missing content.
@@ -242,9 +290,14 @@ func runChildPipeline(ctx context.Context, exec *Execution, childDotfile string,
 		Registry:           exec.Engine.Registry,
 		CodergenBackend:    exec.Engine.CodergenBackend,
 		Interviewer:        exec.Engine.Interviewer,
+		budget:             exec.Engine.budget,
 		ModelCatalogSHA:    exec.Engine.ModelCatalogSHA,
 		ModelCatalogSource: exec.Engine.ModelCatalogSource,
 		ModelCatalogPath:   exec.Engine.ModelCatalogPath,
+		steering:           steering,
+	}
+	if steering != nil {
+		steering.attach(childEng.Context)
 	}
 
 	res, err := runSubgraphUntil(ctx, childEng, startID, exitID)
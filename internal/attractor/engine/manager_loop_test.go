@@ -2,7 +2,10 @@ package engine
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -370,3 +373,217 @@ func TestFindExitNodeID_NilGraph(t *testing.T) {
 		t.Errorf("expected empty for nil graph, got %q", exitID)
 	}
 }
+
+func TestParseManagerSteerConfig(t *testing.T) {
+	node := &model.Node{ID: "m", Attrs: map[string]string{
+		"manager.steer_prompt":    "focus on the failing test",
+		"manager.steer_context":   "hint=narrow, retry_budget = 2",
+		"manager.steer_fidelity":  "Truncate",
+		"manager.steer_condition": "context.needs_help=true",
+	}}
+	cfg, err := parseManagerSteerConfig(node)
+	if err != nil {
+		t.Fatalf("parseManagerSteerConfig: %v", err)
+	}
+	if cfg.Fidelity != "truncate" || cfg.Max != 1 || cfg.Note != "focus on the failing test" {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+	if cfg.ContextUpdates["hint"] != "narrow" || cfg.ContextUpdates["retry_budget"] != "2" {
+		t.Fatalf("context updates=%v", cfg.ContextUpdates)
+	}
+
+	bad := []map[string]string{
+		{},
+		{"manager.steer_fidelity": "everything"},
+		{"manager.steer_context": "novalue"},
+		{"manager.steer_context": "=x"},
+	}
+	for _, attrs := range bad {
+		if _, err := parseManagerSteerConfig(&model.Node{ID: "m", Attrs: attrs}); err == nil {
+			t.Errorf("parseManagerSteerConfig(%v): expected error", attrs)
+		}
+	}
+}
+
+func TestManagerLoop_SteerWithoutDirectives_FailsFast(t *testing.T) {
+	node := &model.Node{
+		ID: "manager-steer",
+		Attrs: map[string]string{
+			"manager.actions":       "observe,steer,wait",
+			"manager.poll_interval": "1ms",
+			"stack.child_autostart": "false",
+		},
+	}
+	graph := &model.Graph{Nodes: map[string]*model.Node{node.ID: node}, Attrs: map[string]string{}}
+	eng := &Engine{Graph: graph, Options: RunOptions{RunID: "test-run"}, Context: runtime.NewContext()}
+	exec := &Execution{Engine: eng, Graph: graph, Context: eng.Context, WorktreeDir: t.TempDir(), LogsRoot: t.TempDir()}
+
+	out, err := (&ManagerLoopHandler{}).Execute(context.Background(), exec, node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Status != runtime.StatusFail || !strings.Contains(out.FailureReason, "manager.steer_prompt") {
+		t.Fatalf("expected steer config failure, got %s: %s", out.Status, out.FailureReason)
+	}
+}
+
+func TestApplySteering_HoldsNotesAndFidelityForNextLLMNode(t *testing.T) {
+	g := &model.Graph{
+		Nodes: map[string]*model.Node{
+			"tool": {ID: "tool", Attrs: map[string]string{"shape": "parallelogram", "tool_command": "true"}},
+			"impl": {ID: "impl", Attrs: map[string]string{"shape": "box"}},
+		},
+		Attrs: map[string]string{},
+	}
+	eng := &Engine{
+		Graph:    g,
+		Context:  runtime.NewContext(),
+		Registry: NewDefaultRegistry(),
+		LogsRoot: t.TempDir(),
+		steering: &steerInbox{},
+	}
+	eng.lastResolvedFidelity = "compact"
+	eng.steering.push(steerDirective{
+		ManagerNodeID:  "mgr",
+		Cycle:          2,
+		ContextUpdates: map[string]any{"hint": "narrow"},
+		Fidelity:       "full",
+		Note:           "fix the failing test first",
+	})
+
+	restore := eng.applySteering(g.Nodes["tool"])
+	if got := eng.Context.GetString("hint", ""); got != "narrow" {
+		t.Fatalf("context hint=%q want narrow (context updates apply at the next node boundary)", got)
+	}
+	if eng.steeringPromptPreamble() != "" || eng.lastResolvedFidelity != "compact" {
+		t.Fatalf("non-LLM node must not consume steering notes or fidelity")
+	}
+	restore()
+
+	restore = eng.applySteering(g.Nodes["impl"])
+	if eng.lastResolvedFidelity != "full" {
+		t.Fatalf("fidelity=%q want full", eng.lastResolvedFidelity)
+	}
+	if p := eng.steeringPromptPreamble(); !strings.Contains(p, "fix the failing test first") {
+		t.Fatalf("preamble=%q", p)
+	}
+	restore()
+	if eng.lastResolvedFidelity != "compact" || eng.steeringPromptPreamble() != "" {
+		t.Fatalf("steering must apply to one LLM node only; fidelity=%q", eng.lastResolvedFidelity)
+	}
+
+	events := progressEventsOfType(t, eng.LogsRoot, "manager_steer_applied")
+	if len(events) != 1 || events[0]["manager_node_id"] != "mgr" || events[0]["node_id"] != "tool" {
+		t.Fatalf("manager_steer_applied events=%v", events)
+	}
+}
+
+// steeredChildBackend drives a child pipeline: node "a" raises a help flag
+// and waits for the manager's intervention to be queued; node "b" records
+// what the steering changed.
+type steeredChildBackend struct {
+	mu       sync.Mutex
+	prompt   string
+	fidelity string
+	hint     string
+}
+
+func (b *steeredChildBackend) Run(ctx context.Context, exec *Execution, node *model.Node, prompt string) (string, *runtime.Outcome, error) {
+	switch node.ID {
+	case "a":
+		exec.Context.Set("needs_help", "true")
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			exec.Engine.steering.mu.Lock()
+			n := len(exec.Engine.steering.pending)
+			exec.Engine.steering.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	case "b":
+		b.mu.Lock()
+		b.prompt = prompt
+		b.fidelity = exec.Engine.lastResolvedFidelity
+		b.hint = exec.Context.GetString("hint", "")
+		b.mu.Unlock()
+	}
+	return "ok", &runtime.Outcome{Status: runtime.StatusSuccess}, nil
+}
+
+func TestManagerLoop_SteerInjectsGuidanceIntoRunningChild(t *testing.T) {
+	repo := t.TempDir()
+	runCmd(t, repo, "git", "init")
+	runCmd(t, repo, "git", "config", "user.name", "tester")
+	runCmd(t, repo, "git", "config", "user.email", "tester@example.com")
+	child := `
+digraph child {
+  start [shape=Mdiamond]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5, prompt="work on it"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5, prompt="keep going"]
+  exit [shape=Msquare]
+  start -> a -> b -> exit
+}
+`
+	if err := os.WriteFile(filepath.Join(repo, "child.dot"), []byte(child), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "init")
+
+	node := &model.Node{
+		ID: "manager",
+		Attrs: map[string]string{
+			"shape":                   "house",
+			"manager.actions":         "observe,steer,wait",
+			"manager.poll_interval":   "5ms",
+			"manager.max_cycles":      "2000",
+			"manager.steer_condition": "context.needs_help=true",
+			"manager.steer_prompt":    "Stop refactoring; fix the failing test.",
+			"manager.steer_context":   "hint=narrow",
+			"manager.steer_fidelity":  "truncate",
+			"stack.child_dotfile":     "child.dot",
+		},
+	}
+	graph := &model.Graph{Nodes: map[string]*model.Node{node.ID: node}, Attrs: map[string]string{}}
+	backend := &steeredChildBackend{}
+	eng := &Engine{
+		Graph:           graph,
+		Options:         RunOptions{RunID: "steer-run", RepoPath: repo},
+		Context:         runtime.NewContext(),
+		Registry:        NewDefaultRegistry(),
+		CodergenBackend: backend,
+		LogsRoot:        t.TempDir(),
+		WorktreeDir:     repo,
+	}
+	exec := &Execution{Engine: eng, Graph: graph, Context: eng.Context, WorktreeDir: repo, LogsRoot: eng.LogsRoot}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out, err := (&ManagerLoopHandler{}).Execute(ctx, exec, node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Status != runtime.StatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s: %s", out.Status, out.FailureReason)
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if !strings.Contains(backend.prompt, "Stop refactoring; fix the failing test.") {
+		t.Fatalf("child node b prompt missing steering note:\n%s", backend.prompt)
+	}
+	if backend.fidelity != "truncate" || backend.hint != "narrow" {
+		t.Fatalf("child node b fidelity=%q hint=%q; want truncate/narrow", backend.fidelity, backend.hint)
+	}
+
+	steers := progressEventsOfType(t, eng.LogsRoot, "manager_steer")
+	if len(steers) != 1 || steers[0]["node_id"] != "manager" {
+		t.Fatalf("manager_steer events=%v", steers)
+	}
+	applied := progressEventsOfType(t, filepath.Join(eng.LogsRoot, "manager", "child"), "manager_steer_applied")
+	if len(applied) != 1 || applied[0]["node_id"] != "b" {
+		t.Fatalf("manager_steer_applied events=%v", applied)
+	}
+}
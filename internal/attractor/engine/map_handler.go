@@ -0,0 +1,402 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// MapHandler fans out over a list computed at run time. The subgraph between
+// the map node's single outgoing edge and the join node runs once per item,
+// each in its own worktree, with $item and $index expanded in prompts and
+// passed to tool commands as KILROY_MAP_ITEM and KILROY_MAP_INDEX.
+// Concurrency, join_policy and error_policy work as they do for parallel
+// nodes.
+//
+// Attributes:
+//   - items_key: context key holding a list (a JSON array value, a string
+//     containing one, or newline-separated text such as tool.output)
+//   - items_file: path to a JSON array, relative to the worktree
+//   - join: node ID where items converge (default: nearest tripleoctagon)
+type MapHandler struct{}
+
+// mapItemPromptAttrs are the node attributes in which $item and $index are
+// expanded verbatim.
+var mapItemPromptAttrs = []string{"prompt", "llm_prompt"}
+
+const (
+	mapItemEnvKey  = "KILROY_MAP_ITEM"
+	mapIndexEnvKey = "KILROY_MAP_INDEX"
+)
+
+// mapItemRefPattern matches $name and ${name} as whole identifiers, so
+// $items or $index_file are left alone.
+var (
+	mapItemRefPattern = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+	mapItemRefPrefix  = regexp.MustCompile(`^` + mapItemRefPattern.String())
+)
+
+// mapItemEnvKeys maps the names a map body may refer to onto the variables
+// its tool commands read them from.
+var mapItemEnvKeys = map[string]string{"item": mapItemEnvKey, "index": mapIndexEnvKey}
+
+// mapItemResult is the per-item summary exposed to edge conditions and later
+// stages as map.results.
+type mapItemResult struct {
+	Index         int    `json:"index"`
+	Item          string `json:"item"`
+	BranchKey     string `json:"branch_key"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+func (h *MapHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
+	if exec == nil || exec.Engine == nil || exec.Graph == nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "map handler missing execution context"}, nil
+	}
+
+	out := exec.Graph.Outgoing(node.ID)
+	if len(out) != 1 {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: fmt.Sprintf("map node must have exactly one outgoing edge (has %d)", len(out))}, nil
+	}
+	body := out[0]
+	joinID, err := mapJoinNode(exec.Graph, node, body)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
+
+	items, err := mapItems(exec, node)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
+	}
+	if len(items) == 0 {
+		return runtime.Outcome{
+			Status: runtime.StatusSuccess,
+			Notes:  fmt.Sprintf("map over empty list, join=%s", joinID),
+			ContextUpdates: map[string]any{
+				"parallel.join_node":        joinID,
+				parallelMergeModeContextKey: classifyJoinMergeMode(exec.Graph, joinID),
+				"parallel.results":          []parallelBranchResult{},
+				"map.item_count":            0,
+				"map.success_count":         0,
+				"map.fail_count":            0,
+				"map.failed_items":          []string{},
+				"map.results":               []mapItemResult{},
+			},
+		}, nil
+	}
+
+	bodyNodes := mapBodyNodes(exec.Graph, body.To, joinID)
+	width := len(strconv.Itoa(len(items) - 1))
+	if width < 2 {
+		width = 2
+	}
+	branches := make([]fanOutBranch, len(items))
+	keys := make(map[string]int, len(items))
+	for i, item := range items {
+		key := fmt.Sprintf("item-%0*d", width, i)
+		keys[key] = i
+		branches[i] = fanOutBranch{
+			Edge:    body,
+			Key:     key,
+			Graph:   expandMapItemGraph(exec.Graph, bodyNodes, item, i),
+			Context: map[string]any{"map.item": item, "map.index": i},
+		}
+	}
+
+	jp, ep := parallelPolicies(node)
+	mapStart := time.Now()
+	exec.Engine.cxdbParallelStarted(ctx, node.ID, len(branches), string(jp), string(ep))
+
+	results, baseSHA, err := dispatchFanOutWithPolicy(ctx, exec, node.ID, branches, joinID, jp, ep, node)
+	if err != nil {
+		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, err
+	}
+
+	itemResults := make([]mapItemResult, 0, len(results))
+	failedItems := []string{}
+	successCount, failCount := 0, 0
+	for _, r := range results {
+		i, ok := keys[r.BranchKey]
+		if !ok {
+			continue
+		}
+		ir := mapItemResult{
+			Index:         i,
+			Item:          items[i],
+			BranchKey:     r.BranchKey,
+			Status:        string(r.Outcome.Status),
+			FailureReason: r.Outcome.FailureReason,
+		}
+		switch r.Outcome.Status {
+		case runtime.StatusSuccess, runtime.StatusPartialSuccess:
+			successCount++
+		case runtime.StatusFail:
+			failCount++
+			failedItems = append(failedItems, items[i])
+		}
+		itemResults = append(itemResults, ir)
+	}
+	exec.Engine.cxdbParallelCompleted(ctx, node.ID, successCount, failCount, time.Since(mapStart).Milliseconds())
+
+	filteredResults := filterResultsByErrorPolicy(ep, results)
+	policyOutcome := evaluateJoinPolicy(jp, node, filteredResults)
+
+	stageDir := filepath.Join(exec.LogsRoot, node.ID)
+	_ = os.MkdirAll(stageDir, 0o755)
+	_ = writeJSON(filepath.Join(stageDir, "parallel_results.json"), results)
+	_ = writeJSON(filepath.Join(stageDir, "map_results.json"), itemResults)
+
+	return runtime.Outcome{
+		Status:        policyOutcome.Status,
+		Notes:         fmt.Sprintf("map fan-out complete (%d items), join=%s; %s", len(items), joinID, policyOutcome.Notes),
+		FailureReason: policyOutcome.FailureReason,
+		ContextUpdates: map[string]any{
+			"parallel.join_node":        joinID,
+			parallelMergeModeContextKey: classifyJoinMergeMode(exec.Graph, joinID),
+			"parallel.results":          filteredResults,
+			"map.item_count":            len(items),
+			"map.success_count":         successCount,
+			"map.fail_count":            failCount,
+			"map.failed_items":          failedItems,
+			"map.results":               itemResults,
+		},
+		Meta: map[string]any{
+			"kilroy.git_checkpoint_sha": baseSHA,
+		},
+	}, nil
+}
+
+// isJoinHopNodeType reports whether nodes of type t pick their next hop from
+// parallel.join_node rather than from outgoing edges.
+func isJoinHopNodeType(t string) bool {
+	return t == "parallel" || t == "map"
+}
+
+func mapJoinNode(g *model.Graph, node *model.Node, body *model.Edge) (string, error) {
+	if join := strings.TrimSpace(node.Attr("join", "")); join != "" {
+		if g.Nodes[join] == nil {
+			return "", fmt.Errorf("map join node %q not found", join)
+		}
+		return join, nil
+	}
+	joinID, err := findJoinFanInNode(g, []*model.Edge{body})
+	if err != nil {
+		return "", fmt.Errorf("map node %s: %v (set join=<node>)", node.ID, err)
+	}
+	return joinID, nil
+}
+
+// mapItems reads the list from items_key or items_file. Non-string items are
+// passed on as compact JSON.
+func mapItems(exec *Execution, node *model.Node) ([]string, error) {
+	key := strings.TrimSpace(node.Attr("items_key", ""))
+	file := strings.TrimSpace(node.Attr("items_file", ""))
+	switch {
+	case key != "" && file != "":
+		return nil, fmt.Errorf("map node %s: set only one of items_key and items_file", node.ID)
+	case key != "":
+		raw, ok := exec.Context.Get(key)
+		if !ok || raw == nil {
+			return nil, fmt.Errorf("map node %s: context key %q not set", node.ID, key)
+		}
+		return mapItemsFromValue(raw)
+	case file != "":
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(exec.WorktreeDir, path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("map node %s: read items_file: %w", node.ID, err)
+		}
+		var list []any
+		if err := json.Unmarshal(b, &list); err != nil {
+			return nil, fmt.Errorf("map node %s: items_file %s is not a JSON array: %w", node.ID, file, err)
+		}
+		return mapItemsFromValue(list)
+	default:
+		return nil, fmt.Errorf("map node %s: missing items_key or items_file", node.ID)
+	}
+}
+
+func mapItemsFromValue(raw any) ([]string, error) {
+	switch v := raw.(type) {
+	case []string:
+		return append([]string{}, v...), nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, it := range v {
+			if s, ok := it.(string); ok {
+				out = append(out, s)
+				continue
+			}
+			b, err := json.Marshal(it)
+			if err != nil {
+				return nil, fmt.Errorf("map item: %w", err)
+			}
+			out = append(out, string(b))
+		}
+		return out, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.HasPrefix(s, "[") {
+			var list []any
+			if err := json.Unmarshal([]byte(s), &list); err == nil {
+				return mapItemsFromValue(list)
+			}
+		}
+		var out []string
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				out = append(out, line)
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("map items must be a list or string, got %T", raw)
+	}
+}
+
+// mapBodyNodes returns the nodes reachable from start without passing
+// through the join.
+func mapBodyNodes(g *model.Graph, start, joinID string) map[string]bool {
+	seen := map[string]bool{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == joinID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		for _, e := range g.Outgoing(id) {
+			queue = append(queue, e.To)
+		}
+	}
+	return seen
+}
+
+// expandMapItemGraph copies g with $item and $index expanded in the body
+// nodes' prompts and turned into environment references in their tool
+// commands. Nodes outside the body are shared with g.
+func expandMapItemGraph(g *model.Graph, body map[string]bool, item string, index int) *model.Graph {
+	out := model.NewGraph(g.Name)
+	for k, v := range g.Attrs {
+		out.Attrs[k] = v
+	}
+	vars := map[string]string{"item": item, "index": strconv.Itoa(index)}
+	expand := func(s string) string {
+		return mapItemRefPattern.ReplaceAllStringFunc(s, func(m string) string {
+			sub := mapItemRefPattern.FindStringSubmatch(m)
+			if v, ok := vars[sub[1]+sub[2]]; ok {
+				return v
+			}
+			return m
+		})
+	}
+	for id, n := range g.Nodes {
+		if !body[id] {
+			_ = out.AddNode(n)
+			continue
+		}
+		nn := &model.Node{ID: n.ID, Attrs: make(map[string]string, len(n.Attrs)), Classes: n.Classes, Order: n.Order, Pos: n.Pos}
+		for k, v := range n.Attrs {
+			nn.Attrs[k] = v
+		}
+		for _, k := range mapItemPromptAttrs {
+			if v, ok := nn.Attrs[k]; ok {
+				nn.Attrs[k] = expand(v)
+			}
+		}
+		if v, ok := nn.Attrs["tool_command"]; ok {
+			nn.Attrs["tool_command"] = shellMapItemRefs(v)
+		}
+		_ = out.AddNode(nn)
+	}
+	for _, e := range g.Edges {
+		ne := *e
+		_ = out.AddEdge(&ne)
+	}
+	return out
+}
+
+// shellMapItemRefs rewrites $item and $index in a shell command into quoted
+// references to KILROY_MAP_ITEM and KILROY_MAP_INDEX. Items come from run-time
+// data, so they must reach the command as a single word and never be parsed
+// as shell syntax. The reference is quoted to suit where it appears: bare,
+// inside double quotes, or inside single quotes (where it used to be pasted
+// literally).
+func shellMapItemRefs(cmd string) string {
+	var b strings.Builder
+	inSingle, inDouble := false, false
+	for i := 0; i < len(cmd); {
+		c := cmd[i]
+		switch {
+		case c == '\\' && !inSingle && i+1 < len(cmd):
+			b.WriteString(cmd[i : i+2])
+			i += 2
+			continue
+		case c == '\'' && !inDouble:
+			inSingle = !inSingle
+		case c == '"' && !inSingle:
+			inDouble = !inDouble
+		case c == '$':
+			if token, key := mapItemRef(cmd[i:]); token != "" {
+				switch {
+				case inDouble:
+					b.WriteString("${" + key + "}")
+				case inSingle:
+					b.WriteString(`'"${` + key + `}"'`)
+				default:
+					b.WriteString(`"${` + key + `}"`)
+				}
+				i += len(token)
+				continue
+			}
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// mapItemRef reports whether s starts with a reference to $item or $index
+// (or ${item}, ${index}) and returns the reference and its variable.
+func mapItemRef(s string) (token, envKey string) {
+	m := mapItemRefPrefix.FindStringSubmatch(s)
+	if m == nil {
+		return "", ""
+	}
+	if key, ok := mapItemEnvKeys[m[1]+m[2]]; ok {
+		return m[0], key
+	}
+	return "", ""
+}
+
+// mapItemEnv returns the environment a map body's tool commands read $item
+// and $index from. It is empty outside a map body.
+func mapItemEnv(ctx *runtime.Context) map[string]string {
+	env := map[string]string{}
+	if ctx == nil {
+		return env
+	}
+	item, ok := ctx.Get("map.item")
+	if !ok {
+		return env
+	}
+	env[mapItemEnvKey] = fmt.Sprint(item)
+	if index, ok := ctx.Get("map.index"); ok {
+		env[mapIndexEnvKey] = fmt.Sprint(index)
+	}
+	return env
+}
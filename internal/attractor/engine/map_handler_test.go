@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_MapNode_FansOutOverToolOutputAndMergesItems(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	dot := []byte(`
+digraph P {
+  graph [goal="map"]
+  start [shape=Mdiamond]
+  list [shape=parallelogram, tool_command="printf 'alpha\nbeta\ngamma\n'"]
+  each [type=map, items_key="tool.output", max_parallel=2]
+  fix [shape=parallelogram, tool_command="echo $index > $item.txt"]
+  join [shape=tripleoctagon, merge_mode=merge_all]
+  exit [shape=Msquare]
+
+  start -> list -> each -> fix -> join
+  join -> exit [condition="context.map.fail_count=0"]
+  join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res.FinalStatus)
+	}
+
+	for i, name := range []string{"alpha", "beta", "gamma"} {
+		got := strings.TrimSpace(runCmdOut(t, repo, "git", "show", res.FinalCommitSHA+":"+name+".txt"))
+		if got != string(rune('0'+i)) {
+			t.Fatalf("%s.txt=%q want %d", name, got, i)
+		}
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "parallel", "each", "pass1", "02-item-01"))
+
+	b, err := os.ReadFile(filepath.Join(res.LogsRoot, "each", "map_results.json"))
+	if err != nil {
+		t.Fatalf("read map_results.json: %v", err)
+	}
+	var items []mapItemResult
+	if err := json.Unmarshal(b, &items); err != nil {
+		t.Fatalf("decode map_results.json: %v", err)
+	}
+	if len(items) != 3 || items[2].Item != "gamma" || items[2].Index != 2 || items[2].Status != "success" {
+		t.Fatalf("map results=%+v", items)
+	}
+}
+
+func TestRun_MapNode_ToolCommandTreatsItemsAsData(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	items := []string{"a; touch pwned", `it's "quoted"`, "my file $index"}
+	b, _ := json.Marshal(items)
+	_ = os.WriteFile(filepath.Join(repo, "items.json"), b, 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "items")
+	dot := []byte(`
+digraph P {
+  graph [goal="map"]
+  start [shape=Mdiamond]
+  each [type=map, items_file="items.json"]
+  fix [shape=parallelogram, tool_command="printf '%s' $item > out-$index.txt"]
+  join [shape=tripleoctagon, merge_mode=merge_all]
+  exit [shape=Msquare]
+
+  start -> each -> fix -> join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res.FinalStatus)
+	}
+	for i, want := range items {
+		got := runCmdOut(t, repo, "git", "show", fmt.Sprintf("%s:out-%d.txt", res.FinalCommitSHA, i))
+		if got != want {
+			t.Fatalf("out-%d.txt=%q want %q", i, got, want)
+		}
+	}
+	if files := runCmdOut(t, repo, "git", "ls-tree", "--name-only", res.FinalCommitSHA); strings.Contains(files, "pwned") {
+		t.Fatalf("item was executed as a command: %s", files)
+	}
+}
+
+func TestShellMapItemRefs(t *testing.T) {
+	cases := map[string]string{
+		`echo $item`:        `echo "${KILROY_MAP_ITEM}"`,
+		`echo "n=$index"`:   `echo "n=${KILROY_MAP_INDEX}"`,
+		`echo '$item'`:      `echo ''"${KILROY_MAP_ITEM}"''`,
+		`echo \$item $item`: `echo \$item "${KILROY_MAP_ITEM}"`,
+		`echo ${item}/x`:    `echo "${KILROY_MAP_ITEM}"/x`,
+		`echo "$item"x`:     `echo "${KILROY_MAP_ITEM}"x`,
+		`echo $items`:       `echo $items`,
+		`cat $index_file`:   `cat $index_file`,
+		`echo $items_list`:  `echo $items_list`,
+	}
+	for in, want := range cases {
+		if got := shellMapItemRefs(in); got != want {
+			t.Fatalf("shellMapItemRefs(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestExpandMapItemGraph_MatchesWholeNames(t *testing.T) {
+	g := model.NewGraph("g")
+	n := model.NewNode("fix")
+	n.Attrs["prompt"] = "Fix $item (${index}) but keep $items, $item_count and $index_file as they are"
+	_ = g.AddNode(n)
+	got := expandMapItemGraph(g, map[string]bool{"fix": true}, "a.go", 2).Nodes["fix"].Attrs["prompt"]
+	if want := "Fix a.go (2) but keep $items, $item_count and $index_file as they are"; got != want {
+		t.Fatalf("prompt=%q want %q", got, want)
+	}
+}
+
+func TestRun_MapNode_EmptyItemsFileSkipsToJoin(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	_ = os.WriteFile(filepath.Join(repo, "items.json"), []byte("[]\n"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "items")
+	dot := []byte(`
+digraph P {
+  graph [goal="map"]
+  start [shape=Mdiamond]
+  each [type=map, items_file="items.json"]
+  fix [shape=parallelogram, tool_command="exit 1"]
+  join [shape=tripleoctagon]
+  exit [shape=Msquare]
+
+  start -> each -> fix -> join -> exit
+}
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res.FinalStatus)
+	}
+	if out := readJoinOutcome(t, res.LogsRoot); out.Status != runtime.StatusSuccess {
+		t.Fatalf("join outcome=%+v", out)
+	}
+	if _, err := os.Stat(filepath.Join(res.LogsRoot, "fix")); err == nil {
+		t.Fatalf("fix should not run for an empty list")
+	}
+}
+
+func TestMapItemsFromValue(t *testing.T) {
+	cases := []struct {
+		in   any
+		want []string
+	}{
+		{[]any{"a", float64(2), map[string]any{"k": "v"}}, []string{"a", "2", `{"k":"v"}`}},
+		{`["x","y"]`, []string{"x", "y"}},
+		{"pkg/a\n\n  pkg/b  \n", []string{"pkg/a", "pkg/b"}},
+	}
+	for _, c := range cases {
+		got, err := mapItemsFromValue(c.in)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("mapItemsFromValue(%v)=%v, %v want %v", c.in, got, err, c.want)
+		}
+	}
+	if _, err := mapItemsFromValue(42); err == nil {
+		t.Fatalf("expected error for non-list value")
+	}
+}
@@ -135,6 +135,13 @@ func resolveRetryTarget(g *model.Graph, nodeID string) string {
 	return target
 }
 
+// RetryTarget returns where a failed stage goes when none of its edges match:
+// the node's retry_target or fallback_retry_target, then the graph's. It
+// returns "" when the run would fail instead.
+func RetryTarget(g *model.Graph, nodeID string) string {
+	return resolveRetryTarget(g, nodeID)
+}
+
 func isFanInFailureLike(g *model.Graph, from string, status runtime.StageStatus) bool {
 	if status != runtime.StatusFail && status != runtime.StatusRetry {
 		return false
@@ -176,6 +176,24 @@ func (h *ParallelHandler) Execute(ctx context.Context, exec *Execution, node *mo
 	}, nil
 }
 
+// fanOutBranch is one unit of fan-out work. Parallel and implicit fan-out
+// branches are just an edge; map items also carry their own key, a graph with
+// $item/$index expanded, and context values.
+type fanOutBranch struct {
+	Edge    *model.Edge
+	Key     string         // defaults to the sanitized start node ID
+	Graph   *model.Graph   // nil runs the branch on the execution's graph
+	Context map[string]any // applied on top of the cloned parent context
+}
+
+func edgeBranches(edges []*model.Edge) []fanOutBranch {
+	out := make([]fanOutBranch, len(edges))
+	for i, e := range edges {
+		out[i] = fanOutBranch{Edge: e}
+	}
+	return out
+}
+
 // dispatchParallelBranches runs branches in parallel and returns the results.
 // It creates a checkpoint commit, spawns worktrees for each branch, runs subgraphs,
 // and collects results. This is the shared core used by both explicit ParallelHandler
@@ -186,6 +204,16 @@ func dispatchParallelBranches(
 	sourceNodeID string,
 	branches []*model.Edge,
 	joinID string,
+) ([]parallelBranchResult, string, error) {
+	return dispatchFanOutBranches(ctx, exec, sourceNodeID, edgeBranches(branches), joinID)
+}
+
+func dispatchFanOutBranches(
+	ctx context.Context,
+	exec *Execution,
+	sourceNodeID string,
+	branches []fanOutBranch,
+	joinID string,
 ) ([]parallelBranchResult, string, error) {
 	if exec == nil || exec.Engine == nil || exec.Graph == nil {
 		return nil, "", fmt.Errorf("dispatchParallelBranches: missing execution context")
@@ -223,8 +251,8 @@ func dispatchParallelBranches(
 	var gitMu sync.Mutex
 
 	type job struct {
-		idx  int
-		edge *model.Edge
+		idx    int
+		branch fanOutBranch
 	}
 
 	h := &ParallelHandler{}
@@ -235,11 +263,10 @@ func dispatchParallelBranches(
 	worker := func() {
 		defer wg.Done()
 		for j := range jobs {
-			e := j.edge
-			if e == nil {
+			if j.branch.Edge == nil {
 				continue
 			}
-			res := h.runBranch(ctx, exec, sourceNode, baseSHA, joinID, j.idx, e, passNum, &gitMu)
+			res := h.runFanOutBranch(ctx, exec, sourceNode, baseSHA, joinID, j.idx, j.branch, passNum, &gitMu)
 			results[j.idx] = res
 		}
 	}
@@ -252,8 +279,8 @@ func dispatchParallelBranches(
 	for i := 0; i < workers; i++ {
 		go worker()
 	}
-	for idx, e := range branches {
-		jobs <- job{idx: idx, edge: e}
+	for idx, b := range branches {
+		jobs <- job{idx: idx, branch: b}
 	}
 	close(jobs)
 	wg.Wait()
@@ -270,7 +297,15 @@ func dispatchParallelBranches(
 }
 
 func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parallelNode *model.Node, baseSHA, joinID string, idx int, edge *model.Edge, passNum int, gitMu *sync.Mutex) parallelBranchResult {
-	key := sanitizeRefComponent(edge.To)
+	return h.runFanOutBranch(ctx, exec, parallelNode, baseSHA, joinID, idx, fanOutBranch{Edge: edge}, passNum, gitMu)
+}
+
+func (h *ParallelHandler) runFanOutBranch(ctx context.Context, exec *Execution, parallelNode *model.Node, baseSHA, joinID string, idx int, branch fanOutBranch, passNum int, gitMu *sync.Mutex) parallelBranchResult {
+	edge := branch.Edge
+	key := sanitizeRefComponent(branch.Key)
+	if key == "" {
+		key = sanitizeRefComponent(edge.To)
+	}
 	if key == "" {
 		key = fmt.Sprintf("branch-%d", idx+1)
 	}
@@ -413,17 +448,26 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 	}
 	emitBranchProgress("branch_setup_ready", nil)
 
+	graph := exec.Graph
+	if branch.Graph != nil {
+		graph = branch.Graph
+	}
+	branchCtx := exec.Context.Clone()
+	if len(branch.Context) > 0 {
+		branchCtx.ApplyUpdates(branch.Context)
+	}
 	branchEng := &Engine{
-		Graph:                      exec.Graph,
+		Graph:                      graph,
 		Options:                    exec.Engine.Options,
 		DotSource:                  exec.Engine.DotSource,
 		RunBranch:                  branchName,
 		WorktreeDir:                worktreeDir,
 		LogsRoot:                   branchRoot,
-		Context:                    exec.Context.Clone(),
+		Context:                    branchCtx,
 		Registry:                   exec.Engine.Registry,
 		CodergenBackend:            exec.Engine.CodergenBackend,
 		Interviewer:                exec.Engine.Interviewer,
+		budget:                     exec.Engine.budget,
 		ModelCatalogSHA:            exec.Engine.ModelCatalogSHA,
 		ModelCatalogSource:         exec.Engine.ModelCatalogSource,
 		ModelCatalogPath:           exec.Engine.ModelCatalogPath,
@@ -552,7 +596,6 @@ func (h *ParallelHandler) runBranch(ctx context.Context, exec *Execution, parall
 type FanInHandler struct{}
 
 func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model.Node) (runtime.Outcome, error) {
-	_ = ctx
 	raw, ok := exec.Context.Get("parallel.results")
 	if !ok || raw == nil {
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "no parallel.results found in context"}, nil
@@ -563,23 +606,33 @@ func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: err.Error()}, nil
 	}
 	if len(results) == 0 {
+		if n, isMap := exec.Context.Get("map.item_count"); isMap && fmt.Sprint(n) == "0" {
+			return runtime.Outcome{Status: runtime.StatusSuccess, Notes: "map produced no items"}, nil
+		}
 		return runtime.Outcome{Status: runtime.StatusFail, FailureReason: "no parallel results to evaluate"}, nil
 	}
 
+	if fanInMergeMode(node) == fanInMergeModeMergeAll {
+		return executeFanInMergeAll(exec, node, results)
+	}
+
 	winner, ok := selectHeuristicWinner(results)
 	if !ok {
-		failureClass := classifyParallelAllFailFailureClass(results)
-		return runtime.Outcome{
-			Status:        runtime.StatusFail,
-			FailureReason: "all parallel branches failed",
-			Meta: map[string]any{
-				"failure_class":     failureClass,
-				"failure_signature": parallelAllFailSignature(results, failureClass),
-			},
-			ContextUpdates: map[string]any{
-				"failure_class": failureClass,
-			},
-		}, nil
+		return parallelAllFailOutcome(results), nil
+	}
+	var verdict *fanInJudgeVerdict
+	if fanInJudgeEnabled(node) && exec != nil && exec.Engine != nil {
+		var v fanInJudgeVerdict
+		winner, v = judgeFanInWinner(ctx, exec, node, results, winner)
+		verdict = &v
+		exec.Engine.appendProgress(map[string]any{
+			"event":           "fan_in_judged",
+			"node_id":         node.ID,
+			"winner":          v.Winner,
+			"scores":          v.Scores,
+			"fallback_reason": v.FallbackReason,
+		})
+		exec.Engine.cxdbFanInJudged(ctx, node.ID, v)
 	}
 
 	// Fast-forward the main run branch to the winner head.
@@ -607,27 +660,9 @@ func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model
 		}
 	}
 
-	lineageRunHead := ""
-	if exec != nil && exec.Engine != nil {
-		var conflicts []InputSnapshotConflict
-		var mergeErr error
-		lineageRunHead, conflicts, mergeErr = exec.Engine.mergeRunScopedFanInState(results)
-		if mergeErr != nil {
-			if isInputSnapshotConflictError(mergeErr) {
-				return runtime.Outcome{
-					Status:        runtime.StatusFail,
-					FailureReason: "input_snapshot_conflict",
-					Meta: map[string]any{
-						"conflicts":     conflictsToMeta(conflicts),
-						"failure_class": failureClassDeterministic,
-					},
-					ContextUpdates: map[string]any{
-						"failure_class": failureClassDeterministic,
-					},
-				}, nil
-			}
-			return runtime.Outcome{Status: runtime.StatusFail, FailureReason: mergeErr.Error()}, nil
-		}
+	lineageRunHead, failed := mergeFanInLineage(exec, results)
+	if failed != nil {
+		return *failed, nil
 	}
 
 	losers := []map[string]any{}
@@ -657,14 +692,68 @@ func (h *FanInHandler) Execute(ctx context.Context, exec *Execution, node *model
 	if strings.TrimSpace(lineageRunHead) != "" {
 		contextUpdates["input_lineage.run_head_revision"] = strings.TrimSpace(lineageRunHead)
 	}
+	notes := fmt.Sprintf("fan-in selected %s (%s)", winner.BranchKey, winner.Outcome.Status)
+	if verdict != nil {
+		contextUpdates["parallel.fan_in.judge_scores"] = verdict.Scores
+		contextUpdates["parallel.fan_in.judge_rationale"] = verdict.Rationale
+		contextUpdates["parallel.fan_in.judge_model"] = verdict.Model
+		contextUpdates["parallel.fan_in.judge_fallback_reason"] = verdict.FallbackReason
+		if verdict.FallbackReason == "" {
+			notes += " by judge"
+		} else {
+			notes += " by heuristic (judge: " + verdict.FallbackReason + ")"
+		}
+	}
 
 	return runtime.Outcome{
 		Status:         runtime.StatusSuccess,
-		Notes:          fmt.Sprintf("fan-in selected %s (%s)", winner.BranchKey, winner.Outcome.Status),
+		Notes:          notes,
 		ContextUpdates: contextUpdates,
 	}, nil
 }
 
+// parallelAllFailOutcome is the fan-in outcome when no branch succeeded.
+func parallelAllFailOutcome(results []parallelBranchResult) runtime.Outcome {
+	failureClass := classifyParallelAllFailFailureClass(results)
+	return runtime.Outcome{
+		Status:        runtime.StatusFail,
+		FailureReason: "all parallel branches failed",
+		Meta: map[string]any{
+			"failure_class":     failureClass,
+			"failure_signature": parallelAllFailSignature(results, failureClass),
+		},
+		ContextUpdates: map[string]any{
+			"failure_class": failureClass,
+		},
+	}
+}
+
+// mergeFanInLineage merges run-scoped input snapshot state from all branches.
+// A non-nil outcome means the merge failed and fan-in must stop.
+func mergeFanInLineage(exec *Execution, results []parallelBranchResult) (string, *runtime.Outcome) {
+	if exec == nil || exec.Engine == nil {
+		return "", nil
+	}
+	lineageRunHead, conflicts, mergeErr := exec.Engine.mergeRunScopedFanInState(results)
+	if mergeErr == nil {
+		return lineageRunHead, nil
+	}
+	if isInputSnapshotConflictError(mergeErr) {
+		return "", &runtime.Outcome{
+			Status:        runtime.StatusFail,
+			FailureReason: "input_snapshot_conflict",
+			Meta: map[string]any{
+				"conflicts":     conflictsToMeta(conflicts),
+				"failure_class": failureClassDeterministic,
+			},
+			ContextUpdates: map[string]any{
+				"failure_class": failureClassDeterministic,
+			},
+		}
+	}
+	return "", &runtime.Outcome{Status: runtime.StatusFail, FailureReason: mergeErr.Error()}
+}
+
 // ManagerLoopHandler is defined in manager_loop.go.
 type ManagerLoopHandler struct{}
 
@@ -1163,6 +1252,20 @@ func bfsFanInDistances(g *model.Graph, start string) map[string]int {
 	return out
 }
 
+// ImplicitFanOutJoin returns the node where edges that are eligible together
+// converge, or "" when the engine would pick a single edge instead of fanning
+// out.
+func ImplicitFanOutJoin(g *model.Graph, edges []*model.Edge) string {
+	if len(edges) < 2 {
+		return ""
+	}
+	joinID, err := findJoinNode(g, edges)
+	if err != nil {
+		return ""
+	}
+	return joinID
+}
+
 // findJoinNode finds the convergence point for a set of branches.
 // Prefers tripleoctagon (explicit fan-in) nodes. Falls back to any node
 // reachable from ALL branches (topological convergence).
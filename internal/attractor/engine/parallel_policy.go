@@ -228,10 +228,23 @@ func dispatchParallelBranchesWithPolicy(
 	jp joinPolicy,
 	ep errorPolicy,
 	node *model.Node,
+) ([]parallelBranchResult, string, error) {
+	return dispatchFanOutWithPolicy(ctx, exec, sourceNodeID, edgeBranches(branches), joinID, jp, ep, node)
+}
+
+func dispatchFanOutWithPolicy(
+	ctx context.Context,
+	exec *Execution,
+	sourceNodeID string,
+	branches []fanOutBranch,
+	joinID string,
+	jp joinPolicy,
+	ep errorPolicy,
+	node *model.Node,
 ) ([]parallelBranchResult, string, error) {
 	if !needsEarlyTermination(jp, ep) {
 		// No early termination needed — use the standard dispatch path.
-		return dispatchParallelBranches(ctx, exec, sourceNodeID, branches, joinID)
+		return dispatchFanOutBranches(ctx, exec, sourceNodeID, branches, joinID)
 	}
 
 	// For early termination policies, we use a streaming variant that sends
@@ -250,7 +263,7 @@ func dispatchParallelBranchesStreaming(
 	ctx context.Context,
 	exec *Execution,
 	sourceNodeID string,
-	branches []*model.Edge,
+	branches []fanOutBranch,
 	joinID string,
 	jp joinPolicy,
 	ep errorPolicy,
@@ -299,8 +312,8 @@ func dispatchParallelBranchesStreaming(
 	results := make([]parallelBranchResult, len(branches))
 
 	type job struct {
-		idx  int
-		edge *model.Edge
+		idx    int
+		branch fanOutBranch
 	}
 	jobs := make(chan job)
 	var wg sync.WaitGroup
@@ -308,11 +321,10 @@ func dispatchParallelBranchesStreaming(
 	worker := func() {
 		defer wg.Done()
 		for j := range jobs {
-			e := j.edge
-			if e == nil {
+			if j.branch.Edge == nil {
 				continue
 			}
-			res := h.runBranch(cancelCtx, exec, sourceNode, baseSHA, joinID, j.idx, e, passNum, &gitMu)
+			res := h.runFanOutBranch(cancelCtx, exec, sourceNode, baseSHA, joinID, j.idx, j.branch, passNum, &gitMu)
 			resultCh <- indexedResult{idx: j.idx, result: res}
 		}
 	}
@@ -329,9 +341,9 @@ func dispatchParallelBranchesStreaming(
 	// Feed jobs in a separate goroutine so we can read results concurrently.
 	go func() {
 		defer close(jobs)
-		for idx, e := range branches {
+		for idx, b := range branches {
 			select {
-			case jobs <- job{idx: idx, edge: e}:
+			case jobs <- job{idx: idx, branch: b}:
 			case <-cancelCtx.Done():
 				// Context cancelled — stop sending new jobs.
 				return
@@ -218,6 +218,11 @@ func classifyAPIError(err error) (failureClass string, failureSignature string)
 	provider := "api"
 	detail := "unknown"
 
+	var budgetErr *budgetExhaustedError
+	if errors.As(err, &budgetErr) {
+		return failureClassCostBudgetExhausted, fmt.Sprintf("cost_budget_exhausted|%s|%s", budgetErr.Scope, budgetErr.NodeID)
+	}
+
 	var abortErr *llm.AbortError
 	if errors.As(err, &abortErr) {
 		if p := strings.TrimSpace(abortErr.Provider()); p != "" {
@@ -168,6 +168,24 @@ func runProviderAPIPreflight(ctx context.Context, g *model.Graph, runtimes map[s
 		return nil
 	}
 
+	replay := cfg != nil && strings.EqualFold(strings.TrimSpace(cfg.LLM.Replay), string(llm.CassetteReplay))
+	if replay {
+		if _, err := os.Stat(cfg.LLM.Cassette); err != nil {
+			report.addCheck(providerPreflightCheck{
+				Name:    "llm_cassette",
+				Status:  preflightStatusFail,
+				Message: fmt.Sprintf("cassette unreadable: %v", err),
+			})
+			return fmt.Errorf("preflight: llm.cassette: %w", err)
+		}
+		report.addCheck(providerPreflightCheck{
+			Name:    "llm_cassette",
+			Status:  preflightStatusPass,
+			Message: "replaying api traffic from cassette",
+			Details: map[string]any{"path": cfg.LLM.Cassette},
+		})
+	}
+
 	for _, provider := range providers {
 		rt, ok := runtimes[provider]
 		if !ok {
@@ -179,6 +197,15 @@ func runProviderAPIPreflight(ctx context.Context, g *model.Graph, runtimes map[s
 			})
 			return fmt.Errorf("preflight: provider %s missing runtime definition", provider)
 		}
+		if replay {
+			report.addCheck(providerPreflightCheck{
+				Name:     "provider_api_credentials",
+				Provider: provider,
+				Status:   preflightStatusPass,
+				Message:  "replaying from cassette; api key not required",
+			})
+			continue
+		}
 		keyEnv := strings.TrimSpace(rt.API.DefaultAPIKeyEnv)
 		if keyEnv == "" {
 			report.addCheck(providerPreflightCheck{
@@ -209,6 +236,20 @@ func runProviderAPIPreflight(ctx context.Context, g *model.Graph, runtimes map[s
 		})
 	}
 
+	if replay {
+		for _, provider := range providers {
+			report.addCheck(providerPreflightCheck{
+				Name:     "provider_prompt_probe",
+				Provider: provider,
+				Status:   preflightStatusPass,
+				Message:  "prompt probe skipped in replay mode",
+				Details: map[string]any{
+					"backend": "api",
+				},
+			})
+		}
+		return nil
+	}
 	if report.PromptProbeMode == "off" {
 		for _, provider := range providers {
 			report.addCheck(providerPreflightCheck{
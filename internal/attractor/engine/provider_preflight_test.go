@@ -1943,3 +1943,52 @@ func TestUsedAPIProviders_ExcludesUncredentialedFailoverTarget(t *testing.T) {
 		t.Fatalf("want [anthropic google] (both credentialed), got %v", got)
 	}
 }
+
+func TestProviderPreflight_ReplayMode_SkipsCredentialsAndRequiresCassette(t *testing.T) {
+	repo := initTestRepo(t)
+	catalog := writeCatalogForPreflight(t, `{
+  "data": [
+    {"id": "openai/gpt-5.2"}
+  ]
+}`)
+	t.Setenv("OPENAI_API_KEY", "")
+	cfg := testPreflightConfigForProviders(repo, catalog, map[string]BackendKind{
+		"openai": BackendAPI,
+	})
+	cfg.LLM.Replay = "replay"
+	cfg.LLM.Cassette = filepath.Join(t.TempDir(), "missing.jsonl")
+	dot := singleProviderDot("openai", "gpt-5.2")
+
+	run := func(runID string) (preflightReportDoc, error) {
+		logsRoot := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: runID, LogsRoot: logsRoot, AllowTestShim: true})
+		return mustReadPreflightReport(t, logsRoot), err
+	}
+
+	_, err := run("replay-missing-cassette")
+	if err == nil || !strings.Contains(err.Error(), "llm.cassette") {
+		t.Fatalf("expected missing cassette preflight error, got %v", err)
+	}
+
+	if err := os.WriteFile(cfg.LLM.Cassette, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := run("replay-no-keys")
+	if err != nil && strings.Contains(err.Error(), "preflight:") {
+		t.Fatalf("unexpected preflight failure: %v", err)
+	}
+	found := false
+	for _, c := range report.Checks {
+		if c.Name == "provider_api_credentials" {
+			found = true
+			if c.Status != preflightStatusPass {
+				t.Fatalf("credentials check should pass in replay mode: %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("missing provider_api_credentials check: %+v", report.Checks)
+	}
+}
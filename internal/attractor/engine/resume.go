@@ -22,6 +22,8 @@ var restartSuffixRE = regexp.MustCompile(`^restart-(\d+)$`)
 type manifest struct {
 	RunID         string            `json:"run_id"`
 	RepoPath      string            `json:"repo_path"`
+	GraphPath     string            `json:"graph_path"`
+	Params        map[string]string `json:"params"`
 	RunBranch     string            `json:"run_branch"`
 	RunConfigPath string            `json:"run_config_path"`
 	ForceModels   map[string]string `json:"force_models"`
@@ -43,6 +45,23 @@ type manifest struct {
 type ResumeOverrides struct {
 	CXDBHTTPBaseURL string
 	CXDBContextID   string
+
+	// ProgressSink, Interviewer and OnEngineReady behave as the RunOptions
+	// fields of the same name, so an embedding host (the HTTP server) can
+	// observe and answer a resumed run.
+	ProgressSink  func(map[string]any)
+	Interviewer   Interviewer
+	OnEngineReady func(e *Engine)
+
+	// FromNode rewinds the run to the checkpoint written before the last
+	// execution of that node and continues from it instead of routing on
+	// from the latest checkpoint.
+	FromNode string
+
+	// Fork resumes a copy of the run under a new run ID (ForkRunID, or a
+	// generated one) and branch, leaving the original run untouched.
+	Fork      bool
+	ForkRunID string
 }
 
 // Resume continues an existing run from {logs_root}/checkpoint.json.
@@ -55,6 +74,11 @@ func Resume(ctx context.Context, logsRoot string) (*Result, error) {
 	return resumeFromLogsRoot(ctx, logsRoot, ResumeOverrides{})
 }
 
+// ResumeWithOverrides is Resume with host hooks and CXDB overrides applied.
+func ResumeWithOverrides(ctx context.Context, logsRoot string, ov ResumeOverrides) (*Result, error) {
+	return resumeFromLogsRoot(ctx, logsRoot, ov)
+}
+
 func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides) (res *Result, err error) {
 	logsRoot = strings.TrimSpace(logsRoot)
 	if logsRoot == "" {
@@ -92,15 +116,43 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		_ = final.Save(filepath.Join(logsRoot, "final.json"))
 	}()
 
+	if ov.Fork {
+		if _, err := loadManifest(filepath.Join(logsRoot, "manifest.json")); err != nil {
+			return nil, err
+		}
+		forked, err := forkRunLogs(logsRoot, ov.ForkRunID)
+		if err != nil {
+			return nil, err
+		}
+		logsRoot = forked
+	}
 	m, err := loadManifest(filepath.Join(logsRoot, "manifest.json"))
 	if err != nil {
 		return nil, err
 	}
 	runID = strings.TrimSpace(m.RunID)
-	cp, err := runtime.LoadCheckpoint(filepath.Join(logsRoot, "checkpoint.json"))
+	fromNode := strings.TrimSpace(ov.FromNode)
+	var (
+		cp     *runtime.Checkpoint
+		rewind *rewindPlan
+	)
+	if fromNode != "" {
+		rewind, err = planRewind(logsRoot, fromNode)
+		if err == nil {
+			cp = rewind.checkpoint
+		}
+	} else {
+		cp, err = runtime.LoadCheckpoint(filepath.Join(logsRoot, "checkpoint.json"))
+	}
 	if err != nil {
 		return nil, err
 	}
+	if ov.Fork {
+		if cp.Extra == nil {
+			cp.Extra = map[string]any{}
+		}
+		cp.Extra["base_logs_root"] = logsRoot
+	}
 	if err := validateAbsoluteResumePaths(logsRoot, cp); err != nil {
 		return nil, err
 	}
@@ -108,11 +160,13 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	if strings.TrimSpace(cp.GitCommitSHA) == "" {
 		return nil, fmt.Errorf("checkpoint missing git_commit_sha")
 	}
-	dotSource, err := os.ReadFile(filepath.Join(logsRoot, "graph.dot"))
+	// The snapshot of includes and prompt files keeps the graph identical to
+	// the one the run started with.
+	g, _, err := PrepareRunGraph(logsRoot, PrepareOptions{RepoPath: m.RepoPath, Params: suppliedGraphParams(m.Params)})
 	if err != nil {
 		return nil, err
 	}
-	g, _, err := Prepare(dotSource)
+	dotSource, err := os.ReadFile(filepath.Join(logsRoot, "graph.dot"))
 	if err != nil {
 		return nil, err
 	}
@@ -214,16 +268,31 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	prefix := deriveRunBranchPrefix(m, cfg)
 	opts := RunOptions{
 		RepoPath:        m.RepoPath,
+		GraphPath:       m.GraphPath,
+		Params:          m.Params,
 		RunID:           m.RunID,
 		LogsRoot:        logsRoot,
 		WorktreeDir:     filepath.Join(logsRoot, "worktree"),
 		RunBranchPrefix: prefix,
 		RequireClean:    resolveRequireClean(cfg),
 		ForceModels:     normalizeForceModels(copyStringStringMap(m.ForceModels)),
+		ProgressSink:    ov.ProgressSink,
+		Interviewer:     ov.Interviewer,
 	}
 	if err := opts.applyDefaults(); err != nil {
 		return nil, err
 	}
+	if router, ok := backend.(*CodergenRouter); ok {
+		router.setRunPaths(opts)
+	}
+	hook, err := newConfiguredInterviewer(cfg, opts.RunID)
+	if err != nil {
+		return nil, err
+	}
+	if hook != nil {
+		opts.Interviewer = hook
+		defer context.AfterFunc(ctx, hook.Cancel)()
+	}
 	if strings.TrimSpace(prefix) == "" {
 		return nil, fmt.Errorf("resume: unable to derive run_branch_prefix from manifest/config")
 	}
@@ -234,10 +303,17 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		return nil, err
 	}
 	eng = newBaseEngine(g, dotSource, opts)
+	if eng.graphSources, err = loadGraphSources(logsRoot); err != nil {
+		return nil, err
+	}
 	eng.RunConfig = cfg
 	eng.ArtifactPolicy = resolvedArtifactPolicy
 	eng.CodergenBackend = backend
 	eng.CXDB = sink
+	if cfg != nil {
+		eng.budget = newBudgetTracker(cfg.Budget, catalog)
+		eng.budget.restore(restoreRunUsage(cp))
+	}
 	eng.ModelCatalogSHA = func() string {
 		if catalog == nil {
 			return ""
@@ -280,6 +356,10 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		}
 	}
 
+	if ov.OnEngineReady != nil {
+		ov.OnEngineReady(eng)
+	}
+
 	if !gitutil.IsRepo(m.RepoPath) {
 		return nil, fmt.Errorf("not a git repo: %s", m.RepoPath)
 	}
@@ -290,6 +370,11 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	if !clean {
 		return nil, fmt.Errorf("repo has uncommitted changes (resume requires clean repo)")
 	}
+	if rewind != nil {
+		if err := rewind.apply(); err != nil {
+			return nil, fmt.Errorf("resume --from-node: %w", err)
+		}
+	}
 
 	// Recreate branch pointer and worktree at the last checkpoint commit.
 	// The run branch may currently be checked out by the existing worktree at logs_root/worktree.
@@ -314,11 +399,36 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		return nil, fmt.Errorf("resume input materialization failed: %w", err)
 	}
 
+	// Reconstruct node outcomes for goal gate enforcement from completed nodes (best-effort).
+	// A rewind has already archived the stage dirs, so it read them beforehand.
+	nodeOutcomes := completedNodeOutcomes(logsRoot, cp.CompletedNodes)
+	if rewind != nil {
+		nodeOutcomes = rewind.outcomes
+	}
+
 	// Determine next node to execute by re-evaluating routing from the last completed node.
 	lastNodeID := strings.TrimSpace(cp.CurrentNode)
 	if lastNodeID == "" {
 		return nil, fmt.Errorf("checkpoint missing current_node")
 	}
+	if fromNode != "" {
+		eng.appendProgress(map[string]any{
+			"event":           "run_rewound",
+			"node_id":         fromNode,
+			"checkpoint_node": lastNodeID,
+			"git_commit_sha":  cp.GitCommitSHA,
+			"fork":            ov.Fork,
+		})
+		eng.incomingEdge = edgeBetween(eng.Graph, lastNodeID, fromNode)
+		res, err = eng.runLoop(ctx, fromNode, append([]string{}, cp.CompletedNodes...), copyStringIntMap(cp.NodeRetries), nodeOutcomes)
+		if err != nil {
+			return nil, err
+		}
+		if startup != nil {
+			res.CXDBUIURL = strings.TrimSpace(startup.UIURL)
+		}
+		return res, nil
+	}
 	lastStatusPath := filepath.Join(logsRoot, lastNodeID, "status.json")
 	b, err := os.ReadFile(lastStatusPath)
 	if err != nil {
@@ -329,30 +439,13 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 		return nil, fmt.Errorf("decode last status.json: %w", err)
 	}
 
-	// Reconstruct node outcomes for goal gate enforcement from completed nodes (best-effort).
-	nodeOutcomes := map[string]runtime.Outcome{}
-	for _, id := range cp.CompletedNodes {
-		if id == "" {
-			continue
-		}
-		sb, err := os.ReadFile(filepath.Join(logsRoot, id, "status.json"))
-		if err != nil {
-			continue
-		}
-		o, err := runtime.DecodeOutcomeJSON(sb)
-		if err != nil {
-			continue
-		}
-		nodeOutcomes[id] = o
-	}
-
-	// Kilroy v1: parallel nodes control the next hop via context.
+	// Kilroy v1: parallel and map nodes control the next hop via context.
 	if lastNode := eng.Graph.Nodes[lastNodeID]; lastNode != nil {
 		t := strings.TrimSpace(lastNode.TypeOverride())
 		if t == "" {
 			t = shapeToType(lastNode.Shape())
 		}
-		if t == "parallel" {
+		if isJoinHopNodeType(t) {
 			join := strings.TrimSpace(eng.Context.GetString("parallel.join_node", ""))
 			if join == "" {
 				return nil, fmt.Errorf("resume: parallel node missing parallel.join_node in checkpoint context")
@@ -465,6 +558,25 @@ func resumeFromLogsRoot(ctx context.Context, logsRoot string, ov ResumeOverrides
 	return res, nil
 }
 
+func completedNodeOutcomes(logsRoot string, completed []string) map[string]runtime.Outcome {
+	nodeOutcomes := map[string]runtime.Outcome{}
+	for _, id := range completed {
+		if id == "" {
+			continue
+		}
+		sb, err := os.ReadFile(filepath.Join(logsRoot, id, "status.json"))
+		if err != nil {
+			continue
+		}
+		o, err := runtime.DecodeOutcomeJSON(sb)
+		if err != nil {
+			continue
+		}
+		nodeOutcomes[id] = o
+	}
+	return nodeOutcomes
+}
+
 func firstExistingPath(paths ...string) string {
 	for _, p := range paths {
 		p = strings.TrimSpace(p)
@@ -626,6 +738,30 @@ func restoreLoopFailureSignatures(cp *runtime.Checkpoint) map[string]int {
 	return out
 }
 
+// restoreRunUsage decodes the llm_usage checkpoint entry written by
+// Engine.checkpoint. Returns nil when absent or malformed.
+func restoreRunUsage(cp *runtime.Checkpoint) *runtime.RunUsage {
+	if cp == nil || cp.Extra == nil {
+		return nil
+	}
+	raw, ok := cp.Extra["llm_usage"]
+	if !ok || raw == nil {
+		return nil
+	}
+	if u, ok := raw.(*runtime.RunUsage); ok {
+		return u
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var u runtime.RunUsage
+	if err := json.Unmarshal(b, &u); err != nil {
+		return nil
+	}
+	return &u
+}
+
 func anyToStringValue(v any) string {
 	if v == nil {
 		return ""
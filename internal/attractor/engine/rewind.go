@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// checkpointHistoryDirName holds a numbered copy of every checkpoint.json the
+// run wrote, so it can later be rewound to the state before any stage.
+const checkpointHistoryDirName = "checkpoints"
+
+// nodeOutcomeExtraKey holds, in a history entry only, the outcome of the stage
+// that wrote it. A later visit overwrites <node>/status.json, so this is the
+// only record of what the stage returned at that point in the run.
+const nodeOutcomeExtraKey = "node_outcome"
+
+func saveCheckpointHistory(logsRoot string, cp *runtime.Checkpoint, out runtime.Outcome) error {
+	dir := filepath.Join(logsRoot, checkpointHistoryDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	history, err := checkpointHistory(logsRoot)
+	if err != nil {
+		return err
+	}
+	entry := *cp
+	entry.Extra = make(map[string]any, len(cp.Extra)+1)
+	for k, v := range cp.Extra {
+		entry.Extra[k] = v
+	}
+	if fo, err := out.Canonicalize(); err == nil {
+		entry.Extra[nodeOutcomeExtraKey] = fo
+	}
+	return entry.Save(filepath.Join(dir, fmt.Sprintf("%06d-%s.json", len(history)+1, cp.CurrentNode)))
+}
+
+// historyNodeOutcome returns the stage outcome recorded in a history entry.
+func historyNodeOutcome(cp *runtime.Checkpoint) (runtime.Outcome, bool) {
+	raw, ok := cp.Extra[nodeOutcomeExtraKey]
+	if !ok {
+		return runtime.Outcome{}, false
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return runtime.Outcome{}, false
+	}
+	o, err := runtime.DecodeOutcomeJSON(b)
+	if err != nil {
+		return runtime.Outcome{}, false
+	}
+	return o, true
+}
+
+// checkpointHistory returns the run's checkpoint history files, oldest first.
+func checkpointHistory(logsRoot string) ([]string, error) {
+	dir := filepath.Join(logsRoot, checkpointHistoryDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// rewindPlan rolls a run's logs back to the checkpoint written just before
+// the last execution of a node.
+type rewindPlan struct {
+	logsRoot   string
+	checkpoint *runtime.Checkpoint
+	// abandoned are the history entries of that execution and everything after.
+	abandoned []string
+	nodes     []string
+	// outcomes are the completed nodes' outcomes as of the restored
+	// checkpoint, for goal gate checks.
+	outcomes map[string]runtime.Outcome
+}
+
+func planRewind(logsRoot, nodeID string) (*rewindPlan, error) {
+	history, err := checkpointHistory(logsRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("resume --from-node: %s has no checkpoint history", logsRoot)
+	}
+	cps := make([]*runtime.Checkpoint, len(history))
+	visit := -1
+	for i, path := range history {
+		cp, err := runtime.LoadCheckpoint(path)
+		if err != nil {
+			return nil, fmt.Errorf("resume --from-node: %w", err)
+		}
+		cps[i] = cp
+		if cp.CurrentNode == nodeID {
+			visit = i
+		}
+	}
+	if visit < 0 {
+		return nil, fmt.Errorf("resume --from-node: node %q never ran in this run", nodeID)
+	}
+	if visit == 0 {
+		return nil, fmt.Errorf("resume --from-node: %q is the first stage; start a new run instead", nodeID)
+	}
+	p := &rewindPlan{logsRoot: logsRoot, checkpoint: cps[visit-1], abandoned: history[visit:]}
+	delete(p.checkpoint.Extra, nodeOutcomeExtraKey)
+	// status.json is current for nodes that did not run again after the
+	// rewind point; the history has the rest (and is authoritative when set).
+	p.outcomes = completedNodeOutcomes(logsRoot, p.checkpoint.CompletedNodes)
+	for _, cp := range cps[:visit] {
+		if o, ok := historyNodeOutcome(cp); ok {
+			p.outcomes[cp.CurrentNode] = o
+		}
+	}
+	seen := map[string]bool{}
+	for _, cp := range cps[visit:] {
+		if id := cp.CurrentNode; id != "" && !seen[id] {
+			seen[id] = true
+			p.nodes = append(p.nodes, id)
+		}
+	}
+	return p, nil
+}
+
+// apply archives the abandoned stage directories as visit_N/ (see
+// archivePriorVisitDir), moves the abandoned history entries to
+// checkpoints/rewind-N/ and makes the restored checkpoint current.
+func (p *rewindPlan) apply() error {
+	for _, id := range p.nodes {
+		archivePriorVisitDir(filepath.Join(p.logsRoot, id))
+	}
+	rewinds, _ := filepath.Glob(filepath.Join(p.logsRoot, checkpointHistoryDirName, "rewind-*"))
+	abandonedDir := filepath.Join(p.logsRoot, checkpointHistoryDirName, fmt.Sprintf("rewind-%d", len(rewinds)+1))
+	if err := os.MkdirAll(abandonedDir, 0o755); err != nil {
+		return err
+	}
+	for _, path := range p.abandoned {
+		if err := os.Rename(path, filepath.Join(abandonedDir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	if err := p.checkpoint.Save(filepath.Join(p.logsRoot, "checkpoint.json")); err != nil {
+		return err
+	}
+	// The run is no longer finished.
+	_ = os.Remove(filepath.Join(p.logsRoot, "final.json"))
+	return nil
+}
+
+// forkRunLogs copies a run's logs (not its worktree) to a sibling directory
+// for a new run ID and points the copied manifest at it, so the fork can be
+// resumed without touching the original run.
+func forkRunLogs(logsRoot, newRunID string) (string, error) {
+	if strings.TrimSpace(newRunID) == "" {
+		id, err := NewRunID()
+		if err != nil {
+			return "", err
+		}
+		newRunID = id
+	}
+	dst := filepath.Join(filepath.Dir(logsRoot), newRunID)
+	if _, err := os.Stat(dst); err == nil {
+		return "", fmt.Errorf("resume --fork: %s already exists", dst)
+	}
+	skip := map[string]bool{"worktree": true, "run.pid": true, "final.json": true, "run.tgz": true}
+	err := filepath.WalkDir(logsRoot, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(logsRoot, path)
+		if err != nil {
+			return err
+		}
+		if skip[rel] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFileContents(path, target)
+	})
+	if err != nil {
+		_ = os.RemoveAll(dst)
+		return "", fmt.Errorf("resume --fork: %w", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dst, "manifest.json"))
+	if err != nil {
+		return "", err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return "", err
+	}
+	oldRunID := anyToStringValue(raw["run_id"])
+	manifest := rebaseLogsRootPaths(raw, logsRoot, dst).(map[string]any)
+	manifest["run_id"] = newRunID
+	if rb := anyToStringValue(raw["run_branch"]); strings.HasSuffix(rb, "/"+oldRunID) {
+		manifest["run_branch"] = strings.TrimSuffix(rb, oldRunID) + newRunID
+	}
+	// The fork gets its own CXDB context rather than appending to the original's.
+	if cx, ok := manifest["cxdb"].(map[string]any); ok {
+		delete(cx, "context_id")
+		delete(cx, "head_turn_id")
+	}
+	manifest["started_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	manifest["forked_from"] = map[string]any{"run_id": oldRunID, "logs_root": logsRoot}
+	if err := writeJSON(filepath.Join(dst, "manifest.json"), manifest); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// rebaseLogsRootPaths rewrites string values under oldRoot to newRoot.
+func rebaseLogsRootPaths(v any, oldRoot, newRoot string) any {
+	switch t := v.(type) {
+	case string:
+		if t == oldRoot || strings.HasPrefix(t, oldRoot+string(filepath.Separator)) {
+			return newRoot + strings.TrimPrefix(t, oldRoot)
+		}
+		return t
+	case map[string]any:
+		for k, sub := range t {
+			t[k] = rebaseLogsRootPaths(sub, oldRoot, newRoot)
+		}
+		return t
+	case []any:
+		for i, sub := range t {
+			t[i] = rebaseLogsRootPaths(sub, oldRoot, newRoot)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// edgeBetween returns the first edge from one node to another, if any.
+func edgeBetween(g *model.Graph, from, to string) *model.Edge {
+	for _, e := range g.Outgoing(from) {
+		if e != nil && e.To == to {
+			return e
+		}
+	}
+	return nil
+}
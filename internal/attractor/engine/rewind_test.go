@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func runRewindFixture(t *testing.T) (repo, counters string, res *Result) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo = initFanInMergeRepo(t)
+	counters = t.TempDir()
+	dot := []byte(fmt.Sprintf(`
+digraph P {
+  graph [goal="rewind"]
+  start [shape=Mdiamond]
+  a [shape=parallelogram, tool_command="echo a > a.txt; echo run >> %[1]s/a"]
+  b [shape=parallelogram, tool_command="echo b >> b.txt; echo run >> %[1]s/b"]
+  c [shape=parallelogram, tool_command="echo c > c.txt; echo run >> %[1]s/c"]
+  exit [shape=Msquare]
+  start -> a -> b -> c -> exit
+}
+`, counters))
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return repo, counters, res
+}
+
+func countRuns(t *testing.T, counters, node string) int {
+	t.Helper()
+	b, _ := os.ReadFile(filepath.Join(counters, node))
+	return strings.Count(string(b), "run")
+}
+
+func TestResume_FromNode_RewindsToCheckpointBeforeNode(t *testing.T) {
+	repo, counters, res := runRewindFixture(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res2, err := ResumeWithOverrides(ctx, res.LogsRoot, ResumeOverrides{FromNode: "b"})
+	if err != nil {
+		t.Fatalf("Resume --from-node: %v", err)
+	}
+	if res2.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("final status=%q", res2.FinalStatus)
+	}
+	if got := [3]int{countRuns(t, counters, "a"), countRuns(t, counters, "b"), countRuns(t, counters, "c")}; got != [3]int{1, 2, 2} {
+		t.Fatalf("executions a,b,c=%v want [1 2 2]", got)
+	}
+	// b.txt is appended to, so a worktree that was not reset would have two lines.
+	if got := runCmdOut(t, repo, "git", "show", res2.FinalCommitSHA+":b.txt"); got != "b\n" {
+		t.Fatalf("b.txt=%q", got)
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "b", "visit_1", "status.json"))
+	assertExists(t, filepath.Join(res.LogsRoot, "c", "visit_1", "status.json"))
+	assertExists(t, filepath.Join(res.LogsRoot, checkpointHistoryDirName, "rewind-1"))
+	if _, err := os.Stat(filepath.Join(res.LogsRoot, "a", "visit_1")); err == nil {
+		t.Fatalf("stage before the rewind point was archived")
+	}
+
+	if _, err := ResumeWithOverrides(ctx, res.LogsRoot, ResumeOverrides{FromNode: "nope"}); err == nil || !strings.Contains(err.Error(), "never ran") {
+		t.Fatalf("unknown node err=%v", err)
+	}
+}
+
+func TestResume_FromNodeFork_LeavesOriginalRunUntouched(t *testing.T) {
+	repo, counters, res := runRewindFixture(t)
+	origHead := strings.TrimSpace(runCmdOut(t, repo, "git", "rev-parse", res.RunBranch))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	forked, err := ResumeWithOverrides(ctx, res.LogsRoot, ResumeOverrides{FromNode: "c", Fork: true, ForkRunID: "forked-run"})
+	if err != nil {
+		t.Fatalf("Resume --fork: %v", err)
+	}
+	if forked.RunID != "forked-run" || forked.LogsRoot != filepath.Join(filepath.Dir(res.LogsRoot), "forked-run") {
+		t.Fatalf("fork run_id=%q logs_root=%q", forked.RunID, forked.LogsRoot)
+	}
+	if !strings.HasSuffix(forked.RunBranch, "/forked-run") || forked.FinalStatus != runtime.FinalSuccess {
+		t.Fatalf("fork branch=%q status=%q", forked.RunBranch, forked.FinalStatus)
+	}
+	if countRuns(t, counters, "b") != 1 || countRuns(t, counters, "c") != 2 {
+		t.Fatalf("fork executions b=%d c=%d", countRuns(t, counters, "b"), countRuns(t, counters, "c"))
+	}
+	assertExists(t, filepath.Join(forked.LogsRoot, "c", "visit_1", "status.json"))
+
+	if head := strings.TrimSpace(runCmdOut(t, repo, "git", "rev-parse", res.RunBranch)); head != origHead {
+		t.Fatalf("original branch moved: %s -> %s", origHead, head)
+	}
+	assertExists(t, filepath.Join(res.LogsRoot, "final.json"))
+	if _, err := os.Stat(filepath.Join(res.LogsRoot, "c", "visit_1")); err == nil {
+		t.Fatalf("original run's stage dirs were archived")
+	}
+	m, err := loadManifest(filepath.Join(forked.LogsRoot, "manifest.json"))
+	if err != nil || m.RunID != "forked-run" {
+		t.Fatalf("fork manifest=%+v err=%v", m, err)
+	}
+}
+
+func TestResume_FromNode_KeepsPreRewindOutcomesOfLoopNodes(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	repo := initFanInMergeRepo(t)
+	counters := t.TempDir()
+	// a, work, b loop once: work (a goal gate) fails on the first pass and
+	// passes on the second. After rewinding to a, a's third run routes
+	// straight to exit, so the gate must be judged on work's first outcome.
+	dot := []byte(fmt.Sprintf(`
+digraph P {
+  graph [goal="rewind loop"]
+  start [shape=Mdiamond]
+  a [shape=parallelogram, max_retries=0, tool_command="echo run >> %[1]s/a; test $(grep -c run %[1]s/a) -lt 3"]
+  work [shape=parallelogram, goal_gate=true, max_retries=0, tool_command="echo run >> %[1]s/work; test $(grep -c run %[1]s/work) -ge 2"]
+  b [shape=parallelogram, max_retries=0, tool_command="echo run >> %[1]s/b; test $(grep -c run %[1]s/b) -lt 2"]
+  exit [shape=Msquare]
+  start -> a
+  a -> work
+  a -> exit [condition="outcome=fail"]
+  work -> b [condition="outcome=fail"]
+  work -> b
+  b -> a [condition="outcome=success"]
+  b -> exit
+}
+`, counters))
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := runForTest(t, ctx, dot, RunOptions{RepoPath: repo})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.FinalStatus != runtime.FinalSuccess || countRuns(t, counters, "work") != 2 {
+		t.Fatalf("first run status=%q work runs=%d", res.FinalStatus, countRuns(t, counters, "work"))
+	}
+
+	plan, err := planRewind(res.LogsRoot, "a")
+	if err != nil {
+		t.Fatalf("planRewind: %v", err)
+	}
+	if got := plan.outcomes["work"].Status; got != runtime.StatusFail {
+		t.Fatalf("work outcome at the rewind point=%q want fail", got)
+	}
+
+	res2, err := ResumeWithOverrides(ctx, res.LogsRoot, ResumeOverrides{FromNode: "a"})
+	if err == nil && res2.FinalStatus == runtime.FinalSuccess {
+		t.Fatalf("resumed run passed the goal gate with work's pre-rewind outcome lost")
+	}
+	if countRuns(t, counters, "a") != 3 || countRuns(t, counters, "work") != 2 {
+		t.Fatalf("executions a=%d work=%d", countRuns(t, counters, "a"), countRuns(t, counters, "work"))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -43,15 +44,26 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		}
 	}
 
-	// Prepare graph (parse + transforms + validate).
+	// Prepare graph (parse + transforms + validate), snapshotting the files it
+	// reads so resume and render see the same graph.
+	sources := newGraphSources(overrides.GraphPath, cfg.Repo.Path)
 	g, _, err := PrepareWithOptions(dotSource, PrepareOptions{
 		RepoPath:   cfg.Repo.Path,
 		KnownTypes: reg.KnownTypes(),
 		Catalog:    earlyCatalog,
+		SourcePath: overrides.GraphPath,
+		Params:     suppliedGraphParams(overrides.Params),
+		ReadFile:   sources.recordFrom(overrides.ReadGraphFile),
 	})
 	if err != nil {
 		return nil, err
 	}
+	// Record every resolved value (defaults included) so resume expands the
+	// graph identically.
+	params, err := resolveGraphParams(g, suppliedGraphParams(overrides.Params))
+	if err != nil {
+		return nil, err
+	}
 
 	// Ensure backend is specified for each provider used by the graph.
 	// Use the handler registry to identify nodes that require an LLM provider
@@ -61,7 +73,8 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		if n == nil {
 			continue
 		}
-		if pr, ok := reg.Resolve(n).(ProviderRequiringHandler); !ok || !pr.RequiresProvider() {
+		// A fan-in judge calls its node's provider too.
+		if pr, ok := reg.Resolve(n).(ProviderRequiringHandler); (!ok || !pr.RequiresProvider()) && !fanInJudgeEnabled(n) {
 			continue
 		}
 		p := strings.TrimSpace(n.Attr("llm_provider", ""))
@@ -123,8 +136,11 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	if overrides.RunBranchPrefix != "" {
 		opts.RunBranchPrefix = overrides.RunBranchPrefix
 	}
+	opts.GraphPath = overrides.GraphPath
+	opts.Params = params
 	opts.AllowTestShim = overrides.AllowTestShim
 	opts.ForceModels = normalizeForceModels(overrides.ForceModels)
+	opts.Labels = copyStringStringMap(overrides.Labels)
 	opts.ProgressSink = overrides.ProgressSink
 	opts.Interviewer = overrides.Interviewer
 	opts.OnEngineReady = overrides.OnEngineReady
@@ -132,6 +148,17 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	if err := opts.applyDefaults(); err != nil {
 		return nil, err
 	}
+	dryRun := overrides.DryRun
+	var hook *WebhookInterviewer
+	if dryRun == nil {
+		if hook, err = newConfiguredInterviewer(cfg, opts.RunID); err != nil {
+			return nil, err
+		}
+	}
+	if hook != nil {
+		opts.Interviewer = hook
+		defer context.AfterFunc(ctx, hook.Cancel)()
+	}
 	// Wire require_clean from config (applyDefaults sets the safe default;
 	// the config can explicitly relax it to false).
 	if cfg.Git.RequireClean != nil {
@@ -175,63 +202,31 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		return nil, fmt.Errorf("cannot create logs directory %s: %w", opts.LogsRoot, err)
 	}
 
-	if err := validateRunCLIProfilePolicy(cfg, opts, runUsesCLIProviders); err != nil {
-		report := &providerPreflightReport{
-			GeneratedAt:         time.Now().UTC().Format(time.RFC3339Nano),
-			CLIProfile:          normalizedCLIProfile(cfg),
-			AllowTestShim:       opts.AllowTestShim,
-			StrictCapabilities:  parseBool(strings.TrimSpace(os.Getenv("KILROY_PREFLIGHT_STRICT_CAPABILITIES")), false),
-			CapabilityProbeMode: capabilityProbeMode(),
-			PromptProbeMode:     promptProbeMode(cfg),
-		}
-		report.addCheck(providerPreflightCheck{
-			Name:    "provider_executable_policy",
-			Status:  preflightStatusFail,
-			Message: err.Error(),
-		})
-		_ = writePreflightReport(opts.LogsRoot, report)
-		return nil, err
-	}
-
-	// Resolve + snapshot the model catalog for this run (repeatability).
-	resolved, err := modeldb.ResolveModelCatalog(
-		ctx,
-		cfg.ModelDB.OpenRouterModelInfoPath,
-		opts.LogsRoot,
-		modeldb.CatalogUpdatePolicy(strings.ToLower(strings.TrimSpace(cfg.ModelDB.OpenRouterModelInfoUpdatePolicy))),
-		cfg.ModelDB.OpenRouterModelInfoURL,
-		time.Duration(cfg.ModelDB.OpenRouterModelInfoFetchTimeoutMS)*time.Millisecond,
+	var (
+		catalog  *modeldb.Catalog
+		resolved *modeldb.ResolvedCatalog
 	)
-	if err != nil {
-		return nil, err
-	}
-	catalog, err := loadCatalogForRun(resolved.SnapshotPath)
-	if err != nil {
-		return nil, err
-	}
-	catalogChecks, catalogErr := validateProviderModelPairs(g, runtimes, catalog, opts)
-	if catalogErr != nil {
-		report := &providerPreflightReport{
-			GeneratedAt:         time.Now().UTC().Format(time.RFC3339Nano),
-			CLIProfile:          normalizedCLIProfile(cfg),
-			AllowTestShim:       opts.AllowTestShim,
-			StrictCapabilities:  parseBool(strings.TrimSpace(os.Getenv("KILROY_PREFLIGHT_STRICT_CAPABILITIES")), false),
-			CapabilityProbeMode: capabilityProbeMode(),
-			PromptProbeMode:     promptProbeMode(cfg),
+	if dryRun != nil {
+		// A dry run spends no tokens and makes no network calls: the early
+		// catalog stands in for the resolved snapshot and providers are not
+		// probed.
+		if err := dryRun.checkNodes(g); err != nil {
+			return nil, err
 		}
-		for _, c := range catalogChecks {
-			report.addCheck(c)
+		catalog = earlyCatalog
+		resolved = &modeldb.ResolvedCatalog{Source: "dry_run"}
+		opts.Labels = copyStringStringMap(opts.Labels)
+		if opts.Labels == nil {
+			opts.Labels = map[string]string{}
 		}
-		_ = writePreflightReport(opts.LogsRoot, report)
-		return nil, catalogErr
-	}
-	if _, err := runProviderCLIPreflight(ctx, g, runtimes, cfg, opts, catalog, catalogChecks); err != nil {
+		opts.Labels["dry_run"] = "true"
+	} else if catalog, resolved, err = preflightRunProviders(ctx, g, cfg, opts, runtimes, runUsesCLIProviders); err != nil {
 		return nil, err
 	}
 
 	var sink *CXDBSink
 	var startup *CXDBStartupInfo
-	if !overrides.DisableCXDB {
+	if !overrides.DisableCXDB && dryRun == nil {
 		// CXDB is required in v1 and must be reachable.
 		cxdbClient, bin, cxdbStartup, err := ensureCXDBReady(ctx, cfg, opts.LogsRoot, opts.RunID)
 		if err != nil {
@@ -261,13 +256,19 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	}
 
 	eng := newBaseEngine(g, dotSource, opts)
+	eng.graphSources = sources
 	eng.Registry = reg // reuse the registry from validation (avoids creating a duplicate)
 	eng.RunConfig = cfg
 	eng.ArtifactPolicy = resolvedArtifactPolicy
 	eng.Context = NewContextWithGraphAttrs(g)
-	eng.CodergenBackend = NewCodergenRouterWithRuntimes(cfg, catalog, runtimes)
+	router := NewCodergenRouterWithRuntimes(cfg, catalog, runtimes)
+	router.setRunPaths(opts)
+	eng.CodergenBackend = router
 	eng.CXDB = sink
-	eng.ModelCatalogSHA = catalog.SHA256
+	eng.budget = newBudgetTracker(cfg.Budget, catalog)
+	if catalog != nil {
+		eng.ModelCatalogSHA = catalog.SHA256
+	}
 	eng.ModelCatalogSource = resolved.Source
 	eng.ModelCatalogPath = resolved.SnapshotPath
 	eng.InputMaterializationPolicy = inputMaterializationPolicyFromConfig(cfg)
@@ -288,11 +289,29 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 		}
 	}
 
+	if dryRun != nil {
+		dryRun.install(eng)
+	}
+
 	if overrides.OnEngineReady != nil {
 		overrides.OnEngineReady(eng)
 	}
 
 	res, err := eng.run(ctx)
+	if dryRun != nil {
+		// Coverage is written even when the run fails; unreached edges are
+		// often the point of the exercise.
+		cov, covErr := computeDryRunCoverage(g, opts.LogsRoot)
+		if covErr == nil {
+			covErr = writeJSON(filepath.Join(opts.LogsRoot, dryRunCoverageFile), cov)
+		}
+		if covErr != nil && err == nil {
+			return nil, fmt.Errorf("dry-run coverage: %w", covErr)
+		}
+		if res != nil {
+			res.DryRunCoverage = cov
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -302,6 +321,66 @@ func RunWithConfig(ctx context.Context, dotSource []byte, cfg *RunConfigFile, ov
 	return res, nil
 }
 
+// preflightRunProviders enforces the CLI profile policy, resolves and
+// snapshots the model catalog, and probes the providers the graph uses.
+// Failures are recorded in the preflight report under the logs root.
+func preflightRunProviders(ctx context.Context, g *model.Graph, cfg *RunConfigFile, opts RunOptions, runtimes map[string]ProviderRuntime, runUsesCLIProviders bool) (*modeldb.Catalog, *modeldb.ResolvedCatalog, error) {
+	if err := validateRunCLIProfilePolicy(cfg, opts, runUsesCLIProviders); err != nil {
+		report := &providerPreflightReport{
+			GeneratedAt:         time.Now().UTC().Format(time.RFC3339Nano),
+			CLIProfile:          normalizedCLIProfile(cfg),
+			AllowTestShim:       opts.AllowTestShim,
+			StrictCapabilities:  parseBool(strings.TrimSpace(os.Getenv("KILROY_PREFLIGHT_STRICT_CAPABILITIES")), false),
+			CapabilityProbeMode: capabilityProbeMode(),
+			PromptProbeMode:     promptProbeMode(cfg),
+		}
+		report.addCheck(providerPreflightCheck{
+			Name:    "provider_executable_policy",
+			Status:  preflightStatusFail,
+			Message: err.Error(),
+		})
+		_ = writePreflightReport(opts.LogsRoot, report)
+		return nil, nil, err
+	}
+
+	// Resolve + snapshot the model catalog for this run (repeatability).
+	resolved, err := modeldb.ResolveModelCatalog(
+		ctx,
+		cfg.ModelDB.OpenRouterModelInfoPath,
+		opts.LogsRoot,
+		modeldb.CatalogUpdatePolicy(strings.ToLower(strings.TrimSpace(cfg.ModelDB.OpenRouterModelInfoUpdatePolicy))),
+		cfg.ModelDB.OpenRouterModelInfoURL,
+		time.Duration(cfg.ModelDB.OpenRouterModelInfoFetchTimeoutMS)*time.Millisecond,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	catalog, err := loadCatalogForRun(resolved.SnapshotPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	catalogChecks, catalogErr := validateProviderModelPairs(g, runtimes, catalog, opts)
+	if catalogErr != nil {
+		report := &providerPreflightReport{
+			GeneratedAt:         time.Now().UTC().Format(time.RFC3339Nano),
+			CLIProfile:          normalizedCLIProfile(cfg),
+			AllowTestShim:       opts.AllowTestShim,
+			StrictCapabilities:  parseBool(strings.TrimSpace(os.Getenv("KILROY_PREFLIGHT_STRICT_CAPABILITIES")), false),
+			CapabilityProbeMode: capabilityProbeMode(),
+			PromptProbeMode:     promptProbeMode(cfg),
+		}
+		for _, c := range catalogChecks {
+			report.addCheck(c)
+		}
+		_ = writePreflightReport(opts.LogsRoot, report)
+		return nil, nil, catalogErr
+	}
+	if _, err := runProviderCLIPreflight(ctx, g, runtimes, cfg, opts, catalog, catalogChecks); err != nil {
+		return nil, nil, err
+	}
+	return catalog, resolved, nil
+}
+
 func validateProviderModelPairs(g *model.Graph, runtimes map[string]ProviderRuntime, catalog *modeldb.Catalog, opts RunOptions) ([]providerPreflightCheck, error) {
 	if g == nil || catalog == nil {
 		return nil, nil
@@ -313,7 +392,8 @@ func validateProviderModelPairs(g *model.Graph, runtimes map[string]ProviderRunt
 		if n == nil {
 			continue
 		}
-		if pr, ok := reg.Resolve(n).(ProviderRequiringHandler); !ok || !pr.RequiresProvider() {
+		// A fan-in judge calls its node's provider too.
+		if pr, ok := reg.Resolve(n).(ProviderRequiringHandler); (!ok || !pr.RequiresProvider()) && !fanInJudgeEnabled(n) {
 			continue
 		}
 		provider := normalizeProviderKey(n.Attr("llm_provider", ""))
@@ -397,3 +397,22 @@ digraph G {
 		})
 	}
 }
+
+func TestRunWithConfig_FailsFastWhenFanInJudgeBackendMissing(t *testing.T) {
+	dot := []byte(strings.Replace(judgeGraph, "llm_provider=openai", "llm_provider=anthropic", 1))
+	cfg := &RunConfigFile{}
+	cfg.Version = 1
+	cfg.Repo.Path = "/tmp/repo"
+	cfg.CXDB.BinaryAddr = "127.0.0.1:9009"
+	cfg.CXDB.HTTPBaseURL = "http://127.0.0.1:9010"
+	cfg.ModelDB.OpenRouterModelInfoPath = "/tmp/catalog.json"
+	// The judge's provider needs a backend even though fan-in nodes do not
+	// otherwise call a model.
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := RunWithConfig(ctx, dot, cfg, RunOptions{RunID: "r1", LogsRoot: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "llm.providers.anthropic.backend") {
+		t.Fatalf("expected missing judge backend error, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/agent"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+const (
+	sandboxModeOff    = "off"
+	sandboxModeStrict = "strict"
+)
+
+func parseSandboxMode(s string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(s)); v {
+	case "", "off", "none", "false":
+		return sandboxModeOff, nil
+	case sandboxModeStrict:
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid sandbox mode %q (want off|strict)", s)
+	}
+}
+
+// parseSandboxNetwork returns whether network access is denied; "" means use
+// the mode's default.
+func parseSandboxNetwork(s string) (*bool, error) {
+	deny := true
+	allow := false
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return nil, nil
+	case "deny", "none", "off":
+		return &deny, nil
+	case "allow", "on":
+		return &allow, nil
+	default:
+		return nil, fmt.Errorf("invalid sandbox network %q (want allow|deny)", s)
+	}
+}
+
+// resolveSandbox decides whether node runs sandboxed and, if so, whether its
+// network is denied. The run config is a floor: node attributes (then graph
+// attributes) can turn the sandbox on or deny the network, but cannot relax
+// what the operator configured, since graphs may come from ingest or server
+// clients.
+func resolveSandbox(execCtx *Execution, node *model.Node) (strict bool, denyNetwork bool, err error) {
+	var runCfg SandboxConfig
+	if execCtx != nil && execCtx.Engine != nil && execCtx.Engine.RunConfig != nil {
+		runCfg = execCtx.Engine.RunConfig.Sandbox
+	}
+	nodeID := ""
+	if node != nil {
+		nodeID = node.ID
+	}
+	attr := func(key string) string {
+		if node != nil {
+			if v := strings.TrimSpace(node.Attr(key, "")); v != "" {
+				return v
+			}
+		}
+		if execCtx != nil && execCtx.Graph != nil {
+			return strings.TrimSpace(execCtx.Graph.Attrs[key])
+		}
+		return ""
+	}
+	runMode, err := parseSandboxMode(runCfg.Mode)
+	if err != nil {
+		return false, false, err
+	}
+	attrMode, err := parseSandboxMode(attr("sandbox"))
+	if err != nil {
+		return false, false, err
+	}
+	if runMode == sandboxModeStrict && attr("sandbox") != "" && attrMode != sandboxModeStrict {
+		warnEngine(execCtx, fmt.Sprintf("sandbox=%s on node %s ignored: the run config requires sandbox mode strict", attr("sandbox"), nodeID))
+	}
+	if runMode != sandboxModeStrict && attrMode != sandboxModeStrict {
+		return false, false, nil
+	}
+
+	runDeny, err := parseSandboxNetwork(runCfg.Network)
+	if err != nil {
+		return false, false, err
+	}
+	attrDeny, err := parseSandboxNetwork(attr("sandbox_network"))
+	if err != nil {
+		return false, false, err
+	}
+	// Under a strict run config an unset network means deny, and that is a
+	// floor too; otherwise the attribute, then the run config, then deny.
+	floor := (runDeny != nil && *runDeny) || (runDeny == nil && runMode == sandboxModeStrict)
+	switch {
+	case floor:
+		if attrDeny != nil && !*attrDeny {
+			warnEngine(execCtx, fmt.Sprintf("sandbox_network=allow on node %s ignored: the run config denies network access", nodeID))
+		}
+		denyNetwork = true
+	case attrDeny != nil:
+		denyNetwork = *attrDeny
+	case runDeny != nil:
+		denyNetwork = *runDeny
+	default:
+		denyNetwork = true
+	}
+	return true, denyNetwork, nil
+}
+
+// resolveAgentLoopSandbox returns the sandbox for node's agent_loop session,
+// or nil when the sandbox is off.
+func resolveAgentLoopSandbox(execCtx *Execution, node *model.Node, writable ...string) (*agent.SandboxConfig, error) {
+	strict, deny, err := resolveSandbox(execCtx, node)
+	if err != nil || !strict {
+		return nil, err
+	}
+	var runCfg SandboxConfig
+	if execCtx != nil && execCtx.Engine != nil && execCtx.Engine.RunConfig != nil {
+		runCfg = execCtx.Engine.RunConfig.Sandbox
+	}
+	cfg := &agent.SandboxConfig{
+		DenyNetwork:      deny,
+		MemoryLimitBytes: int64(runCfg.MemoryMB) << 20,
+		CPULimit:         runCfg.CPUs,
+	}
+	for _, p := range append(append([]string{}, writable...), runCfg.WritablePaths...) {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.WritablePaths = append(cfg.WritablePaths, p)
+		}
+	}
+	return cfg, nil
+}
+
+// checkSandboxUnsupported fails stages that would run unconfined although a
+// sandbox applies to them. Codergen stages honor the graph and run config
+// (only the agent_loop backend can be sandboxed); tool and http nodes are
+// authored in the graph rather than by an agent, so only their own sandbox
+// attribute counts.
+func checkSandboxUnsupported(execCtx *Execution, node *model.Node, what string, nodeOnly bool) error {
+	var strict bool
+	if nodeOnly {
+		mode, err := parseSandboxMode(node.Attr("sandbox", ""))
+		if err != nil {
+			return err
+		}
+		strict = mode == sandboxModeStrict
+	} else {
+		var err error
+		if strict, _, err = resolveSandbox(execCtx, node); err != nil {
+			return err
+		}
+	}
+	if strict {
+		return fmt.Errorf("sandbox=strict cannot be applied to %s (node %s); only agent_loop codergen stages can be sandboxed", what, node.ID)
+	}
+	return nil
+}
+
+// buildAgentLoopEnvironment wraps local in the sandbox selected for node. A
+// requested sandbox that cannot be created fails the stage rather than
+// silently running unconfined.
+func buildAgentLoopEnvironment(execCtx *Execution, node *model.Node, local *agent.LocalExecutionEnvironment, stageDir string, contract stageStatusContract) (agent.ExecutionEnvironment, error) {
+	writable := []string{stageDir}
+	if contract.FallbackPath != "" {
+		writable = append(writable, filepath.Dir(contract.FallbackPath))
+	}
+	cfg, err := resolveAgentLoopSandbox(execCtx, node, writable...)
+	if err != nil || cfg == nil {
+		return local, err
+	}
+	for _, p := range cfg.WritablePaths {
+		// Paths must exist before they can be bound into the sandbox.
+		_ = os.MkdirAll(p, 0o755)
+	}
+	env, err := agent.NewSandboxedExecutionEnvironment(local, *cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := env.ResourceLimitsError(); err != nil {
+		warnEngine(execCtx, fmt.Sprintf("sandbox resource limits not enforced for node %s: %v", node.ID, err))
+	}
+	if execCtx != nil && execCtx.Engine != nil {
+		execCtx.Engine.appendProgress(map[string]any{
+			"event":        "sandbox_enabled",
+			"node_id":      node.ID,
+			"mode":         sandboxModeStrict,
+			"deny_network": cfg.DenyNetwork,
+		})
+	}
+	return env, nil
+}
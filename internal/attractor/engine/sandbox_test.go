@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+func TestResolveAgentLoopSandbox_OffByDefault(t *testing.T) {
+	got, err := resolveAgentLoopSandbox(&Execution{Graph: model.NewGraph("g")}, model.NewNode("n"))
+	if err != nil || got != nil {
+		t.Fatalf("sandbox=%+v err=%v want nil", got, err)
+	}
+}
+
+func TestResolveAgentLoopSandbox_Precedence(t *testing.T) {
+	cfg := &RunConfigFile{}
+	cfg.Sandbox = SandboxConfig{Mode: "strict", Network: "allow", WritablePaths: []string{"/cache"}, MemoryMB: 512, CPUs: 2}
+	eng := &Engine{RunConfig: cfg}
+	g := model.NewGraph("g")
+	exec := &Execution{Graph: g, Engine: eng}
+
+	// Run config alone enables the sandbox.
+	got, err := resolveAgentLoopSandbox(exec, model.NewNode("n"), "/logs/n")
+	if err != nil || got == nil {
+		t.Fatalf("sandbox=%+v err=%v", got, err)
+	}
+	if got.DenyNetwork {
+		t.Fatalf("network should follow run config allow")
+	}
+	if got.MemoryLimitBytes != 512<<20 || got.CPULimit != 2 {
+		t.Fatalf("limits=%d/%v", got.MemoryLimitBytes, got.CPULimit)
+	}
+	if strings.Join(got.WritablePaths, ",") != "/logs/n,/cache" {
+		t.Fatalf("writable=%v", got.WritablePaths)
+	}
+
+	// The run config is a floor: attributes can tighten it but not relax it.
+	g.Attrs["sandbox_network"] = "deny"
+	got, _ = resolveAgentLoopSandbox(exec, model.NewNode("n"))
+	if got == nil || !got.DenyNetwork {
+		t.Fatalf("graph sandbox_network=deny not applied: %+v", got)
+	}
+	node := model.NewNode("n")
+	node.Attrs["sandbox"] = "off"
+	node.Attrs["sandbox_network"] = "allow"
+	if got, _ := resolveAgentLoopSandbox(exec, node); got == nil || got.DenyNetwork {
+		t.Fatalf("node sandbox=off must not disable a strict run config: %+v", got)
+	}
+
+	cfg.Sandbox.Network = ""
+	delete(g.Attrs, "sandbox_network")
+	g.Attrs["sandbox"] = "off"
+	if got, _ := resolveAgentLoopSandbox(exec, node); got == nil || !got.DenyNetwork {
+		t.Fatalf("strict run config denies network unless it allows it: %+v", got)
+	}
+}
+
+func TestResolveAgentLoopSandbox_AttributesEnableWhenRunConfigIsOff(t *testing.T) {
+	g := model.NewGraph("g")
+	exec := &Execution{Graph: g, Engine: &Engine{RunConfig: &RunConfigFile{}}}
+	g.Attrs["sandbox"] = "strict"
+	node := model.NewNode("n")
+	node.Attrs["sandbox_network"] = "allow"
+	got, err := resolveAgentLoopSandbox(exec, node)
+	if err != nil || got == nil || got.DenyNetwork {
+		t.Fatalf("sandbox=%+v err=%v want strict with network allowed", got, err)
+	}
+}
+
+func TestCheckSandboxUnsupported(t *testing.T) {
+	cfg := &RunConfigFile{}
+	exec := &Execution{Graph: model.NewGraph("g"), Engine: &Engine{RunConfig: cfg}}
+	node := model.NewNode("n")
+	if err := checkSandboxUnsupported(exec, node, "a CLI agent", false); err != nil {
+		t.Fatalf("no sandbox requested: %v", err)
+	}
+	cfg.Sandbox.Mode = "strict"
+	if err := checkSandboxUnsupported(exec, node, "a CLI agent", false); err == nil {
+		t.Fatalf("strict run config must fail a stage that cannot be sandboxed")
+	}
+	// Tool and http nodes only answer to their own attribute.
+	if err := checkSandboxUnsupported(exec, node, "a tool command", true); err != nil {
+		t.Fatalf("run config should not apply to tool nodes: %v", err)
+	}
+	node.Attrs["sandbox"] = "strict"
+	if err := checkSandboxUnsupported(exec, node, "a tool command", true); err == nil || !strings.Contains(err.Error(), "cannot be applied") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestResolveAgentLoopSandbox_StrictDeniesNetworkByDefault(t *testing.T) {
+	node := model.NewNode("n")
+	node.Attrs["sandbox"] = "strict"
+	got, err := resolveAgentLoopSandbox(&Execution{Graph: model.NewGraph("g")}, node)
+	if err != nil || got == nil || !got.DenyNetwork {
+		t.Fatalf("sandbox=%+v err=%v want strict with network denied", got, err)
+	}
+	node.Attrs["sandbox"] = "loose"
+	if _, err := resolveAgentLoopSandbox(&Execution{Graph: model.NewGraph("g")}, node); err == nil {
+		t.Fatalf("expected error for unknown sandbox mode")
+	}
+}
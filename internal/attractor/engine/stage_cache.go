@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/gitutil"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// Stage memoization: a node with cache=true (or in a graph with cache=true)
+// is skipped when an earlier run executed it with the same inputs, and the
+// stored outcome and worktree tree are restored instead. Entries live under
+// the runs base dir and are shared by every run on the machine.
+
+const (
+	stageCacheVersion = "v1"
+
+	// stageCacheHitFileName records where a replayed stage came from.
+	stageCacheHitFileName = "cache_hit.json"
+
+	// stageCacheScratchPrefix holds run-scoped scratch files, which differ
+	// between runs and are neither hashed nor restored.
+	stageCacheScratchPrefix = ".ai/runs/"
+)
+
+type stageCacheEntry struct {
+	Key       string          `json:"key"`
+	NodeID    string          `json:"node_id"`
+	RunID     string          `json:"run_id"`
+	TreeSHA   string          `json:"tree_sha"`
+	CommitSHA string          `json:"commit_sha,omitempty"`
+	CreatedAt string          `json:"created_at"`
+	Outcome   runtime.Outcome `json:"outcome"`
+}
+
+// DefaultStageCacheDir is where stage cache entries are kept unless
+// RunOptions.StageCacheDir overrides it. The leading dot keeps it out of
+// run listings.
+func DefaultStageCacheDir() string {
+	return filepath.Join(DefaultRunsBaseDir(), ".stage_cache")
+}
+
+func (e *Engine) stageCacheDir() string {
+	if dir := strings.TrimSpace(e.Options.StageCacheDir); dir != "" {
+		return dir
+	}
+	return DefaultStageCacheDir()
+}
+
+// stageCacheEnabled reports whether node opted into memoization. Only
+// codergen and tool stages are cached; routing and fan-out nodes are cheap
+// and their effects are not captured by a single tree.
+func (e *Engine) stageCacheEnabled(node *model.Node, h Handler) bool {
+	if e == nil || node == nil || e.Options.NoCache || e.Options.DryRun != nil || e.WorktreeDir == "" {
+		return false
+	}
+	switch h.(type) {
+	case *CodergenHandler, *ToolHandler:
+	default:
+		return false
+	}
+	def := false
+	if e.Graph != nil {
+		def = parseBool(e.Graph.Attrs["cache"], false)
+	}
+	return parseBool(node.Attr("cache", ""), def)
+}
+
+// stageCacheKey hashes everything the stage's result depends on: the node and
+// its attributes (prompt, tool_command, model, provider, ...), the prompt
+// with $context references resolved, forced model overrides, the worktree
+// tree before the stage, the context values the node names in
+// cache.context_keys or references as $context.<key>, and the map item.
+func (e *Engine) stageCacheKey(node *model.Node) (string, error) {
+	h := sha256.New()
+	write := func(k, v string) {
+		fmt.Fprintf(h, "%s=%d:%s\n", k, len(v), v)
+	}
+	write("version", stageCacheVersion)
+	write("node", node.ID)
+
+	attrKeys := make([]string, 0, len(node.Attrs))
+	for k := range node.Attrs {
+		if k != "cache" {
+			attrKeys = append(attrKeys, k)
+		}
+	}
+	sort.Strings(attrKeys)
+	for _, k := range attrKeys {
+		write("attr."+k, node.Attrs[k])
+	}
+	write("prompt", interpolateContextVars(node.Prompt(), e.Context))
+	if forced, ok := forceModelForProvider(e.Options.ForceModels, node.Attr("llm_provider", "")); ok {
+		write("force_model", forced)
+	}
+
+	entries, err := gitutil.TreeEntries(e.WorktreeDir, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range entries {
+		if i := strings.IndexByte(line, '\t'); i >= 0 && strings.HasPrefix(line[i+1:], stageCacheScratchPrefix) {
+			continue
+		}
+		write("tree", line)
+	}
+
+	for _, k := range stageCacheContextKeys(node) {
+		v, _ := e.Context.Get(k)
+		b, _ := json.Marshal(v)
+		write("context."+k, string(b))
+	}
+	// Map bodies' tool commands read the item from the environment.
+	env := mapItemEnv(e.Context)
+	for _, k := range []string{mapItemEnvKey, mapIndexEnvKey} {
+		if v, ok := env[k]; ok {
+			write("env."+k, v)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func stageCacheContextKeys(node *model.Node) []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(k string) {
+		k = strings.TrimSpace(k)
+		if k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range strings.Split(node.Attr("cache.context_keys", ""), ",") {
+		add(k)
+	}
+	for _, text := range []string{node.Prompt(), node.Attr("tool_command", "")} {
+		for _, m := range contextVarRe.FindAllStringSubmatch(text, -1) {
+			add(m[1])
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *Engine) stageCacheEntryPath(key string) string {
+	return filepath.Join(e.stageCacheDir(), key[:2], key+".json")
+}
+
+// lookupStageCache returns the node's cache key and, on a hit, the entry
+// whose tree has already been restored into the worktree. An empty key means
+// the node is not cached.
+func (e *Engine) lookupStageCache(ctx context.Context, node *model.Node, h Handler) (string, *stageCacheEntry) {
+	if !e.stageCacheEnabled(node, h) {
+		return "", nil
+	}
+	key, err := e.stageCacheKey(node)
+	if err != nil {
+		e.Warn(fmt.Sprintf("stage cache disabled for %s: %v", node.ID, err))
+		return "", nil
+	}
+	b, err := os.ReadFile(e.stageCacheEntryPath(key))
+	if err != nil {
+		return key, nil
+	}
+	var entry stageCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil || entry.Key != key {
+		return key, nil
+	}
+	if !gitutil.HasObject(e.WorktreeDir, entry.TreeSHA) {
+		// The tree was garbage collected or belongs to another repository.
+		return key, nil
+	}
+	if err := gitutil.RestoreTree(e.WorktreeDir, entry.TreeSHA, []string{stageCacheScratchPrefix + "**"}); err != nil {
+		e.Warn(fmt.Sprintf("stage cache restore for %s failed: %v", node.ID, err))
+		_ = gitutil.ResetHard(e.WorktreeDir, "HEAD")
+		return key, nil
+	}
+
+	_ = writeJSON(filepath.Join(e.LogsRoot, node.ID, stageCacheHitFileName), map[string]any{
+		"key":           entry.Key,
+		"source_run_id": entry.RunID,
+		"tree_sha":      entry.TreeSHA,
+		"commit_sha":    entry.CommitSHA,
+		"created_at":    entry.CreatedAt,
+	})
+	e.appendProgress(map[string]any{
+		"event":         "stage_cache_hit",
+		"node_id":       node.ID,
+		"cache_key":     entry.Key,
+		"source_run_id": entry.RunID,
+		"tree_sha":      entry.TreeSHA,
+		"status":        string(entry.Outcome.Status),
+	})
+	e.cxdbStageCacheHit(ctx, node.ID, &entry)
+	return key, &entry
+}
+
+// deferStageCacheStore remembers a successful miss; the entry is written by
+// storeStageCache once the stage's checkpoint commit exists.
+func (e *Engine) deferStageCacheStore(nodeID, key string, out runtime.Outcome) {
+	if key == "" || (out.Status != runtime.StatusSuccess && out.Status != runtime.StatusPartialSuccess) {
+		delete(e.pendingStageCache, nodeID)
+		return
+	}
+	if e.pendingStageCache == nil {
+		e.pendingStageCache = map[string]string{}
+	}
+	e.pendingStageCache[nodeID] = key
+}
+
+func (e *Engine) storeStageCache(nodeID, commitSHA string, out runtime.Outcome) {
+	key := e.pendingStageCache[nodeID]
+	if key == "" {
+		return
+	}
+	delete(e.pendingStageCache, nodeID)
+	tree, err := gitutil.TreeSHA(e.WorktreeDir, commitSHA)
+	if err != nil {
+		e.Warn(fmt.Sprintf("stage cache store for %s failed: %v", nodeID, err))
+		return
+	}
+	stored := out
+	if len(out.Meta) > 0 {
+		stored.Meta = map[string]any{}
+		for k, v := range out.Meta {
+			if k != "kilroy.git_checkpoint_sha" {
+				stored.Meta[k] = v
+			}
+		}
+	}
+	entry := stageCacheEntry{
+		Key:       key,
+		NodeID:    nodeID,
+		RunID:     e.Options.RunID,
+		TreeSHA:   tree,
+		CommitSHA: commitSHA,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Outcome:   stored,
+	}
+	path := e.stageCacheEntryPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		e.Warn(fmt.Sprintf("stage cache store for %s failed: %v", nodeID, err))
+		return
+	}
+	if err := writeJSON(path, entry); err != nil {
+		e.Warn(fmt.Sprintf("stage cache store for %s failed: %v", nodeID, err))
+	}
+}
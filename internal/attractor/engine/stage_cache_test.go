@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func TestRun_StageCache_ReplaysUnchangedToolStage(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	cacheDir := t.TempDir()
+	counter := filepath.Join(t.TempDir(), "count")
+	dot := []byte(fmt.Sprintf(`
+digraph P {
+  graph [goal="cache"]
+  start [shape=Mdiamond]
+  build [shape=parallelogram, cache=true, tool_command="echo built > out.txt; echo run >> %s"]
+  exit [shape=Msquare]
+  start -> build -> exit
+}
+`, counter))
+	run := func(opts RunOptions) *Result {
+		t.Helper()
+		opts.RepoPath = repo
+		opts.StageCacheDir = cacheDir
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		res, err := runForTest(t, ctx, dot, opts)
+		if err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+		if res.FinalStatus != runtime.FinalSuccess {
+			t.Fatalf("final status=%q", res.FinalStatus)
+		}
+		if got := strings.TrimSpace(runCmdOut(t, repo, "git", "show", res.FinalCommitSHA+":out.txt")); got != "built" {
+			t.Fatalf("out.txt=%q", got)
+		}
+		return res
+	}
+	runs := func() int {
+		b, _ := os.ReadFile(counter)
+		return strings.Count(string(b), "run")
+	}
+
+	first := run(RunOptions{})
+	if runs() != 1 {
+		t.Fatalf("first run executions=%d", runs())
+	}
+	second := run(RunOptions{})
+	if runs() != 1 {
+		t.Fatalf("cached stage was executed again")
+	}
+	assertExists(t, filepath.Join(second.LogsRoot, "build", stageCacheHitFileName))
+	progress, err := os.ReadFile(filepath.Join(second.LogsRoot, "progress.ndjson"))
+	if err != nil {
+		t.Fatalf("read progress: %v", err)
+	}
+	if !strings.Contains(string(progress), `"event":"stage_cache_hit"`) || !strings.Contains(string(progress), first.RunID) {
+		t.Fatalf("progress missing stage_cache_hit from %s", first.RunID)
+	}
+
+	run(RunOptions{NoCache: true})
+	if runs() != 2 {
+		t.Fatalf("--no-cache run executions=%d want 2", runs())
+	}
+}
+
+func TestStageCacheKey_ChangesWithTreeAndContext(t *testing.T) {
+	repo := initFanInMergeRepo(t)
+	g, _, err := Prepare([]byte(`
+digraph P {
+  start [shape=Mdiamond]
+  build [shape=parallelogram, tool_command="make $context.target", cache.context_keys="flavor"]
+  exit [shape=Msquare]
+  start -> build -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	eng := &Engine{Graph: g, Context: runtime.NewContext(), WorktreeDir: repo}
+	node := g.Nodes["build"]
+	key := func() string {
+		t.Helper()
+		k, err := eng.stageCacheKey(node)
+		if err != nil {
+			t.Fatalf("stageCacheKey: %v", err)
+		}
+		return k
+	}
+	base := key()
+	if key() != base {
+		t.Fatalf("key is not deterministic")
+	}
+	eng.Context.Set("unrelated", "x")
+	if key() != base {
+		t.Fatalf("unrelated context value changed the key")
+	}
+	eng.Context.Set("target", "all")
+	withTarget := key()
+	if withTarget == base {
+		t.Fatalf("$context reference did not change the key")
+	}
+	eng.Context.Set("flavor", "debug")
+	if key() == withTarget {
+		t.Fatalf("cache.context_keys value did not change the key")
+	}
+	withFlavor := key()
+
+	_ = os.MkdirAll(filepath.Join(repo, ".ai", "runs", "r1"), 0o755)
+	_ = os.WriteFile(filepath.Join(repo, ".ai", "runs", "r1", "notes.md"), []byte("scratch"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "scratch")
+	if key() != withFlavor {
+		t.Fatalf("run-scoped scratch files changed the key")
+	}
+	_ = os.WriteFile(filepath.Join(repo, "README.md"), []byte("edited"), 0o644)
+	runCmd(t, repo, "git", "add", "-A")
+	runCmd(t, repo, "git", "commit", "-m", "edit")
+	if key() == withFlavor {
+		t.Fatalf("worktree change did not change the key")
+	}
+}
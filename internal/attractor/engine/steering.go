@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// steerDirective is one manager intervention queued for a child pipeline.
+type steerDirective struct {
+	ManagerNodeID  string
+	Cycle          int
+	ContextUpdates map[string]any
+	Fidelity       string
+	Note           string
+}
+
+// steerInbox connects a manager_loop node to the child engine it supervises.
+// The manager pushes directives from its own goroutine; the child drains them
+// at node boundaries, so the child engine's own fields are only ever touched
+// by the child goroutine.
+type steerInbox struct {
+	mu       sync.Mutex
+	pending  []steerDirective
+	childCtx *runtime.Context
+}
+
+func (s *steerInbox) push(d steerDirective) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, d)
+}
+
+func (s *steerInbox) drain() []steerDirective {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.pending
+	s.pending = nil
+	return out
+}
+
+func (s *steerInbox) attach(ctx *runtime.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.childCtx = ctx
+}
+
+// childContext returns the running child's context, or nil before the child
+// engine has been built.
+func (s *steerInbox) childContext() *runtime.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.childCtx
+}
+
+// steerState is the child-side view of directives that have been received but
+// not yet consumed by an LLM node.
+type steerState struct {
+	fidelity string
+	notes    []string
+	// active holds the notes for the node currently executing, so every retry
+	// attempt of that node sees the same guidance.
+	active []string
+}
+
+// applySteering drains queued manager directives before node runs. Context
+// updates land immediately; a forced fidelity and steering notes are held
+// until the next LLM node and apply to that node only. The returned func
+// restores per-node state and must be called once the node finishes.
+func (e *Engine) applySteering(node *model.Node) func() {
+	if e == nil || e.steering == nil || node == nil {
+		return func() {}
+	}
+	for _, d := range e.steering.drain() {
+		if len(d.ContextUpdates) > 0 {
+			e.Context.ApplyUpdates(d.ContextUpdates)
+		}
+		if d.Fidelity != "" {
+			e.steer.fidelity = d.Fidelity
+		}
+		if d.Note != "" {
+			e.steer.notes = append(e.steer.notes, d.Note)
+		}
+		keys := make([]string, 0, len(d.ContextUpdates))
+		for k := range d.ContextUpdates {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.appendProgress(map[string]any{
+			"event":           "manager_steer_applied",
+			"manager_node_id": d.ManagerNodeID,
+			"node_id":         node.ID,
+			"cycle":           d.Cycle,
+			"context_keys":    keys,
+			"fidelity":        d.Fidelity,
+			"note":            d.Note,
+		})
+	}
+
+	fa, ok := e.Registry.Resolve(node).(FidelityAwareHandler)
+	if !ok || !fa.UsesFidelity() || (e.steer.fidelity == "" && len(e.steer.notes) == 0) {
+		return func() {}
+	}
+	prevFidelity, prevThread := e.lastResolvedFidelity, e.lastResolvedThreadKey
+	if e.steer.fidelity != "" {
+		e.lastResolvedFidelity = e.steer.fidelity
+		e.lastResolvedThreadKey = ""
+		if e.steer.fidelity == "full" {
+			e.lastResolvedThreadKey = resolveThreadKey(e.Graph, e.incomingEdge, node)
+		}
+	}
+	e.steer.active = e.steer.notes
+	e.steer.fidelity = ""
+	e.steer.notes = nil
+	return func() {
+		e.lastResolvedFidelity, e.lastResolvedThreadKey = prevFidelity, prevThread
+		e.steer.active = nil
+	}
+}
+
+// steeringPromptPreamble renders manager guidance for the current LLM node.
+func (e *Engine) steeringPromptPreamble() string {
+	if e == nil || len(e.steer.active) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Supervisor steering (from the managing pipeline; follow this guidance for this stage):\n")
+	for _, n := range e.steer.active {
+		b.WriteString("- ")
+		b.WriteString(strings.TrimSpace(n))
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// managerSteerConfig holds the manager.steer_* attributes of a manager_loop node.
+type managerSteerConfig struct {
+	Condition      string
+	Note           string
+	Fidelity       string
+	ContextUpdates map[string]any
+	Max            int
+}
+
+func parseManagerSteerConfig(node *model.Node) (managerSteerConfig, error) {
+	cfg := managerSteerConfig{
+		Condition: strings.TrimSpace(node.Attr("manager.steer_condition", "")),
+		Note:      strings.TrimSpace(node.Attr("manager.steer_prompt", "")),
+		Fidelity:  strings.ToLower(strings.TrimSpace(node.Attr("manager.steer_fidelity", ""))),
+		Max:       parseInt(node.Attr("manager.steer_max", "1"), 1),
+	}
+	if cfg.Fidelity != "" && !validFidelityModes[cfg.Fidelity] {
+		return cfg, fmt.Errorf("invalid manager.steer_fidelity %q", cfg.Fidelity)
+	}
+	if raw := strings.TrimSpace(node.Attr("manager.steer_context", "")); raw != "" {
+		cfg.ContextUpdates = map[string]any{}
+		for _, pair := range strings.Split(raw, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			k = strings.TrimSpace(k)
+			if !ok || k == "" {
+				return cfg, fmt.Errorf("invalid manager.steer_context entry %q (want key=value)", pair)
+			}
+			cfg.ContextUpdates[k] = strings.TrimSpace(v)
+		}
+	}
+	if cfg.Note == "" && cfg.Fidelity == "" && len(cfg.ContextUpdates) == 0 {
+		return cfg, fmt.Errorf("steer action requires manager.steer_prompt, manager.steer_context, or manager.steer_fidelity")
+	}
+	return cfg, nil
+}
+
+func (cfg managerSteerConfig) directive(managerNodeID string, cycle int) steerDirective {
+	updates := make(map[string]any, len(cfg.ContextUpdates))
+	for k, v := range cfg.ContextUpdates {
+		updates[k] = v
+	}
+	return steerDirective{
+		ManagerNodeID:  managerNodeID,
+		Cycle:          cycle,
+		ContextUpdates: updates,
+		Fidelity:       cfg.Fidelity,
+		Note:           cfg.Note,
+	}
+}
@@ -92,8 +92,10 @@ func runSubgraphUntil(ctx context.Context, eng *Engine, startNodeID, stopNodeID
 		// for subgraph/branch execution, matching the main loop (engine.go).
 		eng.Context.Set(fmt.Sprintf("internal.retry_count.%s", current), nodeRetries[current])
 
+		restoreSteering := eng.applySteering(node)
 		eng.cxdbStageStarted(ctx, node)
 		out, err := eng.executeWithRetry(ctx, node, nodeRetries)
+		restoreSteering()
 		if err != nil {
 			return parallelBranchResult{}, err
 		}
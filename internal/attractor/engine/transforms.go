@@ -56,10 +56,15 @@ func (t goalExpansionTransform) Apply(g *model.Graph) error {
 //   - If both prompt and prompt_file are set, it is an error (ambiguous).
 //   - If the referenced file does not exist or is unreadable, it is an error.
 //   - After expansion, prompt_file is removed from the node attributes.
-func expandPromptFiles(g *model.Graph, repoPath string) error {
+//
+// readFile loads the files (PrepareOptions.ReadFile); nil reads from disk.
+func expandPromptFiles(g *model.Graph, repoPath string, readFile func(path string) ([]byte, error)) error {
 	if repoPath == "" {
 		return nil
 	}
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
 	for _, n := range g.Nodes {
 		if n == nil {
 			continue
@@ -79,7 +84,7 @@ func expandPromptFiles(g *model.Graph, repoPath string) error {
 		if !filepath.IsAbs(pf) {
 			resolved = filepath.Join(repoPath, pf)
 		}
-		data, err := os.ReadFile(resolved)
+		data, err := readFile(resolved)
 		if err != nil {
 			return fmt.Errorf("node %q: prompt_file %q: %w", n.ID, pf, err)
 		}
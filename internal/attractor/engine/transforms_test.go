@@ -93,7 +93,7 @@ func TestExpandPromptFiles_LoadsFileContent(t *testing.T) {
 	n.Attrs["prompt_file"] = "prompts/impl.md"
 	_ = g.AddNode(n)
 
-	if err := expandPromptFiles(g, dir); err != nil {
+	if err := expandPromptFiles(g, dir, nil); err != nil {
 		t.Fatalf("expandPromptFiles: %v", err)
 	}
 
@@ -116,7 +116,7 @@ func TestExpandPromptFiles_ErrorOnConflict(t *testing.T) {
 	n.Attrs["prompt"] = "inline prompt"
 	_ = g.AddNode(n)
 
-	err := expandPromptFiles(g, dir)
+	err := expandPromptFiles(g, dir, nil)
 	if err == nil {
 		t.Fatal("expected error for conflicting prompt and prompt_file")
 	}
@@ -133,7 +133,7 @@ func TestExpandPromptFiles_ErrorOnMissingFile(t *testing.T) {
 	n.Attrs["prompt_file"] = "nonexistent.md"
 	_ = g.AddNode(n)
 
-	err := expandPromptFiles(g, dir)
+	err := expandPromptFiles(g, dir, nil)
 	if err == nil {
 		t.Fatal("expected error for missing prompt_file")
 	}
@@ -149,7 +149,7 @@ func TestExpandPromptFiles_NoOpWithoutRepoPath(t *testing.T) {
 	_ = g.AddNode(n)
 
 	// Should not error even though file doesn't exist — no repoPath means skip.
-	if err := expandPromptFiles(g, ""); err != nil {
+	if err := expandPromptFiles(g, "", nil); err != nil {
 		t.Fatalf("expandPromptFiles with empty repoPath: %v", err)
 	}
 	// prompt_file should still be present (not resolved).
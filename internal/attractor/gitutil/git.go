@@ -118,18 +118,64 @@ func AddAll(worktreeDir string) error {
 // AddAllWithExcludes stages all changes except paths matching provided git
 // pathspec globs via :(exclude)<glob>.
 func AddAllWithExcludes(worktreeDir string, excludes []string) error {
-	args := []string{"add", "-A", "--", "."}
+	args := append([]string{"add", "-A", "--", "."}, excludePathspecs(excludes)...)
+	_, _, err := runGit(worktreeDir, args...)
+	return err
+}
+
+func excludePathspecs(excludes []string) []string {
+	var out []string
 	for _, p := range excludes {
 		p = strings.TrimSpace(p)
 		if p == "" {
 			continue
 		}
 		if strings.HasPrefix(p, ":(") {
-			args = append(args, p)
+			out = append(out, p)
 			continue
 		}
-		args = append(args, ":(glob,exclude)"+p)
+		out = append(out, ":(glob,exclude)"+p)
+	}
+	return out
+}
+
+// TreeSHA returns the tree object ID of ref (e.g. HEAD).
+func TreeSHA(dir, ref string) (string, error) {
+	out, _, err := runGit(dir, "rev-parse", ref+"^{tree}")
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSpace(out), nil
+}
+
+// TreeEntries returns the recursive `git ls-tree` listing of ref, one
+// "<mode> <type> <object>\t<path>" line per file.
+func TreeEntries(dir, ref string) ([]string, error) {
+	out, _, err := runGit(dir, "ls-tree", "-r", "--full-tree", ref)
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
+
+// HasObject reports whether the object exists in the repository (it may
+// have been garbage collected).
+func HasObject(dir, sha string) bool {
+	_, _, err := runGit(dir, "cat-file", "-e", sha)
+	return err == nil
+}
+
+// RestoreTree makes the index and working tree match tree, except for paths
+// matching excludes. Tracked files missing from tree are removed; untracked
+// files are left alone.
+func RestoreTree(worktreeDir, tree string, excludes []string) error {
+	args := append([]string{"restore", "--source=" + tree, "--staged", "--worktree", "--", "."}, excludePathspecs(excludes)...)
 	_, _, err := runGit(worktreeDir, args...)
 	return err
 }
@@ -150,9 +196,7 @@ func commitAllowEmpty(worktreeDir, message string) (string, error) {
 	if err != nil {
 		// If identity is missing, retry once with an explicit fallback committer identity
 		// (without mutating repo config).
-		if strings.Contains(err.Error(), "Author identity unknown") ||
-			strings.Contains(err.Error(), "Please tell me who you are") ||
-			strings.Contains(err.Error(), "unable to auto-detect email address") {
+		if isMissingIdentityError(err) {
 			_, _, err = runGit(
 				worktreeDir,
 				"-c", "user.name=kilroy-attractor",
@@ -200,6 +244,56 @@ func DiffNameOnly(dir, baseRef string) ([]string, error) {
 	return files, nil
 }
 
+// Diff returns the unified diff from fromRef to toRef.
+func Diff(dir, fromRef, toRef string) (string, error) {
+	out, _, err := runGit(dir, "diff", fromRef, toRef)
+	return out, err
+}
+
+// MergeNoFF merges otherRef into the currently checked out branch, always
+// creating a merge commit. On conflict the merge is left in progress so the
+// caller can inspect it with ConflictedFiles and then call MergeAbort.
+func MergeNoFF(worktreeDir, otherRef, message string) error {
+	_, _, err := runGit(worktreeDir, "merge", "--no-ff", "--no-edit", "-m", message, otherRef)
+	if err != nil && isMissingIdentityError(err) {
+		_, _, err = runGit(
+			worktreeDir,
+			"-c", "user.name=kilroy-attractor",
+			"-c", "user.email=kilroy-attractor@local",
+			"merge", "--no-ff", "--no-edit", "-m", message, otherRef,
+		)
+	}
+	return err
+}
+
+// MergeAbort abandons an in-progress merge and restores the pre-merge state.
+func MergeAbort(worktreeDir string) error {
+	_, _, err := runGit(worktreeDir, "merge", "--abort")
+	return err
+}
+
+// ConflictedFiles returns the unmerged paths of an in-progress merge.
+func ConflictedFiles(worktreeDir string) ([]string, error) {
+	out, _, err := runGit(worktreeDir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			files = append(files, trimmed)
+		}
+	}
+	return files, nil
+}
+
+func isMissingIdentityError(err error) bool {
+	return strings.Contains(err.Error(), "Author identity unknown") ||
+		strings.Contains(err.Error(), "Committer identity unknown") ||
+		strings.Contains(err.Error(), "Please tell me who you are") ||
+		strings.Contains(err.Error(), "unable to auto-detect email address")
+}
+
 func ensureUserIdentity(worktreeDir string) error {
 	name, _, err := runGit(worktreeDir, "config", "--get", "user.name")
 	if err != nil {
@@ -89,3 +89,105 @@ func TestDiffNameOnly_NoChanges(t *testing.T) {
 		t.Errorf("DiffNameOnly with no changes = %v, want []", files)
 	}
 }
+
+func TestMergeNoFF_CleanAndConflicting(t *testing.T) {
+	dir := initTestRepo(t)
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commitFile := func(branch, name, content string) string {
+		t.Helper()
+		git("checkout", "-q", "-B", branch, "main")
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", branch)
+		sha, err := HeadSHA(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sha
+	}
+	a := commitFile("a", "a.txt", "a")
+	b := commitFile("b", "initial.txt", "from b")
+	c := commitFile("c", "initial.txt", "from c")
+	git("checkout", "-q", "main")
+
+	if err := MergeNoFF(dir, a, "merge a"); err != nil {
+		t.Fatalf("MergeNoFF(a): %v", err)
+	}
+	if err := MergeNoFF(dir, b, "merge b"); err != nil {
+		t.Fatalf("MergeNoFF(b): %v", err)
+	}
+	head, _ := HeadSHA(dir)
+	if err := MergeNoFF(dir, c, "merge c"); err == nil {
+		t.Fatal("expected conflict merging c")
+	}
+	files, err := ConflictedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "initial.txt" {
+		t.Fatalf("conflicted files=%v", files)
+	}
+	if err := MergeAbort(dir); err != nil {
+		t.Fatalf("MergeAbort: %v", err)
+	}
+	if got, _ := HeadSHA(dir); got != head {
+		t.Fatalf("HEAD moved after abort: %s != %s", got, head)
+	}
+	if files, _ := ConflictedFiles(dir); len(files) != 0 {
+		t.Fatalf("conflicts remain after abort: %v", files)
+	}
+}
+
+func TestRestoreTree_RestoresTrackedFilesExceptExcludes(t *testing.T) {
+	dir := initTestRepo(t)
+	_ = os.MkdirAll(filepath.Join(dir, "keep"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "keep", "k.txt"), []byte("before"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "gone.txt"), []byte("x"), 0o644)
+	if _, err := CommitAllowEmpty(dir, "base"); err != nil {
+		t.Fatal(err)
+	}
+	base, err := TreeSHA(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.Remove(filepath.Join(dir, "gone.txt"))
+	_ = os.WriteFile(filepath.Join(dir, "initial.txt"), []byte("changed"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "keep", "k.txt"), []byte("after"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "new.txt"), []byte("n"), 0o644)
+	if _, err := CommitAllowEmpty(dir, "change"); err != nil {
+		t.Fatal(err)
+	}
+	if !HasObject(dir, base) || HasObject(dir, "0123456789012345678901234567890123456789") {
+		t.Fatalf("HasObject mismatch")
+	}
+
+	if err := RestoreTree(dir, base, []string{"keep/**"}); err != nil {
+		t.Fatalf("RestoreTree: %v", err)
+	}
+	read := func(name string) string {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(b)
+	}
+	if read("initial.txt") != "hello" || read("gone.txt") != "x" {
+		t.Fatalf("tree not restored: initial=%q gone=%q", read("initial.txt"), read("gone.txt"))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("new.txt should be removed, stat err=%v", err)
+	}
+	if read("keep/k.txt") != "after" {
+		t.Fatalf("excluded path was restored: %q", read("keep/k.txt"))
+	}
+	entries, err := TreeEntries(dir, base)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("TreeEntries=%v err=%v", entries, err)
+	}
+}
@@ -0,0 +1,17 @@
+package ingest
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	if got := unifiedDiff("a", "b", "x\n", "x\n"); got != "" {
+		t.Fatalf("identical inputs: %q", got)
+	}
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	want := "--- a\n+++ b\n" +
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if got := unifiedDiff("a", "b", a, b); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
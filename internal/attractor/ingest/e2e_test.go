@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -177,3 +178,75 @@ func TestRunWithMockClaudeNoPipelineDot(t *testing.T) {
 	}
 	t.Logf("Got expected error: %v", err)
 }
+
+// TestRunWithMockClaudeRepairsInvalidDraft tests that a draft failing
+// validation is sent back to claude, which fixes pipeline.dot in place.
+func TestRunWithMockClaudeRepairsInvalidDraft(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// First call writes a graph without start/exit nodes; later calls (the
+	// repair rounds, which pass --continue) write a valid one and record the
+	// prompt they were given.
+	mockScript := filepath.Join(tmpDir, "claude")
+	script := `#!/bin/sh
+for last; do :; done
+if [ -f pipeline.dot ]; then
+  printf '%s' "$last" > "` + tmpDir + `/repair-prompt.txt"
+  printf 'digraph G {\n  graph [goal="demo"]\n  start [shape=Mdiamond]\n  exit [shape=Msquare]\n  start -> exit\n}\n' > pipeline.dot
+else
+  printf 'digraph G { a -> b }\n' > pipeline.dot
+fi
+`
+	if err := os.WriteFile(mockScript, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	skillPath := filepath.Join(tmpDir, "SKILL.md")
+	if err := os.WriteFile(skillPath, []byte("# Test Skill\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KILROY_CLAUDE_PATH", mockScript)
+
+	opts := Options{
+		Requirements: "Build something",
+		SkillPath:    skillPath,
+		Model:        "claude-sonnet-4-5",
+		Validate:     true,
+	}
+	result, err := Run(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "after 0 repair round(s)") {
+		t.Fatalf("without repair rounds: err=%v", err)
+	}
+	if result == nil || result.DotContent != "digraph G { a -> b }" || result.Report().Valid {
+		t.Fatalf("without repair rounds: result=%+v", result)
+	}
+
+	opts.RepairRounds = DefaultRepairRounds
+	result, err = Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.RepairRounds != 1 || !strings.Contains(result.DotContent, "start -> exit") {
+		t.Fatalf("result=%+v", result)
+	}
+	prompt, err := os.ReadFile(filepath.Join(tmpDir, "repair-prompt.txt"))
+	if err != nil {
+		t.Fatalf("repair round did not run: %v", err)
+	}
+	if !strings.Contains(string(prompt), "- [terminal_node]") || !strings.Contains(string(prompt), "editing pipeline.dot") {
+		t.Fatalf("repair prompt=%q", prompt)
+	}
+
+	reportPath := ReportPath(filepath.Join(tmpDir, "out.dot"))
+	if err := result.WriteReport(reportPath); err != nil {
+		t.Fatal(err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"valid": true`, `"repair_rounds": 1`, `+++ final.dot`} {
+		if !strings.Contains(string(report), want) {
+			t.Fatalf("report missing %q:\n%s", want, report)
+		}
+	}
+}
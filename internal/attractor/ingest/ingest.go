@@ -12,6 +12,8 @@ import (
 	"text/template"
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+	"github.com/danshapiro/kilroy/internal/llm"
 )
 
 //go:embed ingest_prompt.tmpl
@@ -29,23 +31,42 @@ type Options struct {
 	RepoPath     string // Repository root (working directory for claude).
 	Validate     bool   // Whether to validate the .dot output.
 	MaxTurns     int    // Max turns for claude (default 15).
+
+	// RepairRounds bounds how often a draft that fails validation is sent
+	// back to the model with its diagnostics. Zero disables repair.
+	RepairRounds int
+
+	// Provider selects the API path: the requirements are sent through an
+	// agent session for this llm.providers entry of Config instead of the
+	// claude CLI. Empty keeps the CLI path.
+	Provider string
+	Config   *engine.RunConfigFile
+	Client   *llm.Client // overrides the client built from Config (tests)
 }
 
 // Result contains the output of an ingestion run.
 type Result struct {
 	DotContent string   // The extracted .dot file content.
 	Warnings   []string // Any validation warnings.
+
+	FirstDraft   string                // The graph before any repair round.
+	RepairRounds int                   // Repair rounds that ran.
+	Diagnostics  []validate.Diagnostic // Diagnostics of the final draft.
 }
 
 // buildPrompt renders the ingest prompt template with the given requirements.
-func buildPrompt(requirements, skillName string) string {
+// With inlineOutput the model is asked to reply with the graph instead of
+// writing pipeline.dot, for sessions that only have read-only tools.
+func buildPrompt(requirements, skillName string, inlineOutput bool) string {
 	var buf bytes.Buffer
 	data := struct {
 		Requirements string
 		SkillName    string
+		InlineOutput bool
 	}{
 		Requirements: requirements,
 		SkillName:    skillName,
+		InlineOutput: inlineOutput,
 	}
 	if err := ingestPrompt.Execute(&buf, data); err != nil {
 		// Embedded template execution should not fail; keep ingest usable with
@@ -115,7 +136,7 @@ func buildCLIArgs(opts Options) (string, []string, string, error) {
 	}
 
 	// The prompt is appended last as a positional argument.
-	args = append(args, buildPrompt(opts.Requirements, inferSkillName(opts.SkillPath)))
+	args = append(args, buildPrompt(opts.Requirements, inferSkillName(opts.SkillPath), false))
 
 	return exe, args, tmpDir, nil
 }
@@ -128,6 +149,9 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 	if _, err := os.Stat(opts.SkillPath); err != nil {
 		return nil, fmt.Errorf("skill file not found: %s: %w", opts.SkillPath, err)
 	}
+	if strings.TrimSpace(opts.Provider) != "" {
+		return runAPI(ctx, opts)
+	}
 
 	exe, args, tmpDir, err := buildCLIArgs(opts)
 	if err != nil {
@@ -135,44 +159,146 @@ func Run(ctx context.Context, opts Options) (*Result, error) {
 	}
 	defer os.RemoveAll(tmpDir)
 
+	if err := runClaude(ctx, exe, args, tmpDir); err != nil {
+		return nil, err
+	}
+	dotContent, err := readDraft(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{DotContent: dotContent, FirstDraft: dotContent}
+	if !opts.Validate {
+		return result, nil
+	}
+
+	// Repair rounds continue the same claude conversation; the model edits
+	// pipeline.dot in place.
+	base := append(args[:len(args)-1:len(args)-1], "--continue")
+	for {
+		diags, err := validateDraft(result.DotContent, opts.RepoPath)
+		result.Diagnostics = diags
+		if err == nil {
+			result.Warnings = diagnosticWarnings(diags)
+			return result, nil
+		}
+		if result.RepairRounds >= opts.RepairRounds {
+			return result, validationFailure(result.RepairRounds, err)
+		}
+		result.RepairRounds++
+		prompt := repairFeedback(diags, "Fix these problems by editing "+outputFilename+" in your working directory. Keep everything that is not broken.")
+		if err := runClaude(ctx, exe, append(base, prompt), tmpDir); err != nil {
+			return result, err
+		}
+		if result.DotContent, err = readDraft(tmpDir); err != nil {
+			return result, err
+		}
+	}
+}
+
+func runClaude(ctx context.Context, exe string, args []string, dir string) error {
 	cmd := exec.CommandContext(ctx, exe, args...)
-	cmd.Dir = tmpDir
+	cmd.Dir = dir
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-
-	if err = cmd.Run(); err != nil {
-		return nil, fmt.Errorf("claude exited with error: %v", err)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("claude exited with error: %v", err)
 	}
+	return nil
+}
 
-	// Read the .dot file Claude wrote.
-	dotPath := filepath.Join(tmpDir, outputFilename)
-	dotBytes, err := os.ReadFile(dotPath)
+// readDraft reads the .dot file claude wrote to dir.
+func readDraft(dir string) (string, error) {
+	dotBytes, err := os.ReadFile(filepath.Join(dir, outputFilename))
 	if err != nil {
-		return nil, fmt.Errorf("claude did not write %s: %w", outputFilename, err)
+		return "", fmt.Errorf("claude did not write %s: %w", outputFilename, err)
 	}
-
 	dotContent := strings.TrimSpace(string(dotBytes))
 	if dotContent == "" {
-		return nil, fmt.Errorf("%s is empty", outputFilename)
+		return "", fmt.Errorf("%s is empty", outputFilename)
 	}
+	return dotContent, nil
+}
+
+func validationFailure(rounds int, err error) error {
+	return fmt.Errorf("generated .dot failed validation after %d repair round(s): %w", rounds, err)
+}
 
-	result := &Result{
-		DotContent: dotContent,
+// runAPI runs ingestion through an agent session with read-only repo tools.
+// The graph is taken from the model's reply; when validation fails the errors
+// are sent back in the same session for up to opts.RepairRounds repairs.
+func runAPI(ctx context.Context, opts Options) (*Result, error) {
+	skill, err := os.ReadFile(opts.SkillPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading skill file: %w", err)
+	}
+	workDir := opts.RepoPath
+	if workDir == "" {
+		workDir = "."
+	}
+	if workDir, err = filepath.Abs(workDir); err != nil {
+		return nil, fmt.Errorf("resolving repo path: %w", err)
+	}
+	maxTurns := opts.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = 15
 	}
+	sess, err := engine.NewAgentSession(opts.Config, engine.AgentSessionOptions{
+		Provider:      opts.Provider,
+		Model:         opts.Model,
+		WorkDir:       workDir,
+		MaxToolRounds: maxTurns,
+		ReadOnly:      true,
+		SystemPrompt:  string(skill),
+		Client:        opts.Client,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
 
-	// Optionally validate.
-	if opts.Validate {
-		_, diags, err := engine.Prepare([]byte(dotContent))
+	input := buildPrompt(opts.Requirements, inferSkillName(opts.SkillPath), true)
+	var result *Result
+	for round := 0; ; round++ {
+		reply, err := sess.ProcessInput(ctx, input)
+		if err != nil {
+			return result, fmt.Errorf("%s session failed: %w", opts.Provider, err)
+		}
+		dot, err := ExtractDigraph(reply)
 		if err != nil {
-			return result, fmt.Errorf("generated .dot failed validation: %w", err)
+			if round >= opts.RepairRounds {
+				return result, fmt.Errorf("model reply has no usable digraph: %w", err)
+			}
+			input = "Your reply did not contain a complete digraph (" + err.Error() + "). Reply with the full .dot pipeline in a single ```dot fenced block."
+			continue
 		}
-		for _, d := range diags {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %s (%s)", d.Severity, d.Message, d.Rule))
+		if result == nil {
+			result = &Result{FirstDraft: dot}
 		}
+		result.DotContent = dot
+		result.RepairRounds = round
+		if !opts.Validate {
+			return result, nil
+		}
+		diags, err := validateDraft(dot, workDir)
+		result.Diagnostics = diags
+		if err == nil {
+			result.Warnings = diagnosticWarnings(diags)
+			return result, nil
+		}
+		if round >= opts.RepairRounds {
+			return result, validationFailure(round, err)
+		}
+		input = repairFeedback(diags, "Fix these problems and reply with the complete corrected .dot pipeline in a single ```dot fenced block.")
 	}
+}
 
-	return result, nil
+func diagnosticWarnings(diags []validate.Diagnostic) []string {
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s: %s (%s)", d.Severity, d.Message, d.Rule))
+	}
+	return out
 }
 
 func envOr(key, def string) string {
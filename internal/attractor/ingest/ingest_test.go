@@ -2,10 +2,15 @@ package ingest
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/danshapiro/kilroy/internal/llm"
 )
 
 func TestBuildCLIArgs(t *testing.T) {
@@ -165,6 +170,94 @@ func TestRunIngestRequiresSkill(t *testing.T) {
 	}
 }
 
+// scriptedAdapter returns canned responses in order and records requests.
+type scriptedAdapter struct {
+	mu       sync.Mutex
+	replies  []llm.Message
+	requests []llm.Request
+}
+
+func (a *scriptedAdapter) Name() string { return "openai" }
+
+func (a *scriptedAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, req)
+	msg := llm.Assistant("done")
+	if len(a.replies) > 0 {
+		msg, a.replies = a.replies[0], a.replies[1:]
+	}
+	return llm.Response{Provider: "openai", Model: req.Model, Message: msg}, nil
+}
+
+func (a *scriptedAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	return nil, errors.New("not implemented")
+}
+
+func lastUserText(req llm.Request) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == llm.RoleUser {
+			return req.Messages[i].Text()
+		}
+	}
+	return ""
+}
+
+func TestRunAPI_ReadOnlyToolsAndRepairLoop(t *testing.T) {
+	repo := t.TempDir()
+	skillPath := filepath.Join(t.TempDir(), "SKILL.md")
+	if err := os.WriteFile(skillPath, []byte("# Dotfile skill\nAlways add a goal.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeCall := llm.ToolCallData{ID: "c1", Name: "write_file", Type: "function",
+		Arguments: json.RawMessage(`{"file_path":"pipeline.dot","content":"x"}`)}
+	adapter := &scriptedAdapter{replies: []llm.Message{
+		{Role: llm.RoleAssistant, Content: []llm.ContentPart{{Kind: llm.ContentToolCall, ToolCall: &writeCall}}},
+		llm.Assistant("```dot\ndigraph G { a -> b }\n```"),
+		llm.Assistant("Fixed:\n```dot\ndigraph G {\n  graph [goal=\"demo\"]\n  start [shape=Mdiamond]\n  exit [shape=Msquare]\n  start -> exit\n}\n```"),
+	}}
+	client := llm.NewClient()
+	client.Register(adapter)
+
+	res, err := Run(context.Background(), Options{
+		Requirements: "demo",
+		SkillPath:    skillPath,
+		Model:        "gpt-5.2",
+		RepoPath:     repo,
+		Validate:     true,
+		RepairRounds: DefaultRepairRounds,
+		Provider:     "openai",
+		Client:       client,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(res.DotContent, `goal="demo"`) {
+		t.Fatalf("DotContent=%q", res.DotContent)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "pipeline.dot")); !os.IsNotExist(err) {
+		t.Fatalf("read-only session wrote pipeline.dot (stat err=%v)", err)
+	}
+	if len(adapter.requests) != 3 {
+		t.Fatalf("requests=%d want 3", len(adapter.requests))
+	}
+	first := adapter.requests[0]
+	if !strings.Contains(lastUserText(first), "reply with the final .dot pipeline") {
+		t.Fatalf("first prompt=%q", lastUserText(first))
+	}
+	repair := lastUserText(adapter.requests[2])
+	if !strings.Contains(repair, "failed validation") || !strings.Contains(repair, "- [start_node]") || !strings.Contains(repair, "edge a -> b:") {
+		t.Fatalf("repair prompt=%q", repair)
+	}
+	if res.RepairRounds != 1 || res.FirstDraft != "digraph G { a -> b }" {
+		t.Fatalf("RepairRounds=%d FirstDraft=%q", res.RepairRounds, res.FirstDraft)
+	}
+	report := res.Report()
+	if !report.Valid || !strings.Contains(report.Diff, "-digraph G { a -> b }") || !strings.Contains(report.Diff, "+  start -> exit") {
+		t.Fatalf("report=%+v", report)
+	}
+}
+
 func assertContains(t *testing.T, slice []string, want string) {
 	t.Helper()
 	for _, s := range slice {
@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// DefaultRepairRounds is how many times a draft that fails validation is sent
+// back to the model when the caller does not choose a limit.
+const DefaultRepairRounds = 2
+
+// validateDraft runs the checks `attractor validate` runs, including the
+// catalog-aware stylesheet rules. Failures that happen before validation
+// (parse errors, bad includes) are reported as a single "prepare" diagnostic
+// so the model and the report always see something actionable.
+func validateDraft(dot, repoPath string) ([]validate.Diagnostic, error) {
+	cat, catErr := modeldb.LoadEmbeddedCatalog()
+	if catErr != nil {
+		cat = nil
+	}
+	_, diags, err := engine.PrepareWithOptions([]byte(dot), engine.PrepareOptions{Catalog: cat, RepoPath: repoPath})
+	if err != nil && len(errorDiagnostics(diags)) == 0 {
+		diags = append(diags, validate.Diagnostic{Rule: "prepare", Severity: validate.SeverityError, Message: err.Error()})
+	}
+	return diags, err
+}
+
+func errorDiagnostics(diags []validate.Diagnostic) []validate.Diagnostic {
+	var out []validate.Diagnostic
+	for _, d := range diags {
+		if d.Severity == validate.SeverityError {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// repairFeedback lists the error diagnostics of a draft with their rule names
+// and node or edge IDs, followed by instructions on how to hand back the fix.
+func repairFeedback(diags []validate.Diagnostic, instructions string) string {
+	var b strings.Builder
+	b.WriteString("The pipeline you produced failed validation:\n\n")
+	for _, d := range errorDiagnostics(diags) {
+		fmt.Fprintf(&b, "- [%s]", d.Rule)
+		switch {
+		case d.NodeID != "":
+			fmt.Fprintf(&b, " node %s:", d.NodeID)
+		case d.EdgeFrom != "" || d.EdgeTo != "":
+			fmt.Fprintf(&b, " edge %s -> %s:", d.EdgeFrom, d.EdgeTo)
+		}
+		b.WriteString(" " + d.Message)
+		if d.Fix != "" {
+			b.WriteString(" (fix: " + d.Fix + ")")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n" + instructions)
+	return b.String()
+}
+
+// Report summarizes validation and repair of one ingestion. The CLI writes it
+// next to the --output file.
+type Report struct {
+	Valid        bool                  `json:"valid"`
+	RepairRounds int                   `json:"repair_rounds"`
+	Diagnostics  []validate.Diagnostic `json:"diagnostics"`
+	// Diff is a unified diff from the first draft to the final one; empty
+	// when no repair changed the graph.
+	Diff string `json:"diff,omitempty"`
+}
+
+// Report builds the sidecar report for r.
+func (r *Result) Report() Report {
+	diags := r.Diagnostics
+	if diags == nil {
+		diags = []validate.Diagnostic{}
+	}
+	return Report{
+		Valid:        len(errorDiagnostics(r.Diagnostics)) == 0,
+		RepairRounds: r.RepairRounds,
+		Diagnostics:  diags,
+		Diff:         unifiedDiff("first-draft.dot", "final.dot", r.FirstDraft, r.DotContent),
+	}
+}
+
+// ReportPath returns the sidecar report path for an output file:
+// pipeline.dot -> pipeline.ingest-report.json.
+func ReportPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".ingest-report.json"
+}
+
+// WriteReport writes r's report as indented JSON to path.
+func (r *Result) WriteReport(path string) error {
+	b, err := json.MarshalIndent(r.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -83,11 +83,30 @@ func (g *Graph) AllNodeIDs() []string {
 	return ids
 }
 
+// Position locates a declaration in DOT source. File is empty when the graph
+// was parsed from bytes without a known path.
+type Position struct {
+	File string
+	Line int
+}
+
+func (p Position) String() string {
+	switch {
+	case p.Line <= 0:
+		return p.File
+	case p.File == "":
+		return fmt.Sprintf("line %d", p.Line)
+	default:
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+}
+
 type Node struct {
 	ID      string
 	Attrs   map[string]string
 	Classes []string
-	Order   int // first-seen declaration order (stable)
+	Order   int      // first-seen declaration order (stable)
+	Pos     Position // first declaration
 }
 
 func NewNode(id string) *Node {
@@ -156,6 +175,7 @@ type Edge struct {
 	To    string
 	Attrs map[string]string
 	Order int // declaration order (stable)
+	Pos   Position
 }
 
 func NewEdge(from, to string) *Edge {
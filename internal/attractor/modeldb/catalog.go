@@ -55,13 +55,20 @@ func CatalogCoversProvider(c *Catalog, provider string) bool {
 // provider/model pair. It accepts either canonical model IDs
 // ("openai/gpt-5.2-codex") or provider-relative IDs ("gpt-5.2-codex").
 func CatalogHasProviderModel(c *Catalog, provider, modelID string) bool {
+	_, ok := FindProviderModel(c, provider, modelID)
+	return ok
+}
+
+// FindProviderModel returns the catalog entry for the given provider/model pair,
+// using the same matching rules as CatalogHasProviderModel.
+func FindProviderModel(c *Catalog, provider, modelID string) (ModelEntry, bool) {
 	if c == nil || c.Models == nil {
-		return false
+		return ModelEntry{}, false
 	}
 	provider = modelmeta.NormalizeProvider(provider)
 	modelID = strings.TrimSpace(modelID)
 	if provider == "" || modelID == "" {
-		return false
+		return ModelEntry{}, false
 	}
 	inCanonical := canonicalModelID(provider, modelID)
 	inRelative := providerRelativeModelID(provider, modelID)
@@ -74,10 +81,10 @@ func CatalogHasProviderModel(c *Catalog, provider, modelID string) bool {
 			continue
 		}
 		if strings.EqualFold(canonicalModelID(provider, id), inCanonical) {
-			return true
+			return entry, true
 		}
 		if strings.EqualFold(providerRelativeModelID(provider, id), inRelative) {
-			return true
+			return entry, true
 		}
 	}
 	// Anthropic OpenRouter catalog uses dots in version numbers (claude-sonnet-4.5)
@@ -95,11 +102,11 @@ func CatalogHasProviderModel(c *Catalog, provider, modelID string) bool {
 			}
 			normEntry := versionDotRe.ReplaceAllString(providerRelativeModelID(provider, id), "${1}-${2}")
 			if strings.EqualFold(normEntry, normQuery) {
-				return true
+				return entry, true
 			}
 		}
 	}
-	return false
+	return ModelEntry{}, false
 }
 
 // ModelLookupStatus describes the result of looking up a model ID in the catalog.
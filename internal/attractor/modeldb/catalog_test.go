@@ -40,6 +40,27 @@ func TestCatalogHasProviderModel_MatchesAnthropicDotsAndDashes(t *testing.T) {
 	}
 }
 
+func TestFindProviderModel_ReturnsPricing(t *testing.T) {
+	in := 0.000003
+	out := 0.000015
+	c := &Catalog{Models: map[string]ModelEntry{
+		"anthropic/claude-sonnet-4.5": {Provider: "anthropic", InputCostPerToken: &in, OutputCostPerToken: &out},
+	}}
+	entry, ok := FindProviderModel(c, "anthropic", "claude-sonnet-4-5")
+	if !ok {
+		t.Fatalf("expected dash-format model to resolve")
+	}
+	if entry.InputCostPerToken == nil || *entry.InputCostPerToken != in {
+		t.Fatalf("input cost: got %v want %v", entry.InputCostPerToken, in)
+	}
+	if entry.OutputCostPerToken == nil || *entry.OutputCostPerToken != out {
+		t.Fatalf("output cost: got %v want %v", entry.OutputCostPerToken, out)
+	}
+	if _, ok := FindProviderModel(c, "openai", "claude-sonnet-4-5"); ok {
+		t.Fatalf("expected provider mismatch to miss")
+	}
+}
+
 func TestCatalogCoversProvider_TrueForCoveredProvider(t *testing.T) {
 	c := &Catalog{CoveredProviders: map[string]bool{"openai": true, "anthropic": true}}
 	if !CatalogCoversProvider(c, "openai") {
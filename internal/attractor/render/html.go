@@ -0,0 +1,213 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+const htmlHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font: 14px sans-serif; margin: 24px; color: #111827; }
+h1 { font-size: 20px; margin: 0 0 4px; }
+.goal { color: #4b5563; margin: 0 0 12px; }
+.legend span { display: inline-block; margin-right: 14px; }
+.legend i { display: inline-block; width: 12px; height: 12px; margin-right: 4px; vertical-align: -1px; border: 1px solid; }
+.swatch-completed { background: #dcfce7; border-color: #16a34a; }
+.swatch-failed { background: #fee2e2; border-color: #dc2626; }
+.swatch-retried { background: #fef3c7; border-color: #d97706; }
+.swatch-current { background: #dbeafe; border-color: #2563eb; }
+.swatch-unvisited { background: #f9fafb; border-color: #d1d5db; }
+.graph { overflow: auto; margin: 16px 0; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 3px 12px 3px 0; border-bottom: 1px solid #e5e7eb; }
+#run-status { color: #4b5563; }
+</style>
+</head>
+<body>
+`
+
+// renderHTML wraps the SVG in a page with a legend and a per-node table.
+// With opts.EventsURL set, the page subscribes to that SSE stream and
+// recolors itself as events arrive.
+func renderHTML(g *model.Graph, opts Options) string {
+	o := opts.Overlay
+	title := strings.TrimSpace(g.Name)
+	if title == "" {
+		title = "pipeline"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, htmlHead, esc(title))
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", esc(title))
+	if goal := strings.TrimSpace(g.Attrs["goal"]); goal != "" {
+		fmt.Fprintf(&b, "<p class=\"goal\">%s</p>\n", esc(goal))
+	}
+	status := ""
+	switch {
+	case opts.EventsURL != "":
+		status = "live"
+	case o != nil && o.Finished:
+		status = "finished"
+	case o != nil:
+		status = "snapshot"
+	}
+	fmt.Fprintf(&b, "<p id=\"run-status\">%s</p>\n", esc(status))
+	b.WriteString(`<div class="legend">`)
+	for _, s := range []NodeState{NodeCompleted, NodeFailed, NodeRetried, NodeCurrent, NodeUnvisited} {
+		fmt.Fprintf(&b, `<span><i class="swatch-%s"></i>%s</span>`, s, s)
+	}
+	b.WriteString("</div>\n<div class=\"graph\">\n")
+	b.WriteString(renderSVG(g, o))
+	b.WriteString("</div>\n<table>\n<thead><tr><th>Node</th><th>State</th><th>Attempts</th><th>Duration</th></tr></thead>\n<tbody>\n")
+
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		attempts, duration := "0", ""
+		if r := o.run(id); r != nil {
+			attempts = strconv.Itoa(r.Attempts)
+			if r.DurationMS > 0 {
+				duration = FormatDuration(r.DurationMS)
+			}
+		}
+		fmt.Fprintf(&b, `<tr data-node-row="%s"><td>%s</td><td class="state">%s</td><td class="attempts">%s</td><td class="duration">%s</td></tr>`+"\n",
+			esc(id), esc(id), o.NodeState(id), attempts, duration)
+	}
+	b.WriteString("</tbody>\n</table>\n")
+
+	if opts.EventsURL != "" {
+		var parallel []string
+		reg := engine.NewDefaultRegistry()
+		for _, id := range ids {
+			switch reg.Resolve(g.Nodes[id]).(type) {
+			case *engine.ParallelHandler, *engine.MapHandler:
+				parallel = append(parallel, id)
+			}
+		}
+		cfg, _ := json.Marshal(map[string]any{"events": opts.EventsURL, "parallel": parallel})
+		// JSON inside a script element must not be able to close it.
+		fmt.Fprintf(&b, "<script>\nconst KILROY_GRAPH = %s;\n%s</script>\n",
+			strings.ReplaceAll(string(cfg), "</", `<\/`), liveScript)
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+func (o *Overlay) run(id string) *NodeRun {
+	if o == nil {
+		return nil
+	}
+	return o.Nodes[id]
+}
+
+// liveScript mirrors Overlay.Apply, NodeRun.State, Overlay.Traversals and
+// FormatDuration. The SSE stream replays the whole history on every
+// (re)connect, so the state is rebuilt from the first event after each open.
+const liveScript = `(function () {
+  let nodes = {}, edges = {}, fanOut = {}, finished = false, fresh = true;
+  const parallel = new Set(KILROY_GRAPH.parallel || []);
+  const node = (id) => nodes[id] || (nodes[id] = {attempts: 0, status: "", durationMS: 0, retried: false, running: false, started: 0});
+  const edgeKey = (from, to, label, cond) => JSON.stringify([from, to, label || "", cond || ""]);
+  const str = (ev, k) => (typeof ev[k] === "string" ? ev[k].trim() : "");
+
+  function apply(ev) {
+    const ts = Date.parse(str(ev, "ts")) || 0;
+    switch (str(ev, "event")) {
+    case "stage_attempt_start": {
+      const n = node(str(ev, "node_id"));
+      n.attempts++; n.running = true; n.started = ts;
+      if (ev.attempt > 1) n.retried = true;
+      break;
+    }
+    case "stage_attempt_end": {
+      const n = node(str(ev, "node_id"));
+      n.status = str(ev, "status");
+      if (n.running && n.started && ts) n.durationMS += ts - n.started;
+      n.running = false;
+      break;
+    }
+    case "edge_selected": {
+      const k = edgeKey(str(ev, "from_node"), str(ev, "to_node"), str(ev, "label"), str(ev, "condition"));
+      edges[k] = (edges[k] || 0) + 1;
+      break;
+    }
+    case "implicit_fan_out":
+      fanOut[str(ev, "source_node")] = true;
+      break;
+    }
+  }
+
+  function state(n) {
+    if (!n) return "unvisited";
+    if (n.running && !finished) return "current";
+    if (n.status === "fail") return "failed";
+    if (n.retried) return "retried";
+    if (n.status || n.attempts > 0) return "completed";
+    return "unvisited";
+  }
+
+  function formatDuration(ms) {
+    if (ms < 1000) return ms + "ms";
+    if (ms < 60000) return (ms / 1000).toFixed(1) + "s";
+    if (ms < 3600000) { const s = Math.floor(ms / 1000); return Math.floor(s / 60) + "m" + String(s % 60).padStart(2, "0") + "s"; }
+    const m = Math.floor(ms / 60000);
+    return Math.floor(m / 60) + "h" + String(m % 60).padStart(2, "0") + "m";
+  }
+
+  function paint() {
+    document.querySelectorAll("g.node[data-node]").forEach((g) => {
+      const id = g.dataset.node, n = nodes[id], st = state(n);
+      g.setAttribute("class", "node state-" + st);
+      let meta = "";
+      if (n && n.attempts > 0) {
+        meta = n.attempts + (n.attempts === 1 ? " attempt" : " attempts");
+        if (n.durationMS > 0) meta += " · " + formatDuration(n.durationMS);
+      }
+      const m = g.querySelector("text.meta");
+      if (m) m.textContent = meta;
+    });
+    document.querySelectorAll("g.edge[data-from]").forEach((g) => {
+      const d = g.dataset;
+      let taken = (edges[edgeKey(d.from, d.to, d.label, d.condition)] || 0) > 0;
+      if (!taken && nodes[d.from] && nodes[d.to] && (parallel.has(d.from) || fanOut[d.from])) taken = true;
+      g.classList.toggle("taken", taken);
+    });
+    document.querySelectorAll("tr[data-node-row]").forEach((tr) => {
+      const n = nodes[tr.dataset.nodeRow];
+      tr.querySelector(".state").textContent = state(n);
+      tr.querySelector(".attempts").textContent = n ? n.attempts : 0;
+      tr.querySelector(".duration").textContent = n && n.durationMS > 0 ? formatDuration(n.durationMS) : "";
+    });
+  }
+
+  const status = document.getElementById("run-status");
+  const es = new EventSource(KILROY_GRAPH.events);
+  es.onopen = () => { fresh = true; status.textContent = "live"; };
+  es.onmessage = (msg) => {
+    let ev;
+    try { ev = JSON.parse(msg.data); } catch (e) { return; }
+    if (fresh) { nodes = {}; edges = {}; fanOut = {}; fresh = false; }
+    apply(ev);
+    paint();
+  };
+  es.addEventListener("done", () => {
+    finished = true;
+    es.close();
+    status.textContent = "finished";
+    paint();
+  });
+  es.onerror = () => { if (!finished) status.textContent = "reconnecting"; };
+})();
+`
@@ -0,0 +1,308 @@
+package render
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+const (
+	layerGap   = 70.0
+	nodeGap    = 40.0
+	margin     = 30.0
+	nodeHeight = 44.0
+	// backEdgeOffset is how far loop edges bow out to the right.
+	backEdgeOffset = 50.0
+	// maxLabelRunes truncates long node labels so one verbose node does not
+	// stretch its whole layer.
+	maxLabelRunes = 40
+)
+
+type point struct{ X, Y float64 }
+
+// bezier is a cubic Bézier: start, two control points, end.
+type bezier [4]point
+
+// placedNode is a node's box, centered on X, Y.
+type placedNode struct {
+	Node  *model.Node
+	Label string
+	X, Y  float64
+	W, H  float64
+}
+
+type placedEdge struct {
+	Edge  *model.Edge
+	Path  bezier
+	Back  bool
+	Label string
+}
+
+type layout struct {
+	Nodes         []*placedNode // layer by layer, left to right
+	Edges         []*placedEdge
+	Width, Height float64
+}
+
+// computeLayout places nodes in layers from the start node downward. Back
+// edges (found by DFS) are ignored for layering and drawn bowing out to the
+// right. Within a layer, a few barycenter sweeps reduce crossings. The
+// result depends only on the graph, so repeated renders are identical.
+func computeLayout(g *model.Graph) *layout {
+	ids := make([]string, 0, len(g.Nodes))
+	for id, n := range g.Nodes {
+		if n != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	back, discovery := findBackEdges(g, ids)
+
+	// Longest-path layering over the forward edges.
+	indeg := map[string]int{}
+	forward := map[string][]string{}
+	for _, e := range g.Edges {
+		if e == nil || back[e] || e.From == e.To || g.Nodes[e.From] == nil || g.Nodes[e.To] == nil {
+			continue
+		}
+		forward[e.From] = append(forward[e.From], e.To)
+		indeg[e.To]++
+	}
+	rank := map[string]int{}
+	var queue []string
+	for _, id := range discovery {
+		if indeg[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, to := range forward[id] {
+			rank[to] = max(rank[to], rank[id]+1)
+			if indeg[to]--; indeg[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	var layers [][]string
+	for _, id := range discovery {
+		r := rank[id]
+		for len(layers) <= r {
+			layers = append(layers, nil)
+		}
+		layers[r] = append(layers[r], id)
+	}
+	orderLayers(g, layers, back)
+
+	l := &layout{}
+	placed := map[string]*placedNode{}
+	y := margin
+	var rows [][]*placedNode
+	for _, layer := range layers {
+		var row []*placedNode
+		rowH := 0.0
+		for _, id := range layer {
+			n := g.Nodes[id]
+			p := &placedNode{Node: n, Label: nodeLabel(n)}
+			p.W = max(90, 7.5*float64(len([]rune(p.Label)))+30)
+			p.H = nodeHeight
+			switch n.Shape() {
+			case "diamond", "Mdiamond":
+				p.W += 30
+				p.H += 16
+			}
+			rowH = max(rowH, p.H)
+			row = append(row, p)
+			placed[id] = p
+		}
+		for _, p := range row {
+			p.Y = y + rowH/2
+		}
+		y += rowH + layerGap
+		rows = append(rows, row)
+	}
+	width := 0.0
+	for _, row := range rows {
+		w := -nodeGap
+		for _, p := range row {
+			w += p.W + nodeGap
+		}
+		width = max(width, w)
+	}
+	for _, row := range rows {
+		w := -nodeGap
+		for _, p := range row {
+			w += p.W + nodeGap
+		}
+		x := margin + (width-w)/2
+		for _, p := range row {
+			p.X = x + p.W/2
+			x += p.W + nodeGap
+			l.Nodes = append(l.Nodes, p)
+		}
+	}
+	l.Width = width + 2*margin + backEdgeOffset
+	l.Height = y - layerGap + margin
+
+	for _, e := range g.Edges {
+		if e == nil || placed[e.From] == nil || placed[e.To] == nil {
+			continue
+		}
+		from, to := placed[e.From], placed[e.To]
+		pe := &placedEdge{Edge: e, Label: edgeLabel(e)}
+		switch {
+		case e.From == e.To:
+			s := point{from.X + from.W/2, from.Y - from.H/4}
+			t := point{from.X + from.W/2, from.Y + from.H/4}
+			pe.Path = bezier{s, {s.X + backEdgeOffset, s.Y - 20}, {t.X + backEdgeOffset, t.Y + 20}, t}
+			pe.Back = true
+		case back[e] || to.Y <= from.Y:
+			s := point{from.X + from.W/2, from.Y}
+			t := point{to.X + to.W/2, to.Y}
+			bow := max(s.X, t.X) + backEdgeOffset
+			pe.Path = bezier{s, {bow, s.Y}, {bow, t.Y}, t}
+			pe.Back = true
+		default:
+			s := point{from.X, from.Y + from.H/2}
+			t := point{to.X, to.Y - to.H/2}
+			mid := (t.Y - s.Y) / 2
+			pe.Path = bezier{s, {s.X, s.Y + mid}, {t.X, t.Y - mid}, t}
+		}
+		l.Edges = append(l.Edges, pe)
+	}
+	return l
+}
+
+// findBackEdges runs a DFS from the start node (then any unvisited node, in
+// ID order) and returns the edges that close a cycle, plus the order in which
+// nodes were discovered.
+func findBackEdges(g *model.Graph, ids []string) (map[*model.Edge]bool, []string) {
+	back := map[*model.Edge]bool{}
+	visited := map[string]bool{}
+	onStack := map[string]bool{}
+	var discovery []string
+	var dfs func(id string)
+	dfs = func(id string) {
+		visited[id] = true
+		onStack[id] = true
+		discovery = append(discovery, id)
+		for _, e := range g.Outgoing(id) {
+			if e == nil || g.Nodes[e.To] == nil {
+				continue
+			}
+			switch {
+			case onStack[e.To]:
+				back[e] = true
+			case !visited[e.To]:
+				dfs(e.To)
+			}
+		}
+		onStack[id] = false
+	}
+	if start := startNodeID(g, ids); start != "" {
+		dfs(start)
+	}
+	for _, id := range ids {
+		if !visited[id] {
+			dfs(id)
+		}
+	}
+	return back, discovery
+}
+
+func startNodeID(g *model.Graph, ids []string) string {
+	for _, id := range ids {
+		if g.Nodes[id].Shape() == "Mdiamond" {
+			return id
+		}
+	}
+	if g.Nodes["start"] != nil {
+		return "start"
+	}
+	return ""
+}
+
+// orderLayers reorders each layer by the mean position of its neighbors in
+// the adjacent layers, sweeping down and then up a few times.
+func orderLayers(g *model.Graph, layers [][]string, back map[*model.Edge]bool) {
+	preds := map[string][]string{}
+	succs := map[string][]string{}
+	for _, e := range g.Edges {
+		if e == nil || back[e] || e.From == e.To || g.Nodes[e.From] == nil || g.Nodes[e.To] == nil {
+			continue
+		}
+		preds[e.To] = append(preds[e.To], e.From)
+		succs[e.From] = append(succs[e.From], e.To)
+	}
+	pos := map[string]float64{}
+	for _, layer := range layers {
+		for i, id := range layer {
+			pos[id] = float64(i)
+		}
+	}
+	sweep := func(layer []string, neighbors map[string][]string) {
+		key := map[string]float64{}
+		for _, id := range layer {
+			key[id] = pos[id]
+			if ns := neighbors[id]; len(ns) > 0 {
+				sum := 0.0
+				for _, n := range ns {
+					sum += pos[n]
+				}
+				key[id] = sum / float64(len(ns))
+			}
+		}
+		sort.SliceStable(layer, func(i, j int) bool { return key[layer[i]] < key[layer[j]] })
+		for i, id := range layer {
+			pos[id] = float64(i)
+		}
+	}
+	for range 4 {
+		for r := 1; r < len(layers); r++ {
+			sweep(layers[r], preds)
+		}
+		for r := len(layers) - 2; r >= 0; r-- {
+			sweep(layers[r], succs)
+		}
+	}
+}
+
+func nodeLabel(n *model.Node) string {
+	label := strings.TrimSpace(n.Label())
+	if label == "" {
+		label = n.ID
+	}
+	if i := strings.IndexAny(label, "\r\n"); i >= 0 {
+		label = strings.TrimSpace(label[:i])
+	}
+	label = strings.ReplaceAll(label, `\n`, " ")
+	if r := []rune(label); len(r) > maxLabelRunes {
+		label = string(r[:maxLabelRunes-1]) + "…"
+	}
+	return label
+}
+
+// edgeLabel prefers the edge's label and falls back to its condition.
+func edgeLabel(e *model.Edge) string {
+	if l := strings.TrimSpace(e.Label()); l != "" {
+		return l
+	}
+	return strings.TrimSpace(e.Condition())
+}
+
+// at evaluates the curve at t in [0, 1].
+func (p bezier) at(t float64) point {
+	u := 1 - t
+	a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+	return point{
+		X: a*p[0].X + b*p[1].X + c*p[2].X + d*p[3].X,
+		Y: a*p[0].Y + b*p[1].Y + c*p[2].Y + d*p[3].Y,
+	}
+}
+
+func round1(v float64) float64 { return math.Round(v*10) / 10 }
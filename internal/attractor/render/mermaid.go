@@ -0,0 +1,112 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+var mermaidIDRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// mermaidReserved are node IDs Mermaid would parse as keywords.
+var mermaidReserved = map[string]bool{
+	"end": true, "graph": true, "flowchart": true, "subgraph": true,
+	"style": true, "class": true, "classDef": true, "click": true, "linkStyle": true,
+}
+
+// renderMermaid emits a flowchart. With an overlay, node states become
+// classes and taken edges are drawn thick.
+func renderMermaid(g *model.Graph, o *Overlay) string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	safe := map[string]string{}
+	for i, id := range ids {
+		if mermaidIDRE.MatchString(id) && !mermaidReserved[id] {
+			safe[id] = id
+		} else {
+			safe[id] = fmt.Sprintf("n%d", i)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for _, id := range ids {
+		label := mermaidText(nodeLabel(g.Nodes[id]))
+		if meta := nodeMeta(o, id); meta != "" {
+			label += "<br/><small>" + mermaidText(meta) + "</small>"
+		}
+		left, right := mermaidShape(g.Nodes[id].Shape())
+		fmt.Fprintf(&b, "    %s%s\"%s\"%s\n", safe[id], left, label, right)
+	}
+	var taken []int
+	n := 0
+	for _, e := range g.Edges {
+		if e == nil || g.Nodes[e.From] == nil || g.Nodes[e.To] == nil {
+			continue
+		}
+		if l := edgeLabel(e); l != "" {
+			fmt.Fprintf(&b, "    %s -->|\"%s\"| %s\n", safe[e.From], mermaidText(l), safe[e.To])
+		} else {
+			fmt.Fprintf(&b, "    %s --> %s\n", safe[e.From], safe[e.To])
+		}
+		if o.Traversals(g, e) > 0 {
+			taken = append(taken, n)
+		}
+		n++
+	}
+	if o == nil {
+		return b.String()
+	}
+
+	b.WriteString("    classDef completed fill:#dcfce7,stroke:#16a34a\n")
+	b.WriteString("    classDef failed fill:#fee2e2,stroke:#dc2626\n")
+	b.WriteString("    classDef retried fill:#fef3c7,stroke:#d97706\n")
+	b.WriteString("    classDef current fill:#dbeafe,stroke:#2563eb,stroke-width:3px\n")
+	b.WriteString("    classDef unvisited fill:#f9fafb,stroke:#d1d5db,stroke-dasharray:4 3,color:#9ca3af\n")
+	byState := map[NodeState][]string{}
+	for _, id := range ids {
+		st := o.NodeState(id)
+		byState[st] = append(byState[st], safe[id])
+	}
+	for _, st := range []NodeState{NodeCompleted, NodeFailed, NodeRetried, NodeCurrent, NodeUnvisited} {
+		if len(byState[st]) > 0 {
+			fmt.Fprintf(&b, "    class %s %s\n", strings.Join(byState[st], ","), st)
+		}
+	}
+	if len(taken) > 0 {
+		idx := make([]string, len(taken))
+		for i, t := range taken {
+			idx[i] = fmt.Sprint(t)
+		}
+		fmt.Fprintf(&b, "    linkStyle %s stroke:#111827,stroke-width:3px\n", strings.Join(idx, ","))
+	}
+	return b.String()
+}
+
+func mermaidShape(shape string) (string, string) {
+	switch shape {
+	case "diamond":
+		return "{", "}"
+	case "Mdiamond":
+		return "([", "])"
+	case "Msquare":
+		return "[[", "]]"
+	case "hexagon":
+		return "{{", "}}"
+	case "parallelogram":
+		return "[/", "/]"
+	case "component", "tripleoctagon":
+		return "[[", "]]"
+	}
+	return "[", "]"
+}
+
+func mermaidText(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
@@ -0,0 +1,225 @@
+package render
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// NodeState is how a node is drawn in a run overlay.
+type NodeState string
+
+const (
+	NodeCompleted NodeState = "completed"
+	NodeFailed    NodeState = "failed"
+	NodeRetried   NodeState = "retried"
+	NodeCurrent   NodeState = "current"
+	NodeUnvisited NodeState = "unvisited"
+)
+
+// NodeRun summarizes one node's executions in a run.
+type NodeRun struct {
+	// Attempts counts every attempt across all visits.
+	Attempts int `json:"attempts"`
+	// Status is the outcome of the latest finished attempt.
+	Status     string `json:"status,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+
+	retried bool
+	running bool
+	started time.Time
+}
+
+// State classifies the node: a running attempt wins, then the last outcome,
+// then whether any attempt was a retry.
+func (n *NodeRun) State(finished bool) NodeState {
+	switch {
+	case n == nil:
+		return NodeUnvisited
+	case n.running && !finished:
+		return NodeCurrent
+	case n.Status == string(runtime.StatusFail):
+		return NodeFailed
+	case n.retried:
+		return NodeRetried
+	case n.Status != "" || n.Attempts > 0:
+		return NodeCompleted
+	}
+	return NodeUnvisited
+}
+
+// EdgeKey identifies an edge the way edge_selected events do.
+type EdgeKey struct {
+	From, To, Label, Condition string
+}
+
+func edgeKeyOf(e *model.Edge) EdgeKey {
+	return EdgeKey{From: e.From, To: e.To, Label: e.Label(), Condition: e.Condition()}
+}
+
+// Overlay is a run's progress projected onto its graph.
+type Overlay struct {
+	Nodes map[string]*NodeRun
+	Edges map[EdgeKey]int
+	// Finished is set once final.json exists; no node is current after that.
+	Finished bool
+
+	fanOut map[string]bool
+}
+
+// NewOverlay returns an empty overlay.
+func NewOverlay() *Overlay {
+	return &Overlay{Nodes: map[string]*NodeRun{}, Edges: map[EdgeKey]int{}, fanOut: map[string]bool{}}
+}
+
+func (o *Overlay) node(id string) *NodeRun {
+	n := o.Nodes[id]
+	if n == nil {
+		n = &NodeRun{}
+		o.Nodes[id] = n
+	}
+	return n
+}
+
+// Apply folds one progress event into the overlay. The HTML live view runs
+// the same logic in the browser, so changes here belong there too.
+func (o *Overlay) Apply(ev map[string]any) {
+	ts, _ := time.Parse(time.RFC3339Nano, eventString(ev, "ts"))
+	switch eventString(ev, "event") {
+	case "stage_attempt_start":
+		n := o.node(eventString(ev, "node_id"))
+		n.Attempts++
+		n.running = true
+		n.started = ts
+		if a, _ := ev["attempt"].(float64); a > 1 {
+			n.retried = true
+		}
+	case "stage_attempt_end":
+		n := o.node(eventString(ev, "node_id"))
+		n.Status = eventString(ev, "status")
+		if n.running && !n.started.IsZero() && !ts.IsZero() {
+			n.DurationMS += ts.Sub(n.started).Milliseconds()
+		}
+		n.running = false
+	case "edge_selected":
+		o.Edges[EdgeKey{
+			From:      eventString(ev, "from_node"),
+			To:        eventString(ev, "to_node"),
+			Label:     eventString(ev, "label"),
+			Condition: eventString(ev, "condition"),
+		}]++
+	case "implicit_fan_out":
+		o.fanOut[eventString(ev, "source_node")] = true
+	}
+}
+
+// NodeState returns the state id is drawn with.
+func (o *Overlay) NodeState(id string) NodeState {
+	if o == nil {
+		return NodeUnvisited
+	}
+	return o.Nodes[id].State(o.Finished)
+}
+
+// Traversals counts how often e was taken. Branch edges out of a parallel
+// node or an implicit fan-out are not reported by edge_selected, so they count
+// once when both ends ran.
+func (o *Overlay) Traversals(g *model.Graph, e *model.Edge) int {
+	if o == nil {
+		return 0
+	}
+	if n := o.Edges[edgeKeyOf(e)]; n > 0 {
+		return n
+	}
+	if o.Nodes[e.From] == nil || o.Nodes[e.To] == nil {
+		return 0
+	}
+	_, parallel := engine.NewDefaultRegistry().Resolve(g.Nodes[e.From]).(*engine.ParallelHandler)
+	if parallel || o.fanOut[e.From] {
+		return 1
+	}
+	return 0
+}
+
+// OverlayFromEvents builds an overlay from progress events in order.
+func OverlayFromEvents(events []map[string]any) *Overlay {
+	o := NewOverlay()
+	for _, ev := range events {
+		o.Apply(ev)
+	}
+	return o
+}
+
+// LoadOverlay reads a run's logs root: every progress.ndjson under it
+// (restarts and parallel branches included) merged by timestamp, plus
+// checkpoint.json for nodes whose events are missing and final.json to tell
+// whether the run is over.
+func LoadOverlay(logsRoot string) (*Overlay, error) {
+	var events []map[string]any
+	err := filepath.WalkDir(logsRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "worktree" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != "progress.ndjson" {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for sc.Scan() {
+			var ev map[string]any
+			if json.Unmarshal(sc.Bytes(), &ev) == nil {
+				events = append(events, ev)
+			}
+		}
+		return sc.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventString(events[i], "ts") < eventString(events[j], "ts")
+	})
+	o := OverlayFromEvents(events)
+
+	if cp, err := runtime.LoadCheckpoint(filepath.Join(logsRoot, "checkpoint.json")); err == nil {
+		for _, id := range cp.CompletedNodes {
+			if n := o.node(id); n.Status == "" {
+				n.Status = string(runtime.StatusSuccess)
+			}
+		}
+		for id, retries := range cp.NodeRetries {
+			if retries > 0 {
+				o.node(id).retried = true
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(logsRoot, "final.json")); err == nil {
+		o.Finished = true
+	}
+	return o, nil
+}
+
+func eventString(ev map[string]any, key string) string {
+	s, _ := ev[key].(string)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,35 @@
+// Package render draws a pipeline graph as SVG, HTML or Mermaid, optionally
+// colored by a run's progress.
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// Formats lists the output formats Render accepts.
+var Formats = []string{"svg", "html", "mermaid"}
+
+// Options controls a render.
+type Options struct {
+	// Overlay colors nodes and edges by run progress; nil draws the bare graph.
+	Overlay *Overlay
+	// EventsURL, for HTML only, is an SSE endpoint the page follows to keep
+	// itself current.
+	EventsURL string
+}
+
+// Render lays out g and draws it in format.
+func Render(g *model.Graph, format string, opts Options) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "svg":
+		return renderSVG(g, opts.Overlay), nil
+	case "html":
+		return renderHTML(g, opts), nil
+	case "mermaid", "mmd":
+		return renderMermaid(g, opts.Overlay), nil
+	}
+	return "", fmt.Errorf("unknown render format %q (want %s)", format, strings.Join(Formats, ", "))
+}
@@ -0,0 +1,225 @@
+package render
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/dot"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+const testGraph = `digraph demo {
+	graph [goal="Ship it"]
+	start [shape=Mdiamond]
+	impl [shape=box, label="Implement \"it\""]
+	check [shape=diamond]
+	docs [shape=box]
+	exit [shape=Msquare]
+	start -> impl -> check
+	check -> exit [condition="outcome=success"]
+	check -> impl [condition="outcome=fail", label="retry"]
+	start -> docs
+	docs -> exit
+}`
+
+func mustParse(t *testing.T, src string) *model.Graph {
+	t.Helper()
+	g, err := dot.Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return g
+}
+
+func testEvents() []map[string]any {
+	return []map[string]any{
+		{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:00Z", "node_id": "start", "attempt": 1.0},
+		{"event": "stage_attempt_end", "ts": "2026-01-01T00:00:00.5Z", "node_id": "start", "status": "success"},
+		{"event": "edge_selected", "ts": "2026-01-01T00:00:01Z", "from_node": "start", "to_node": "impl"},
+		{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:01Z", "node_id": "impl", "attempt": 1.0},
+		{"event": "stage_attempt_end", "ts": "2026-01-01T00:00:03Z", "node_id": "impl", "status": "fail"},
+		{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:04Z", "node_id": "impl", "attempt": 2.0},
+		{"event": "stage_attempt_end", "ts": "2026-01-01T00:00:09Z", "node_id": "impl", "status": "success"},
+		{"event": "edge_selected", "ts": "2026-01-01T00:00:09Z", "from_node": "impl", "to_node": "check"},
+		{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:10Z", "node_id": "check", "attempt": 1.0},
+	}
+}
+
+func TestOverlay_StatesAttemptsAndDurations(t *testing.T) {
+	o := OverlayFromEvents(testEvents())
+	for id, want := range map[string]NodeState{
+		"start": NodeCompleted,
+		"impl":  NodeRetried,
+		"check": NodeCurrent,
+		"docs":  NodeUnvisited,
+	} {
+		if got := o.NodeState(id); got != want {
+			t.Fatalf("%s state=%s want %s", id, got, want)
+		}
+	}
+	if r := o.Nodes["impl"]; r.Attempts != 2 || r.DurationMS != 7000 {
+		t.Fatalf("impl run=%+v", r)
+	}
+	if r := o.Nodes["start"]; r.DurationMS != 500 {
+		t.Fatalf("start run=%+v", r)
+	}
+
+	o.Apply(map[string]any{"event": "stage_attempt_end", "ts": "2026-01-01T00:00:11Z", "node_id": "check", "status": "fail"})
+	if got := o.NodeState("check"); got != NodeFailed {
+		t.Fatalf("check state=%s", got)
+	}
+
+	o = OverlayFromEvents(testEvents())
+	o.Finished = true
+	if got := o.NodeState("check"); got == NodeCurrent {
+		t.Fatal("a finished run has no current node")
+	}
+}
+
+func TestLoadOverlay_MergesProgressAndCheckpoint(t *testing.T) {
+	root := t.TempDir()
+	var lines []string
+	for _, ev := range testEvents()[:5] {
+		b, _ := json.Marshal(ev)
+		lines = append(lines, string(b))
+	}
+	if err := os.WriteFile(filepath.Join(root, "progress.ndjson"), []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp := `{"current_node":"docs","completed_nodes":["start","docs"],"node_retries":{"impl":1}}`
+	if err := os.WriteFile(filepath.Join(root, "checkpoint.json"), []byte(cp), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o, err := LoadOverlay(root)
+	if err != nil {
+		t.Fatalf("LoadOverlay: %v", err)
+	}
+	if o.Finished {
+		t.Fatal("no final.json, run should not be finished")
+	}
+	if got := o.NodeState("docs"); got != NodeCompleted {
+		t.Fatalf("docs state=%s", got)
+	}
+	if got := o.NodeState("impl"); got != NodeFailed {
+		t.Fatalf("impl state=%s", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "final.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if o, err = LoadOverlay(root); err != nil || !o.Finished {
+		t.Fatalf("finished=%v err=%v", o != nil && o.Finished, err)
+	}
+}
+
+func TestLoadOverlay_EmptyLogsRoot(t *testing.T) {
+	o, err := LoadOverlay(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadOverlay: %v", err)
+	}
+	if len(o.Nodes) != 0 || o.Finished {
+		t.Fatalf("overlay=%+v", o)
+	}
+}
+
+func TestRender_SVG(t *testing.T) {
+	g := mustParse(t, testGraph)
+	out, err := Render(g, "svg", Options{Overlay: OverlayFromEvents(testEvents())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg"`,
+		`<g class="node state-retried" data-node="impl">`,
+		`<g class="node state-current" data-node="check">`,
+		`<g class="node state-unvisited" data-node="docs">`,
+		`Implement &#34;it&#34;`,
+		`2 attempts · 7.0s`,
+		`<g class="edge taken" data-from="start" data-to="impl"`,
+		`<g class="edge back" data-from="check" data-to="impl" data-label="retry" data-condition="outcome=fail">`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	again, _ := Render(g, "svg", Options{Overlay: OverlayFromEvents(testEvents())})
+	if again != out {
+		t.Fatal("render is not deterministic")
+	}
+}
+
+func TestRender_HTML(t *testing.T) {
+	g := mustParse(t, testGraph)
+	out, err := Render(g, "html", Options{Overlay: OverlayFromEvents(testEvents())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<title>demo</title>", "Ship it", `<tr data-node-row="impl"><td>impl</td><td class="state">retried</td><td class="attempts">2</td><td class="duration">7.0s</td></tr>`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "EventSource") {
+		t.Fatal("static page should not subscribe to events")
+	}
+
+	live, _ := Render(g, "html", Options{EventsURL: "events"})
+	if !strings.Contains(live, `const KILROY_GRAPH = {"events":"events"`) || !strings.Contains(live, "new EventSource(KILROY_GRAPH.events)") {
+		t.Fatalf("live page missing event subscription:\n%s", live)
+	}
+}
+
+func TestRender_Mermaid(t *testing.T) {
+	g := mustParse(t, `digraph demo {
+		start [shape=Mdiamond]
+		end [shape=Msquare]
+		check [shape=diamond, label="Check \"done\""]
+		start -> check
+		check -> end [condition="outcome=success"]
+		check -> start [label="again"]
+	}`)
+	out, err := Render(g, "mermaid", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `flowchart TD
+    check{"Check #quot;done#quot;"}
+    n1[["end"]]
+    start(["start"])
+    start --> check
+    check -->|"outcome=success"| n1
+    check -->|"again"| start
+`
+	if out != want {
+		t.Fatalf("mermaid:\n%s\nwant:\n%s", out, want)
+	}
+
+	o := OverlayFromEvents([]map[string]any{
+		{"event": "stage_attempt_start", "node_id": "start", "attempt": 1.0},
+		{"event": "stage_attempt_end", "node_id": "start", "status": "success"},
+		{"event": "edge_selected", "from_node": "start", "to_node": "check"},
+	})
+	out, _ = Render(g, "mermaid", Options{Overlay: o})
+	for _, want := range []string{"class start completed", "class check,n1 unvisited", "linkStyle 0 stroke"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRender_UnknownFormat(t *testing.T) {
+	if _, err := Render(mustParse(t, testGraph), "png", Options{}); err == nil || !strings.Contains(err.Error(), "svg, html, mermaid") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for ms, want := range map[int64]string{850: "850ms", 12_340: "12.3s", 245_000: "4m05s", 3_720_000: "1h02m"} {
+		if got := FormatDuration(ms); got != want {
+			t.Fatalf("FormatDuration(%d)=%q want %q", ms, got, want)
+		}
+	}
+}
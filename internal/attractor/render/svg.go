@@ -0,0 +1,155 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+)
+
+// svgStyle colors nodes and edges by state. The HTML live view swaps the
+// state-* classes in place, so the palette lives in one spot.
+const svgStyle = `
+.node rect, .node polygon, .node ellipse { fill: #ffffff; stroke: #6b7280; stroke-width: 1.5; }
+.node text { font: 13px sans-serif; fill: #111827; text-anchor: middle; dominant-baseline: middle; }
+.node text.meta { font-size: 10px; fill: #4b5563; }
+.node.state-completed rect, .node.state-completed polygon, .node.state-completed ellipse { fill: #dcfce7; stroke: #16a34a; }
+.node.state-failed rect, .node.state-failed polygon, .node.state-failed ellipse { fill: #fee2e2; stroke: #dc2626; }
+.node.state-retried rect, .node.state-retried polygon, .node.state-retried ellipse { fill: #fef3c7; stroke: #d97706; }
+.node.state-current rect, .node.state-current polygon, .node.state-current ellipse { fill: #dbeafe; stroke: #2563eb; stroke-width: 3; }
+.node.state-unvisited rect, .node.state-unvisited polygon, .node.state-unvisited ellipse { fill: #f9fafb; stroke: #d1d5db; stroke-dasharray: 4 3; }
+.node.state-unvisited text { fill: #9ca3af; }
+.edge path { fill: none; stroke: #9ca3af; stroke-width: 1.2; }
+.edge.back path { stroke-dasharray: 5 3; }
+.edge.taken path { stroke: #111827; stroke-width: 2.2; }
+.edge text { font: 11px sans-serif; fill: #374151; text-anchor: middle; }
+`
+
+// renderSVG draws g with the overlay's states, if any. Every node carries a
+// data-node attribute and every edge data-from/data-to/data-label/
+// data-condition so the live view can find them again.
+func renderSVG(g *model.Graph, o *Overlay) string {
+	l := computeLayout(g)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="attractor-graph" width="%s" height="%s" viewBox="0 0 %s %s">`+"\n",
+		num(l.Width), num(l.Height), num(l.Width), num(l.Height))
+	b.WriteString("<style>" + svgStyle + "</style>\n")
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#6b7280"/></marker></defs>` + "\n")
+
+	for _, pe := range l.Edges {
+		e := pe.Edge
+		class := "edge"
+		if pe.Back {
+			class += " back"
+		}
+		if o.Traversals(g, e) > 0 {
+			class += " taken"
+		}
+		p := pe.Path
+		fmt.Fprintf(&b, `<g class="%s" data-from="%s" data-to="%s" data-label="%s" data-condition="%s">`,
+			class, esc(e.From), esc(e.To), esc(e.Label()), esc(e.Condition()))
+		fmt.Fprintf(&b, `<path d="M%s,%s C%s,%s %s,%s %s,%s" marker-end="url(#arrow)"/>`,
+			num(p[0].X), num(p[0].Y), num(p[1].X), num(p[1].Y), num(p[2].X), num(p[2].Y), num(p[3].X), num(p[3].Y))
+		if pe.Label != "" {
+			mid := p.at(0.5)
+			fmt.Fprintf(&b, `<text x="%s" y="%s">%s</text>`, num(mid.X+6), num(mid.Y-4), esc(pe.Label))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	for _, pn := range l.Nodes {
+		n := pn.Node
+		fmt.Fprintf(&b, `<g class="node state-%s" data-node="%s">`, o.NodeState(n.ID), esc(n.ID))
+		fmt.Fprintf(&b, `<title>%s</title>`, esc(nodeTitle(n, o)))
+		b.WriteString(nodeShape(n.Shape(), pn))
+		labelY := pn.Y
+		meta := nodeMeta(o, n.ID)
+		if meta != "" {
+			labelY -= 7
+		}
+		fmt.Fprintf(&b, `<text x="%s" y="%s">%s</text>`, num(pn.X), num(labelY), esc(pn.Label))
+		fmt.Fprintf(&b, `<text class="meta" x="%s" y="%s">%s</text>`, num(pn.X), num(pn.Y+9), esc(meta))
+		b.WriteString("</g>\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// nodeShape approximates the DOT shapes pipelines use; anything else is a
+// rounded box.
+func nodeShape(shape string, p *placedNode) string {
+	x0, y0, x1, y1 := p.X-p.W/2, p.Y-p.H/2, p.X+p.W/2, p.Y+p.H/2
+	poly := func(pts ...point) string {
+		var s []string
+		for _, pt := range pts {
+			s = append(s, num(pt.X)+","+num(pt.Y))
+		}
+		return `<polygon points="` + strings.Join(s, " ") + `"/>`
+	}
+	switch shape {
+	case "diamond", "Mdiamond":
+		return poly(point{p.X, y0}, point{x1, p.Y}, point{p.X, y1}, point{x0, p.Y})
+	case "hexagon":
+		d := p.H / 2
+		return poly(point{x0 + d, y0}, point{x1 - d, y0}, point{x1, p.Y}, point{x1 - d, y1}, point{x0 + d, y1}, point{x0, p.Y})
+	case "parallelogram":
+		d := p.H / 3
+		return poly(point{x0 + d, y0}, point{x1, y0}, point{x1 - d, y1}, point{x0, y1})
+	case "Msquare", "tripleoctagon":
+		d := p.H / 4
+		return poly(point{x0 + d, y0}, point{x1 - d, y0}, point{x1, y0 + d}, point{x1, y1 - d},
+			point{x1 - d, y1}, point{x0 + d, y1}, point{x0, y1 - d}, point{x0, y0 + d})
+	case "component":
+		return fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s"/>`, num(x0), num(y0), num(p.W), num(p.H))
+	}
+	return fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" rx="6"/>`, num(x0), num(y0), num(p.W), num(p.H))
+}
+
+// nodeMeta is the small second line under a node label.
+func nodeMeta(o *Overlay, id string) string {
+	if o == nil || o.Nodes[id] == nil || o.Nodes[id].Attempts == 0 {
+		return ""
+	}
+	n := o.Nodes[id]
+	meta := strconv.Itoa(n.Attempts) + " attempt"
+	if n.Attempts != 1 {
+		meta += "s"
+	}
+	if n.DurationMS > 0 {
+		meta += " · " + FormatDuration(n.DurationMS)
+	}
+	return meta
+}
+
+func nodeTitle(n *model.Node, o *Overlay) string {
+	title := n.ID
+	if o != nil {
+		title += " (" + string(o.NodeState(n.ID)) + ")"
+		if r := o.Nodes[n.ID]; r != nil && r.Status != "" {
+			title += " last status: " + r.Status
+		}
+	}
+	return title
+}
+
+// FormatDuration renders milliseconds the way the HTML view does: 850ms,
+// 12.3s, 4m05s, 1h02m.
+func FormatDuration(ms int64) string {
+	switch {
+	case ms < 1000:
+		return strconv.FormatInt(ms, 10) + "ms"
+	case ms < 60_000:
+		return strconv.FormatFloat(float64(ms)/1000, 'f', 1, 64) + "s"
+	case ms < 3_600_000:
+		s := ms / 1000
+		return fmt.Sprintf("%dm%02ds", s/60, s%60)
+	}
+	m := ms / 60_000
+	return fmt.Sprintf("%dh%02dm", m/60, m%60)
+}
+
+func num(v float64) string { return strconv.FormatFloat(round1(v), 'f', -1, 64) }
+
+func esc(s string) string { return html.EscapeString(s) }
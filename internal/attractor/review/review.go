@@ -14,6 +14,7 @@ import (
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
 	"github.com/danshapiro/kilroy/internal/attractor/model"
 	"github.com/danshapiro/kilroy/internal/attractor/validate"
+	"github.com/danshapiro/kilroy/internal/llm"
 )
 
 // Options configures a review run.
@@ -22,6 +23,13 @@ type Options struct {
 	DotSource string
 	RepoPath  string
 	MaxTurns  int // per expert; default 3
+
+	// Provider and Model run the loop experts through agent sessions for
+	// this llm.providers entry of Config instead of `claude -p`.
+	Provider string
+	Model    string
+	Config   *engine.RunConfigFile
+	Client   *llm.Client // overrides the client built from Config (tests)
 }
 
 // CycleEdge describes a back edge (cycle) detected in the graph.
@@ -51,8 +59,10 @@ type ReviewReport struct {
 	Loops            []LoopAnalysis `json:"loops"`
 	ValidateErrors   int            `json:"validate_errors"`
 	ValidateWarnings int            `json:"validate_warnings"`
-	OverallScore     int            `json:"overall_score"`
-	Summary          string         `json:"summary"`
+	// Routing holds the deterministic findings of AnalyzeRouting.
+	Routing      []validate.Diagnostic `json:"routing"`
+	OverallScore int                   `json:"overall_score"`
+	Summary      string                `json:"summary"`
 }
 
 // Markdown returns a human-readable markdown representation of the report.
@@ -62,6 +72,13 @@ func (r *ReviewReport) Markdown() string {
 	sb.WriteString(fmt.Sprintf("**Overall Score:** %d/100  **Loops:** %d  **Validate Errors:** %d  **Warnings:** %d\n\n",
 		r.OverallScore, r.LoopCount, r.ValidateErrors, r.ValidateWarnings))
 	sb.WriteString(fmt.Sprintf("**Summary:** %s\n\n", r.Summary))
+	if len(r.Routing) > 0 {
+		sb.WriteString("## Routing\n")
+		for _, d := range r.Routing {
+			sb.WriteString(fmt.Sprintf("- %s (%s): %s\n", d.Severity, d.Rule, d.Message))
+		}
+		sb.WriteString("\n")
+	}
 	for i, loop := range r.Loops {
 		sb.WriteString(fmt.Sprintf("## Loop %d: %s → %s\n", i+1, loop.EntryNode, loop.BackEdgeTo))
 		sb.WriteString(fmt.Sprintf("- **Verdict:** %s  **Score:** %d/100\n", loop.Verdict, loop.Score))
@@ -115,12 +132,17 @@ func Run(ctx context.Context, opts Options) (*ReviewReport, error) {
 	}
 
 	cycles := detectCycles(g)
+	routing := AnalyzeRouting(g)
+	if routing == nil {
+		routing = []validate.Diagnostic{}
+	}
 
 	report := &ReviewReport{
 		File:             opts.GraphPath,
 		LoopCount:        len(cycles),
 		ValidateErrors:   errCount,
 		ValidateWarnings: warnCount,
+		Routing:          routing,
 	}
 
 	if len(cycles) == 0 {
@@ -129,10 +151,13 @@ func Run(ctx context.Context, opts Options) (*ReviewReport, error) {
 			score = 0
 		}
 		report.OverallScore = score
-		report.Summary = fmt.Sprintf("No loops detected. Validate: %d errors, %d warnings.", errCount, warnCount)
+		report.Summary = fmt.Sprintf("No loops detected. Validate: %d errors, %d warnings. Routing: %d finding(s).", errCount, warnCount, len(routing))
 		return report, nil
 	}
 
+	// The experts also see the routing findings for their loop.
+	diags = append(diags, routing...)
+
 	// Spawn parallel expert goroutines — one per cycle.
 	analyses := make([]LoopAnalysis, len(cycles))
 	var wg sync.WaitGroup
@@ -164,8 +189,8 @@ func Run(ctx context.Context, opts Options) (*ReviewReport, error) {
 	for _, a := range analyses {
 		verdicts = append(verdicts, fmt.Sprintf("%s→%s:%s", a.EntryNode, a.BackEdgeTo, a.Verdict))
 	}
-	report.Summary = fmt.Sprintf("%d loop(s): %s. Validate: %d errors, %d warnings.",
-		len(cycles), strings.Join(verdicts, "; "), errCount, warnCount)
+	report.Summary = fmt.Sprintf("%d loop(s): %s. Validate: %d errors, %d warnings. Routing: %d finding(s).",
+		len(cycles), strings.Join(verdicts, "; "), errCount, warnCount, len(routing))
 
 	return report, nil
 }
@@ -247,7 +272,8 @@ func findStartNode(g *model.Graph) string {
 	return ""
 }
 
-// analyzeLoop calls a claude -p expert to evaluate one cycle.
+// analyzeLoop asks an expert (claude -p, or an agent session when
+// opts.Provider is set) to evaluate one cycle.
 func analyzeLoop(ctx context.Context, g *model.Graph, cycle CycleEdge, diags []validate.Diagnostic, opts Options) LoopAnalysis {
 	analysis := LoopAnalysis{
 		EntryNode:  cycle.To,
@@ -261,6 +287,16 @@ func analyzeLoop(ctx context.Context, g *model.Graph, cycle CycleEdge, diags []v
 	}
 
 	prompt := buildLoopPrompt(g, cycle, diags)
+	if strings.TrimSpace(opts.Provider) != "" {
+		result, err := runAPIExpert(ctx, prompt, opts, maxTurns)
+		if err != nil {
+			analysis.Verdict = "error"
+			analysis.Score = 0
+			analysis.Issues = []string{fmt.Sprintf("%s expert session failed: %v", opts.Provider, err)}
+			return analysis
+		}
+		return parseLoopVerdict(analysis, result)
+	}
 	exe := claudeExe()
 	cmd := exec.CommandContext(ctx, exe,
 		"-p",
@@ -300,16 +336,21 @@ func analyzeLoop(ctx context.Context, g *model.Graph, cycle CycleEdge, diags []v
 		return analysis
 	}
 
-	// Extract JSON from the result text (the model should emit a JSON block).
+	return parseLoopVerdict(analysis, envelope.Result)
+}
+
+// parseLoopVerdict fills analysis from the JSON block the expert was asked to
+// emit, falling back to a warning when none can be extracted.
+func parseLoopVerdict(analysis LoopAnalysis, result string) LoopAnalysis {
 	var loopJSON struct {
 		Verdict     string   `json:"verdict"`
 		Score       int      `json:"score"`
 		Issues      []string `json:"issues"`
 		Suggestions []string `json:"suggestions"`
 	}
-	result := envelope.Result
 	if startBrace := strings.Index(result, "{"); startBrace >= 0 {
-		if err := json.Unmarshal([]byte(result[startBrace:]), &loopJSON); err == nil {
+		dec := json.NewDecoder(strings.NewReader(result[startBrace:]))
+		if err := dec.Decode(&loopJSON); err == nil {
 			analysis.Verdict = loopJSON.Verdict
 			analysis.Score = loopJSON.Score
 			analysis.Issues = loopJSON.Issues
@@ -325,6 +366,28 @@ func analyzeLoop(ctx context.Context, g *model.Graph, cycle CycleEdge, diags []v
 	return analysis
 }
 
+// runAPIExpert runs one loop expert in its own read-only agent session so it
+// can inspect the repo the way the CLI expert does.
+func runAPIExpert(ctx context.Context, prompt string, opts Options, maxTurns int) (string, error) {
+	workDir := opts.RepoPath
+	if workDir == "" {
+		workDir = "."
+	}
+	sess, err := engine.NewAgentSession(opts.Config, engine.AgentSessionOptions{
+		Provider:      opts.Provider,
+		Model:         opts.Model,
+		WorkDir:       workDir,
+		MaxToolRounds: maxTurns,
+		ReadOnly:      true,
+		Client:        opts.Client,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer sess.Close()
+	return sess.ProcessInput(ctx, prompt)
+}
+
 // buildLoopPrompt constructs the expert prompt for a single loop.
 func buildLoopPrompt(g *model.Graph, cycle CycleEdge, diags []validate.Diagnostic) string {
 	var sb strings.Builder
@@ -370,7 +433,7 @@ func buildLoopPrompt(g *model.Graph, cycle CycleEdge, diags []validate.Diagnosti
 		}
 	}
 
-	// Include validator diagnostics touching loop nodes.
+	// Include validator and routing diagnostics touching loop nodes.
 	bodySet := map[string]bool{}
 	for _, id := range cycle.LoopBody {
 		bodySet[id] = true
@@ -1,10 +1,14 @@
 package review
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/danshapiro/kilroy/internal/attractor/dot"
 	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/llm"
 )
 
 func mustParse(t *testing.T, src string) *model.Graph {
@@ -136,3 +140,55 @@ func TestDetectCycles_TwoIndependentCycles(t *testing.T) {
 		t.Errorf("expected 2 cycles, got %d: %+v", len(cycles), cycles)
 	}
 }
+
+type verdictAdapter struct{ prompts []string }
+
+func (a *verdictAdapter) Name() string { return "anthropic" }
+
+func (a *verdictAdapter) Complete(ctx context.Context, req llm.Request) (llm.Response, error) {
+	a.prompts = append(a.prompts, req.Messages[len(req.Messages)-1].Text())
+	reply := "Looks bounded.\n```json\n" +
+		`{"verdict":"ok","score":88,"issues":[],"suggestions":["add a pass counter"]}` + "\n```"
+	return llm.Response{Provider: "anthropic", Model: req.Model, Message: llm.Assistant(reply)}, nil
+}
+
+func (a *verdictAdapter) Stream(ctx context.Context, req llm.Request) (llm.Stream, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestRun_APIExpertScoresLoop(t *testing.T) {
+	src := `digraph test {
+		graph [goal="loop"]
+		start [shape=Mdiamond]
+		impl [shape=box, llm_provider=anthropic, llm_model=claude-sonnet-4-5, prompt="implement"]
+		check [shape=diamond]
+		exit [shape=Msquare]
+		start -> impl -> check
+		check -> impl [condition="outcome=fail"]
+		check -> exit [condition="outcome=success"]
+	}`
+	adapter := &verdictAdapter{}
+	client := llm.NewClient()
+	client.Register(adapter)
+
+	rep, err := Run(context.Background(), Options{
+		DotSource: src,
+		RepoPath:  t.TempDir(),
+		Provider:  "anthropic",
+		Model:     "claude-sonnet-4-5",
+		Client:    client,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if rep.LoopCount != 1 || len(rep.Loops) != 1 {
+		t.Fatalf("report=%+v", rep)
+	}
+	loop := rep.Loops[0]
+	if loop.Verdict != "ok" || loop.Score != 88 || len(loop.Suggestions) != 1 {
+		t.Fatalf("loop=%+v", loop)
+	}
+	if len(adapter.prompts) != 1 || !strings.Contains(adapter.prompts[0], "loop-semantics expert") {
+		t.Fatalf("prompts=%q", adapter.prompts)
+	}
+}
@@ -0,0 +1,418 @@
+package review
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danshapiro/kilroy/internal/attractor/cond"
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+// promptOutcomePatterns find the statuses a prompt tells the agent to write,
+// e.g. `status=needs_dod`, `outcome=done` or `{"status":"rejected"}`.
+var promptOutcomePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(?:status|outcome)\s*=\s*"?([a-z][a-z0-9_]*)`),
+	regexp.MustCompile(`(?i)"(?:status|outcome)"\s*:\s*"([a-z][a-z0-9_]*)"`),
+}
+
+// nodeRouting is what the static analysis knows about one node's outcomes.
+type nodeRouting struct {
+	// outcomes the node can finish with, canonical ones first.
+	outcomes []runtime.StageStatus
+	// opaque nodes route on something other than their status (human
+	// answers, parallel branches) and are not simulated.
+	opaque bool
+	fanIn  bool
+}
+
+// AnalyzeRouting checks a graph's routing without running it or calling a
+// model. For every node it enumerates the outcomes the node can produce
+// (success and fail, partial_success when allow_partial is set, and custom
+// statuses mined from the prompt), replays the engine's edge selection for
+// each one and reports:
+//
+//   - routing_unhandled_outcome: an outcome no edge accepts, or a custom
+//     outcome no condition matches (the engine treats it as a failure);
+//   - routing_shadowed_edge: an edge that is eligible but always loses the
+//     weight/target tie-break to a sibling;
+//   - routing_loop_no_exit_guard: a cycle none of whose nodes can route out
+//     of it.
+//
+// Conditions on context keys or preferred_label cannot be decided statically
+// and are assumed to match sometimes; edges picked by preferred_label or
+// suggested_next_ids are not modeled.
+func AnalyzeRouting(g *model.Graph) []validate.Diagnostic {
+	if g == nil {
+		return nil
+	}
+	routing := classifyRouting(g)
+	selectable := map[*model.Edge]bool{}
+	var diags []validate.Diagnostic
+
+	for _, id := range sortedNodeIDs(g) {
+		edges := outgoingEdges(g, id)
+		r := routing[id]
+		if r == nil || r.opaque {
+			for _, e := range edges {
+				selectable[e] = true
+			}
+			continue
+		}
+		if len(edges) == 0 {
+			continue
+		}
+		eligible := map[*model.Edge]bool{}
+		for _, o := range r.outcomes {
+			sel := simulateSelection(g, edges, o, r.fanIn)
+			if d, ok := unhandledOutcome(g, id, o, sel); ok {
+				diags = append(diags, d)
+			}
+			if !o.IsCanonical() && !sel.matchedCondition() {
+				// Retried and then routed as fail, which is simulated on
+				// its own.
+				continue
+			}
+			for _, e := range sel.candidates {
+				eligible[e] = true
+			}
+			for _, e := range sel.taken {
+				selectable[e] = true
+			}
+		}
+		diags = append(diags, shadowedEdges(edges, eligible, selectable)...)
+	}
+
+	for _, c := range detectCycles(g) {
+		if d, ok := loopWithoutExit(g, c, selectable); ok {
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// classifyRouting assigns each node its possible outcomes. Conditional nodes
+// pass their predecessor's outcome through, so they get every outcome with
+// which a predecessor can route to them.
+func classifyRouting(g *model.Graph) map[string]*nodeRouting {
+	reg := engine.NewDefaultRegistry()
+	out := map[string]*nodeRouting{}
+	var conditionals []string
+	for _, id := range sortedNodeIDs(g) {
+		n := g.Nodes[id]
+		r := &nodeRouting{}
+		out[id] = r
+		switch reg.Resolve(n).(type) {
+		case *engine.ExitHandler:
+			out[id] = nil
+			continue
+		case *engine.WaitHumanHandler, *engine.ParallelHandler:
+			r.opaque = true
+			continue
+		case *engine.StartHandler:
+			r.outcomes = []runtime.StageStatus{runtime.StatusSuccess}
+			continue
+		case *engine.ConditionalHandler:
+			conditionals = append(conditionals, id)
+			continue
+		case *engine.FanInHandler:
+			r.fanIn = true
+			r.outcomes = []runtime.StageStatus{runtime.StatusSuccess, runtime.StatusPartialSuccess, runtime.StatusFail}
+			continue
+		case *engine.CodergenHandler:
+			r.outcomes = []runtime.StageStatus{runtime.StatusSuccess, runtime.StatusFail}
+			for _, o := range promptOutcomes(n.Prompt()) {
+				r.add(o)
+			}
+		default:
+			r.outcomes = []runtime.StageStatus{runtime.StatusSuccess, runtime.StatusFail}
+		}
+		if strings.EqualFold(n.Attr("allow_partial", "false"), "true") {
+			r.add(runtime.StatusPartialSuccess)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, id := range conditionals {
+			r := out[id]
+			for _, in := range g.Incoming(id) {
+				if in == nil {
+					continue
+				}
+				pred := out[in.From]
+				if pred == nil {
+					continue
+				}
+				if pred.opaque && !r.opaque {
+					r.opaque, changed = true, true
+				}
+				for _, o := range pred.outcomes {
+					if !r.has(o) && routesThrough(g, pred, o, in) {
+						r.add(o)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// routesThrough reports whether a node finishing with o can take edge e.
+func routesThrough(g *model.Graph, r *nodeRouting, o runtime.StageStatus, e *model.Edge) bool {
+	sel := simulateSelection(g, outgoingEdges(g, e.From), o, r.fanIn)
+	if !o.IsCanonical() && !sel.matchedCondition() {
+		return false
+	}
+	for _, taken := range sel.taken {
+		if taken == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *nodeRouting) has(o runtime.StageStatus) bool {
+	for _, have := range r.outcomes {
+		if have == o {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *nodeRouting) add(o runtime.StageStatus) {
+	if !r.has(o) {
+		r.outcomes = append(r.outcomes, o)
+	}
+}
+
+// promptOutcomes returns the statuses a prompt instructs the agent to write.
+// retry is left out: the engine retries the stage instead of routing it.
+func promptOutcomes(prompt string) []runtime.StageStatus {
+	var out []runtime.StageStatus
+	seen := map[runtime.StageStatus]bool{}
+	for _, re := range promptOutcomePatterns {
+		for _, m := range re.FindAllStringSubmatch(prompt, -1) {
+			st, err := runtime.ParseStageStatus(m[1])
+			if err != nil || st == runtime.StatusRetry || seen[st] {
+				continue
+			}
+			seen[st] = true
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// selection is the static replay of edge selection for one outcome.
+type selection struct {
+	// candidates are the edges eligible together; taken are the ones the
+	// engine follows (all of them on an implicit fan-out).
+	candidates []*model.Edge
+	taken      []*model.Edge
+	// undecided is set when a context-dependent condition might match.
+	undecided bool
+}
+
+// simulateSelection mirrors selectAllEligibleEdges: matching conditional
+// edges win, then unconditional ones; several eligible edges fan out when
+// they converge, otherwise the best one by weight and target is taken. Fan-in
+// failures only follow conditional edges.
+func simulateSelection(g *model.Graph, edges []*model.Edge, o runtime.StageStatus, fanIn bool) selection {
+	var sel selection
+	var matched, uncond []*model.Edge
+	for _, e := range edges {
+		c := strings.TrimSpace(e.Condition())
+		if c == "" {
+			uncond = append(uncond, e)
+			continue
+		}
+		match, known := conditionMatches(c, o)
+		switch {
+		case !known:
+			sel.undecided = true
+			sel.taken = append(sel.taken, e)
+		case match:
+			matched = append(matched, e)
+		}
+	}
+	candidates := matched
+	if len(candidates) == 0 {
+		if fanIn && (o == runtime.StatusFail || o == runtime.StatusRetry) {
+			return sel
+		}
+		candidates = uncond
+	}
+	if len(candidates) == 0 {
+		return sel
+	}
+	sel.candidates = candidates
+	if engine.ImplicitFanOutJoin(g, candidates) != "" {
+		sel.taken = append(sel.taken, candidates...)
+	} else {
+		sel.taken = append(sel.taken, engine.BestEdge(candidates))
+	}
+	return sel
+}
+
+func (s selection) matchedCondition() bool {
+	return len(s.candidates) > 0 && strings.TrimSpace(s.candidates[0].Condition()) != ""
+}
+
+// conditionMatches decides whether condition holds for outcome o. known is
+// false when the answer depends on context values or preferred_label; for
+// AND-only conditions the outcome clauses alone can still rule a match out.
+func conditionMatches(condition string, o runtime.StageStatus) (match, known bool) {
+	expr, err := cond.Parse(condition)
+	if err != nil {
+		// condition_syntax reports it; the engine can never take the edge.
+		return false, true
+	}
+	outcomeOnly := true
+	for _, c := range expr.Clauses() {
+		if c.Key != "outcome" {
+			outcomeOnly = false
+		}
+	}
+	ctx := runtime.NewContext()
+	ctx.Set("outcome", string(o))
+	out := runtime.Outcome{Status: o}
+	if outcomeOnly {
+		ok, err := expr.Eval(out, ctx)
+		return err == nil && ok, true
+	}
+	if cond.UsesExtendedSyntax(condition) {
+		return false, false
+	}
+	for _, c := range expr.Clauses() {
+		if c.Key != "outcome" {
+			continue
+		}
+		if ok, err := cond.Evaluate(c.Key+c.Op+c.Literal, out, ctx); err == nil && !ok {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func unhandledOutcome(g *model.Graph, id string, o runtime.StageStatus, sel selection) (validate.Diagnostic, bool) {
+	if sel.undecided {
+		return validate.Diagnostic{}, false
+	}
+	d := validate.Diagnostic{
+		Rule:     "routing_unhandled_outcome",
+		Severity: validate.SeverityWarning,
+		NodeID:   id,
+	}
+	switch {
+	case !o.IsCanonical():
+		if sel.matchedCondition() {
+			return validate.Diagnostic{}, false
+		}
+		// Usually a typo on one side: the prompt and the conditions disagree.
+		d.Message = fmt.Sprintf("node %q can finish with custom outcome %q but no edge condition matches it; the engine treats it as a failure", id, o)
+		d.Fix = fmt.Sprintf("add an edge with condition=\"outcome=%s\" or fix the outcome name in the prompt or condition", o)
+	case len(sel.candidates) > 0:
+		return validate.Diagnostic{}, false
+	case o == runtime.StatusFail:
+		if engine.RetryTarget(g, id) != "" {
+			return validate.Diagnostic{}, false
+		}
+		d.Message = fmt.Sprintf("node %q has no edge for outcome fail and no retry_target; a failure here ends the run", id)
+		d.Fix = "add an edge with condition=\"outcome=fail\" or set retry_target"
+	default:
+		d.Message = fmt.Sprintf("node %q has no edge for outcome %q; the run would stop here and report success", id, o)
+		d.Fix = fmt.Sprintf("add an edge with condition=\"outcome=%s\" or an unconditional fallback edge", o)
+	}
+	return d, true
+}
+
+// shadowedEdges reports edges that were eligible for some outcome but never
+// taken. Edges that are simply never eligible are left alone: the analysis
+// cannot know every outcome a node might produce.
+func shadowedEdges(edges []*model.Edge, eligible, selectable map[*model.Edge]bool) []validate.Diagnostic {
+	var diags []validate.Diagnostic
+	for _, e := range edges {
+		if !eligible[e] || selectable[e] {
+			continue
+		}
+		winner := winnerOver(e, edges, selectable)
+		msg := fmt.Sprintf("edge %s -> %s is never taken", e.From, e.To)
+		if winner != nil {
+			msg += fmt.Sprintf(": %s -> %s wins on weight and target whenever both are eligible", winner.From, winner.To)
+		}
+		diags = append(diags, validate.Diagnostic{
+			Rule:     "routing_shadowed_edge",
+			Severity: validate.SeverityWarning,
+			EdgeFrom: e.From,
+			EdgeTo:   e.To,
+			Message:  msg,
+			Fix:      "give the edge a distinct condition, raise its weight, or remove it",
+		})
+	}
+	return diags
+}
+
+// winnerOver returns a taken edge with the same condition as e, which is the
+// one it ties with.
+func winnerOver(e *model.Edge, edges []*model.Edge, selectable map[*model.Edge]bool) *model.Edge {
+	for _, other := range edges {
+		if other != e && selectable[other] && strings.TrimSpace(other.Condition()) == strings.TrimSpace(e.Condition()) {
+			return other
+		}
+	}
+	return nil
+}
+
+// loopWithoutExit reports a cycle when no edge that can be taken leads from
+// one of its nodes to a node outside it. A failing node's retry_target does
+// not count: it is a recovery route, not a guard.
+func loopWithoutExit(g *model.Graph, c CycleEdge, selectable map[*model.Edge]bool) (validate.Diagnostic, bool) {
+	inLoop := map[string]bool{}
+	for _, id := range c.LoopBody {
+		inLoop[id] = true
+	}
+	for _, id := range c.LoopBody {
+		for _, e := range outgoingEdges(g, id) {
+			if !inLoop[e.To] && selectable[e] {
+				return validate.Diagnostic{}, false
+			}
+		}
+	}
+	return validate.Diagnostic{
+		Rule:     "routing_loop_no_exit_guard",
+		Severity: validate.SeverityWarning,
+		NodeID:   c.To,
+		EdgeFrom: c.From,
+		EdgeTo:   c.To,
+		Message:  fmt.Sprintf("loop %s has no edge that can leave it; it only stops when a stage fails or max_node_visits trips", strings.Join(append(c.LoopBody, c.To), " -> ")),
+		Fix:      "add a conditional edge out of the loop (e.g. condition=\"outcome=success\") or guard the back edge with a condition",
+	}, true
+}
+
+func outgoingEdges(g *model.Graph, id string) []*model.Edge {
+	var out []*model.Edge
+	for _, e := range g.Outgoing(id) {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func sortedNodeIDs(g *model.Graph) []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id, n := range g.Nodes {
+		if n != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
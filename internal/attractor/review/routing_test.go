@@ -0,0 +1,189 @@
+package review
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danshapiro/kilroy/internal/attractor/validate"
+)
+
+func routingRules(diags []validate.Diagnostic) map[string][]validate.Diagnostic {
+	out := map[string][]validate.Diagnostic{}
+	for _, d := range diags {
+		out[d.Rule] = append(out[d.Rule], d)
+	}
+	return out
+}
+
+func TestAnalyzeRouting_FullyRoutedGraphIsClean(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="Write status=success or status=fail"]
+		check [shape=diamond]
+		exit [shape=Msquare]
+		start -> impl -> check
+		check -> exit [condition="outcome=success"]
+		check -> impl [condition="outcome=fail"]
+	}`)
+	if diags := AnalyzeRouting(g); len(diags) != 0 {
+		t.Fatalf("diags=%+v", diags)
+	}
+}
+
+func TestAnalyzeRouting_UnhandledOutcomes(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		triage [shape=box, prompt="If the spec is missing write {\"status\":\"needs_spec\"}; if done write status=has_spec."]
+		partial [shape=box, allow_partial=true, prompt="work"]
+		exit [shape=Msquare]
+		start -> triage
+		triage -> partial [condition="outcome=has_spec"]
+		triage -> exit [condition="outcome=fail"]
+		triage -> exit
+		partial -> exit [condition="outcome=success"]
+	}`)
+	rules := routingRules(AnalyzeRouting(g))
+	var msgs []string
+	for _, d := range rules["routing_unhandled_outcome"] {
+		msgs = append(msgs, d.NodeID+": "+d.Message)
+	}
+	got := strings.Join(msgs, "\n")
+	for _, want := range []string{
+		`triage: node "triage" can finish with custom outcome "needs_spec"`,
+		`partial: node "partial" has no edge for outcome fail`,
+		`partial: node "partial" has no edge for outcome "partial_success"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("unhandled outcomes:\n%s", got)
+	}
+}
+
+func TestAnalyzeRouting_RetryTargetHandlesFail(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		graph [retry_target="impl"]
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="work"]
+		exit [shape=Msquare]
+		start -> impl
+		impl -> exit [condition="outcome=success"]
+	}`)
+	if diags := AnalyzeRouting(g); len(diags) != 0 {
+		t.Fatalf("diags=%+v", diags)
+	}
+}
+
+func TestAnalyzeRouting_ContextConditionsAreUndecided(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="work"]
+		exit [shape=Msquare]
+		start -> impl
+		impl -> exit [condition="context.ready=true"]
+		impl -> impl [condition="outcome=fail && context.attempts=1"]
+	}`)
+	for _, d := range AnalyzeRouting(g) {
+		if d.Rule == "routing_unhandled_outcome" {
+			t.Fatalf("context condition should count as possibly matching: %+v", d)
+		}
+	}
+}
+
+func TestAnalyzeRouting_ShadowedEdges(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="work"]
+		a [shape=box, prompt="a"]
+		b [shape=box, prompt="b"]
+		exit [shape=Msquare]
+		start -> impl
+		impl -> exit [condition="outcome=fail"]
+		impl -> b [condition="outcome=fail"]
+		impl -> exit [weight=5]
+		impl -> a
+		a -> exit
+		b -> exit
+	}`)
+	shadowed := routingRules(AnalyzeRouting(g))["routing_shadowed_edge"]
+	if len(shadowed) != 2 {
+		t.Fatalf("shadowed=%+v", shadowed)
+	}
+	if d := shadowed[0]; d.EdgeFrom != "impl" || d.EdgeTo != "exit" || !strings.Contains(d.Message, "impl -> b wins") {
+		t.Fatalf("conditional shadow=%+v", d)
+	}
+	if d := shadowed[1]; d.EdgeTo != "a" || !strings.Contains(d.Message, "impl -> exit wins") || d.Severity != validate.SeverityWarning {
+		t.Fatalf("unconditional shadow=%+v", d)
+	}
+}
+
+func TestAnalyzeRouting_ImplicitFanOutIsNotShadowing(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		a [shape=box, prompt="a"]
+		b [shape=box, prompt="b"]
+		join [shape=box, prompt="join"]
+		exit [shape=Msquare]
+		start -> a
+		start -> b
+		a -> join
+		b -> join
+		join -> exit
+	}`)
+	if shadowed := routingRules(AnalyzeRouting(g))["routing_shadowed_edge"]; len(shadowed) != 0 {
+		t.Fatalf("shadowed=%+v", shadowed)
+	}
+}
+
+func TestAnalyzeRouting_LoopWithoutExitGuard(t *testing.T) {
+	g := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="work"]
+		verify [shape=box, prompt="verify"]
+		exit [shape=Msquare]
+		start -> impl -> verify
+		verify -> impl
+		verify -> exit [condition="outcome=bogus"]
+	}`)
+	loops := routingRules(AnalyzeRouting(g))["routing_loop_no_exit_guard"]
+	if len(loops) != 1 {
+		t.Fatalf("loops=%+v", loops)
+	}
+	if d := loops[0]; d.EdgeFrom != "verify" || d.EdgeTo != "impl" || !strings.Contains(d.Message, "impl -> verify -> impl") {
+		t.Fatalf("loop=%+v", d)
+	}
+
+	guarded := mustParse(t, `digraph test {
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="work"]
+		verify [shape=box, prompt="verify"]
+		exit [shape=Msquare]
+		start -> impl -> verify
+		verify -> impl [condition="outcome=fail"]
+		verify -> exit [condition="outcome=success"]
+	}`)
+	if loops := routingRules(AnalyzeRouting(guarded))["routing_loop_no_exit_guard"]; len(loops) != 0 {
+		t.Fatalf("guarded loop flagged: %+v", loops)
+	}
+}
+
+func TestRun_ReportsRoutingWithoutLoops(t *testing.T) {
+	rep, err := Run(t.Context(), Options{DotSource: `digraph test {
+		start [shape=Mdiamond]
+		impl [shape=box, prompt="work"]
+		exit [shape=Msquare]
+		start -> impl
+		impl -> exit [condition="outcome=success"]
+	}`})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(rep.Routing) != 1 || rep.Routing[0].Rule != "routing_unhandled_outcome" {
+		t.Fatalf("routing=%+v", rep.Routing)
+	}
+	if !strings.Contains(rep.Summary, "Routing: 1 finding(s)") || !strings.Contains(rep.Markdown(), "## Routing") {
+		t.Fatalf("summary=%q markdown=%q", rep.Summary, rep.Markdown())
+	}
+}
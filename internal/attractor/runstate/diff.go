@@ -0,0 +1,185 @@
+package runstate
+
+import (
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+// RunDiff compares two verbose snapshots.
+type RunDiff struct {
+	A RunSummary `json:"a"`
+	B RunSummary `json:"b"`
+	// Trace pairs up the two stage traces, aligned on node IDs so an extra
+	// retry or detour on one side doesn't shift every later row.
+	Trace []TraceRow `json:"trace"`
+	// Nodes has one entry per node either run executed, in first-seen order.
+	Nodes []NodeDiff `json:"nodes"`
+	// CodeDiff is the git diff between the two final commits, filled in by
+	// callers that have a repository to run git in.
+	CodeDiff      string `json:"code_diff,omitempty"`
+	CodeDiffError string `json:"code_diff_error,omitempty"`
+}
+
+// RunSummary is one side of a RunDiff.
+type RunSummary struct {
+	LogsRoot       string            `json:"logs_root"`
+	RunID          string            `json:"run_id,omitempty"`
+	State          State             `json:"state"`
+	FailureReason  string            `json:"failure_reason,omitempty"`
+	FinalCommitSHA string            `json:"final_commit_sha,omitempty"`
+	Attempts       int               `json:"attempts"`
+	DurationMS     int64             `json:"duration_ms"`
+	Usage          *runtime.RunUsage `json:"usage,omitempty"`
+}
+
+// TraceRow is one line of the side-by-side trace. A nil side means that run
+// had no matching attempt there.
+type TraceRow struct {
+	A *StageAttempt `json:"a,omitempty"`
+	B *StageAttempt `json:"b,omitempty"`
+}
+
+// NodeDiff compares one node across the two runs.
+type NodeDiff struct {
+	NodeID  string       `json:"node_id"`
+	A       *NodeSummary `json:"a,omitempty"`
+	B       *NodeSummary `json:"b,omitempty"`
+	Changed []string     `json:"changed,omitempty"`
+}
+
+// NodeSummary folds a node's attempts in one run.
+type NodeSummary struct {
+	Attempts      int                  `json:"attempts"`
+	Retries       int                  `json:"retries"`
+	Status        string               `json:"status"`
+	FailureReason string               `json:"failure_reason,omitempty"`
+	DurationMS    int64                `json:"duration_ms"`
+	Usage         *runtime.UsageTotals `json:"usage,omitempty"`
+}
+
+// Differs reports whether anything about the node differs between the runs.
+func (d NodeDiff) Differs() bool { return len(d.Changed) > 0 }
+
+// Compare diffs two snapshots that have been through ApplyVerbose.
+func Compare(a, b *Snapshot) *RunDiff {
+	d := &RunDiff{A: summarizeRun(a), B: summarizeRun(b)}
+	d.Trace = alignTraces(a.StageTrace, b.StageTrace)
+
+	na, nb := summarizeNodes(a), summarizeNodes(b)
+	seen := map[string]bool{}
+	var order []string
+	for _, sa := range append(append([]StageAttempt{}, a.StageTrace...), b.StageTrace...) {
+		if !seen[sa.NodeID] {
+			seen[sa.NodeID] = true
+			order = append(order, sa.NodeID)
+		}
+	}
+	for _, id := range order {
+		nd := NodeDiff{NodeID: id, A: na[id], B: nb[id]}
+		nd.Changed = changedFields(nd.A, nd.B)
+		d.Nodes = append(d.Nodes, nd)
+	}
+	return d
+}
+
+func summarizeRun(s *Snapshot) RunSummary {
+	rs := RunSummary{
+		LogsRoot:       s.LogsRoot,
+		RunID:          s.RunID,
+		State:          s.State,
+		FailureReason:  s.FailureReason,
+		FinalCommitSHA: s.FinalCommitSHA,
+		Attempts:       len(s.StageTrace),
+		Usage:          s.Usage,
+	}
+	for _, sa := range s.StageTrace {
+		rs.DurationMS += sa.DurationMS
+	}
+	return rs
+}
+
+func summarizeNodes(s *Snapshot) map[string]*NodeSummary {
+	out := map[string]*NodeSummary{}
+	for _, sa := range s.StageTrace {
+		n := out[sa.NodeID]
+		if n == nil {
+			n = &NodeSummary{}
+			out[sa.NodeID] = n
+		}
+		n.Attempts++
+		n.Status = sa.Status
+		n.FailureReason = sa.FailureReason
+		n.DurationMS += sa.DurationMS
+	}
+	for id, n := range out {
+		n.Retries = s.RetryCounts[id]
+		if s.Usage != nil {
+			if u, ok := s.Usage.Nodes[id]; ok {
+				n.Usage = &u
+			}
+		}
+	}
+	return out
+}
+
+// changedFields names what differs. Durations and usage always differ a
+// little between runs, so only outcomes, reasons and attempt counts count.
+func changedFields(a, b *NodeSummary) []string {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return []string{"only_in_b"}
+	case b == nil:
+		return []string{"only_in_a"}
+	}
+	var changed []string
+	if a.Status != b.Status {
+		changed = append(changed, "status")
+	}
+	if a.FailureReason != b.FailureReason {
+		changed = append(changed, "failure_reason")
+	}
+	if a.Attempts != b.Attempts {
+		changed = append(changed, "attempts")
+	}
+	if a.Retries != b.Retries {
+		changed = append(changed, "retries")
+	}
+	return changed
+}
+
+// alignTraces pairs attempts by a longest common subsequence of node IDs;
+// attempts outside it get a row of their own.
+func alignTraces(a, b []StageAttempt) []TraceRow {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i].NodeID == b[j].NodeID {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var rows []TraceRow
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i].NodeID == b[j].NodeID:
+			rows = append(rows, TraceRow{A: &a[i], B: &b[j]})
+			i++
+			j++
+		case j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			rows = append(rows, TraceRow{A: &a[i]})
+			i++
+		default:
+			rows = append(rows, TraceRow{B: &b[j]})
+			j++
+		}
+	}
+	return rows
+}
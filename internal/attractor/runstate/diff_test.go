@@ -0,0 +1,93 @@
+package runstate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeDiffRun(t *testing.T, final, progress string) *Snapshot {
+	t.Helper()
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "final.json"), []byte(final), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "progress.ndjson"), []byte(progress), 0o644)
+	s, err := LoadSnapshot(root)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if err := ApplyVerbose(s); err != nil {
+		t.Fatalf("ApplyVerbose: %v", err)
+	}
+	return s
+}
+
+func TestApplyVerbose_StageTraceDurations(t *testing.T) {
+	s := writeDiffRun(t, `{"status":"success","run_id":"r1"}`,
+		`{"event":"stage_attempt_start","ts":"2026-01-01T00:00:00Z","node_id":"impl","attempt":1}
+{"event":"stage_attempt_end","ts":"2026-01-01T00:00:02.5Z","node_id":"impl","status":"success","attempt":1}
+{"event":"stage_attempt_end","node_id":"exit","status":"success","attempt":1}
+`)
+	if len(s.StageTrace) != 2 || s.StageTrace[0].DurationMS != 2500 || s.StageTrace[1].DurationMS != 0 {
+		t.Fatalf("stage_trace=%+v", s.StageTrace)
+	}
+}
+
+func TestCompare_AlignsTracesAndFlagsChangedNodes(t *testing.T) {
+	a := writeDiffRun(t,
+		`{"status":"fail","run_id":"a","failure_reason":"tests failed","final_git_commit_sha":"aaa","usage":{"input_tokens":100,"cost_usd":0.5,"nodes":{"impl":{"input_tokens":100,"cost_usd":0.5}}}}`,
+		`{"event":"stage_attempt_start","ts":"2026-01-01T00:00:00Z","node_id":"start","attempt":1}
+{"event":"stage_attempt_end","ts":"2026-01-01T00:00:01Z","node_id":"start","status":"success","attempt":1}
+{"event":"stage_attempt_start","ts":"2026-01-01T00:00:01Z","node_id":"impl","attempt":1}
+{"event":"stage_attempt_end","ts":"2026-01-01T00:00:04Z","node_id":"impl","status":"fail","attempt":1,"failure_reason":"tests failed"}
+{"event":"stage_attempt_start","ts":"2026-01-01T00:00:04Z","node_id":"impl","attempt":2}
+{"event":"stage_attempt_end","ts":"2026-01-01T00:00:09Z","node_id":"impl","status":"fail","attempt":2,"failure_reason":"tests failed"}
+`)
+	b := writeDiffRun(t,
+		`{"status":"success","run_id":"b","final_git_commit_sha":"bbb"}`,
+		`{"event":"stage_attempt_end","node_id":"start","status":"success","attempt":1}
+{"event":"stage_attempt_end","node_id":"impl","status":"success","attempt":1}
+{"event":"stage_attempt_end","node_id":"exit","status":"success","attempt":1}
+`)
+
+	d := Compare(a, b)
+	if d.A.State != StateFail || d.B.State != StateSuccess || d.A.FinalCommitSHA != "aaa" || d.B.FinalCommitSHA != "bbb" {
+		t.Fatalf("summaries a=%+v b=%+v", d.A, d.B)
+	}
+	if d.A.DurationMS != 9000 || d.A.Attempts != 3 || d.A.Usage == nil || d.A.Usage.CostUSD != 0.5 {
+		t.Fatalf("a=%+v", d.A)
+	}
+
+	var trace [][2]string
+	for _, r := range d.Trace {
+		row := [2]string{}
+		if r.A != nil {
+			row[0] = r.A.NodeID
+		}
+		if r.B != nil {
+			row[1] = r.B.NodeID
+		}
+		trace = append(trace, row)
+	}
+	want := [][2]string{{"start", "start"}, {"impl", "impl"}, {"impl", ""}, {"", "exit"}}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace=%v want %v", trace, want)
+	}
+
+	changed := map[string][]string{}
+	for _, n := range d.Nodes {
+		changed[n.NodeID] = n.Changed
+	}
+	if len(changed["start"]) != 0 {
+		t.Fatalf("start changed=%v", changed["start"])
+	}
+	if !reflect.DeepEqual(changed["impl"], []string{"status", "failure_reason", "attempts", "retries"}) {
+		t.Fatalf("impl changed=%v", changed["impl"])
+	}
+	if !reflect.DeepEqual(changed["exit"], []string{"only_in_b"}) {
+		t.Fatalf("exit changed=%v", changed["exit"])
+	}
+	if n := d.Nodes[1]; n.A.Usage == nil || n.A.Usage.InputTokens != 100 || n.A.Retries != 1 {
+		t.Fatalf("impl a=%+v", n.A)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/procutil"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
 type finalOutcomeDoc struct {
@@ -270,9 +271,10 @@ func applyCheckpointVerbose(s *Snapshot) error {
 }
 
 type finalVerboseDoc struct {
-	FinalCommitSHA string `json:"final_git_commit_sha"`
-	CXDBContextID  string `json:"cxdb_context_id"`
-	RunID          string `json:"run_id"`
+	FinalCommitSHA string            `json:"final_git_commit_sha"`
+	CXDBContextID  string            `json:"cxdb_context_id"`
+	RunID          string            `json:"run_id"`
+	Usage          *runtime.RunUsage `json:"usage"`
 }
 
 func applyFinalVerbose(s *Snapshot) error {
@@ -290,6 +292,7 @@ func applyFinalVerbose(s *Snapshot) error {
 	}
 	s.FinalCommitSHA = strings.TrimSpace(doc.FinalCommitSHA)
 	s.CXDBContextID = strings.TrimSpace(doc.CXDBContextID)
+	s.Usage = doc.Usage
 	if s.RunID == "" {
 		s.RunID = strings.TrimSpace(doc.RunID)
 	}
@@ -310,6 +313,10 @@ func applyStageTrace(s *Snapshot) error {
 	sc := bufio.NewScanner(f)
 	sc.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
 
+	// final.json usage is authoritative; progress usage only fills the gap
+	// for runs that have not finished yet.
+	var progressUsage *runtime.RunUsage
+	started := map[string]time.Time{}
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
 		if line == "" {
@@ -320,6 +327,8 @@ func applyStageTrace(s *Snapshot) error {
 			continue
 		}
 		switch eventString(ev["event"]) {
+		case "stage_attempt_start":
+			started[eventString(ev["node_id"])] = parseEventTime(ev["ts"])
 		case "stage_attempt_end":
 			sa := StageAttempt{
 				NodeID:        eventString(ev["node_id"]),
@@ -328,6 +337,10 @@ func applyStageTrace(s *Snapshot) error {
 				MaxAttempts:   eventInt(ev["max"]),
 				FailureReason: eventString(ev["failure_reason"]),
 			}
+			if start, end := started[sa.NodeID], parseEventTime(ev["ts"]); !start.IsZero() && end.After(start) {
+				sa.DurationMS = end.Sub(start).Milliseconds()
+			}
+			delete(started, sa.NodeID)
 			s.StageTrace = append(s.StageTrace, sa)
 		case "edge_selected":
 			et := EdgeTransition{
@@ -336,8 +349,34 @@ func applyStageTrace(s *Snapshot) error {
 				Condition: eventString(ev["condition"]),
 			}
 			s.EdgeTrace = append(s.EdgeTrace, et)
+		case "stage_usage":
+			if progressUsage == nil {
+				progressUsage = &runtime.RunUsage{Nodes: map[string]runtime.UsageTotals{}}
+			}
+			progressUsage.InputTokens = eventInt64(ev["run_input_tokens"])
+			progressUsage.OutputTokens = eventInt64(ev["run_output_tokens"])
+			progressUsage.CostUSD = eventFloat(ev["run_cost_usd"])
+			if nodeID := eventString(ev["node_id"]); nodeID != "" {
+				progressUsage.Nodes[nodeID] = runtime.UsageTotals{
+					InputTokens:   eventInt64(ev["input_tokens"]),
+					OutputTokens:  eventInt64(ev["output_tokens"]),
+					CostUSD:       eventFloat(ev["cost_usd"]),
+					Calls:         eventInt(ev["calls"]),
+					UnpricedCalls: eventInt(ev["unpriced_calls"]),
+				}
+			}
 		}
 	}
+	if s.Usage == nil && progressUsage != nil {
+		calls, unpriced := 0, 0
+		for _, u := range progressUsage.Nodes {
+			calls += u.Calls
+			unpriced += u.UnpricedCalls
+		}
+		progressUsage.Calls = calls
+		progressUsage.UnpricedCalls = unpriced
+		s.Usage = progressUsage
+	}
 	return sc.Err()
 }
 
@@ -369,6 +408,30 @@ func eventInt(v any) int {
 	}
 }
 
+func eventInt64(v any) int64 {
+	switch t := v.(type) {
+	case float64:
+		return int64(t)
+	case string:
+		n, _ := strconv.ParseInt(t, 10, 64)
+		return n
+	default:
+		return 0
+	}
+}
+
+func eventFloat(v any) float64 {
+	switch t := v.(type) {
+	case float64:
+		return t
+	case string:
+		f, _ := strconv.ParseFloat(t, 64)
+		return f
+	default:
+		return 0
+	}
+}
+
 func eventString(v any) string {
 	switch t := v.(type) {
 	case nil:
@@ -216,6 +216,53 @@ func TestApplyVerbose_RetryCountsFromTraceForCompletedRuns(t *testing.T) {
 	}
 }
 
+func TestApplyVerbose_UsageFromFinalWinsOverProgress(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "final.json"),
+		[]byte(`{"status":"success","run_id":"r1","usage":{"input_tokens":300,"output_tokens":40,"cost_usd":0.5,"calls":3,"nodes":{"impl":{"input_tokens":300,"output_tokens":40,"cost_usd":0.5,"calls":3}}}}`), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "progress.ndjson"),
+		[]byte(`{"event":"stage_usage","node_id":"impl","input_tokens":100,"output_tokens":10,"cost_usd":0.1,"calls":1,"run_input_tokens":100,"run_output_tokens":10,"run_cost_usd":0.1}`+"\n"), 0o644)
+
+	s := &Snapshot{LogsRoot: root}
+	if err := ApplyVerbose(s); err != nil {
+		t.Fatalf("ApplyVerbose: %v", err)
+	}
+	if s.Usage == nil {
+		t.Fatal("usage=nil want final.json usage")
+	}
+	if s.Usage.InputTokens != 300 || s.Usage.CostUSD != 0.5 || s.Usage.Calls != 3 {
+		t.Fatalf("usage=%+v want final.json totals", s.Usage)
+	}
+	if s.Usage.Nodes["impl"].OutputTokens != 40 {
+		t.Fatalf("usage.nodes[impl]=%+v", s.Usage.Nodes["impl"])
+	}
+}
+
+func TestApplyVerbose_UsageFromProgressForRunningRun(t *testing.T) {
+	root := t.TempDir()
+	ndjson := `{"event":"stage_usage","node_id":"plan","input_tokens":100,"output_tokens":10,"cost_usd":0.1,"calls":1,"run_input_tokens":100,"run_output_tokens":10,"run_cost_usd":0.1}
+{"event":"stage_usage","node_id":"impl","input_tokens":200,"output_tokens":20,"cost_usd":0.2,"calls":2,"unpriced_calls":1,"run_input_tokens":300,"run_output_tokens":30,"run_cost_usd":0.3}
+`
+	_ = os.WriteFile(filepath.Join(root, "progress.ndjson"), []byte(ndjson), 0o644)
+
+	s := &Snapshot{LogsRoot: root}
+	if err := ApplyVerbose(s); err != nil {
+		t.Fatalf("ApplyVerbose: %v", err)
+	}
+	if s.Usage == nil {
+		t.Fatal("usage=nil want progress usage")
+	}
+	if s.Usage.InputTokens != 300 || s.Usage.OutputTokens != 30 || s.Usage.CostUSD != 0.3 {
+		t.Fatalf("usage=%+v want latest run totals", s.Usage)
+	}
+	if s.Usage.Calls != 3 || s.Usage.UnpricedCalls != 1 {
+		t.Fatalf("calls=%d unpriced=%d want 3/1", s.Usage.Calls, s.Usage.UnpricedCalls)
+	}
+	if len(s.Usage.Nodes) != 2 || s.Usage.Nodes["plan"].CostUSD != 0.1 {
+		t.Fatalf("nodes=%+v", s.Usage.Nodes)
+	}
+}
+
 func TestLoadSnapshot_TerminalStateIgnoresMalformedPIDFile(t *testing.T) {
 	root := t.TempDir()
 	_ = os.WriteFile(filepath.Join(root, "final.json"), []byte(`{"status":"success","run_id":"r1"}`), 0o644)
@@ -1,6 +1,10 @@
 package runstate
 
-import "time"
+import (
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
 
 type State string
 
@@ -17,6 +21,8 @@ type StageAttempt struct {
 	Attempt       int    `json:"attempt"`
 	MaxAttempts   int    `json:"max_attempts"`
 	FailureReason string `json:"failure_reason,omitempty"`
+	// DurationMS is the time from the attempt's start event to its end event.
+	DurationMS int64 `json:"duration_ms,omitempty"`
 }
 
 type EdgeTransition struct {
@@ -47,4 +53,7 @@ type Snapshot struct {
 	EdgeTrace      []EdgeTransition `json:"edge_trace,omitempty"`
 	PostmortemText string           `json:"postmortem_text,omitempty"`
 	ReviewText     string           `json:"review_text,omitempty"`
+	// Usage is LLM token/cost accounting: from final.json when the run is
+	// terminal, otherwise from the latest stage_usage progress events.
+	Usage *runtime.RunUsage `json:"usage,omitempty"`
 }
@@ -23,6 +23,26 @@ type FinalOutcome struct {
 
 	CXDBContextID  string `json:"cxdb_context_id"`
 	CXDBHeadTurnID string `json:"cxdb_head_turn_id"`
+
+	// Usage is the LLM token and cost accounting for the run, when tracked.
+	Usage *RunUsage `json:"usage,omitempty"`
+}
+
+// UsageTotals aggregates LLM token counts and estimated spend. UnpricedCalls
+// counts calls whose model had no pricing in the model catalog; their tokens
+// are included but they contribute nothing to CostUSD.
+type UsageTotals struct {
+	InputTokens   int64   `json:"input_tokens"`
+	OutputTokens  int64   `json:"output_tokens"`
+	CostUSD       float64 `json:"cost_usd"`
+	Calls         int     `json:"calls"`
+	UnpricedCalls int     `json:"unpriced_calls,omitempty"`
+}
+
+// RunUsage is the run-wide usage total plus the per-node breakdown.
+type RunUsage struct {
+	UsageTotals
+	Nodes map[string]UsageTotals `json:"nodes,omitempty"`
 }
 
 func (fo *FinalOutcome) Save(path string) error {
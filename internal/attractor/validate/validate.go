@@ -1,6 +1,7 @@
 package validate
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
@@ -10,6 +11,8 @@ import (
 	"github.com/danshapiro/kilroy/internal/attractor/modeldb"
 	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 	"github.com/danshapiro/kilroy/internal/attractor/style"
+	"github.com/danshapiro/kilroy/internal/jsonschemautil"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 type Severity string
@@ -28,6 +31,16 @@ type Diagnostic struct {
 	EdgeFrom string   `json:"edge_from,omitempty"`
 	EdgeTo   string   `json:"edge_to,omitempty"`
 	Fix      string   `json:"fix,omitempty"`
+
+	// File and Line point at the declaration of NodeID (or the edge), which
+	// may live in an included fragment rather than the root DOT file.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Location renders File:Line for messages; empty when unknown.
+func (d Diagnostic) Location() string {
+	return model.Position{File: d.File, Line: d.Line}.String()
 }
 
 // LintRule is the interface for custom lint rules that can be passed to
@@ -74,6 +87,12 @@ func ValidateWithOptions(g *model.Graph, opts ValidateOptions, extraRules ...Lin
 	diags = append(diags, lintGoalGateExitStatusContract(g)...)
 	diags = append(diags, lintGoalGatePromptStatusHint(g)...)
 	diags = append(diags, lintFidelityValid(g)...)
+	diags = append(diags, lintSandboxValid(g)...)
+	diags = append(diags, lintFanInMergeMode(g)...)
+	diags = append(diags, lintFanInJudge(g)...)
+	diags = append(diags, lintHumanGate(g)...)
+	diags = append(diags, lintOutputSchema(g)...)
+	diags = append(diags, lintHTTPNode(g)...)
 	diags = append(diags, lintPromptOnCodergenNodes(g)...)
 	diags = append(diags, lintStatusContractInPrompt(g)...)
 	diags = append(diags, lintPromptOnConditionalNodes(g)...)
@@ -99,9 +118,36 @@ func ValidateWithOptions(g *model.Graph, opts ValidateOptions, extraRules ...Lin
 			diags = append(diags, rule.Apply(g)...)
 		}
 	}
+	locateDiagnostics(g, diags)
 	return diags
 }
 
+// locateDiagnostics fills File/Line from the node or edge each diagnostic
+// names, unless the rule already set them.
+func locateDiagnostics(g *model.Graph, diags []Diagnostic) {
+	for i := range diags {
+		d := &diags[i]
+		if d.File != "" || d.Line != 0 {
+			continue
+		}
+		var pos model.Position
+		switch {
+		case d.EdgeFrom != "" && d.EdgeTo != "":
+			for _, e := range g.Outgoing(d.EdgeFrom) {
+				if e != nil && e.To == d.EdgeTo {
+					pos = e.Pos
+					break
+				}
+			}
+		case d.NodeID != "":
+			if n := g.Nodes[d.NodeID]; n != nil {
+				pos = n.Pos
+			}
+		}
+		d.File, d.Line = pos.File, pos.Line
+	}
+}
+
 func ValidateOrError(g *model.Graph, extraRules ...LintRule) error {
 	diags := Validate(g, extraRules...)
 	var errs []string
@@ -337,11 +383,6 @@ func lintConditionSyntax(g *model.Graph) []Diagnostic {
 			})
 			continue
 		}
-		// NOTE: evalClause error paths are unreachable for inputs that pass
-		// validateConditionSyntax above: SplitN(s, op, 2) on a string that
-		// contains op always yields exactly 2 parts. The Evaluate call below
-		// is retained as a forward-compatibility safety net.
-		//
 		// Also ensure our evaluator can process it. Discard the boolean result
 		// (we are linting with a synthetic outcome, so the match value is
 		// meaningless) but treat an error as a lint failure: it means the
@@ -361,13 +402,17 @@ func lintConditionSyntax(g *model.Graph) []Diagnostic {
 }
 
 func validateConditionSyntax(condExpr string) error {
+	if cond.UsesExtendedSyntax(condExpr) {
+		return validateExtendedConditionSyntax(condExpr)
+	}
 	clauses := strings.Split(condExpr, "&&")
 	for _, clause := range clauses {
 		clause = strings.TrimSpace(clause)
 		if clause == "" {
 			continue
 		}
-		// Disallow known future operators so mistakes don't silently "parse" as bare keys.
+		// A lone '|' is almost always a mistyped '||'; don't let it silently
+		// become part of a literal.
 		if strings.ContainsAny(clause, "<>|") {
 			return fmt.Errorf("invalid condition operator in clause %q", clause)
 		}
@@ -405,6 +450,26 @@ func validateConditionSyntax(condExpr string) error {
 	return nil
 }
 
+// validateExtendedConditionSyntax checks expressions that use ||, !,
+// parentheses, or the comparison operators beyond = and !=. The parser
+// reports structural errors; keys are held to the same shape as the base
+// grammar.
+func validateExtendedConditionSyntax(condExpr string) error {
+	expr, err := cond.Parse(condExpr)
+	if err != nil {
+		return err
+	}
+	for _, clause := range expr.Clauses() {
+		if err := validateCondKey(clause.Key); err != nil {
+			return err
+		}
+		if (clause.Op == "=" || clause.Op == "!=") && clause.Literal == "" {
+			return fmt.Errorf("invalid condition clause %q: missing literal", clause.Key+clause.Op)
+		}
+	}
+	return nil
+}
+
 func validateCondKey(key string) error {
 	if key == "" {
 		return fmt.Errorf("invalid condition: empty key")
@@ -760,14 +825,258 @@ func lintFidelityValid(g *model.Graph) []Diagnostic {
 	return diags
 }
 
+// lintFanInMergeMode checks merge_mode on fan-in nodes.
+//
+// Rule: fan_in_merge_mode (ERROR for unknown values, WARNING when set on a
+// node that is not a fan-in)
+func lintFanInMergeMode(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		mode, ok := n.Attrs["merge_mode"]
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(mode)) {
+		case "", "select", "merge_all":
+		default:
+			diags = append(diags, Diagnostic{
+				Rule:     "fan_in_merge_mode",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("invalid merge_mode value %q (want select|merge_all)", mode),
+				NodeID:   id,
+				Fix:      "use merge_mode=merge_all or remove the attribute",
+			})
+			continue
+		}
+		t := strings.TrimSpace(n.Attr("type", ""))
+		if t != "parallel.fan_in" && !(t == "" && n.Shape() == "tripleoctagon") {
+			diags = append(diags, Diagnostic{
+				Rule:     "fan_in_merge_mode",
+				Severity: SeverityWarning,
+				Message:  "merge_mode only applies to fan-in nodes (shape=tripleoctagon) and is ignored here",
+				NodeID:   id,
+			})
+		}
+	}
+	return diags
+}
+
+// lintFanInJudge checks that a fan-in with fan_in.judge_prompt names the
+// judge model and is not in merge_all mode, where there is nothing to pick.
+//
+// Rule: fan_in_judge (ERROR when the model is missing, WARNING with merge_all)
+func lintFanInJudge(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	for id, n := range g.Nodes {
+		if n == nil || strings.TrimSpace(n.Attr("fan_in.judge_prompt", "")) == "" {
+			continue
+		}
+		if strings.TrimSpace(n.Attr("llm_provider", "")) == "" || strings.TrimSpace(n.Attr("llm_model", "")) == "" {
+			diags = append(diags, Diagnostic{
+				Rule:     "fan_in_judge",
+				Severity: SeverityError,
+				Message:  "fan_in.judge_prompt requires llm_provider and llm_model on the fan-in node for the judge call",
+				NodeID:   id,
+				Fix:      "set llm_provider and llm_model on the node or through the model stylesheet",
+			})
+		}
+		if strings.EqualFold(strings.TrimSpace(n.Attr("merge_mode", "")), "merge_all") {
+			diags = append(diags, Diagnostic{
+				Rule:     "fan_in_judge",
+				Severity: SeverityWarning,
+				Message:  "fan_in.judge_prompt is ignored with merge_mode=merge_all, which merges every successful branch",
+				NodeID:   id,
+			})
+		}
+	}
+	return diags
+}
+
+// lintHumanGate checks the typed-question attributes of wait.human nodes.
+//
+// Rule: human_gate (ERROR)
+func lintHumanGate(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	add := func(id, msg, fix string) {
+		diags = append(diags, Diagnostic{Rule: "human_gate", Severity: SeverityError, NodeID: id, Message: msg, Fix: fix})
+	}
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		qtype := strings.ToUpper(strings.TrimSpace(n.Attr("human.question_type", "")))
+		switch qtype {
+		case "", "SINGLE_SELECT", "FREE_TEXT", "CONFIRM", "YES_NO":
+		case "MULTI_SELECT":
+			if strings.TrimSpace(n.Attr("human.options", "")) == "" {
+				add(id, "human.question_type=multi_select requires human.options", `set human.options="first, second, third"`)
+			}
+		default:
+			add(id, fmt.Sprintf("unknown human.question_type %q", n.Attr("human.question_type", "")),
+				"use single_select, multi_select, free_text, confirm or yes_no")
+		}
+		raw := strings.TrimSpace(n.Attr("human.schema", ""))
+		if raw == "" {
+			continue
+		}
+		if qtype != "FREE_TEXT" {
+			add(id, "human.schema only applies to human.question_type=free_text", "set human.question_type=free_text")
+		}
+		var schema map[string]any
+		if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+			add(id, fmt.Sprintf("human.schema is not a JSON object: %v", err), "")
+			continue
+		}
+		if _, err := jsonschemautil.CompileMapSchema(schema, jsonschema.Draft2020); err != nil {
+			add(id, fmt.Sprintf("human.schema does not compile: %v", err), "")
+		}
+	}
+	return diags
+}
+
+// lintOutputSchema checks inline output_schema values. Schema files are read
+// from the worktree at run time, so only inline schemas can be checked here.
+//
+// Rule: output_schema (ERROR)
+func lintOutputSchema(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	add := func(id, msg, fix string) {
+		diags = append(diags, Diagnostic{Rule: "output_schema", Severity: SeverityError, NodeID: id, Message: msg, Fix: fix})
+	}
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		raw := strings.TrimSpace(n.Attr("output_schema", ""))
+		if raw == "" {
+			continue
+		}
+		if !nodeResolvesToCodergen(n) {
+			add(id, "output_schema only applies to codergen nodes", "remove output_schema or use shape=box")
+			continue
+		}
+		if !strings.HasPrefix(raw, "{") {
+			continue
+		}
+		var schema map[string]any
+		if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+			add(id, fmt.Sprintf("output_schema is not a JSON object: %v", err), "")
+			continue
+		}
+		if _, err := jsonschemautil.CompileMapSchema(schema, jsonschema.Draft2020); err != nil {
+			add(id, fmt.Sprintf("output_schema does not compile: %v", err), "")
+		}
+	}
+	return diags
+}
+
+var (
+	httpExpectStatusRE = regexp.MustCompile(`^[1-5][0-9x]{2}$`)
+	httpExtractRE      = regexp.MustCompile(`^[A-Za-z0-9_.-]+\s*=\s*\$(\.[^.\[\]]+|\[\d+\])*$`)
+)
+
+// lintHTTPNode checks the attributes of type=http nodes.
+//
+// Rule: http_node (ERROR)
+func lintHTTPNode(g *model.Graph) []Diagnostic {
+	var diags []Diagnostic
+	add := func(id, msg, fix string) {
+		diags = append(diags, Diagnostic{Rule: "http_node", Severity: SeverityError, NodeID: id, Message: msg, Fix: fix})
+	}
+	for id, n := range g.Nodes {
+		if n == nil || strings.TrimSpace(n.Attr("type", "")) != "http" {
+			continue
+		}
+		if strings.TrimSpace(n.Attr("http.url", "")) == "" {
+			add(id, "http node has no http.url", `set http.url="http://localhost:8080/..."`)
+		}
+		switch strings.ToUpper(strings.TrimSpace(n.Attr("http.method", ""))) {
+		case "", "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		default:
+			add(id, fmt.Sprintf("unknown http.method %q", n.Attr("http.method", "")), "use GET, HEAD, POST, PUT, PATCH, DELETE or OPTIONS")
+		}
+		for _, part := range strings.Split(n.Attr("http.expect_status", ""), ",") {
+			if p := strings.ToLower(strings.TrimSpace(part)); p != "" && !httpExpectStatusRE.MatchString(p) {
+				add(id, fmt.Sprintf("invalid http.expect_status entry %q", part), `use codes or classes, e.g. "200,201" or "2xx"`)
+			}
+		}
+		for _, part := range strings.Split(n.Attr("http.extract", ""), ",") {
+			if p := strings.TrimSpace(part); p != "" && !httpExtractRE.MatchString(p) {
+				add(id, fmt.Sprintf("invalid http.extract entry %q", part), `use key=$.path, e.g. "deploy.id=$.items[0].id"`)
+			}
+		}
+		if raw := strings.TrimSpace(n.Attr("http.headers", "")); strings.HasPrefix(raw, "{") {
+			var headers map[string]string
+			if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+				add(id, fmt.Sprintf("http.headers is not a JSON object of strings: %v", err), `or use one "Name: value" per line`)
+			}
+		}
+	}
+	return diags
+}
+
+// lintSandboxValid rejects unknown sandbox settings up front: the engine
+// refuses to run a stage whose sandbox cannot be resolved. It also rejects
+// sandbox=strict on tool and http nodes, which the engine cannot sandbox and
+// fails rather than run unconfined.
+//
+// Rules: sandbox_valid, sandbox_unsupported (ERROR)
+func lintSandboxValid(g *model.Graph) []Diagnostic {
+	validMode := map[string]bool{"": true, "off": true, "none": true, "false": true, "strict": true}
+	validNetwork := map[string]bool{"": true, "allow": true, "on": true, "deny": true, "none": true, "off": true}
+	check := func(attrs map[string]string, nodeID string) []Diagnostic {
+		var diags []Diagnostic
+		if v := strings.TrimSpace(attrs["sandbox"]); !validMode[strings.ToLower(v)] {
+			diags = append(diags, Diagnostic{
+				Rule:     "sandbox_valid",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("invalid sandbox value %q (want off|strict)", v),
+				NodeID:   nodeID,
+				Fix:      "use sandbox=strict or remove the attribute",
+			})
+		}
+		if v := strings.TrimSpace(attrs["sandbox_network"]); !validNetwork[strings.ToLower(v)] {
+			diags = append(diags, Diagnostic{
+				Rule:     "sandbox_valid",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("invalid sandbox_network value %q (want allow|deny)", v),
+				NodeID:   nodeID,
+			})
+		}
+		return diags
+	}
+	diags := check(g.Attrs, "")
+	for id, n := range g.Nodes {
+		if n == nil {
+			continue
+		}
+		diags = append(diags, check(n.Attrs, id)...)
+		if !strings.EqualFold(strings.TrimSpace(n.Attr("sandbox", "")), "strict") {
+			continue
+		}
+		if nodeResolvesToTool(n) || strings.TrimSpace(n.Attr("type", "")) == "http" {
+			diags = append(diags, Diagnostic{
+				Rule:     "sandbox_unsupported",
+				Severity: SeverityError,
+				Message:  "sandbox=strict cannot be applied to tool or http nodes; only agent_loop codergen stages are sandboxed",
+				NodeID:   id,
+				Fix:      "remove sandbox=strict from this node",
+			})
+		}
+	}
+	return diags
+}
+
 func lintPromptOnCodergenNodes(g *model.Graph) []Diagnostic {
 	var diags []Diagnostic
 	for id, n := range g.Nodes {
 		if n == nil {
 			continue
 		}
-		// Best-effort: default handler is codergen for shape box.
-		if n.Shape() != "box" {
+		if !nodeResolvesToCodergen(n) {
 			continue
 		}
 		if strings.TrimSpace(n.Prompt()) == "" {
@@ -847,7 +1156,7 @@ func lintLLMProviderPresent(g *model.Graph) []Diagnostic {
 		if n == nil {
 			continue
 		}
-		if n.Shape() != "box" {
+		if !nodeResolvesToCodergen(n) {
 			continue
 		}
 		if strings.TrimSpace(n.Attr("llm_provider", "")) == "" {
@@ -922,6 +1231,16 @@ func lintValidateScriptFailureContract(g *model.Graph) []Diagnostic {
 	return diags
 }
 
+// nodeResolvesToCodergen is best-effort: the default handler is codergen for
+// shape box unless a type override routes the node elsewhere (e.g. type=map).
+func nodeResolvesToCodergen(n *model.Node) bool {
+	typeOverride := strings.TrimSpace(n.Attr("type", ""))
+	if typeOverride != "" {
+		return typeOverride == "codergen"
+	}
+	return n.Shape() == "box"
+}
+
 func nodeResolvesToTool(n *model.Node) bool {
 	typeOverride := strings.TrimSpace(n.Attr("type", ""))
 	if typeOverride != "" {
@@ -659,6 +659,13 @@ func TestLintConditionSyntax_ValidConditions(t *testing.T) {
 		"context.failure_class!=transient_infra",
 		"preferred_label=Yes",
 		"my_key=some_value",
+		"outcome=success || outcome=partial_success",
+		"!context.tests_passed",
+		"(outcome=fail || outcome=retry) && context.retries < 3",
+		"context.failed_tests >= 1",
+		"context.summary contains 'tests failed'",
+		"context.failure_class in [transient_infra, budget_exhausted]",
+		"context.branch =~ ^feature/",
 	}
 
 	for _, cond := range validConds {
@@ -686,14 +693,10 @@ digraph G {
 }
 
 // TestLintConditionSyntax_SyntaxRejectsGreaterThanOperator verifies that
-// "outcome>success" produces a condition_syntax ERROR. Note: cond.Evaluate
-// is never reached for inputs that fail validateConditionSyntax, so this
-// test exercises only the syntax-checker path. The Evaluate error paths in
-// evalClause are unreachable for inputs that pass syntax check (SplitN with
-// a known operator always returns exactly 2 parts); the guard remains as a
-// forward-compatibility safety net.
+// "outcome>success" produces a condition_syntax ERROR: ">" is a numeric
+// comparison and "success" is not a number.
 func TestLintConditionSyntax_SyntaxRejectsGreaterThanOperator(t *testing.T) {
-	// Invalid condition: uses ">" which validateConditionSyntax rejects.
+	// Invalid condition: numeric ">" against a non-numeric literal.
 	g, err := dot.Parse([]byte(`
 digraph G {
   start [shape=Mdiamond]
@@ -728,6 +731,26 @@ digraph G {
 	}
 }
 
+func TestLintConditionSyntax_ExtendedGrammarErrors(t *testing.T) {
+	badConds := []string{
+		"outcome=success |",
+		"(outcome=success || outcome=fail",
+		"context.retries < many",
+		"context.branch =~ (",
+		"context.x in [a, b",
+		"context.bad-key > 1",
+		"outcome= || outcome=fail",
+	}
+	for _, c := range badConds {
+		c := c
+		t.Run(c, func(t *testing.T) {
+			if err := validateConditionSyntax(c); err == nil {
+				t.Fatalf("validateConditionSyntax(%q): expected error", c)
+			}
+		})
+	}
+}
+
 func assertHasRule(t *testing.T, diags []Diagnostic, rule string, sev Severity) {
 	t.Helper()
 	for _, d := range diags {
@@ -751,6 +774,157 @@ func assertNoRule(t *testing.T, diags []Diagnostic, rule string) {
 	}
 }
 
+func TestValidate_SandboxValid(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  graph [sandbox=strict]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="x", sandbox=off, sandbox_network=allow]
+  start -> a -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assertNoRule(t, Validate(g), "sandbox_valid")
+
+	g.Nodes["a"].Attrs["sandbox"] = "paranoid"
+	assertHasRule(t, Validate(g), "sandbox_valid", SeverityError)
+}
+
+func TestValidate_SandboxUnsupported(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  graph [sandbox=strict]
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  t [shape=parallelogram, tool_command="make test"]
+  h [type=http, http.url="http://localhost:8080/"]
+  start -> t -> h -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// A graph-wide sandbox covers agent stages only.
+	assertNoRule(t, Validate(g), "sandbox_unsupported")
+
+	g.Nodes["t"].Attrs["sandbox"] = "strict"
+	assertHasRule(t, Validate(g), "sandbox_unsupported", SeverityError)
+	delete(g.Nodes["t"].Attrs, "sandbox")
+	g.Nodes["h"].Attrs["sandbox"] = "strict"
+	assertHasRule(t, Validate(g), "sandbox_unsupported", SeverityError)
+}
+
+func TestValidate_FanInMergeMode(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  par [shape=component]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="a"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="b"]
+  join [shape=tripleoctagon, merge_mode=merge_all]
+  start -> par
+  par -> a -> join
+  par -> b -> join
+  join -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assertNoRule(t, Validate(g), "fan_in_merge_mode")
+
+	g.Nodes["join"].Attrs["merge_mode"] = "octopus"
+	assertHasRule(t, Validate(g), "fan_in_merge_mode", SeverityError)
+
+	g.Nodes["join"].Attrs["merge_mode"] = "merge_all"
+	g.Nodes["a"].Attrs["merge_mode"] = "merge_all"
+	assertHasRule(t, Validate(g), "fan_in_merge_mode", SeverityWarning)
+}
+
+func TestValidate_FanInJudge(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  par [shape=component]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="a"]
+  b [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="b"]
+  join [shape=tripleoctagon, fan_in.judge_prompt="pick the cleanest fix", llm_provider=openai, llm_model=gpt-5.2]
+  start -> par
+  par -> a -> join
+  par -> b -> join
+  join -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assertNoRule(t, Validate(g), "fan_in_judge")
+
+	g.Nodes["join"].Attrs["merge_mode"] = "merge_all"
+	assertHasRule(t, Validate(g), "fan_in_judge", SeverityWarning)
+
+	delete(g.Nodes["join"].Attrs, "llm_model")
+	assertHasRule(t, Validate(g), "fan_in_judge", SeverityError)
+}
+
+func TestValidate_HumanGate(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  ask [shape=hexagon, question="Which database?", human.question_type=free_text, human.input_key=db,
+       human.schema="{\"type\":\"object\",\"required\":[\"engine\"]}"]
+  start -> ask -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assertNoRule(t, Validate(g), "human_gate")
+
+	g.Nodes["ask"].Attrs["human.schema"] = "{not json"
+	assertHasRule(t, Validate(g), "human_gate", SeverityError)
+
+	delete(g.Nodes["ask"].Attrs, "human.schema")
+	g.Nodes["ask"].Attrs["human.question_type"] = "multi_select"
+	assertHasRule(t, Validate(g), "human_gate", SeverityError)
+	g.Nodes["ask"].Attrs["human.options"] = "postgres, sqlite"
+	assertNoRule(t, Validate(g), "human_gate")
+
+	g.Nodes["ask"].Attrs["human.question_type"] = "essay"
+	assertHasRule(t, Validate(g), "human_gate", SeverityError)
+}
+
+func TestValidate_OutputSchema(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  plan [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="plan",
+        output_schema="{\"type\":\"object\",\"required\":[\"risk\"]}"]
+  start -> plan -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assertNoRule(t, Validate(g), "output_schema")
+
+	g.Nodes["plan"].Attrs["output_schema"] = "{\"type\": 7}"
+	assertHasRule(t, Validate(g), "output_schema", SeverityError)
+
+	g.Nodes["plan"].Attrs["output_schema"] = "schemas/plan.json"
+	assertNoRule(t, Validate(g), "output_schema")
+
+	g.Nodes["plan"].Attrs["shape"] = "parallelogram"
+	assertHasRule(t, Validate(g), "output_schema", SeverityError)
+}
+
 // --- Tests for tool_command_abs_path lint rule ---
 
 func TestValidate_ToolCommandAbsPath_WarnsOnCdAbsolutePath(t *testing.T) {
@@ -1831,3 +2005,32 @@ digraph G {
 	diags := Validate(g)
 	assertNoRule(t, diags, "custom_outcome_coverage")
 }
+
+func TestValidate_HTTPNode(t *testing.T) {
+	g, err := dot.Parse([]byte(`
+digraph G {
+  start [shape=Mdiamond]
+  exit  [shape=Msquare]
+  deploy [type=http, http.method=post, http.url="http://localhost:8080/deploy",
+          http.expect_status="200,2xx", http.extract="deploy.id=$.items[0].id, deploy.state=$.state"]
+  start -> deploy -> exit
+}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	diags := Validate(g)
+	assertNoRule(t, diags, "http_node")
+	assertNoRule(t, diags, "llm_provider_required")
+
+	g.Nodes["deploy"].Attrs["http.extract"] = "deploy.id=items.id"
+	assertHasRule(t, Validate(g), "http_node", SeverityError)
+
+	g.Nodes["deploy"].Attrs["http.extract"] = ""
+	g.Nodes["deploy"].Attrs["http.expect_status"] = "ok"
+	assertHasRule(t, Validate(g), "http_node", SeverityError)
+
+	g.Nodes["deploy"].Attrs["http.expect_status"] = ""
+	delete(g.Nodes["deploy"].Attrs, "http.url")
+	assertHasRule(t, Validate(g), "http_node", SeverityError)
+}
@@ -204,6 +204,51 @@ func KilroyAttractorRegistryBundle() (bundleID string, bundle RegistryBundle, sh
 				"4": field("question_text", "string", opt()),
 				"5": fieldSemantic("duration_ms", "u64", "duration_ms", opt()),
 			}),
+			// LLM usage and estimated cost (node totals plus run totals).
+			"com.kilroy.attractor.StageUsage": typeDef(map[string]any{
+				"1":  field("run_id", "string"),
+				"2":  field("node_id", "string"),
+				"3":  fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4":  fieldSemantic("input_tokens", "u64", "count"),
+				"5":  fieldSemantic("output_tokens", "u64", "count"),
+				"6":  field("cost_usd", "f64"),
+				"7":  field("calls", "u32"),
+				"8":  fieldSemantic("run_input_tokens", "u64", "count"),
+				"9":  fieldSemantic("run_output_tokens", "u64", "count"),
+				"10": field("run_cost_usd", "f64"),
+			}),
+			// Manager loop intervention pushed into a supervised child pipeline.
+			"com.kilroy.attractor.ManagerSteer": typeDef(map[string]any{
+				"1": field("run_id", "string"),
+				"2": field("node_id", "string"),
+				"3": fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4": field("cycle", "u32"),
+				"5": field("condition", "string", opt()),
+				"6": field("fidelity", "string", opt()),
+				"7": field("note", "string", opt()),
+				"8": fieldArray("context_updates", "string", opt()),
+			}),
+			// LLM judge verdict for a parallel fan-in (best-of-N selection).
+			"com.kilroy.attractor.FanInJudged": typeDef(map[string]any{
+				"1": field("run_id", "string"),
+				"2": field("node_id", "string"),
+				"3": fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4": field("winner", "string"),
+				"5": fieldArray("scores", "string", opt()),
+				"6": field("rationale", "string", opt()),
+				"7": field("judge_model", "string", opt()),
+				"8": field("fallback_reason", "string", opt()),
+			}),
+			// Stage skipped because a memoized result from an earlier run matched.
+			"com.kilroy.attractor.StageCacheHit": typeDef(map[string]any{
+				"1": field("run_id", "string"),
+				"2": field("node_id", "string"),
+				"3": fieldSemantic("timestamp_ms", "u64", "unix_ms"),
+				"4": field("cache_key", "string"),
+				"5": field("source_run_id", "string", opt()),
+				"6": field("tree_sha", "string", opt()),
+				"7": field("status", "string", opt()),
+			}),
 		},
 		Enums: map[string]any{},
 	}
@@ -29,6 +29,10 @@ func TestKilroyAttractorRegistryBundle_IncludesRequiredTypes(t *testing.T) {
 		"com.kilroy.attractor.Blob",
 		"com.kilroy.attractor.AssistantMessage",
 		"com.kilroy.attractor.Prompt",
+		"com.kilroy.attractor.StageUsage",
+		"com.kilroy.attractor.ManagerSteer",
+		"com.kilroy.attractor.FanInJudged",
+		"com.kilroy.attractor.StageCacheHit",
 	}
 	for _, typ := range required {
 		if _, ok := bundle.Types[typ]; !ok {
@@ -0,0 +1,473 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CassetteMode selects whether a Cassette records live traffic or replays it.
+type CassetteMode string
+
+const (
+	CassetteOff    CassetteMode = "off"
+	CassetteRecord CassetteMode = "record"
+	CassetteReplay CassetteMode = "replay"
+)
+
+// ParseCassetteMode normalizes a mode name; the empty string means off.
+func ParseCassetteMode(s string) (CassetteMode, error) {
+	switch m := CassetteMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "", CassetteOff:
+		return CassetteOff, nil
+	case CassetteRecord, CassetteReplay:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid replay mode %q (want record|replay|off)", s)
+	}
+}
+
+// CassetteOptions tunes how requests are matched.
+type CassetteOptions struct {
+	// Placeholders maps names to run-specific strings (worktree paths, run
+	// IDs). They are replaced with {{cassette:<name>}} in everything written
+	// to the cassette and before hashing, and substituted back on replay, so a
+	// recording can be replayed from a different run directory.
+	Placeholders map[string]string
+
+	// Strict disables the in-order fallback: replay then only serves entries
+	// whose request hash matches exactly.
+	Strict bool
+}
+
+// Cassette is a Middleware that records every Complete/Stream call to a JSONL
+// file, or replays those recordings without calling the provider.
+//
+// Each entry is keyed by a SHA-256 of the request (after placeholder
+// substitution). Replay serves the first unused entry with that key; when the
+// request has drifted (e.g. a timestamp in a system prompt) it falls back to
+// the next unused entry for the same provider and model, in recorded order.
+type Cassette struct {
+	path  string
+	mode  CassetteMode
+	opts  CassetteOptions
+	repls []cassettePlaceholder
+
+	mu      sync.Mutex
+	entries []*cassetteEntry
+	used    []bool
+}
+
+type cassettePlaceholder struct {
+	token string
+	value string
+}
+
+type cassetteEntry struct {
+	Key      string          `json:"key"`
+	Kind     string          `json:"kind"` // complete|stream
+	Provider string          `json:"provider"`
+	Model    string          `json:"model"`
+	Request  json.RawMessage `json:"request"`
+	Response *Response       `json:"response,omitempty"`
+	Events   []cassetteEvent `json:"events,omitempty"`
+	Error    *cassetteError  `json:"error,omitempty"`
+}
+
+type cassetteEvent struct {
+	StreamEvent
+	Error *cassetteError `json:"error,omitempty"`
+}
+
+// cassetteError preserves enough of an Error to rebuild the same concrete
+// type, so retry and failover decisions replay identically.
+type cassetteError struct {
+	Type         string `json:"type"`
+	Provider     string `json:"provider,omitempty"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	Message      string `json:"message"`
+	Retryable    bool   `json:"retryable,omitempty"`
+	RetryAfterMS *int64 `json:"retry_after_ms,omitempty"`
+}
+
+const (
+	cassetteKindComplete = "complete"
+	cassetteKindStream   = "stream"
+)
+
+// NewCassette opens path for mode. Record truncates any existing cassette;
+// replay loads it and fails if it is missing.
+func NewCassette(path string, mode CassetteMode, opts CassetteOptions) (*Cassette, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("cassette path is required")
+	}
+	c := &Cassette{path: path, mode: mode, opts: opts}
+	for name, v := range opts.Placeholders {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		c.repls = append(c.repls, cassettePlaceholder{token: "{{cassette:" + name + "}}", value: v})
+	}
+	// Longest first, so a worktree inside the logs root is matched whole.
+	sort.Slice(c.repls, func(i, j int) bool {
+		if len(c.repls[i].value) != len(c.repls[j].value) {
+			return len(c.repls[i].value) > len(c.repls[j].value)
+		}
+		return c.repls[i].token < c.repls[j].token
+	})
+
+	switch mode {
+	case CassetteRecord:
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			return nil, err
+		}
+	case CassetteReplay:
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cassette mode %q does not use a cassette", mode)
+	}
+	return c, nil
+}
+
+// Len returns the number of entries loaded for replay.
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *Cassette) WrapComplete(next CompleteFunc) CompleteFunc {
+	return func(ctx context.Context, req Request) (Response, error) {
+		key, reqJSON, err := c.requestKey(req)
+		if err != nil {
+			return Response{}, err
+		}
+		if c.mode == CassetteReplay {
+			e, err := c.take(cassetteKindComplete, key, req)
+			if err != nil {
+				return Response{}, err
+			}
+			if e.Error != nil {
+				return Response{}, e.Error.toError()
+			}
+			if e.Response == nil {
+				return Response{}, fmt.Errorf("cassette: entry %s has no response", e.Key)
+			}
+			return *e.Response, nil
+		}
+
+		resp, callErr := next(ctx, req)
+		if ctx.Err() != nil {
+			// Cancellation is not part of the provider's behaviour.
+			return resp, callErr
+		}
+		e := &cassetteEntry{Key: key, Kind: cassetteKindComplete, Provider: req.Provider, Model: req.Model, Request: reqJSON}
+		if callErr != nil {
+			e.Error = newCassetteError(callErr)
+		} else {
+			r := resp
+			e.Response = &r
+		}
+		if err := c.append(e); err != nil {
+			return resp, fmt.Errorf("cassette: record: %w", err)
+		}
+		return resp, callErr
+	}
+}
+
+func (c *Cassette) WrapStream(next StreamFunc) StreamFunc {
+	return func(ctx context.Context, req Request) (Stream, error) {
+		key, reqJSON, err := c.requestKey(req)
+		if err != nil {
+			return nil, err
+		}
+		if c.mode == CassetteReplay {
+			e, err := c.take(cassetteKindStream, key, req)
+			if err != nil {
+				return nil, err
+			}
+			if e.Error != nil {
+				return nil, e.Error.toError()
+			}
+			out := NewChanStream(nil)
+			go func() {
+				defer out.CloseSend()
+				for _, ev := range e.Events {
+					se := ev.StreamEvent
+					if ev.Error != nil {
+						se.Err = ev.Error.toError()
+					}
+					out.Send(se)
+				}
+			}()
+			return out, nil
+		}
+
+		inner, callErr := next(ctx, req)
+		e := &cassetteEntry{Key: key, Kind: cassetteKindStream, Provider: req.Provider, Model: req.Model, Request: reqJSON}
+		if callErr != nil {
+			if ctx.Err() == nil {
+				e.Error = newCassetteError(callErr)
+				if err := c.append(e); err != nil {
+					return nil, fmt.Errorf("cassette: record: %w", err)
+				}
+			}
+			return nil, callErr
+		}
+		var abandoned atomic.Bool
+		out := NewChanStream(func() {
+			abandoned.Store(true)
+			_ = inner.Close()
+		})
+		go func() {
+			defer out.CloseSend()
+			for ev := range inner.Events() {
+				ce := cassetteEvent{StreamEvent: ev}
+				if ev.Err != nil {
+					ce.Error = newCassetteError(ev.Err)
+				}
+				e.Events = append(e.Events, ce)
+				out.Send(ev)
+			}
+			// Only complete streams are replayable.
+			if !abandoned.Load() && ctx.Err() == nil {
+				_ = c.append(e)
+			}
+		}()
+		return out, nil
+	}
+}
+
+// requestKey hashes the request with run-specific strings replaced, and
+// returns the redacted request JSON for the cassette.
+func (c *Cassette) requestKey(req Request) (string, json.RawMessage, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("cassette: encode request: %w", err)
+	}
+	b = c.redact(b)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), b, nil
+}
+
+func (c *Cassette) take(kind, key string, req Request) (*cassetteEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, e := range c.entries {
+		if !c.used[i] && e.Kind == kind && e.Key == key {
+			c.used[i] = true
+			return e, nil
+		}
+	}
+	if !c.opts.Strict {
+		for i, e := range c.entries {
+			if !c.used[i] && e.Kind == kind && e.Provider == req.Provider && e.Model == req.Model {
+				c.used[i] = true
+				return e, nil
+			}
+		}
+	}
+	return nil, &ConfigurationError{Message: fmt.Sprintf("cassette %s has no recording left for %s request to %s/%s (key %s)", c.path, kind, req.Provider, req.Model, shortKey(key))}
+}
+
+func (c *Cassette) append(e *cassetteEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(c.redact(b), '\n')
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *Cassette) load() error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e cassetteEntry
+		if err := json.Unmarshal(c.restore(raw), &e); err != nil {
+			return fmt.Errorf("cassette %s line %d: %w", c.path, line, err)
+		}
+		c.entries = append(c.entries, &e)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("cassette %s: %w", c.path, err)
+	}
+	c.used = make([]bool, len(c.entries))
+	return nil
+}
+
+// redact swaps placeholder values for tokens in JSON text. Values are matched
+// in their JSON-escaped form.
+func (c *Cassette) redact(b []byte) []byte {
+	for _, r := range c.repls {
+		b = bytes.ReplaceAll(b, jsonEscaped(r.value), []byte(r.token))
+	}
+	return b
+}
+
+// restore is the inverse of redact, using the current run's values.
+func (c *Cassette) restore(b []byte) []byte {
+	for _, r := range c.repls {
+		b = bytes.ReplaceAll(b, []byte(r.token), jsonEscaped(r.value))
+	}
+	return b
+}
+
+func jsonEscaped(s string) []byte {
+	b, _ := json.Marshal(s)
+	return b[1 : len(b)-1]
+}
+
+func shortKey(k string) string {
+	if len(k) > 12 {
+		return k[:12]
+	}
+	return k
+}
+
+func newCassetteError(err error) *cassetteError {
+	ce := &cassetteError{Type: "error", Message: err.Error()}
+	var le Error
+	if errors.As(err, &le) {
+		ce.Provider = le.Provider()
+		ce.StatusCode = le.StatusCode()
+		ce.Retryable = le.Retryable()
+		if ra := le.RetryAfter(); ra != nil {
+			ms := ra.Milliseconds()
+			ce.RetryAfterMS = &ms
+		}
+	}
+	var base *httpErrorBase
+	switch e := err.(type) {
+	case *ConfigurationError:
+		ce.Type, ce.Message = "configuration", e.Message
+	case *InvalidRequestError:
+		ce.Type, base = "invalid_request", &e.httpErrorBase
+	case *AuthenticationError:
+		ce.Type, base = "authentication", &e.httpErrorBase
+	case *AccessDeniedError:
+		ce.Type, base = "access_denied", &e.httpErrorBase
+	case *NotFoundError:
+		ce.Type, base = "not_found", &e.httpErrorBase
+	case *RequestTimeoutError:
+		ce.Type, base = "request_timeout", &e.httpErrorBase
+	case *ContextLengthError:
+		ce.Type, base = "context_length", &e.httpErrorBase
+	case *ContentFilterError:
+		ce.Type, base = "content_filter", &e.httpErrorBase
+	case *QuotaExceededError:
+		ce.Type, base = "quota_exceeded", &e.httpErrorBase
+	case *RateLimitError:
+		ce.Type, base = "rate_limit", &e.httpErrorBase
+	case *ServerError:
+		ce.Type, base = "server", &e.httpErrorBase
+	case *UnknownHTTPError:
+		ce.Type, base = "unknown_http", &e.httpErrorBase
+	}
+	if base != nil {
+		ce.Message = base.message
+	}
+	return ce
+}
+
+func (ce *cassetteError) toError() error {
+	var ra *time.Duration
+	if ce.RetryAfterMS != nil {
+		d := time.Duration(*ce.RetryAfterMS) * time.Millisecond
+		ra = &d
+	}
+	base := httpErrorBase{
+		provider:   ce.Provider,
+		statusCode: ce.StatusCode,
+		message:    ce.Message,
+		retryable:  ce.Retryable,
+		retryAfter: ra,
+	}
+	switch ce.Type {
+	case "configuration":
+		return &ConfigurationError{Message: ce.Message}
+	case "invalid_request":
+		return &InvalidRequestError{base}
+	case "authentication":
+		return &AuthenticationError{base}
+	case "access_denied":
+		return &AccessDeniedError{base}
+	case "not_found":
+		return &NotFoundError{base}
+	case "request_timeout":
+		return &RequestTimeoutError{base}
+	case "context_length":
+		return &ContextLengthError{base}
+	case "content_filter":
+		return &ContentFilterError{base}
+	case "quota_exceeded":
+		return &QuotaExceededError{base}
+	case "rate_limit":
+		return &RateLimitError{base}
+	case "server":
+		return &ServerError{base}
+	case "unknown_http":
+		return &UnknownHTTPError{base}
+	default:
+		return errors.New(ce.Message)
+	}
+}
+
+// replayProviderAdapter stands in for a real adapter during replay so the
+// Client can route requests to the cassette without credentials.
+type replayProviderAdapter struct{ name string }
+
+// NewReplayProviderAdapter returns an adapter that never reaches the network.
+// It only answers if a request slips past the replay Cassette.
+func NewReplayProviderAdapter(name string) ProviderAdapter {
+	return &replayProviderAdapter{name: name}
+}
+
+func (a *replayProviderAdapter) Name() string { return a.name }
+
+func (a *replayProviderAdapter) Complete(ctx context.Context, req Request) (Response, error) {
+	return Response{}, &ConfigurationError{Message: fmt.Sprintf("provider %s is in replay mode; live calls are disabled", a.name)}
+}
+
+func (a *replayProviderAdapter) Stream(ctx context.Context, req Request) (Stream, error) {
+	return nil, &ConfigurationError{Message: fmt.Sprintf("provider %s is in replay mode; live calls are disabled", a.name)}
+}
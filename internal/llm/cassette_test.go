@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type cassetteAdapter struct {
+	calls int
+	fail  error
+}
+
+func (a *cassetteAdapter) Name() string { return "openai" }
+func (a *cassetteAdapter) Complete(ctx context.Context, req Request) (Response, error) {
+	a.calls++
+	if a.fail != nil {
+		return Response{}, a.fail
+	}
+	return Response{Provider: "openai", Model: req.Model, Message: Assistant("echo: " + req.Messages[0].Text())}, nil
+}
+func (a *cassetteAdapter) Stream(ctx context.Context, req Request) (Stream, error) {
+	a.calls++
+	s := NewChanStream(nil)
+	go func() {
+		defer s.CloseSend()
+		s.Send(StreamEvent{Type: StreamEventTextDelta, Delta: "he"})
+		s.Send(StreamEvent{Type: StreamEventTextDelta, Delta: "llo"})
+		s.Send(StreamEvent{Type: StreamEventError, Err: ErrorFromHTTPStatus("openai", 503, "overloaded", nil, nil)})
+	}()
+	return s, nil
+}
+
+func newCassetteClient(t *testing.T, path string, mode CassetteMode, opts CassetteOptions, a ProviderAdapter) *Client {
+	t.Helper()
+	cas, err := NewCassette(path, mode, opts)
+	if err != nil {
+		t.Fatalf("NewCassette: %v", err)
+	}
+	c := NewClient()
+	c.Register(a)
+	c.Use(cas)
+	return c
+}
+
+func TestParseCassetteMode(t *testing.T) {
+	for in, want := range map[string]CassetteMode{"": CassetteOff, "OFF": CassetteOff, "record": CassetteRecord, " replay ": CassetteReplay} {
+		got, err := ParseCassetteMode(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseCassetteMode(%q)=%q,%v want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCassetteMode("rewind"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
+
+func TestCassette_RecordThenReplay_CompleteAndStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm.cassette.jsonl")
+	live := &cassetteAdapter{}
+	rec := newCassetteClient(t, path, CassetteRecord, CassetteOptions{Placeholders: map[string]string{"worktree": "/runs/a/worktree"}}, live)
+
+	req := Request{Provider: "openai", Model: "m", Messages: []Message{User("edit /runs/a/worktree/main.go")}}
+	resp, err := rec.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("record Complete: %v", err)
+	}
+	st, err := rec.Stream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("record Stream: %v", err)
+	}
+	for range st.Events() {
+	}
+	_ = st.Close()
+
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "/runs/a/worktree") || !strings.Contains(string(b), "{{cassette:worktree}}") {
+		t.Fatalf("cassette should store placeholders, not run paths:\n%s", b)
+	}
+
+	// Replay from a different run directory with no live provider calls.
+	offline := NewReplayProviderAdapter("openai")
+	rep := newCassetteClient(t, path, CassetteReplay, CassetteOptions{Strict: true, Placeholders: map[string]string{"worktree": "/runs/b/worktree"}}, offline)
+	req.Messages = []Message{User("edit /runs/b/worktree/main.go")}
+	got, err := rep.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("replay Complete: %v", err)
+	}
+	if want := strings.ReplaceAll(resp.Text(), "/runs/a/", "/runs/b/"); got.Text() != want {
+		t.Fatalf("replayed text=%q want %q", got.Text(), want)
+	}
+
+	st, err = rep.Stream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("replay Stream: %v", err)
+	}
+	var text string
+	var streamErr error
+	for ev := range st.Events() {
+		text += ev.Delta
+		if ev.Err != nil {
+			streamErr = ev.Err
+		}
+	}
+	_ = st.Close()
+	var se *ServerError
+	if text != "hello" || !errors.As(streamErr, &se) || se.StatusCode() != 503 || !se.Retryable() {
+		t.Fatalf("replayed stream text=%q err=%#v", text, streamErr)
+	}
+	if live.calls != 2 {
+		t.Fatalf("live calls=%d want 2 (recording only)", live.calls)
+	}
+
+	// The cassette is exhausted: further calls miss instead of going live.
+	if _, err := rep.Complete(context.Background(), req); err == nil || !strings.Contains(err.Error(), "no recording left") {
+		t.Fatalf("expected cassette miss, got %v", err)
+	}
+}
+
+func TestCassette_ReplaysRecordedErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.jsonl")
+	rec := newCassetteClient(t, path, CassetteRecord, CassetteOptions{}, &cassetteAdapter{fail: ErrorFromHTTPStatus("openai", 400, "context too long: maximum context length exceeded", nil, nil)})
+	req := Request{Provider: "openai", Model: "m", Messages: []Message{User("hi")}}
+	if _, err := rec.Complete(context.Background(), req); err == nil {
+		t.Fatalf("expected recorded error")
+	}
+
+	rep := newCassetteClient(t, path, CassetteReplay, CassetteOptions{}, NewReplayProviderAdapter("openai"))
+	_, err := rep.Complete(context.Background(), req)
+	var cle *ContextLengthError
+	if !errors.As(err, &cle) || cle.StatusCode() != 400 {
+		t.Fatalf("replayed err=%#v want *ContextLengthError", err)
+	}
+}
+
+func TestCassette_FallsBackToRecordedOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.jsonl")
+	rec := newCassetteClient(t, path, CassetteRecord, CassetteOptions{}, &cassetteAdapter{})
+	for _, p := range []string{"first", "second"} {
+		if _, err := rec.Complete(context.Background(), Request{Provider: "openai", Model: "m", Messages: []Message{User(p)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rep := newCassetteClient(t, path, CassetteReplay, CassetteOptions{}, NewReplayProviderAdapter("openai"))
+	// "second" matches exactly; the drifted prompt then takes the remaining entry.
+	r1, err := rep.Complete(context.Background(), Request{Provider: "openai", Model: "m", Messages: []Message{User("second")}})
+	if err != nil || r1.Text() != "echo: second" {
+		t.Fatalf("exact match: %q %v", r1.Text(), err)
+	}
+	r2, err := rep.Complete(context.Background(), Request{Provider: "openai", Model: "m", Messages: []Message{User("first, reworded")}})
+	if err != nil || r2.Text() != "echo: first" {
+		t.Fatalf("ordered fallback: %q %v", r2.Text(), err)
+	}
+
+	strict := newCassetteClient(t, path, CassetteReplay, CassetteOptions{Strict: true}, NewReplayProviderAdapter("openai"))
+	if _, err := strict.Complete(context.Background(), Request{Provider: "openai", Model: "m", Messages: []Message{User("first, reworded")}}); err == nil {
+		t.Fatalf("strict replay should not fall back")
+	}
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scope names a class of API operations a credential may perform.
+type Scope string
+
+const (
+	ScopeSubmit Scope = "submit"
+	ScopeRead   Scope = "read"
+	ScopeAnswer Scope = "answer"
+	ScopeCancel Scope = "cancel"
+
+	// scopeAll grants every scope.
+	scopeAll Scope = "*"
+)
+
+var allScopes = []Scope{ScopeSubmit, ScopeRead, ScopeAnswer, ScopeCancel}
+
+// AuthConfig enables authentication for the server. It is loaded with
+// LoadAuthConfig from the file passed to `attractor serve --auth-config`.
+type AuthConfig struct {
+	// Tokens are accepted as "Authorization: Bearer <token>" or
+	// "X-API-Key: <token>".
+	Tokens []TokenConfig `yaml:"tokens" json:"tokens"`
+	// Clients map verified client certificate common names to scopes. They
+	// require tls.client_ca_file.
+	Clients []ClientCertConfig `yaml:"clients" json:"clients"`
+	// AllowedDirs restricts dot_source_path and config_path in requests, and
+	// the include src and prompt_file paths their graphs read, to files under
+	// these directories. Empty allows any path.
+	AllowedDirs []string  `yaml:"allowed_dirs" json:"allowed_dirs"`
+	TLS         TLSConfig `yaml:"tls" json:"tls"`
+	// AuditLog is a file that rejected requests are appended to as JSON
+	// lines. Empty logs them to stderr.
+	AuditLog string `yaml:"audit_log" json:"audit_log"`
+
+	clientCAs *x509.CertPool
+}
+
+type TokenConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Exactly one of Token or TokenEnv is set. TokenEnv names an environment
+	// variable read at load time, which keeps secrets out of the file.
+	Token    string  `yaml:"token" json:"token"`
+	TokenEnv string  `yaml:"token_env" json:"token_env"`
+	Scopes   []Scope `yaml:"scopes" json:"scopes"`
+}
+
+type ClientCertConfig struct {
+	CommonName string  `yaml:"common_name" json:"common_name"`
+	Scopes     []Scope `yaml:"scopes" json:"scopes"`
+}
+
+// TLSConfig serves the API over TLS. Setting ClientCAFile requires every
+// client to present a certificate signed by that CA (mTLS).
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file" json:"cert_file"`
+	KeyFile      string `yaml:"key_file" json:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file" json:"client_ca_file"`
+}
+
+// LoadAuthConfig reads and validates an auth config file. Token environment
+// variables are resolved and allowed directories are made absolute here, so
+// a config that loads cleanly is ready to serve.
+func LoadAuthConfig(path string) (*AuthConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg AuthConfig
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("auth config %s: %w", path, err)
+	}
+	if err := cfg.normalize(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("auth config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *AuthConfig) normalize(baseDir string) error {
+	if len(c.Tokens) == 0 && len(c.Clients) == 0 {
+		return fmt.Errorf("no tokens or clients configured")
+	}
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+
+	names := map[string]bool{}
+	secrets := map[string]bool{}
+	for i := range c.Tokens {
+		t := &c.Tokens[i]
+		t.Name = strings.TrimSpace(t.Name)
+		if t.Name == "" {
+			return fmt.Errorf("tokens[%d]: name is required", i)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("tokens[%d]: duplicate name %q", i, t.Name)
+		}
+		names[t.Name] = true
+		switch {
+		case t.Token != "" && t.TokenEnv != "":
+			return fmt.Errorf("token %q: set token or token_env, not both", t.Name)
+		case t.TokenEnv != "":
+			t.Token = strings.TrimSpace(os.Getenv(t.TokenEnv))
+			if t.Token == "" {
+				return fmt.Errorf("token %q: environment variable %s is not set", t.Name, t.TokenEnv)
+			}
+		case strings.TrimSpace(t.Token) == "":
+			return fmt.Errorf("token %q: token or token_env is required", t.Name)
+		}
+		if secrets[t.Token] {
+			return fmt.Errorf("token %q: same secret as another token", t.Name)
+		}
+		secrets[t.Token] = true
+		scopes, err := normalizeScopes(t.Scopes)
+		if err != nil {
+			return fmt.Errorf("token %q: %w", t.Name, err)
+		}
+		t.Scopes = scopes
+	}
+
+	c.TLS.CertFile = resolve(c.TLS.CertFile)
+	c.TLS.KeyFile = resolve(c.TLS.KeyFile)
+	c.TLS.ClientCAFile = resolve(c.TLS.ClientCAFile)
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.ClientCAFile != "" {
+		if c.TLS.CertFile == "" {
+			return fmt.Errorf("tls.client_ca_file requires tls.cert_file and tls.key_file")
+		}
+		pem, err := os.ReadFile(c.TLS.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls.client_ca_file: %w", err)
+		}
+		c.clientCAs = x509.NewCertPool()
+		if !c.clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls.client_ca_file: no certificates found in %s", c.TLS.ClientCAFile)
+		}
+	}
+	if len(c.Clients) > 0 && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("clients require tls.client_ca_file")
+	}
+	cns := map[string]bool{}
+	for i := range c.Clients {
+		cl := &c.Clients[i]
+		cl.CommonName = strings.TrimSpace(cl.CommonName)
+		if cl.CommonName == "" {
+			return fmt.Errorf("clients[%d]: common_name is required", i)
+		}
+		if cns[cl.CommonName] {
+			return fmt.Errorf("clients[%d]: duplicate common_name %q", i, cl.CommonName)
+		}
+		cns[cl.CommonName] = true
+		scopes, err := normalizeScopes(cl.Scopes)
+		if err != nil {
+			return fmt.Errorf("client %q: %w", cl.CommonName, err)
+		}
+		cl.Scopes = scopes
+	}
+
+	for i, d := range c.AllowedDirs {
+		abs, err := filepath.Abs(resolve(strings.TrimSpace(d)))
+		if err != nil {
+			return fmt.Errorf("allowed_dirs[%d]: %w", i, err)
+		}
+		real, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			return fmt.Errorf("allowed_dirs[%d]: %w", i, err)
+		}
+		c.AllowedDirs[i] = real
+	}
+	c.AuditLog = resolve(c.AuditLog)
+	return nil
+}
+
+func normalizeScopes(in []Scope) ([]Scope, error) {
+	if len(in) == 0 {
+		return nil, fmt.Errorf("scopes are required (%s or *)", scopeList(allScopes))
+	}
+	var out []Scope
+	seen := map[Scope]bool{}
+	for _, s := range in {
+		s = Scope(strings.ToLower(strings.TrimSpace(string(s))))
+		switch s {
+		case scopeAll:
+			return append([]Scope(nil), allScopes...), nil
+		case ScopeSubmit, ScopeRead, ScopeAnswer, ScopeCancel:
+		default:
+			return nil, fmt.Errorf("unknown scope %q (want %s or *)", s, scopeList(allScopes))
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func scopeList(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, "|")
+}
+
+// tlsConfig returns the listener TLS settings, or nil to serve plain HTTP.
+func (c *AuthConfig) tlsConfig() *tls.Config {
+	if c == nil || c.TLS.CertFile == "" {
+		return nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.clientCAs != nil {
+		cfg.ClientCAs = c.clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+type principal struct {
+	name   string
+	scopes map[Scope]bool
+}
+
+func newPrincipal(name string, scopes []Scope) principal {
+	p := principal{name: name, scopes: map[Scope]bool{}}
+	for _, s := range scopes {
+		p.scopes[s] = true
+	}
+	return p
+}
+
+// authenticator checks credentials and scopes for every protected route.
+// Tokens are looked up by SHA-256 digest so secrets are never compared
+// byte-by-byte.
+type authenticator struct {
+	tokens      map[[32]byte]principal
+	clients     map[string]principal
+	allowedDirs []string
+	audit       *log.Logger
+}
+
+func newAuthenticator(cfg *AuthConfig, audit io.Writer) *authenticator {
+	a := &authenticator{
+		tokens:      map[[32]byte]principal{},
+		clients:     map[string]principal{},
+		allowedDirs: cfg.AllowedDirs,
+		audit:       log.New(audit, "", 0),
+	}
+	for _, t := range cfg.Tokens {
+		a.tokens[sha256.Sum256([]byte(t.Token))] = newPrincipal("token:"+t.Name, t.Scopes)
+	}
+	for _, c := range cfg.Clients {
+		a.clients[c.CommonName] = newPrincipal("cert:"+c.CommonName, c.Scopes)
+	}
+	return a
+}
+
+func (a *authenticator) identify(r *http.Request, allowQuery bool) (principal, bool, string) {
+	token := ""
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, rest, _ := strings.Cut(h, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return principal{}, false, "unsupported authorization scheme"
+		}
+		token = strings.TrimSpace(rest)
+	} else {
+		token = strings.TrimSpace(r.Header.Get("X-API-Key"))
+	}
+	if token == "" && allowQuery {
+		token = strings.TrimSpace(r.URL.Query().Get(accessTokenParam))
+	}
+	if token != "" {
+		p, ok := a.tokens[sha256.Sum256([]byte(token))]
+		if !ok {
+			return principal{}, false, "invalid token"
+		}
+		return p, true, ""
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if p, ok := a.clients[cn]; ok {
+			return p, true, ""
+		}
+		return principal{}, false, fmt.Sprintf("client certificate %q is not configured", cn)
+	}
+	return principal{}, false, "missing credentials"
+}
+
+// errPathNotAllowed marks paths outside the allowed directories.
+var errPathNotAllowed = errors.New("outside the allowed directories")
+
+// readFile reads a file a graph refers to (an include fragment or
+// prompt_file) if it lies inside the allowed directories.
+func (a *authenticator) readFile(path string) ([]byte, error) {
+	if err := a.checkPath(path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// checkPath reports whether a request path resolves under an allowed
+// directory. Symlinks are resolved so a link cannot point outside.
+func (a *authenticator) checkPath(p string) error {
+	if len(a.allowedDirs) == 0 {
+		return nil
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %w", p, err)
+	}
+	for _, dir := range a.allowedDirs {
+		if rel, err := filepath.Rel(dir, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is %w", p, errPathNotAllowed)
+}
+
+// reject writes an error response and appends an audit record.
+func (a *authenticator) reject(w http.ResponseWriter, r *http.Request, status int, who, reason string) {
+	rec := map[string]any{
+		"ts":     time.Now().UTC().Format(time.RFC3339Nano),
+		"event":  "request_rejected",
+		"status": status,
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"remote": r.RemoteAddr,
+		"reason": reason,
+	}
+	if who != "" {
+		rec["principal"] = who
+	}
+	if b, err := json.Marshal(rec); err == nil {
+		a.audit.Print(string(b))
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kilroy"`)
+	}
+	writeError(w, status, reason)
+}
+
+// accessTokenParam carries a token in the query string for the routes a
+// browser opens directly (the graph page and its EventSource), which cannot
+// set auth headers.
+const accessTokenParam = "access_token"
+
+// require wraps h so it only runs for callers holding scope. Without an
+// auth config every request is allowed, as before.
+func (s *Server) require(scope Scope, h http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuth(scope, false, h)
+}
+
+// requireView is require for browser-facing GET routes: it also accepts
+// the token as ?access_token=.
+func (s *Server) requireView(scope Scope, h http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuth(scope, true, h)
+}
+
+func (s *Server) requireAuth(scope Scope, allowQuery bool, h http.HandlerFunc) http.HandlerFunc {
+	if s.auth == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok, reason := s.auth.identify(r, allowQuery)
+		if !ok {
+			s.auth.reject(w, r, http.StatusUnauthorized, "", reason)
+			return
+		}
+		if !p.scopes[scope] {
+			s.auth.reject(w, r, http.StatusForbidden, p.name, fmt.Sprintf("%s lacks scope %q", p.name, scope))
+			return
+		}
+		h(w, r.WithContext(withPrincipal(r.Context(), p.name)))
+	}
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, principalKey{}, name)
+}
+
+func principalName(ctx context.Context) string {
+	name, _ := ctx.Value(principalKey{}).(string)
+	return name
+}
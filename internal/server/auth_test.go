@@ -0,0 +1,360 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAuthTestServer(t *testing.T, auth *AuthConfig) (*Server, *httptest.Server, *bytes.Buffer) {
+	t.Helper()
+	audit := &bytes.Buffer{}
+	srv := New(Config{Addr: ":0", Auth: auth, AuditLog: audit})
+	ts := httptest.NewServer(srv.httpSrv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown()
+	})
+	return srv, ts, audit
+}
+
+func doAuthRequest(t *testing.T, method, url, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func writeAuthConfig(t *testing.T, src string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "auth.yaml")
+	if err := os.WriteFile(p, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadAuthConfig_ResolvesTokenEnvAndScopes(t *testing.T) {
+	t.Setenv("KILROY_TEST_CI_TOKEN", "s3cret")
+	cfg, err := LoadAuthConfig(writeAuthConfig(t, `
+tokens:
+  - name: ci
+    token_env: KILROY_TEST_CI_TOKEN
+    scopes: [submit, read]
+  - name: admin
+    token: adm1n
+    scopes: ["*"]
+audit_log: audit.jsonl
+`))
+	if err != nil {
+		t.Fatalf("LoadAuthConfig: %v", err)
+	}
+	if cfg.Tokens[0].Token != "s3cret" {
+		t.Fatalf("token_env not resolved: %+v", cfg.Tokens[0])
+	}
+	if len(cfg.Tokens[1].Scopes) != len(allScopes) {
+		t.Fatalf("* should expand to all scopes: %v", cfg.Tokens[1].Scopes)
+	}
+	if !filepath.IsAbs(cfg.AuditLog) {
+		t.Fatalf("audit_log should resolve relative to the config: %q", cfg.AuditLog)
+	}
+}
+
+func TestLoadAuthConfig_RejectsInvalidConfigs(t *testing.T) {
+	cases := map[string]string{
+		"no tokens or clients":    `allowed_dirs: [/tmp]`,
+		`unknown scope "delete"`:  "tokens: [{name: a, token: x, scopes: [delete]}]",
+		"scopes are required":     "tokens: [{name: a, token: x}]",
+		"KILROY_TEST_UNSET_TOKEN": "tokens: [{name: a, token_env: KILROY_TEST_UNSET_TOKEN, scopes: [read]}]",
+		"same secret":             "tokens: [{name: a, token: x, scopes: [read]}, {name: b, token: x, scopes: [read]}]",
+		"clients require tls":     "clients: [{common_name: ci, scopes: [read]}]",
+		"must be set together":    "tokens: [{name: a, token: x, scopes: [read]}]\ntls: {cert_file: c.pem}",
+		"field bogus not found":   "bogus: 1",
+	}
+	for want, src := range cases {
+		if _, err := LoadAuthConfig(writeAuthConfig(t, src)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("config %q: err=%v want %q", src, err, want)
+		}
+	}
+}
+
+func TestAuth_RequiresCredentialsAndScopes(t *testing.T) {
+	srv, ts, audit := newAuthTestServer(t, &AuthConfig{Tokens: []TokenConfig{
+		{Name: "reader", Token: "read-tok", Scopes: []Scope{ScopeRead}},
+		{Name: "ops", Token: "ops-tok", Scopes: []Scope{ScopeRead, ScopeCancel}},
+	}})
+	registerTestPipeline(t, srv, "run-auth")
+
+	if resp := doAuthRequest(t, "GET", ts.URL+"/health", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("health should stay open, got %d", resp.StatusCode)
+	}
+	resp := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-auth", "", nil)
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("missing credentials: status=%d", resp.StatusCode)
+	}
+	if resp := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-auth", "", map[string]string{"Authorization": "Bearer nope"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad token: status=%d", resp.StatusCode)
+	}
+	if resp := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-auth", "", map[string]string{"Authorization": "Bearer read-tok"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("bearer read: status=%d", resp.StatusCode)
+	}
+	if resp := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-auth", "", map[string]string{"X-API-Key": "read-tok"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("api key read: status=%d", resp.StatusCode)
+	}
+	if resp := doAuthRequest(t, "POST", ts.URL+"/pipelines/run-auth/cancel", "", map[string]string{"X-API-Key": "read-tok"}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("cancel without scope: status=%d", resp.StatusCode)
+	}
+	if resp := doAuthRequest(t, "POST", ts.URL+"/pipelines/run-auth/cancel", "", map[string]string{"X-API-Key": "ops-tok"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("cancel with scope: status=%d", resp.StatusCode)
+	}
+
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("audit line %q: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("want 3 audit records, got %d:\n%s", len(recs), audit.String())
+	}
+	last := recs[2]
+	if last["event"] != "request_rejected" || last["principal"] != "token:reader" || last["path"] != "/pipelines/run-auth/cancel" {
+		t.Fatalf("audit record=%v", last)
+	}
+	if strings.Contains(audit.String(), "read-tok") || strings.Contains(audit.String(), "nope") {
+		t.Fatalf("audit log leaked a token:\n%s", audit.String())
+	}
+}
+
+func TestAuth_SubmitPathsMustBeUnderAllowedDirs(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	for _, p := range []string{filepath.Join(allowed, "run.yaml"), filepath.Join(outside, "run.yaml")} {
+		if err := os.WriteFile(p, []byte("version: 1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "run.yaml"), filepath.Join(allowed, "link.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	realAllowed, _ := filepath.EvalSymlinks(allowed)
+	_, ts, audit := newAuthTestServer(t, &AuthConfig{
+		Tokens:      []TokenConfig{{Name: "ci", Token: "tok", Scopes: []Scope{ScopeSubmit}}},
+		AllowedDirs: []string{realAllowed},
+	})
+	hdr := map[string]string{"Authorization": "Bearer tok", "Content-Type": "application/json"}
+	submit := func(configPath string) int {
+		body, _ := json.Marshal(SubmitPipelineRequest{DotSource: "digraph G {}", ConfigPath: configPath})
+		return doAuthRequest(t, "POST", ts.URL+"/pipelines", string(body), hdr).StatusCode
+	}
+
+	if got := submit(filepath.Join(outside, "run.yaml")); got != http.StatusForbidden {
+		t.Fatalf("outside path: status=%d", got)
+	}
+	if got := submit(filepath.Join(allowed, "link.yaml")); got != http.StatusForbidden {
+		t.Fatalf("symlink escaping the allowlist: status=%d", got)
+	}
+	// Inside the allowlist the request gets as far as config validation.
+	if got := submit(filepath.Join(allowed, "run.yaml")); got != http.StatusBadRequest {
+		t.Fatalf("allowed path: status=%d", got)
+	}
+	if n := strings.Count(audit.String(), `"principal":"token:ci"`); n != 2 {
+		t.Fatalf("want 2 audited path rejections, got %d:\n%s", n, audit.String())
+	}
+}
+
+func TestAuth_GraphFileReferencesMustBeUnderAllowedDirs(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	allowed, _ := filepath.EvalSymlinks(t.TempDir())
+	outside, _ := filepath.EvalSymlinks(t.TempDir())
+	frag := "digraph f { start [shape=Mdiamond] exit [shape=Msquare] w [shape=parallelogram, tool_command=\"true\"] start -> w -> exit }"
+	for _, dir := range []string{allowed, outside} {
+		if err := os.WriteFile(filepath.Join(dir, "frag.dot"), []byte(frag), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte("secret"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfgPath := filepath.Join(allowed, "run.yaml")
+	cfg := fmt.Sprintf(`version: 1
+repo: {path: %q}
+cxdb: {binary_addr: "127.0.0.1:1", http_base_url: "http://127.0.0.1:1"}
+modeldb: {openrouter_model_info_path: %q}
+`, allowed, filepath.Join(allowed, "models.json"))
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, ts, audit := newAuthTestServer(t, &AuthConfig{
+		Tokens:      []TokenConfig{{Name: "ci", Token: "tok", Scopes: []Scope{ScopeSubmit}}},
+		AllowedDirs: []string{allowed},
+	})
+	hdr := map[string]string{"Authorization": "Bearer tok", "Content-Type": "application/json"}
+	submit := func(node string) int {
+		dot := "digraph G { start [shape=Mdiamond] exit [shape=Msquare] " + node + " start -> x -> exit }"
+		body, _ := json.Marshal(SubmitPipelineRequest{DotSource: dot, ConfigPath: cfgPath})
+		return doAuthRequest(t, "POST", ts.URL+"/pipelines", string(body), hdr).StatusCode
+	}
+
+	rejected := map[string]string{
+		"absolute include":    fmt.Sprintf(`x [type="include", src=%q]`, filepath.Join(outside, "frag.dot")),
+		"relative include":    fmt.Sprintf(`x [type="include", src=%q]`, filepath.Join("..", filepath.Base(outside), "frag.dot")),
+		"outside prompt_file": fmt.Sprintf(`x [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt_file=%q]`, filepath.Join(outside, "prompt.md")),
+	}
+	for name, node := range rejected {
+		if got := submit(node); got != http.StatusForbidden {
+			t.Fatalf("%s: status=%d want 403", name, got)
+		}
+	}
+	if n := strings.Count(audit.String(), "outside the allowed directories"); n != len(rejected) {
+		t.Fatalf("want %d audited rejections, got %d:\n%s", len(rejected), n, audit.String())
+	}
+	if got := submit(`x [type="include", src="frag.dot"]`); got != http.StatusAccepted {
+		t.Fatalf("include inside the allowlist: status=%d", got)
+	}
+}
+
+func TestAuth_ClientCertificateIdentity(t *testing.T) {
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kilroy-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	caPath := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	clientCert := func(cn string) tls.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	auth := &AuthConfig{
+		Clients: []ClientCertConfig{{CommonName: "builder", Scopes: []Scope{ScopeRead}}},
+		TLS:     TLSConfig{CertFile: "unused.pem", KeyFile: "unused.key", ClientCAFile: caPath},
+	}
+	if err := auth.normalize(dir); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	srv := New(Config{Addr: ":0", Auth: auth, AuditLog: &bytes.Buffer{}})
+	ts := httptest.NewUnstartedServer(srv.httpSrv.Handler)
+	ts.TLS = srv.httpSrv.TLSConfig
+	ts.StartTLS()
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown()
+	})
+	registerTestPipeline(t, srv, "run-mtls")
+
+	get := func(cn string) int {
+		// A fresh transport per identity so connections are not reused.
+		tr := ts.Client().Transport.(*http.Transport).Clone()
+		tr.TLSClientConfig.Certificates = []tls.Certificate{clientCert(cn)}
+		client := &http.Client{Transport: tr}
+		resp, err := client.Get(ts.URL + "/pipelines/run-mtls")
+		if err != nil {
+			t.Fatalf("GET as %s: %v", cn, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := get("builder"); got != http.StatusOK {
+		t.Fatalf("configured client: status=%d", got)
+	}
+	if got := get("stranger"); got != http.StatusUnauthorized {
+		t.Fatalf("unconfigured client: status=%d", got)
+	}
+}
+
+func TestAuth_GraphViewAcceptsQueryToken(t *testing.T) {
+	srv, ts, audit := newAuthTestServer(t, &AuthConfig{Tokens: []TokenConfig{
+		{Name: "viewer", Token: "view tok&1", Scopes: []Scope{ScopeRead}},
+		{Name: "ci", Token: "submit-tok", Scopes: []Scope{ScopeSubmit}},
+	}})
+	ps, b, _ := registerTestPipeline(t, srv, "run-view")
+	logsRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(logsRoot, "graph.dot"), []byte(graphTestDot), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ps.LogsRoot = logsRoot
+	b.Send(map[string]any{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:00Z", "node_id": "start", "attempt": 1})
+
+	tok := url.Values{accessTokenParam: {"view tok&1"}}.Encode()
+	if _, resp := getGraphPage(t, ts.URL+"/pipelines/run-view/graph"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("graph without credentials: status=%d", resp.StatusCode)
+	}
+	page, resp := getGraphPage(t, ts.URL+"/pipelines/run-view/graph?"+tok)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("graph with query token: status=%d body=%s", resp.StatusCode, page)
+	}
+	if want := `"events":"events?` + tok + `"`; !strings.Contains(page, want) {
+		t.Fatalf("page does not hand the token to its EventSource, want %s in:\n%s", want, page)
+	}
+	if resp.Header.Get("Referrer-Policy") != "no-referrer" {
+		t.Fatalf("Referrer-Policy=%q", resp.Header.Get("Referrer-Policy"))
+	}
+	if resp := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-view/events?"+tok, "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("events with query token: status=%d", resp.StatusCode)
+	}
+
+	// The query token is scoped like any other and only honored on these routes.
+	if _, resp := getGraphPage(t, ts.URL+"/pipelines/run-view/graph?access_token=submit-tok"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("graph with a token lacking read: status=%d", resp.StatusCode)
+	}
+	if resp := doAuthRequest(t, "GET", ts.URL+"/pipelines/run-view?"+tok, "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("query token on a non-view route: status=%d", resp.StatusCode)
+	}
+	if strings.Contains(audit.String(), "view tok") || strings.Contains(audit.String(), "submit-tok") {
+		t.Fatalf("audit log leaked a token:\n%s", audit.String())
+	}
+}
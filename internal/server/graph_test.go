@@ -0,0 +1,84 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const graphTestDot = `digraph g {
+	start [shape=Mdiamond]
+	impl [shape=box, prompt="work"]
+	exit [shape=Msquare]
+	start -> impl -> exit
+}`
+
+func getGraphPage(t *testing.T, url string) (string, *http.Response) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b), resp
+}
+
+func TestPipelineGraph_LiveRunFollowsEvents(t *testing.T) {
+	srv, base := newRehydratedTestServer(t, t.TempDir())
+	ps, b, _ := registerTestPipeline(t, srv, "live-1")
+	logsRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(logsRoot, "graph.dot"), []byte(graphTestDot), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ps.LogsRoot = logsRoot
+	b.Send(map[string]any{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:00Z", "node_id": "start", "attempt": 1})
+	b.Send(map[string]any{"event": "stage_attempt_end", "ts": "2026-01-01T00:00:01Z", "node_id": "start", "status": "success"})
+	b.Send(map[string]any{"event": "stage_attempt_start", "ts": "2026-01-01T00:00:01Z", "node_id": "impl", "attempt": 1})
+
+	page, resp := getGraphPage(t, base+"/pipelines/live-1/graph")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("status=%d content-type=%q body=%s", resp.StatusCode, resp.Header.Get("Content-Type"), page)
+	}
+	for _, want := range []string{
+		`<g class="node state-completed" data-node="start">`,
+		`<g class="node state-current" data-node="impl">`,
+		`<g class="node state-unvisited" data-node="exit">`,
+		`"events":"events"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("missing %q in:\n%s", want, page)
+		}
+	}
+}
+
+func TestPipelineGraph_PersistedRunIsStatic(t *testing.T) {
+	runsDir := t.TempDir()
+	dir := writePersistedRun(t, runsDir, "run-a", "g", "2026-03-01T10:00:00Z", nil, "success")
+	if err := os.WriteFile(filepath.Join(dir, "graph.dot"), []byte(graphTestDot), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	progress := `{"event":"stage_attempt_start","ts":"2026-03-01T10:00:00Z","node_id":"impl","attempt":1}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "progress.ndjson"), []byte(progress), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, base := newRehydratedTestServer(t, runsDir)
+
+	page, resp := getGraphPage(t, base+"/pipelines/run-a/graph")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d body=%s", resp.StatusCode, page)
+	}
+	if strings.Contains(page, "EventSource") || strings.Contains(page, `class="node state-current"`) {
+		t.Fatalf("finished run should render a static page:\n%s", page)
+	}
+	if !strings.Contains(page, `<g class="node state-completed" data-node="impl">`) {
+		t.Fatalf("impl should be drawn as visited:\n%s", page)
+	}
+
+	if _, resp := getGraphPage(t, base+"/pipelines/missing/graph"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing pipeline status=%d", resp.StatusCode)
+	}
+}
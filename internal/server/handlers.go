@@ -1,16 +1,19 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/render"
 )
 
 // validRunID matches ULIDs, UUIDs, and other safe identifiers.
@@ -44,8 +47,21 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.auth != nil {
+		for _, p := range []string{req.DotSourcePath, req.ConfigPath} {
+			if p == "" {
+				continue
+			}
+			if err := s.auth.checkPath(p); err != nil {
+				s.auth.reject(w, r, http.StatusForbidden, principalName(r.Context()), err.Error())
+				return
+			}
+		}
+	}
+
 	// Resolve DOT source.
 	var dotSource []byte
+	var graphPath string
 	if req.DotSource != "" {
 		dotSource = []byte(req.DotSource)
 	} else {
@@ -55,6 +71,10 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot read dot file: %v", err))
 			return
 		}
+		if graphPath, err = filepath.Abs(req.DotSourcePath); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot resolve dot file path: %v", err))
+			return
+		}
 	}
 
 	// Load config.
@@ -64,6 +84,30 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Include src and prompt_file paths come from the graph, so inline DOT
+	// could otherwise read any file. Expand the graph once up front to reject
+	// such requests; the run itself reads through the same check.
+	var readGraphFile func(string) ([]byte, error)
+	if s.auth != nil {
+		readGraphFile = s.auth.readFile
+		var denied error
+		_, _, _ = engine.PrepareWithOptions(dotSource, engine.PrepareOptions{
+			RepoPath:   cfg.Repo.Path,
+			SourcePath: graphPath,
+			ReadFile: func(path string) ([]byte, error) {
+				b, err := s.auth.readFile(path)
+				if errors.Is(err, errPathNotAllowed) && denied == nil {
+					denied = err
+				}
+				return b, err
+			},
+		})
+		if denied != nil {
+			s.auth.reject(w, r, http.StatusForbidden, principalName(r.Context()), denied.Error())
+			return
+		}
+	}
+
 	// Generate run ID if not provided.
 	runID := strings.TrimSpace(req.RunID)
 	if runID == "" {
@@ -80,20 +124,12 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create pipeline components.
-	broadcaster := NewBroadcaster()
-	interviewer := NewWebInterviewer(0) // default timeout
-	ctx, cancel := context.WithCancelCause(s.baseCtx)
-
-	ps := &PipelineState{
-		RunID:       runID,
-		Broadcaster: broadcaster,
-		Interviewer: interviewer,
-		Cancel:      cancel,
-		StartedAt:   time.Now().UTC(),
-	}
+	ps, ctx := s.newPipelineState(runID)
+	ps.Labels = req.Labels
+	broadcaster, interviewer := ps.Broadcaster, ps.Interviewer
 
 	if err := s.registry.Register(runID, ps); err != nil {
-		cancel(nil)
+		ps.Cancel(nil)
 		writeError(w, http.StatusConflict, err.Error())
 		return
 	}
@@ -103,9 +139,13 @@ func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
 		defer broadcaster.Close()
 
 		overrides := engine.RunOptions{
+			GraphPath:     graphPath,
+			ReadGraphFile: readGraphFile,
 			RunID:         runID,
 			AllowTestShim: req.AllowTestShim,
 			ForceModels:   req.ForceModels,
+			Params:        req.Params,
+			Labels:        req.Labels,
 			ProgressSink:  broadcaster.Send,
 			Interviewer:   interviewer,
 			OnEngineReady: func(e *engine.Engine) {
@@ -157,6 +197,59 @@ func (s *Server) handlePipelineEvents(w http.ResponseWriter, r *http.Request) {
 	WriteSSE(w, r, ps.Broadcaster)
 }
 
+// handlePipelineGraph serves the graph colored by the run's progress. While
+// the run is live the page follows the events endpoint next to it.
+func (s *Server) handlePipelineGraph(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("id")
+	if runID == "" {
+		writeError(w, http.StatusBadRequest, "run_id is required")
+		return
+	}
+
+	ps, ok := s.registry.Get(runID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s not found", runID))
+		return
+	}
+
+	g, err := ps.Graph()
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	status := ps.Status()
+	var overlay *render.Overlay
+	if status.LogsRoot != "" {
+		overlay, _ = render.LoadOverlay(status.LogsRoot)
+	}
+	if (overlay == nil || len(overlay.Nodes) == 0) && ps.Broadcaster != nil {
+		overlay = render.OverlayFromEvents(ps.Broadcaster.History())
+	}
+	if overlay == nil {
+		overlay = render.NewOverlay()
+	}
+	overlay.Finished = status.State != "running"
+
+	opts := render.Options{Overlay: overlay}
+	if ps.Running() {
+		opts.EventsURL = "events"
+		// A page opened with ?access_token= hands the same token to its
+		// EventSource, which cannot send headers either.
+		if tok := r.URL.Query().Get(accessTokenParam); tok != "" && s.auth != nil {
+			opts.EventsURL += "?" + url.Values{accessTokenParam: {tok}}.Encode()
+		}
+	}
+	page, err := render.Render(g, "html", opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(page))
+}
+
 func (s *Server) handleCancelPipeline(w http.ResponseWriter, r *http.Request) {
 	runID := r.PathValue("id")
 	if runID == "" {
@@ -170,6 +263,10 @@ func (s *Server) handleCancelPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !ps.Running() {
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s is not running in this server", runID))
+		return
+	}
 	ps.Cancel(fmt.Errorf("canceled via HTTP API"))
 	ps.Interviewer.Cancel()
 	writeJSON(w, http.StatusOK, map[string]string{"status": "canceling"})
@@ -232,6 +329,17 @@ func (s *Server) handleAnswerQuestion(w http.ResponseWriter, r *http.Request) {
 		Values: req.Values,
 		Text:   req.Text,
 	}
+	if len(req.JSON) > 0 {
+		ans.Text = string(req.JSON)
+	}
+	// Reject answers a typed gate would refuse so the client gets the error
+	// now instead of the question being asked again.
+	if q, ok := ps.Interviewer.Question(qid); ok {
+		if _, err := engine.ValidateHumanAnswer(q, ans); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	if !ps.Interviewer.Answer(qid, ans) {
 		writeError(w, http.StatusNotFound, "question not found or already answered")
@@ -241,6 +349,43 @@ func (s *Server) handleAnswerQuestion(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "answered"})
 }
 
+// handleHumanWebhook receives answers from a chat relay for runs using the
+// webhook interviewer. It is authenticated by the webhook signature rather
+// than by API token, since chat platforms cannot present one.
+func (s *Server) handleHumanWebhook(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("id")
+	ps, ok := s.registry.Get(runID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s not found", runID))
+		return
+	}
+	hook, ok := ps.WebhookInterviewer()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s does not use the webhook interviewer", runID))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+		return
+	}
+	err = hook.Deliver(body, r.Header.Get(engine.WebhookTimestampHeader), r.Header.Get(engine.WebhookSignatureHeader))
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "answered"})
+	case errors.Is(err, engine.ErrWebhookSignature):
+		if s.auth != nil {
+			s.auth.reject(w, r, http.StatusUnauthorized, "", err.Error())
+			return
+		}
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, engine.ErrWebhookUnknownQuestion):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
 // --- Helpers ---
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/procutil"
+)
+
+// persistedRun is the terminal or last-known state of a run read back from
+// its logs root.
+type persistedRun struct {
+	State         string
+	FailureReason string
+	FinalCommit   string
+	RunBranch     string
+}
+
+// persistedStateInterrupted marks a run with no final.json whose process is
+// gone, typically because the server or CLI exited mid-run.
+const persistedStateInterrupted = "interrupted"
+
+// loadPersistedRun reads manifest.json and final.json from a logs root.
+func loadPersistedRun(logsRoot string) (*PipelineState, error) {
+	raw, err := os.ReadFile(filepath.Join(logsRoot, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var m struct {
+		RunID     string            `json:"run_id"`
+		GraphName string            `json:"graph_name"`
+		Goal      string            `json:"goal"`
+		RunBranch string            `json:"run_branch"`
+		StartedAt string            `json:"started_at"`
+		Labels    map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(logsRoot, "manifest.json"), err)
+	}
+	if !validRunID.MatchString(m.RunID) {
+		return nil, fmt.Errorf("%s: invalid run_id %q", logsRoot, m.RunID)
+	}
+	startedAt, err := time.Parse(time.RFC3339Nano, m.StartedAt)
+	if err != nil {
+		if info, statErr := os.Stat(logsRoot); statErr == nil {
+			startedAt = info.ModTime().UTC()
+		}
+	}
+
+	p := &persistedRun{State: persistedStateInterrupted, RunBranch: m.RunBranch}
+	if b, err := os.ReadFile(filepath.Join(logsRoot, "final.json")); err == nil {
+		var f struct {
+			Status        string `json:"status"`
+			FailureReason string `json:"failure_reason"`
+			FinalCommit   string `json:"final_git_commit_sha"`
+		}
+		if json.Unmarshal(b, &f) == nil && f.Status != "" {
+			p.State = f.Status
+			p.FailureReason = f.FailureReason
+			p.FinalCommit = f.FinalCommit
+		}
+	} else if pidRunning(filepath.Join(logsRoot, "run.pid")) {
+		// Owned by another process (e.g. a detached CLI run).
+		p.State = "running"
+	}
+
+	b := NewBroadcaster()
+	b.Close()
+	return &PipelineState{
+		RunID:       m.RunID,
+		Broadcaster: b,
+		Interviewer: NewWebInterviewer(0),
+		StartedAt:   startedAt,
+		LogsRoot:    logsRoot,
+		GraphName:   m.GraphName,
+		Goal:        m.Goal,
+		Labels:      m.Labels,
+		persisted:   p,
+	}, nil
+}
+
+func pidRunning(path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	return procutil.PIDAlive(pid) && !procutil.PIDZombie(pid)
+}
+
+// rehydrate registers every run found under runsDir. Unreadable entries are
+// logged and skipped so one corrupt logs root cannot block startup.
+func (s *Server) rehydrate(runsDir string) {
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Printf("rehydrate %s: %v", runsDir, err)
+		}
+		return
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		ps, err := loadPersistedRun(filepath.Join(runsDir, e.Name()))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				s.logger.Printf("rehydrate: skipping %s: %v", e.Name(), err)
+			}
+			continue
+		}
+		if err := s.registry.Register(ps.RunID, ps); err != nil {
+			s.logger.Printf("rehydrate: skipping %s: %v", e.Name(), err)
+			continue
+		}
+		n++
+	}
+	s.logger.Printf("rehydrated %d run(s) from %s", n, runsDir)
+}
+
+// pipelineFilter selects runs for GET /pipelines.
+type pipelineFilter struct {
+	states []string
+	labels map[string]string
+	graph  string
+	since  time.Time
+	until  time.Time
+	limit  int
+}
+
+func parsePipelineFilter(r *http.Request) (pipelineFilter, error) {
+	q := r.URL.Query()
+	f := pipelineFilter{labels: map[string]string{}}
+	for _, v := range q["state"] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				f.states = append(f.states, s)
+			}
+		}
+	}
+	for _, v := range q["label"] {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return f, fmt.Errorf("label filter %q must be key=value", v)
+		}
+		f.labels[strings.TrimSpace(k)] = val
+	}
+	f.graph = strings.TrimSpace(q.Get("graph"))
+	var err error
+	if f.since, err = parseFilterTime("since", q.Get("since")); err != nil {
+		return f, err
+	}
+	if f.until, err = parseFilterTime("until", q.Get("until")); err != nil {
+		return f, err
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.limit, err = strconv.Atoi(v); err != nil || f.limit < 0 {
+			return f, fmt.Errorf("limit must be a non-negative integer")
+		}
+	}
+	return f, nil
+}
+
+// parseFilterTime accepts RFC 3339 timestamps or YYYY-MM-DD dates (UTC).
+func parseFilterTime(name, v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be RFC 3339 or YYYY-MM-DD, got %q", name, v)
+}
+
+func (f pipelineFilter) match(st PipelineStatus) bool {
+	if len(f.states) > 0 {
+		ok := false
+		for _, s := range f.states {
+			if strings.EqualFold(s, st.State) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for k, v := range f.labels {
+		if got, ok := st.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	if f.graph != "" && !strings.Contains(st.GraphName, f.graph) {
+		return false
+	}
+	if !f.since.IsZero() && st.StartedAt.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !st.StartedAt.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleListPipelines(w http.ResponseWriter, r *http.Request) {
+	f, err := parsePipelineFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	out := PipelineList{Pipelines: []PipelineStatus{}}
+	for _, ps := range s.registry.All() {
+		if st := ps.Status(); f.match(st) {
+			out.Pipelines = append(out.Pipelines, st)
+		}
+	}
+	sort.Slice(out.Pipelines, func(i, j int) bool {
+		a, b := out.Pipelines[i], out.Pipelines[j]
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.After(b.StartedAt)
+		}
+		return a.RunID > b.RunID
+	})
+	if f.limit > 0 && len(out.Pipelines) > f.limit {
+		out.Pipelines = out.Pipelines[:f.limit]
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleResumePipeline continues a finished, failed or interrupted run from
+// its last checkpoint using the same logic as `attractor resume`.
+func (s *Server) handleResumePipeline(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("id")
+	prev, ok := s.registry.Get(runID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s not found", runID))
+		return
+	}
+	st := prev.Status()
+	if prev.Running() || st.State == "running" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s is still running", runID))
+		return
+	}
+	if st.LogsRoot == "" {
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s has no logs root", runID))
+		return
+	}
+	if _, err := os.Stat(filepath.Join(st.LogsRoot, "checkpoint.json")); err != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s has no checkpoint to resume from", runID))
+		return
+	}
+
+	ps, ctx := s.newPipelineState(runID)
+	ps.StartedAt = prev.StartedAt
+	ps.LogsRoot = st.LogsRoot
+	ps.GraphName, ps.Goal, ps.Labels = st.GraphName, st.Goal, st.Labels
+	if !s.registry.Swap(runID, prev, ps) {
+		ps.Cancel(nil)
+		writeError(w, http.StatusConflict, fmt.Sprintf("pipeline %s was resumed concurrently", runID))
+		return
+	}
+
+	go func() {
+		defer ps.Broadcaster.Close()
+		res, err := engine.ResumeWithOverrides(ctx, st.LogsRoot, engine.ResumeOverrides{
+			ProgressSink: ps.Broadcaster.Send,
+			Interviewer:  ps.Interviewer,
+			OnEngineReady: func(e *engine.Engine) {
+				ps.SetEngine(e)
+			},
+		})
+		ps.SetResult(res, err)
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"run_id": runID,
+		"status": "resuming",
+	})
+}
+
+// newPipelineState creates the live state for a run started by this server.
+func (s *Server) newPipelineState(runID string) (*PipelineState, context.Context) {
+	ctx, cancel := context.WithCancelCause(s.baseCtx)
+	return &PipelineState{
+		RunID:       runID,
+		Broadcaster: NewBroadcaster(),
+		Interviewer: NewWebInterviewer(0), // default timeout
+		Cancel:      cancel,
+		StartedAt:   time.Now().UTC(),
+	}, ctx
+}
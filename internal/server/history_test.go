@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/runtime"
+)
+
+func writePersistedRun(t *testing.T, runsDir, runID, graph, started string, labels map[string]string, final string) string {
+	t.Helper()
+	dir := filepath.Join(runsDir, runID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := json.Marshal(map[string]any{
+		"run_id":     runID,
+		"graph_name": graph,
+		"started_at": started,
+		"labels":     labels,
+		"run_branch": "attractor/run/" + runID,
+	})
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), m, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if final != "" {
+		f, _ := json.Marshal(map[string]any{"status": final, "run_id": runID, "failure_reason": "boom"})
+		if err := os.WriteFile(filepath.Join(dir, "final.json"), f, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func newRehydratedTestServer(t *testing.T, runsDir string) (*Server, string) {
+	t.Helper()
+	srv := New(Config{Addr: ":0", RunsDir: runsDir})
+	ts := httptest.NewServer(srv.httpSrv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown()
+	})
+	return srv, ts.URL
+}
+
+func listPipelines(t *testing.T, url string) ([]PipelineStatus, int) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var out PipelineList
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return out.Pipelines, resp.StatusCode
+}
+
+func runIDs(list []PipelineStatus) []string {
+	ids := make([]string, 0, len(list))
+	for _, p := range list {
+		ids = append(ids, p.RunID)
+	}
+	return ids
+}
+
+func TestHistory_RehydratesAndFiltersPipelines(t *testing.T) {
+	runsDir := t.TempDir()
+	writePersistedRun(t, runsDir, "run-a", "build_app", "2026-03-01T10:00:00Z", map[string]string{"team": "web"}, "success")
+	writePersistedRun(t, runsDir, "run-b", "review_loop", "2026-03-05T10:00:00Z", map[string]string{"team": "infra"}, "fail")
+	writePersistedRun(t, runsDir, "run-c", "build_app", "2026-03-09T10:00:00Z", nil, "")
+	if err := os.MkdirAll(filepath.Join(runsDir, "no-manifest"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, base := newRehydratedTestServer(t, runsDir)
+	registerTestPipeline(t, srv, "live-1")
+
+	all, code := listPipelines(t, base+"/pipelines")
+	if code != http.StatusOK || len(all) != 4 {
+		t.Fatalf("status=%d pipelines=%v", code, runIDs(all))
+	}
+	if all[0].RunID != "live-1" || all[1].RunID != "run-c" || all[3].RunID != "run-a" {
+		t.Fatalf("want newest first, got %v", runIDs(all))
+	}
+	byID := map[string]PipelineStatus{}
+	for _, p := range all {
+		byID[p.RunID] = p
+	}
+	if p := byID["run-b"]; p.State != "fail" || p.FailureReason != "boom" || !p.Persisted {
+		t.Fatalf("run-b=%+v", p)
+	}
+	if p := byID["run-c"]; p.State != persistedStateInterrupted {
+		t.Fatalf("run-c state=%q", p.State)
+	}
+
+	cases := map[string][]string{
+		"/pipelines?graph=build":                           {"run-c", "run-a"},
+		"/pipelines?label=team=web":                        {"run-a"},
+		"/pipelines?state=fail,interrupted":                {"run-c", "run-b"},
+		"/pipelines?since=2026-03-02&until=2026-03-09":     {"run-b"},
+		"/pipelines?graph=build&limit=1":                   {"run-c"},
+		"/pipelines?since=2026-03-05T10:00:00Z&state=fail": {"run-b"},
+	}
+	for q, want := range cases {
+		got, code := listPipelines(t, base+q)
+		if code != http.StatusOK || len(got) != len(want) {
+			t.Fatalf("%s: status=%d got %v want %v", q, code, runIDs(got), want)
+		}
+		for i := range want {
+			if got[i].RunID != want[i] {
+				t.Fatalf("%s: got %v want %v", q, runIDs(got), want)
+			}
+		}
+	}
+	for _, q := range []string{"/pipelines?label=team", "/pipelines?since=yesterday", "/pipelines?limit=-1"} {
+		if _, code := listPipelines(t, base+q); code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d want 400", q, code)
+		}
+	}
+}
+
+func TestHistory_ResumeRejectsRunningAndUncheckpointedRuns(t *testing.T) {
+	runsDir := t.TempDir()
+	writePersistedRun(t, runsDir, "no-checkpoint", "g", "2026-03-01T10:00:00Z", nil, "fail")
+	srv, base := newRehydratedTestServer(t, runsDir)
+	registerTestPipeline(t, srv, "live-1")
+
+	for path, want := range map[string]int{
+		"/pipelines/missing/resume":       http.StatusNotFound,
+		"/pipelines/live-1/resume":        http.StatusConflict,
+		"/pipelines/no-checkpoint/resume": http.StatusConflict,
+		"/pipelines/no-checkpoint/cancel": http.StatusConflict,
+	} {
+		resp, err := http.Post(base+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("POST %s: status=%d want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestHistory_ResumeContinuesPersistedRun(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init"},
+		{"config", "user.name", "tester"},
+		{"config", "user.email", "tester@example.com"},
+		{"commit", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	dot := []byte(`digraph resumable {
+  graph [goal="resume over http"]
+  start [shape=Mdiamond]
+  a [shape=box, llm_provider=openai, llm_model=gpt-5.2, prompt="a"]
+  exit [shape=Msquare]
+  start -> a -> exit
+}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := engine.Run(ctx, dot, engine.RunOptions{RepoPath: repo, RunID: "resume-http-1"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	cpPath := filepath.Join(res.LogsRoot, "checkpoint.json")
+	cp, err := runtime.LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	cp.CurrentNode = "start"
+	cp.CompletedNodes = []string{"start"}
+	if err := cp.Save(cpPath); err != nil {
+		t.Fatalf("Save checkpoint: %v", err)
+	}
+	final := runtime.FinalOutcome{Status: runtime.FinalFail, RunID: res.RunID, FailureReason: "interrupted for test"}
+	if err := final.Save(filepath.Join(res.LogsRoot, "final.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, base := newRehydratedTestServer(t, engine.DefaultRunsBaseDir())
+	resp, err := http.Post(base+"/pipelines/resume-http-1/resume", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST resume: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("resume status=%d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		r, err := http.Get(base + "/pipelines/resume-http-1")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		var st PipelineStatus
+		_ = json.NewDecoder(r.Body).Decode(&st)
+		r.Body.Close()
+		if st.State == "success" {
+			if st.Persisted || st.GraphName != "resumable" {
+				t.Fatalf("resumed status=%+v", st)
+			}
+			break
+		}
+		if st.State != "running" || time.Now().After(deadline) {
+			t.Fatalf("resume did not succeed: %+v", st)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
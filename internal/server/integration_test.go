@@ -351,6 +351,61 @@ func TestIntegration_QuestionsAndAnswers(t *testing.T) {
 	}
 }
 
+func TestIntegration_StructuredAnswerValidatedBeforeDelivery(t *testing.T) {
+	srv, ts := newTestServer(t)
+	runID := "test-qa-schema"
+	_, _, interviewer := registerTestPipeline(t, srv, runID)
+
+	answerCh := make(chan engine.Answer, 1)
+	go func() {
+		answerCh <- interviewer.Ask(engine.Question{
+			Type:  engine.QuestionFreeText,
+			Text:  "Which database?",
+			Stage: "ask",
+			Metadata: map[string]any{
+				"input_key": "db",
+				"schema":    map[string]any{"type": "object", "required": []any{"engine"}},
+			},
+		})
+	}()
+	pending := waitForPending(t, interviewer, 1)
+	resp, err := http.Get(ts.URL + "/pipelines/" + runID + "/questions")
+	if err != nil {
+		t.Fatalf("GET questions: %v", err)
+	}
+	var listed []PendingQuestion
+	json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if len(listed) != 1 || listed[0].InputKey != "db" || listed[0].Schema["type"] != "object" {
+		t.Fatalf("pending=%+v", listed)
+	}
+
+	post := func(body string) int {
+		t.Helper()
+		url := fmt.Sprintf("%s/pipelines/%s/questions/%s/answer", ts.URL, runID, pending[0].QuestionID)
+		r, err := http.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST answer: %v", err)
+		}
+		r.Body.Close()
+		return r.StatusCode
+	}
+	if code := post(`{"json":{"name":"pg"}}`); code != http.StatusBadRequest {
+		t.Fatalf("schema mismatch: status=%d want 400", code)
+	}
+	if code := post(`{"json":{"engine":"postgres"}}`); code != http.StatusOK {
+		t.Fatalf("valid answer: status=%d want 200", code)
+	}
+	select {
+	case ans := <-answerCh:
+		if ans.Text != `{"engine":"postgres"}` {
+			t.Fatalf("answer text=%q", ans.Text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for answer delivery")
+	}
+}
+
 func TestIntegration_ContextEndpoint(t *testing.T) {
 	srv, ts := newTestServer(t)
 	runID := "test-ctx-001"
@@ -575,3 +630,57 @@ func TestIntegration_FailedPipelineStatus(t *testing.T) {
 		t.Errorf("expected failure reason, got %q", status.FailureReason)
 	}
 }
+
+func TestIntegration_HumanWebhookCallback(t *testing.T) {
+	srv, ts := newTestServer(t)
+	runID := "test-hook"
+	ps, _, _ := registerTestPipeline(t, srv, runID)
+
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer chat.Close()
+	hook := &engine.WebhookInterviewer{URL: chat.URL, Secret: "s3cret", RunID: runID}
+	ps.SetEngine(&engine.Engine{Interviewer: hook})
+
+	answerCh := make(chan engine.Answer, 1)
+	go func() {
+		answerCh <- hook.Ask(engine.Question{Type: engine.QuestionFreeText, Text: "Notes?", Stage: "ask"})
+	}()
+
+	post := func(body, secret string) int {
+		t.Helper()
+		now := time.Now().Unix()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/pipelines/"+runID+"/hooks/human", strings.NewReader(body))
+		req.Header.Set(engine.WebhookTimestampHeader, fmt.Sprint(now))
+		req.Header.Set(engine.WebhookSignatureHeader, engine.SignWebhookBody(secret, now, []byte(body)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST hook: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	body := `{"question_id":"test-hook-q1","text":"use postgres"}`
+	if code := post(body, "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("bad signature: status=%d want 401", code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	code := post(body, "s3cret")
+	for code == http.StatusNotFound && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond) // question not posted yet
+		code = post(body, "s3cret")
+	}
+	if code != http.StatusOK {
+		t.Fatalf("signed answer: status=%d want 200", code)
+	}
+	select {
+	case ans := <-answerCh:
+		if ans.Text != "use postgres" {
+			t.Fatalf("answer=%+v", ans)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for answer delivery")
+	}
+	if code := post(body, "s3cret"); code != http.StatusNotFound {
+		t.Fatalf("answer for answered question: status=%d want 404", code)
+	}
+}
@@ -88,13 +88,19 @@ func (wi *WebInterviewer) Pending() []PendingQuestion {
 		for i, o := range pq.Question.Options {
 			opts[i] = QuestionOption{Key: o.Key, Label: o.Label, To: o.To}
 		}
+		schema, _ := pq.Question.Metadata["schema"].(map[string]any)
+		inputKey, _ := pq.Question.Metadata["input_key"].(string)
+		validationErr, _ := pq.Question.Metadata["validation_error"].(string)
 		out = append(out, PendingQuestion{
-			QuestionID: pq.ID,
-			Type:       string(pq.Question.Type),
-			Text:       pq.Question.Text,
-			Stage:      pq.Question.Stage,
-			Options:    opts,
-			AskedAt:    pq.AskedAt,
+			QuestionID:      pq.ID,
+			Type:            string(pq.Question.Type),
+			Text:            pq.Question.Text,
+			Stage:           pq.Question.Stage,
+			Options:         opts,
+			Schema:          schema,
+			InputKey:        inputKey,
+			ValidationError: validationErr,
+			AskedAt:         pq.AskedAt,
 		})
 	}
 	return out
@@ -126,6 +132,17 @@ func (wi *WebInterviewer) Cancel() {
 	}
 }
 
+// Question returns the pending question with the given ID.
+func (wi *WebInterviewer) Question(qid string) (engine.Question, bool) {
+	wi.mu.Lock()
+	defer wi.mu.Unlock()
+	pq, ok := wi.pending[qid]
+	if !ok {
+		return engine.Question{}, false
+	}
+	return pq.Question, true
+}
+
 // Answer delivers an answer to a pending question by ID. Returns false if qid
 // doesn't match any pending question or is already answered.
 func (wi *WebInterviewer) Answer(qid string, ans engine.Answer) bool {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/danshapiro/kilroy/internal/attractor/engine"
+	"github.com/danshapiro/kilroy/internal/attractor/model"
 	"github.com/danshapiro/kilroy/internal/attractor/runtime"
 )
 
@@ -18,19 +19,45 @@ type PipelineState struct {
 	Cancel      context.CancelCauseFunc
 	StartedAt   time.Time
 	LogsRoot    string
+	GraphName   string
+	Goal        string
+	Labels      map[string]string
 
 	mu     sync.Mutex
 	eng    *engine.Engine
 	result *engine.Result
 	err    error
 	done   bool
+
+	// persisted is set for runs loaded from disk rather than started by
+	// this server process.
+	persisted *persistedRun
 }
 
-// SetEngine stores a reference to the live engine (for context inspection).
+// SetEngine stores a reference to the live engine (for context inspection)
+// and records the run metadata it resolved.
 func (ps *PipelineState) SetEngine(e *engine.Engine) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 	ps.eng = e
+	if e == nil {
+		return
+	}
+	ps.LogsRoot = e.LogsRoot
+	if e.Graph != nil {
+		ps.GraphName = e.Graph.Name
+		ps.Goal = e.Graph.Attrs["goal"]
+	}
+	if len(e.Options.Labels) > 0 {
+		ps.Labels = e.Options.Labels
+	}
+}
+
+// Running reports whether the pipeline is executing in this process.
+func (ps *PipelineState) Running() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return !ps.done && ps.persisted == nil
 }
 
 // SetResult records the terminal outcome of the pipeline.
@@ -48,9 +75,21 @@ func (ps *PipelineState) Status() PipelineStatus {
 	defer ps.mu.Unlock()
 
 	status := PipelineStatus{
-		RunID:    ps.RunID,
-		State:    "running",
-		LogsRoot: ps.LogsRoot,
+		RunID:     ps.RunID,
+		State:     "running",
+		LogsRoot:  ps.LogsRoot,
+		GraphName: ps.GraphName,
+		Goal:      ps.Goal,
+		Labels:    ps.Labels,
+		StartedAt: ps.StartedAt,
+	}
+	if p := ps.persisted; p != nil {
+		status.State = p.State
+		status.FailureReason = p.FailureReason
+		status.FinalCommit = p.FinalCommit
+		status.RunBranch = p.RunBranch
+		status.Persisted = true
+		return status
 	}
 	if ps.done {
 		if ps.err != nil {
@@ -104,6 +143,39 @@ func (ps *PipelineState) ContextValues() map[string]any {
 	return eng.Context.SnapshotValues()
 }
 
+// WebhookInterviewer returns the engine's webhook interviewer when the run
+// config selected human.interviewer=webhook.
+func (ps *PipelineState) WebhookInterviewer() (*engine.WebhookInterviewer, bool) {
+	ps.mu.Lock()
+	eng := ps.eng
+	ps.mu.Unlock()
+	if eng == nil {
+		return nil, false
+	}
+	hook, ok := eng.Interviewer.(*engine.WebhookInterviewer)
+	return hook, ok
+}
+
+// Graph returns the pipeline graph: the live engine's when there is one,
+// otherwise the graph saved in the logs root (see engine.PrepareRunGraph).
+func (ps *PipelineState) Graph() (*model.Graph, error) {
+	ps.mu.Lock()
+	eng := ps.eng
+	logsRoot := ps.LogsRoot
+	ps.mu.Unlock()
+	if eng != nil && eng.Graph != nil {
+		return eng.Graph, nil
+	}
+	if logsRoot == "" {
+		return nil, fmt.Errorf("pipeline %s has no graph yet", ps.RunID)
+	}
+	g, _, err := engine.PrepareRunGraph(logsRoot, engine.PrepareOptions{})
+	if g == nil {
+		return nil, err
+	}
+	return g, nil
+}
+
 // PipelineRegistry tracks all pipelines managed by this server instance.
 type PipelineRegistry struct {
 	mu        sync.RWMutex
@@ -136,6 +208,30 @@ func (r *PipelineRegistry) Get(runID string) (*PipelineState, bool) {
 	return ps, ok
 }
 
+// Swap replaces the state registered for runID with next, but only if it is
+// still old. Resume uses it so two concurrent requests cannot both restart a
+// run.
+func (r *PipelineRegistry) Swap(runID string, old, next *PipelineState) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pipelines[runID] != old {
+		return false
+	}
+	r.pipelines[runID] = next
+	return true
+}
+
+// All returns every registered pipeline.
+func (r *PipelineRegistry) All() []*PipelineState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*PipelineState, 0, len(r.pipelines))
+	for _, ps := range r.pipelines {
+		out = append(out, ps)
+	}
+	return out
+}
+
 // List returns all pipeline IDs.
 func (r *PipelineRegistry) List() []string {
 	r.mu.RLock()
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -15,6 +16,17 @@ import (
 // Config holds server configuration.
 type Config struct {
 	Addr string // listen address, e.g. ":8080"
+
+	// Auth enables token/certificate authentication, scopes and the request
+	// path allowlist. Nil serves every request unauthenticated.
+	Auth *AuthConfig
+	// RunsDir is scanned on startup and every run found there (normally
+	// engine.DefaultRunsBaseDir()) is listed and can be resumed. Empty
+	// skips rehydration.
+	RunsDir string
+	// AuditLog receives a JSON line for every rejected request. Defaults to
+	// stderr.
+	AuditLog io.Writer
 }
 
 // Server is the HTTP server for managing Attractor pipelines.
@@ -25,6 +37,7 @@ type Server struct {
 	cancel   context.CancelFunc
 	httpSrv  *http.Server
 	logger   *log.Logger
+	auth     *authenticator
 }
 
 // New creates a new Server with the given config.
@@ -37,18 +50,33 @@ func New(cfg Config) *Server {
 		cancel:   cancel,
 		logger:   log.New(os.Stderr, "[kilroy-server] ", log.LstdFlags),
 	}
+	if cfg.Auth != nil {
+		audit := cfg.AuditLog
+		if audit == nil {
+			audit = os.Stderr
+		}
+		s.auth = newAuthenticator(cfg.Auth, audit)
+	}
+
+	if cfg.RunsDir != "" {
+		s.rehydrate(cfg.RunsDir)
+	}
 
 	mux := http.NewServeMux()
 
 	// Go 1.22+ method+pattern routing.
 	mux.HandleFunc("GET /health", s.handleHealth)
-	mux.HandleFunc("POST /pipelines", s.handleSubmitPipeline)
-	mux.HandleFunc("GET /pipelines/{id}", s.handleGetPipeline)
-	mux.HandleFunc("GET /pipelines/{id}/events", s.handlePipelineEvents)
-	mux.HandleFunc("POST /pipelines/{id}/cancel", s.handleCancelPipeline)
-	mux.HandleFunc("GET /pipelines/{id}/context", s.handleGetContext)
-	mux.HandleFunc("GET /pipelines/{id}/questions", s.handleGetQuestions)
-	mux.HandleFunc("POST /pipelines/{id}/questions/{qid}/answer", s.handleAnswerQuestion)
+	mux.HandleFunc("GET /pipelines", s.require(ScopeRead, s.handleListPipelines))
+	mux.HandleFunc("POST /pipelines", s.require(ScopeSubmit, s.handleSubmitPipeline))
+	mux.HandleFunc("POST /pipelines/{id}/resume", s.require(ScopeSubmit, s.handleResumePipeline))
+	mux.HandleFunc("GET /pipelines/{id}", s.require(ScopeRead, s.handleGetPipeline))
+	mux.HandleFunc("GET /pipelines/{id}/events", s.requireView(ScopeRead, s.handlePipelineEvents))
+	mux.HandleFunc("GET /pipelines/{id}/graph", s.requireView(ScopeRead, s.handlePipelineGraph))
+	mux.HandleFunc("POST /pipelines/{id}/cancel", s.require(ScopeCancel, s.handleCancelPipeline))
+	mux.HandleFunc("GET /pipelines/{id}/context", s.require(ScopeRead, s.handleGetContext))
+	mux.HandleFunc("GET /pipelines/{id}/questions", s.require(ScopeRead, s.handleGetQuestions))
+	mux.HandleFunc("POST /pipelines/{id}/questions/{qid}/answer", s.require(ScopeAnswer, s.handleAnswerQuestion))
+	mux.HandleFunc("POST /pipelines/{id}/hooks/human", s.handleHumanWebhook)
 
 	s.httpSrv = &http.Server{
 		Handler:      csrfProtect(mux, cfg.Addr),
@@ -56,6 +84,7 @@ func New(cfg Config) *Server {
 		WriteTimeout: 0, // SSE requires no write timeout
 		IdleTimeout:  120 * time.Second,
 		BaseContext:  func(net.Listener) context.Context { return ctx },
+		TLSConfig:    cfg.Auth.tlsConfig(),
 	}
 
 	return s
@@ -72,15 +101,36 @@ func (s *Server) ListenAndServe() error {
 		s.Shutdown()
 	}()
 
-	s.logger.Printf("listening on %s", s.config.Addr)
+	if s.auth == nil && !isLoopbackAddr(s.config.Addr) {
+		s.logger.Printf("WARNING: listening on %s without authentication; pass --auth-config before exposing the server", s.config.Addr)
+	}
 	s.httpSrv.Addr = s.config.Addr
-	err := s.httpSrv.ListenAndServe()
+	var err error
+	if s.httpSrv.TLSConfig != nil {
+		s.logger.Printf("listening on %s (TLS)", s.config.Addr)
+		err = s.httpSrv.ListenAndServeTLS(s.config.Auth.TLS.CertFile, s.config.Auth.TLS.KeyFile)
+	} else {
+		s.logger.Printf("listening on %s", s.config.Addr)
+		err = s.httpSrv.ListenAndServe()
+	}
 	if err == http.ErrServerClosed {
 		return nil
 	}
 	return err
 }
 
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // csrfProtect rejects cross-origin POST requests. Browsers automatically set
 // the Origin header on cross-origin requests, so checking it blocks CSRF from
 // malicious web pages while allowing CLI/programmatic callers (which either
@@ -1,6 +1,9 @@
 package server
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // SubmitPipelineRequest is the POST /pipelines request body.
 type SubmitPipelineRequest struct {
@@ -20,23 +23,45 @@ type SubmitPipelineRequest struct {
 	// ForceModels maps provider -> model for overrides.
 	ForceModels map[string]string `json:"force_models,omitempty"`
 
+	// Params supplies values for the graph's declared params.
+	Params map[string]string `json:"params,omitempty"`
+
+	// Labels are recorded in the run manifest and can be filtered on with
+	// GET /pipelines?label=key=value.
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// AllowTestShim enables test shim mode.
 	AllowTestShim bool `json:"allow_test_shim,omitempty"`
 }
 
-// PipelineStatus is returned by GET /pipelines/{id}.
+// PipelineStatus is returned by GET /pipelines/{id} and listed by
+// GET /pipelines.
 type PipelineStatus struct {
-	RunID         string     `json:"run_id"`
-	State         string     `json:"state"`
-	CurrentNodeID string     `json:"current_node_id,omitempty"`
-	LastEvent     string     `json:"last_event,omitempty"`
-	LastEventAt   *time.Time `json:"last_event_at,omitempty"`
-	FailureReason string     `json:"failure_reason,omitempty"`
-	LogsRoot      string     `json:"logs_root,omitempty"`
-	WorktreeDir   string     `json:"worktree_dir,omitempty"`
-	RunBranch     string     `json:"run_branch,omitempty"`
-	FinalCommit   string     `json:"final_commit,omitempty"`
-	CXDBUIURL     string     `json:"cxdb_ui_url,omitempty"`
+	RunID         string            `json:"run_id"`
+	State         string            `json:"state"`
+	GraphName     string            `json:"graph_name,omitempty"`
+	Goal          string            `json:"goal,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	StartedAt     time.Time         `json:"started_at"`
+	CurrentNodeID string            `json:"current_node_id,omitempty"`
+	LastEvent     string            `json:"last_event,omitempty"`
+	LastEventAt   *time.Time        `json:"last_event_at,omitempty"`
+	FailureReason string            `json:"failure_reason,omitempty"`
+	LogsRoot      string            `json:"logs_root,omitempty"`
+	WorktreeDir   string            `json:"worktree_dir,omitempty"`
+	RunBranch     string            `json:"run_branch,omitempty"`
+	FinalCommit   string            `json:"final_commit,omitempty"`
+	CXDBUIURL     string            `json:"cxdb_ui_url,omitempty"`
+
+	// Persisted marks runs loaded from their logs root rather than started
+	// by this server process. They can be continued with
+	// POST /pipelines/{id}/resume.
+	Persisted bool `json:"persisted,omitempty"`
+}
+
+// PipelineList is returned by GET /pipelines, newest first.
+type PipelineList struct {
+	Pipelines []PipelineStatus `json:"pipelines"`
 }
 
 // PendingQuestion is returned by GET /pipelines/{id}/questions.
@@ -46,7 +71,14 @@ type PendingQuestion struct {
 	Text       string           `json:"text"`
 	Stage      string           `json:"stage"`
 	Options    []QuestionOption `json:"options,omitempty"`
-	AskedAt    time.Time        `json:"asked_at"`
+	// Schema is the JSON Schema a structured FREE_TEXT answer must match.
+	Schema map[string]any `json:"schema,omitempty"`
+	// InputKey is the context key the answer is stored under.
+	InputKey string `json:"input_key,omitempty"`
+	// ValidationError explains why the previous answer to this gate was
+	// rejected, when it is being asked again.
+	ValidationError string    `json:"validation_error,omitempty"`
+	AskedAt         time.Time `json:"asked_at"`
 }
 
 // QuestionOption is a single option in a human gate question.
@@ -61,6 +93,9 @@ type AnswerRequest struct {
 	Value  string   `json:"value,omitempty"`
 	Values []string `json:"values,omitempty"`
 	Text   string   `json:"text,omitempty"`
+	// JSON carries a structured answer for questions with a schema. It is
+	// passed to the engine as the answer text.
+	JSON json.RawMessage `json:"json,omitempty"`
 }
 
 // ErrorResponse is a standard error envelope.